@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+
+	"github.com/adewidyatamadb/GoBookings/internal/dates"
+	"github.com/adewidyatamadb/GoBookings/internal/models"
+	"github.com/adewidyatamadb/GoBookings/internal/repository"
+)
+
+// seedDemoData adds a few reservations and an owner block around today so the demo has something to show
+func seedDemoData(repo repository.DatabaseRepo, today dates.Date) error {
+	ctx := context.Background()
+
+	reservations := []models.Reservation{
+		{FirstName: "John", LastName: "Smith", Email: "john@smith.com", Phone: "555-555-5555", StartDate: today.AddDays(-1), EndDate: today.AddDays(2), RoomID: 1},
+		{FirstName: "Jane", LastName: "Doe", Email: "jane@doe.com", Phone: "555-555-1234", StartDate: today.AddDays(3), EndDate: today.AddDays(6), RoomID: 2},
+		{FirstName: "Peter", LastName: "Parker", Email: "peter@parker.com", StartDate: today.AddDays(10), EndDate: today.AddDays(12), RoomID: 1},
+	}
+
+	for _, res := range reservations {
+		guestID, err := repo.FindOrCreateGuest(ctx, models.Guest{
+			FirstName: res.FirstName,
+			LastName:  res.LastName,
+			Email:     res.Email,
+			Phone:     res.Phone,
+		})
+		if err != nil {
+			return err
+		}
+		res.GuestID = guestID
+
+		id, err := repo.InsertReservation(ctx, res)
+		if err != nil {
+			return err
+		}
+
+		err = repo.InsertRoomRestriction(ctx, models.RoomRestriction{
+			StartDate:     res.StartDate,
+			EndDate:       res.EndDate,
+			RoomID:        res.RoomID,
+			ReservationID: id,
+			RestrictionID: 1,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return repo.InsertBlockForRoom(ctx, 2, today.AddDays(8))
+}
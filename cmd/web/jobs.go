@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/adewidyatamadb/GoBookings/internal/handlers"
+	"github.com/adewidyatamadb/GoBookings/internal/scheduler"
+	"github.com/adewidyatamadb/GoBookings/internal/webhooks"
+)
+
+// jobHistory is how long the runs of background jobs are kept
+const jobHistory = 30 * 24 * time.Hour
+
+// dailySpec returns the cron schedule of a job run every day at the time of day at, given as HH:MM by the flag
+// of that name
+func dailySpec(flagName, at string) (string, error) {
+	t, err := time.Parse("15:04", at)
+	if err != nil {
+		return "", fmt.Errorf("invalid -%s %q, use HH:MM", flagName, at)
+	}
+	return fmt.Sprintf("%d %d * * *", t.Minute(), t.Hour()), nil
+}
+
+// addJobs adds the background jobs of the application to s, expired sessions are only deleted when
+// sessions are kept in the database, the day sheet is only emailed when daySheetAt is set and the guest
+// emails are only sent when guestMailAt is set
+func addJobs(s *scheduler.Scheduler, repo *handlers.Repository, databaseSessions bool, daySheetAt, guestMailAt string) error {
+	// holds are released even with -verifybookings off, in case it was on before the restart
+	err := s.Add("release-expired-holds", "* * * * *", time.Minute, func(ctx context.Context) error {
+		n, err := repo.DB.ReleaseExpiredHolds(ctx, time.Now())
+		if n > 0 {
+			log.Printf("Released %d reservations that were not confirmed in time", n)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	err = s.Add("deliver-webhooks", "@every 15s", 2*time.Minute, func(ctx context.Context) error {
+		_, err := webhooks.NewSender(repo.DB, nil).DeliverDue(ctx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if databaseSessions {
+		err = s.Add("delete-expired-sessions", "@hourly", 5*time.Minute, func(ctx context.Context) error {
+			n, err := repo.DB.DeleteExpiredSessions(ctx)
+			if n > 0 {
+				log.Printf("Deleted %d expired sessions", n)
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if daySheetAt != "" {
+		spec, err := dailySpec("daysheetat", daySheetAt)
+		if err != nil {
+			return err
+		}
+
+		err = s.Add("day-sheet-mail", spec, time.Minute, func(ctx context.Context) error {
+			return repo.SendDaySheet(ctx, time.Now())
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if guestMailAt != "" {
+		spec, err := dailySpec("guestmailat", guestMailAt)
+		if err != nil {
+			return err
+		}
+
+		err = s.Add("guest-mail", spec, 5*time.Minute, func(ctx context.Context) error {
+			n, err := repo.SendGuestMails(ctx, time.Now())
+			if n > 0 {
+				log.Printf("Sent %d pre-arrival, check-out and post-stay emails", n)
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.Add("prune-job-history", "@daily", 5*time.Minute, func(ctx context.Context) error {
+		_, err := repo.DB.DeleteJobRunsBefore(ctx, time.Now().Add(-jobHistory))
+		return err
+	})
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/adewidyatamadb/GoBookings/internal/handlers"
+	"github.com/adewidyatamadb/GoBookings/internal/repository/dbrepo"
+	"github.com/adewidyatamadb/GoBookings/internal/scheduler"
+)
+
+func TestDailySpec(t *testing.T) {
+	var tableTest = []struct {
+		name          string
+		at            string
+		expected      string
+		expectedError bool
+	}{
+		{"evening", "18:30", "30 18 * * *", false},
+		{"midnight", "00:00", "0 0 * * *", false},
+		{"no minutes", "18", "", true},
+		{"out of range", "25:00", "", true},
+	}
+
+	for _, test := range tableTest {
+		spec, err := dailySpec("daysheetat", test.at)
+		if (err != nil) != test.expectedError {
+			t.Errorf("case - %s: expected error %t but got %v", test.name, test.expectedError, err)
+		}
+		if spec != test.expected {
+			t.Errorf("case - %s: expected %q but got %q", test.name, test.expected, spec)
+		}
+	}
+}
+
+func TestAddJobs(t *testing.T) {
+	repo := &handlers.Repository{App: &app, DB: dbrepo.NewMemoryRepo(&app)}
+
+	s := scheduler.New(repo.DB, "test")
+	if err := addJobs(s, repo, true, "18:30", "09:00"); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, job := range s.Jobs() {
+		names = append(names, job.Name)
+	}
+	expected := []string{"day-sheet-mail", "delete-expired-sessions", "deliver-webhooks", "guest-mail", "prune-job-history", "release-expired-holds"}
+	if len(names) != len(expected) {
+		t.Fatalf("expected jobs %v but got %v", expected, names)
+	}
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Errorf("expected jobs %v but got %v", expected, names)
+			break
+		}
+	}
+
+	s = scheduler.New(repo.DB, "test")
+	if err := addJobs(s, repo, false, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if jobs := s.Jobs(); len(jobs) != 3 {
+		t.Errorf("expected only the hold release, webhook and history jobs but got %+v", jobs)
+	}
+
+	if err := addJobs(scheduler.New(repo.DB, "test"), repo, false, "6pm", ""); err == nil {
+		t.Error("expected an error for an invalid day sheet time")
+	}
+	if err := addJobs(scheduler.New(repo.DB, "test"), repo, false, "", "9"); err == nil {
+		t.Error("expected an error for an invalid guest email time")
+	}
+}
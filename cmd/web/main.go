@@ -1,20 +1,33 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
 	"encoding/gob"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/adewidyatamadb/GoBookings/internal/config"
+	"github.com/adewidyatamadb/GoBookings/internal/dates"
 	"github.com/adewidyatamadb/GoBookings/internal/driver"
+	"github.com/adewidyatamadb/GoBookings/internal/events"
 	"github.com/adewidyatamadb/GoBookings/internal/handlers"
 	"github.com/adewidyatamadb/GoBookings/internal/helpers"
 	"github.com/adewidyatamadb/GoBookings/internal/models"
+	"github.com/adewidyatamadb/GoBookings/internal/ratelimit"
 	"github.com/adewidyatamadb/GoBookings/internal/render"
+	"github.com/adewidyatamadb/GoBookings/internal/scheduler"
+	"github.com/adewidyatamadb/GoBookings/internal/sessionstore"
+	"github.com/adewidyatamadb/GoBookings/internal/throttle"
+	"github.com/adewidyatamadb/GoBookings/internal/webhooks"
 	"github.com/alexedwards/scs/v2"
 )
 
@@ -26,13 +39,18 @@ var session *scs.SessionManager
 var infoLog *log.Logger
 var errorLog *log.Logger
 
+// stopScheduler stops the jobs started by run and waits for the running ones
+var stopScheduler = func() {}
+
 //main is the main application function
 func main() {
 	db, err := run()
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer db.SQL.Close()
+	if db != nil {
+		defer db.SQL.Close()
+	}
 	// http.HandleFunc("/", handlers.Repo.Home)
 	// http.HandleFunc("/about", handlers.Repo.About)
 
@@ -48,8 +66,28 @@ func main() {
 		Handler: routes(&app),
 	}
 
+	// an interrupt or a termination signal stops the server and then the jobs, while the database is still open
+	shutdown := make(chan error, 1)
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		shutdown <- srv.Shutdown(ctx)
+	}()
+
 	err = srv.ListenAndServe()
-	log.Fatal(err)
+	if !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+	if err = <-shutdown; err != nil {
+		errorLog.Println(err)
+	}
+
+	fmt.Println("Waiting for running jobs...")
+	stopScheduler()
 }
 
 func run() (*driver.DB, error) {
@@ -63,15 +101,37 @@ func run() (*driver.DB, error) {
 	// read flags
 	inProduction := flag.Bool("production", true, "Application is in production")
 	UseCache := flag.Bool("cache", true, "Use template cache")
+	demo := flag.Bool("demo", false, "Run with an in-memory database seeded with demo data")
+	dbDriver := flag.String("dbdriver", driver.Postgres, "Database driver (postgres, sqlite)")
+	dbPath := flag.String("dbpath", "bookings.db", "Database file, used by the sqlite driver")
 	dbHost := flag.String("dbhost", "localhost", "Database host")
 	dbName := flag.String("dbname", "", "Database name")
 	dbUser := flag.String("dbuser", "", "Database user")
 	dbPass := flag.String("dbpass", "", "Database password")
 	dbPort := flag.String("dbport", "5432", "Database port")
 	dbSSL := flag.String("dbssl", "disable", "Database ssl settings (disable, prefer, require)")
+	dbTimeout := flag.Duration("dbtimeout", 3*time.Second, "Timeout for a single database query")
+	baseURL := flag.String("baseurl", "http://localhost:8080", "Public URL of the site, used in links sent by email")
+	secret := flag.String("secret", "", "Secret key used to sign links sent by email")
+	sessionStore := flag.String("sessions", "database", "Session store (database, memory), memory sessions are lost on restart")
+	require2FA := flag.Int("require2fa", 0, "Access level from which staff must use two-factor authentication, 0 keeps it optional")
+	trustedProxies := flag.String("trustedproxies", "", "Comma separated IP addresses and CIDR ranges of proxies whose X-Forwarded-For header is trusted")
+	searchRate := flag.Int("searchrate", 30, "Availability searches allowed per client IP and minute, 0 disables the limit")
+	bookingRate := flag.Int("bookingrate", 5, "Reservations allowed per client IP and minute, 0 disables the limit")
+	verifyBookings := flag.Bool("verifybookings", false, "Hold reservations until the guest follows the link emailed to confirm the address")
+	holdTTL := flag.Duration("holdttl", 30*time.Minute, "How long a reservation is held for the guest to confirm the email address")
+	daySheetAt := flag.String("daysheetat", "", "Time of day (HH:MM) to email the owner the day sheet of the next day, empty disables the email")
+	guestMailAt := flag.String("guestmailat", "09:00", "Time of day (HH:MM) to send the pre-arrival, check-out and post-stay emails, empty disables them")
+	preArrivalDays := flag.Int("prearrivaldays", 3, "Days before arrival to email the arrival instructions, 0 disables them")
+	checkOutReminder := flag.Bool("checkoutreminder", true, "Email guests a check-out reminder on the day of departure")
+	postStayDays := flag.Int("poststaydays", 1, "Days after departure to email the thank you and review request, 0 disables it")
+	reviewURL := flag.String("reviewurl", "", "Page guests are asked to review their stay on, linked from the post-stay email")
+	timeZone := flag.String("timezone", "Local", "Time zone of the background jobs and of the properties without their own (an IANA name like Asia/Jakarta), which decides what day it is")
+	dateFormat := flag.String("dateformat", config.DefaultDateFormat, "Layout dates are shown with, written as the date 2 January 2006")
+	dateInput := flag.String("dateinput", config.DefaultDateInputFormat, "Layout dates are typed into forms with, written as the date 2 January 2006, ISO 8601 dates are accepted too")
 
 	flag.Parse()
-	if *dbName == "" || *dbUser == "" {
+	if !*demo && *dbDriver == driver.Postgres && (*dbName == "" || *dbUser == "") {
 		fmt.Println("Missing required flags")
 		os.Exit(1)
 	}
@@ -82,6 +142,50 @@ func run() (*driver.DB, error) {
 	// change this to true when in production
 	app.InProduction = *inProduction
 	app.UseCache = *UseCache
+	app.QueryTimeout = *dbTimeout
+	app.BaseURL = strings.TrimSuffix(*baseURL, "/")
+	app.Secret = []byte(*secret)
+	if *secret == "" {
+		// links signed with a random key stop working when the server restarts
+		log.Println("No -secret given, using a random key for signed links")
+		app.Secret = make([]byte, 32)
+		if _, err := rand.Read(app.Secret); err != nil {
+			return nil, err
+		}
+	}
+	app.TwoFactorLevel = *require2FA
+	app.LoginAccounts = throttle.New(handlers.AccountLoginPolicy)
+	app.LoginIPs = throttle.New(handlers.IPLoginPolicy)
+
+	proxies, err := helpers.ParseTrustedProxies(*trustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	app.TrustedProxies = proxies
+	if *searchRate > 0 {
+		app.SearchLimit = ratelimit.New(ratelimit.Policy{Rate: *searchRate, Per: time.Minute, Burst: *searchRate})
+	}
+	if *bookingRate > 0 {
+		app.BookingLimit = ratelimit.New(ratelimit.Policy{Rate: *bookingRate, Per: time.Minute, Burst: *bookingRate})
+	}
+
+	app.VerifyBookings = *verifyBookings
+	app.HoldTTL = *holdTTL
+	app.PreArrivalDays = *preArrivalDays
+	app.CheckOutReminder = *checkOutReminder
+	app.PostStayDays = *postStayDays
+	app.ReviewURL = *reviewURL
+
+	app.Location, err = time.LoadLocation(*timeZone)
+	if err != nil {
+		return nil, fmt.Errorf("-timezone: %w", err)
+	}
+	app.DatePickerFormat, err = dates.PickerFormat(*dateInput)
+	if err != nil {
+		return nil, fmt.Errorf("-dateinput: %w", err)
+	}
+	app.DateInputFormat = *dateInput
+	app.DateFormat = *dateFormat
 
 	infoLog = log.New(os.Stdout, "INFO:\t", log.Ldate|log.Ltime)
 	app.InfoLog = infoLog
@@ -97,16 +201,6 @@ func run() (*driver.DB, error) {
 
 	app.Session = session
 
-	// connect to database
-	log.Println("Connecting to the database...")
-	connectionString := fmt.Sprintf("host=%s port=%s dbname=%s user=%s password=%s sslmode=%s", *dbHost, *dbPort, *dbName, *dbUser, *dbPass, *dbSSL)
-	db, err := driver.ConnectSQL(connectionString)
-	if err != nil {
-		log.Fatal("cannot connect to the database! dying...")
-	}
-
-	log.Println("Connected to the database!")
-
 	tc, err := render.CreateTemplateCache()
 	if err != nil {
 		log.Fatal("cannot create template cache")
@@ -115,7 +209,65 @@ func run() (*driver.DB, error) {
 
 	app.TemplateCache = tc
 
-	repo := handlers.NewRepo(&app, db)
+	var db *driver.DB
+	var repo *handlers.Repository
+	if *demo {
+		log.Println("Running in demo mode with an in-memory database")
+		repo = handlers.NewDemoRepo(&app)
+		err = seedDemoData(repo.DB, app.Today())
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		// connect to database
+		log.Println("Connecting to the database...")
+		switch *dbDriver {
+		case driver.Postgres:
+			connectionString := fmt.Sprintf("host=%s port=%s dbname=%s user=%s password=%s sslmode=%s", *dbHost, *dbPort, *dbName, *dbUser, *dbPass, *dbSSL)
+			db, err = driver.ConnectSQL(connectionString)
+		case driver.SQLite:
+			db, err = driver.ConnectSQLite(*dbPath)
+		default:
+			return nil, fmt.Errorf("unknown database driver %q", *dbDriver)
+		}
+		if err != nil {
+			log.Fatal("cannot connect to the database! dying...")
+		}
+
+		log.Println("Connected to the database!")
+
+		repo = handlers.NewRepo(&app, db)
+	}
+
+	switch *sessionStore {
+	case "database":
+		store := sessionstore.New(repo.DB, session.Codec)
+		session.Store = store
+		app.PersistentSessions = true
+	case "memory":
+	default:
+		return nil, fmt.Errorf("unknown session store %q", *sessionStore)
+	}
+
+	// the side effects of reservations and blocks subscribe to the events the handlers publish
+	app.Events = events.New(errorLog)
+	app.EventCounter = events.NewCounter(time.Now())
+	app.Events.Subscribe("audit", events.AuditLog(infoLog))
+	app.Events.Subscribe("metrics", app.EventCounter.Handle)
+	app.Events.Subscribe("mail", repo.MailEvent)
+	app.Events.Subscribe("webhooks", webhooks.Subscriber(repo.DB))
+
+	app.Scheduler = scheduler.New(repo.DB, "")
+	err = app.Scheduler.SetLocation(app.Location)
+	if err != nil {
+		return nil, err
+	}
+	err = addJobs(app.Scheduler, repo, app.PersistentSessions, *daySheetAt, *guestMailAt)
+	if err != nil {
+		return nil, err
+	}
+	stopScheduler = app.Scheduler.Start()
+
 	handlers.NewHandlers(repo)
 	render.NewRenderer(&app)
 	helpers.NewHelpers(&app)
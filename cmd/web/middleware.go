@@ -1,9 +1,20 @@
 package main
 
 import (
+	"errors"
+	"math"
+	"net"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 
+	"github.com/adewidyatamadb/GoBookings/internal/handlers"
 	"github.com/adewidyatamadb/GoBookings/internal/helpers"
+	"github.com/adewidyatamadb/GoBookings/internal/models"
+	"github.com/adewidyatamadb/GoBookings/internal/ratelimit"
+	"github.com/adewidyatamadb/GoBookings/internal/repository"
+	"github.com/go-chi/chi/v5"
 	"github.com/justinas/nosurf"
 )
 
@@ -17,6 +28,10 @@ func NoSurf(next http.Handler) http.Handler {
 		Secure:   app.InProduction,
 		SameSite: http.SameSiteLaxMode,
 	})
+	// the public API takes JSON only, which forms on other sites cannot send
+	csrfHandler.ExemptFunc(func(r *http.Request) bool {
+		return strings.HasPrefix(r.URL.Path, "/api/")
+	})
 
 	return csrfHandler
 }
@@ -26,6 +41,95 @@ func SessionLoad(next http.Handler) http.Handler {
 	return session.LoadAndSave(next)
 }
 
+// PropertyPrefix takes the property slug off paths like /p/{slug}/search-availability, so the
+// public pages of a property can be reached on a shared host name, SelectProperty picks it up
+func PropertyPrefix(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rest, ok := strings.CutPrefix(r.URL.Path, "/p/")
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		slug, path, _ := strings.Cut(rest, "/")
+		if slug == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		r = helpers.WithPropertySlug(r, slug)
+		u := *r.URL
+		u.Path = "/" + path
+		u.RawPath = ""
+		r.URL = &u
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// SelectProperty finds the property a request is for, from the path prefix, the host name, the
+// property chosen earlier in the session, or else the first property, it has to run after SessionLoad
+func SelectProperty(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		properties, err := handlers.Repo.Properties(r.Context())
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		p, ok := selectProperty(r, properties)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if helpers.PropertySlug(r) != "" {
+			// links on the pages have no prefix, so the session keeps the property
+			session.Put(r.Context(), "property_id", p.ID)
+		}
+
+		next.ServeHTTP(w, helpers.WithProperty(r, p))
+	})
+}
+
+// selectProperty returns the property of properties the request r is for, false when the path
+// prefix names a property that does not exist
+func selectProperty(r *http.Request, properties []models.Property) (models.Property, bool) {
+	if slug := helpers.PropertySlug(r); slug != "" {
+		for _, p := range properties {
+			if p.Slug == slug {
+				return p, true
+			}
+		}
+		return models.Property{}, false
+	}
+
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	for _, p := range properties {
+		if p.Host != "" && strings.EqualFold(p.Host, host) {
+			return p, true
+		}
+	}
+
+	if id := session.GetInt(r.Context(), "property_id"); id > 0 {
+		for _, p := range properties {
+			if p.ID == id {
+				return p, true
+			}
+		}
+	}
+
+	if len(properties) > 0 {
+		return properties[0], true
+	}
+	return models.Property{}, true
+}
+
+// Auth lets logged in users with an active account and a current session through,
+// and sends users that have to choose a new password or set up two-factor
+// authentication to the matching page
 func Auth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if !helpers.IsAuthenticated(r) {
@@ -33,6 +137,183 @@ func Auth(next http.Handler) http.Handler {
 			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 			return
 		}
+
+		u, err := handlers.Repo.DB.GetUserByID(r.Context(), session.GetInt(r.Context(), "user_id"))
+		if errors.Is(err, repository.ErrNotFound) || (err == nil && !u.Active) {
+			_ = session.Destroy(r.Context())
+			_ = session.RenewToken(r.Context())
+			session.Put(r.Context(), "error", "Your account is no longer active")
+			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+			return
+		} else if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		// a password change logs the user out of every session started before it
+		if session.GetInt(r.Context(), "session_version") != u.SessionVersion {
+			_ = session.Destroy(r.Context())
+			_ = session.RenewToken(r.Context())
+			session.Put(r.Context(), "error", "Your password has changed, please log in again")
+			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+			return
+		}
+
+		if u.MustChangePassword && r.URL.Path != "/user/change-password" {
+			session.Put(r.Context(), "warning", "Please choose a new password")
+			http.Redirect(w, r, "/user/change-password", http.StatusSeeOther)
+			return
+		}
+
+		// staff whose access level requires two-factor authentication have to enable it first
+		if handlers.TwoFactorRequired(&app, u) && !u.TOTPEnabled && r.URL.Path != "/user/two-factor" {
+			session.Put(r.Context(), "warning", "Please set up two-factor authentication")
+			http.Redirect(w, r, "/user/two-factor", http.StatusSeeOther)
+			return
+		}
+
+		// keep the access level and properties in sync with changes made by an admin, only writing the
+		// session when they changed so page views do not save it again
+		if session.GetInt(r.Context(), "access_level") != u.AccessLevel {
+			session.Put(r.Context(), "access_level", u.AccessLevel)
+		}
+		if scoped := len(u.PropertyIDs) > 0; session.GetBool(r.Context(), "scoped") != scoped {
+			session.Put(r.Context(), "scoped", scoped)
+		}
 		next.ServeHTTP(w, r)
 	})
 }
+
+// Admin only lets users with the admin access level through, it has to run after Auth
+func Admin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if session.GetInt(r.Context(), "access_level") < models.AccessLevelAdmin {
+			session.Put(r.Context(), "error", "You are not allowed to manage staff users")
+			http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// EveryProperty only lets admins of every property through, the settings shared by all properties are theirs,
+// it has to run after Admin
+func EveryProperty(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if session.GetBool(r.Context(), "scoped") {
+			session.Put(r.Context(), "error", "Only admins of every property can change this")
+			http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RateLimit answers with 429 Too Many Requests once a client IP address has used up its requests
+// to a route, a nil limiter lets every request through
+func RateLimit(l *ratelimit.Limiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if l == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := r.URL.Path
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+				route = rctx.RoutePattern()
+			}
+
+			ok, retry := l.Allow(r.Method + " " + route + " " + helpers.ClientIP(r))
+			if !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+				http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// CSP holds the directives of a Content-Security-Policy
+type CSP struct {
+	// Directives maps a directive to its sources, e.g. "img-src" to "'self' data:"
+	Directives map[string]string
+}
+
+// header returns the policy with the nonce of the request added to script-src
+func (p CSP) header(nonce string) string {
+	names := make([]string, 0, len(p.Directives))
+	for name := range p.Directives {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	directives := make([]string, 0, len(names))
+	for _, name := range names {
+		directive := name + " " + p.Directives[name]
+		if name == "script-src" {
+			directive += " 'nonce-" + nonce + "'"
+		}
+		directives = append(directives, directive)
+	}
+	return strings.Join(directives, "; ")
+}
+
+// publicCSP is the Content-Security-Policy of the public site, inline scripts need the nonce of the request
+var publicCSP = CSP{
+	Directives: map[string]string{
+		"default-src":     "'self'",
+		"script-src":      "'self' https://cdn.jsdelivr.net https://unpkg.com",
+		"style-src":       "'self' 'unsafe-inline' https://cdn.jsdelivr.net https://unpkg.com",
+		"img-src":         "'self' data:",
+		"font-src":        "'self'",
+		"connect-src":     "'self'",
+		"object-src":      "'none'",
+		"base-uri":        "'self'",
+		"form-action":     "'self'",
+		"frame-ancestors": "'none'",
+	},
+}
+
+// adminCSP is the Content-Security-Policy of the admin area, the theme under static/admin
+// loads its fonts and icons from there
+var adminCSP = CSP{
+	Directives: map[string]string{
+		"default-src":     "'self'",
+		"script-src":      "'self' https://cdn.jsdelivr.net https://unpkg.com",
+		"style-src":       "'self' 'unsafe-inline' https://cdn.jsdelivr.net https://unpkg.com",
+		"img-src":         "'self' data:",
+		"font-src":        "'self' data:",
+		"connect-src":     "'self'",
+		"object-src":      "'none'",
+		"base-uri":        "'self'",
+		"form-action":     "'self'",
+		"frame-ancestors": "'none'",
+	},
+}
+
+// SecureHeaders sets the security headers of every response with the Content-Security-Policy p,
+// a route group can use it again with its own policy and keeps the nonce of the request
+func SecureHeaders(p CSP) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r, err := helpers.WithCSPNonce(r)
+			if err != nil {
+				helpers.ServerError(w, err)
+				return
+			}
+
+			h := w.Header()
+			h.Set("Content-Security-Policy", p.header(helpers.CSPNonce(r)))
+			h.Set("X-Content-Type-Options", "nosniff")
+			h.Set("X-Frame-Options", "DENY")
+			h.Set("Referrer-Policy", "strict-origin-when-cross-origin")
+			h.Set("Permissions-Policy", "camera=(), microphone=(), geolocation=(), payment=()")
+			if app.InProduction {
+				h.Set("Strict-Transport-Security", "max-age=63072000; includeSubDomains")
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -1,9 +1,19 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/adewidyatamadb/GoBookings/internal/handlers"
+	"github.com/adewidyatamadb/GoBookings/internal/helpers"
+	"github.com/adewidyatamadb/GoBookings/internal/models"
+	"github.com/adewidyatamadb/GoBookings/internal/ratelimit"
+	"github.com/alexedwards/scs/v2"
 )
 
 func TestNoSurf(t *testing.T) {
@@ -31,3 +41,291 @@ func TestSessionLoad(t *testing.T) {
 		t.Error(fmt.Sprintf("type is not http.Handler, but is %T", v))
 	}
 }
+
+func TestAuth(t *testing.T) {
+	var h Handler
+
+	handler := Auth(&h)
+
+	switch v := handler.(type) {
+	case http.Handler:
+		//do nothing
+	default:
+		t.Error(fmt.Sprintf("type is not http.Handler, but is %T", v))
+	}
+}
+
+// statusHandler records the status of the session it is called with
+type statusHandler struct {
+	status scs.Status
+}
+
+func (h *statusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.status = session.Status(r.Context())
+}
+
+func TestAuth_SessionWrites(t *testing.T) {
+	session = scs.New()
+	app.Session = session
+	helpers.NewHelpers(&app)
+	repo := handlers.NewDemoRepo(&app)
+	handlers.NewHandlers(repo)
+
+	// an administrator of a second property only, the session of the login has no properties
+	ctx := context.Background()
+	propertyID, err := repo.DB.InsertProperty(ctx, models.Property{Name: "Harbour House", Slug: "harbour-house"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	scopedID, err := repo.DB.InsertUser(ctx, models.User{
+		FirstName:   "Hannah",
+		LastName:    "Harbour",
+		Email:       "harbour@here.com",
+		AccessLevel: models.AccessLevelAdmin,
+		Active:      true,
+	}, "long enough 42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.DB.SetUserProperties(ctx, scopedID, []int{propertyID}); err != nil {
+		t.Fatal(err)
+	}
+
+	var tableTest = []struct {
+		name           string
+		accessLevel    int
+		userID         int
+		expectedStatus scs.Status
+	}{
+		{"access level in sync", models.AccessLevelAdmin, 1, scs.Unmodified},
+		{"access level changed", models.AccessLevelStaff, 1, scs.Modified},
+		{"properties changed", models.AccessLevelAdmin, scopedID, scs.Modified},
+	}
+
+	for _, test := range tableTest {
+		// the first request logs in, the second one comes back with the session cookie
+		login := httptest.NewRecorder()
+		session.LoadAndSave(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session.Put(r.Context(), "user_id", test.userID)
+			session.Put(r.Context(), "access_level", test.accessLevel)
+		})).ServeHTTP(login, httptest.NewRequest("GET", "/user/login", nil))
+
+		req := httptest.NewRequest("GET", "/admin/dashboard", nil)
+		for _, c := range login.Result().Cookies() {
+			req.AddCookie(c)
+		}
+
+		h := &statusHandler{}
+		session.LoadAndSave(Auth(h)).ServeHTTP(httptest.NewRecorder(), req)
+
+		if h.status != test.expectedStatus {
+			t.Errorf("case - %s: expected session status %d but got %d", test.name, test.expectedStatus, h.status)
+		}
+	}
+}
+
+func TestAdmin(t *testing.T) {
+	var h Handler
+
+	handler := Admin(&h)
+
+	switch v := handler.(type) {
+	case http.Handler:
+		//do nothing
+	default:
+		t.Error(fmt.Sprintf("type is not http.Handler, but is %T", v))
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	var h Handler
+
+	if handler := RateLimit(nil)(&h); handler != &h {
+		t.Error("expected a nil limiter to let every request through")
+	}
+
+	proxies, err := helpers.ParseTrustedProxies("10.0.0.0/8, 192.0.2.10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.TrustedProxies = proxies
+	helpers.NewHelpers(&app)
+	defer func() { app.TrustedProxies = nil }()
+
+	handler := RateLimit(ratelimit.New(ratelimit.Policy{Rate: 1, Per: time.Minute, Burst: 2}))(&h)
+
+	var tableTest = []struct {
+		name               string
+		remoteAddr         string
+		forwardedFor       string
+		expectedStatusCode int
+	}{
+		{"first request", "198.51.100.1:1234", "", http.StatusOK},
+		{"second request", "198.51.100.1:1234", "", http.StatusOK},
+		{"limited", "198.51.100.1:1234", "", http.StatusTooManyRequests},
+		{"other client", "198.51.100.2:1234", "", http.StatusOK},
+		{"spoofed header of an untrusted client", "198.51.100.1:1234", "203.0.113.1", http.StatusTooManyRequests},
+		{"client behind a trusted proxy", "10.0.0.1:1234", "203.0.113.1", http.StatusOK},
+		{"client behind two trusted proxies", "10.0.0.1:1234", "203.0.113.1, 192.0.2.10", http.StatusOK},
+		{"limited behind trusted proxies", "10.0.0.2:1234", "203.0.113.1", http.StatusTooManyRequests},
+		{"spoofed header behind a trusted proxy", "10.0.0.1:1234", "203.0.113.1, 198.51.100.1", http.StatusTooManyRequests},
+	}
+
+	for _, test := range tableTest {
+		req := httptest.NewRequest("POST", "/search-availability", nil)
+		req.RemoteAddr = test.remoteAddr
+		if test.forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", test.forwardedFor)
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != test.expectedStatusCode {
+			t.Errorf("case - %s: expected code %d but got %d", test.name, test.expectedStatusCode, w.Code)
+		}
+		if w.Code == http.StatusTooManyRequests && w.Header().Get("Retry-After") != "60" {
+			t.Errorf("case - %s: expected Retry-After 60 but got %q", test.name, w.Header().Get("Retry-After"))
+		}
+	}
+
+	if _, err := helpers.ParseTrustedProxies("10.0.0.0/8,proxy"); err == nil {
+		t.Error("expected an error for an invalid trusted proxy")
+	}
+}
+
+// nonceHandler records the Content-Security-Policy nonce of the request it serves
+type nonceHandler struct {
+	nonce string
+}
+
+func (h *nonceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.nonce = helpers.CSPNonce(r)
+}
+
+func TestSecureHeaders(t *testing.T) {
+	var tableTest = []struct {
+		name          string
+		inProduction  bool
+		policies      []CSP
+		expectedHSTS  bool
+		expectedNonce bool
+	}{
+		{"public site", false, []CSP{publicCSP}, false, true},
+		{"public site in production", true, []CSP{publicCSP}, true, true},
+		{"admin area", false, []CSP{publicCSP, adminCSP}, false, true},
+	}
+
+	defer func() { app.InProduction = false }()
+
+	for _, test := range tableTest {
+		app.InProduction = test.inProduction
+
+		var h nonceHandler
+		var handler http.Handler = &h
+		for i := len(test.policies) - 1; i >= 0; i-- {
+			handler = SecureHeaders(test.policies[i])(handler)
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+		if h.nonce == "" {
+			t.Errorf("case - %s: expected the request to carry a nonce", test.name)
+		}
+
+		csp := w.Header().Get("Content-Security-Policy")
+		if hasNonce := strings.Contains(csp, "'nonce-"+h.nonce+"'"); hasNonce != test.expectedNonce {
+			t.Errorf("case - %s: expected the nonce in %q to be %t", test.name, csp, test.expectedNonce)
+		}
+		for _, directive := range strings.Split(csp, "; ") {
+			if strings.HasPrefix(directive, "script-src") && strings.Contains(directive, "'unsafe-inline'") {
+				t.Errorf("case - %s: expected no inline scripts in %q", test.name, directive)
+			}
+		}
+		if !strings.Contains(csp, "frame-ancestors 'none'") {
+			t.Errorf("case - %s: expected frame-ancestors in %q", test.name, csp)
+		}
+
+		if hsts := w.Header().Get("Strict-Transport-Security") != ""; hsts != test.expectedHSTS {
+			t.Errorf("case - %s: expected HSTS to be %t", test.name, test.expectedHSTS)
+		}
+
+		for _, header := range []string{"X-Content-Type-Options", "X-Frame-Options", "Referrer-Policy", "Permissions-Policy"} {
+			if w.Header().Get(header) == "" {
+				t.Errorf("case - %s: expected the %s header", test.name, header)
+			}
+		}
+	}
+}
+
+// propertyHandler records the property slug and path of the request it serves, and the property
+// selectProperty picks for it after putting sessionProperty in the session
+type propertyHandler struct {
+	sessionProperty int
+	properties      []models.Property
+	slug            string
+	path            string
+	property        models.Property
+	found           bool
+}
+
+func (h *propertyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.slug = helpers.PropertySlug(r)
+	h.path = r.URL.Path
+	if h.sessionProperty > 0 {
+		session.Put(r.Context(), "property_id", h.sessionProperty)
+	}
+	h.property, h.found = selectProperty(r, h.properties)
+}
+
+func TestSelectProperty(t *testing.T) {
+	session = scs.New()
+	properties := []models.Property{
+		{ID: 1, Slug: "fort-smythe"},
+		{ID: 2, Slug: "harbour-house", Host: "harbour.example.com"},
+		{ID: 3, Slug: "hill-cabin"},
+	}
+
+	var tableTest = []struct {
+		name             string
+		target           string
+		host             string
+		sessionProperty  int
+		expectedSlug     string
+		expectedPath     string
+		expectedProperty int
+		expectedFound    bool
+	}{
+		{"no prefix", "/search-availability", "localhost:8080", 0, "", "/search-availability", 1, true},
+		{"path prefix", "/p/hill-cabin/search-availability", "localhost:8080", 0, "hill-cabin", "/search-availability", 3, true},
+		{"path prefix of the home page", "/p/hill-cabin", "localhost:8080", 0, "hill-cabin", "/", 3, true},
+		{"path prefix before the host name", "/p/fort-smythe/", "harbour.example.com", 0, "fort-smythe", "/", 1, true},
+		{"unknown path prefix", "/p/nowhere/about", "localhost:8080", 0, "nowhere", "/about", 0, false},
+		{"host name", "/about", "Harbour.Example.com:443", 0, "", "/about", 2, true},
+		{"host name before the session", "/about", "harbour.example.com", 3, "", "/about", 2, true},
+		{"session", "/about", "localhost:8080", 3, "", "/about", 3, true},
+		{"session of a deleted property", "/about", "localhost:8080", 9, "", "/about", 1, true},
+	}
+
+	for _, test := range tableTest {
+		h := &propertyHandler{sessionProperty: test.sessionProperty, properties: properties}
+		req := httptest.NewRequest("GET", test.target, nil)
+		req.Host = test.host
+
+		PropertyPrefix(session.LoadAndSave(h)).ServeHTTP(httptest.NewRecorder(), req)
+
+		if h.slug != test.expectedSlug || h.path != test.expectedPath {
+			t.Errorf("case - %s: expected slug %q and path %q but got %q and %q", test.name, test.expectedSlug, test.expectedPath, h.slug, h.path)
+		}
+		if h.found != test.expectedFound || h.property.ID != test.expectedProperty {
+			t.Errorf("case - %s: expected property %d (%t) but got %d (%t)", test.name, test.expectedProperty, test.expectedFound, h.property.ID, h.found)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	PropertyPrefix(&Handler{}).ServeHTTP(w, httptest.NewRequest("GET", "/p//about", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected code %d for an empty property slug but got %d", http.StatusNotFound, w.Code)
+	}
+}
@@ -13,8 +13,11 @@ func routes(app *config.AppConfig) http.Handler {
 	mux := chi.NewRouter()
 
 	mux.Use(middleware.Recoverer)
+	mux.Use(PropertyPrefix)
+	mux.Use(SecureHeaders(publicCSP))
 	mux.Use(NoSurf)
 	mux.Use(SessionLoad)
+	mux.Use(SelectProperty)
 
 	mux.Get("/", handlers.Repo.Home)
 	mux.Get("/about", handlers.Repo.About)
@@ -22,27 +25,62 @@ func routes(app *config.AppConfig) http.Handler {
 	mux.Get("/majors-suite", handlers.Repo.Majors)
 
 	mux.Get("/search-availability", handlers.Repo.Availability)
-	mux.Post("/search-availability", handlers.Repo.PostAvailability)
-	mux.Post("/search-availability-json", handlers.Repo.AvailabilityJSON)
+	mux.With(RateLimit(app.SearchLimit)).Post("/search-availability", handlers.Repo.PostAvailability)
+	mux.With(RateLimit(app.SearchLimit)).Post("/search-availability-json", handlers.Repo.AvailabilityJSON)
 	mux.Get("/choose-room/{id}", handlers.Repo.ChooseRoom)
 	mux.Get("/book-room", handlers.Repo.BookRoom)
 
 	mux.Get("/contact", handlers.Repo.Contact)
 
 	mux.Get("/make-reservation", handlers.Repo.Reservation)
-	mux.Post("/make-reservation", handlers.Repo.PostReservation)
+	mux.With(RateLimit(app.BookingLimit)).Post("/make-reservation", handlers.Repo.PostReservation)
 	mux.Get("/reservation-summary", handlers.Repo.ReservationSummary)
+	mux.Get("/reservation/confirm", handlers.Repo.ConfirmReservation)
 
 	mux.Get("/user/login", handlers.Repo.ShowLogin)
 	mux.Post("/user/login", handlers.Repo.PostShowLogin)
+	mux.Get("/user/login/two-factor", handlers.Repo.LoginTwoFactor)
+	mux.Post("/user/login/two-factor", handlers.Repo.PostLoginTwoFactor)
 	mux.Get("/user/logout", handlers.Repo.Logout)
+	mux.With(Auth).Get("/user/change-password", handlers.Repo.ChangePassword)
+	mux.With(Auth).Post("/user/change-password", handlers.Repo.PostChangePassword)
+	mux.With(Auth).Get("/user/two-factor", handlers.Repo.TwoFactor)
+	mux.With(Auth).Post("/user/two-factor", handlers.Repo.PostTwoFactor)
+	mux.With(Auth).Post("/user/two-factor/disable", handlers.Repo.PostDisableTwoFactor)
+	mux.Get("/user/forgot-password", handlers.Repo.ForgotPassword)
+	mux.Post("/user/forgot-password", handlers.Repo.PostForgotPassword)
+	mux.Get("/user/reset-password", handlers.Repo.ResetPassword)
+	mux.Post("/user/reset-password", handlers.Repo.PostResetPassword)
+
+	mux.Get("/guest/register", handlers.Repo.GuestRegister)
+	mux.Post("/guest/register", handlers.Repo.PostGuestRegister)
+	mux.Get("/guest/login", handlers.Repo.GuestLogin)
+	mux.Post("/guest/login", handlers.Repo.PostGuestLogin)
+	mux.Get("/guest/logout", handlers.Repo.GuestLogout)
+	mux.Get("/guest/bookings", handlers.Repo.GuestBookings)
+	mux.Post("/guest/verify/resend", handlers.Repo.PostGuestResendVerification)
+	mux.Get("/guest/verify", handlers.Repo.GuestVerify)
+	mux.Get("/guest/forgot-password", handlers.Repo.GuestForgotPassword)
+	mux.Post("/guest/forgot-password", handlers.Repo.PostGuestForgotPassword)
+	mux.Get("/guest/reset-password", handlers.Repo.GuestResetPassword)
+	mux.Post("/guest/reset-password", handlers.Repo.PostGuestResetPassword)
+
+	mux.Route("/api/v1", func(mux chi.Router) {
+		mux.With(RateLimit(app.SearchLimit)).Get("/availability", handlers.Repo.APIAvailability)
+		mux.With(RateLimit(app.SearchLimit)).Get("/rooms/{id}/quote", handlers.Repo.APIQuote)
+		mux.With(RateLimit(app.BookingLimit)).Post("/reservations", handlers.Repo.APICreateReservation)
+	})
 
 	fileServer := http.FileServer(http.Dir("./static/"))
 	mux.Handle("/static/*", http.StripPrefix("/static", fileServer))
 
 	mux.Route("/admin", func(mux chi.Router) {
-		// mux.Use(Auth)
+		mux.Use(SecureHeaders(adminCSP))
+		mux.Use(Auth)
 		mux.Get("/dashboard", handlers.Repo.AdminDashboard)
+		mux.Get("/dashboard.json", handlers.Repo.AdminDashboardJSON)
+		mux.Get("/day-sheet", handlers.Repo.AdminDaySheet)
+		mux.Get("/day-sheet/print", handlers.Repo.AdminDaySheetPrint)
 
 		mux.Get("/reservations-new", handlers.Repo.AdminNewReservations)
 		mux.Get("/reservations-all", handlers.Repo.AdminAllReservations)
@@ -53,6 +91,69 @@ func routes(app *config.AppConfig) http.Handler {
 
 		mux.Get("/reservations/{src}/{id}/show", handlers.Repo.AdminShowReservation)
 		mux.Post("/reservations/{src}/{id}", handlers.Repo.AdminPostShowReservation)
+
+		mux.Get("/guests", handlers.Repo.AdminGuests)
+		mux.Get("/guests/{id}", handlers.Repo.AdminShowGuest)
+		mux.Post("/guests/{id}", handlers.Repo.AdminPostShowGuest)
+		mux.Post("/guests/{id}/merge/{duplicate}/do", handlers.Repo.AdminMergeGuest)
+
+		mux.With(Admin, EveryProperty).Get("/jobs", handlers.Repo.AdminJobs)
+		mux.With(Admin, EveryProperty).Get("/metrics.json", handlers.Repo.AdminMetricsJSON)
+
+		mux.Route("/api", func(mux chi.Router) {
+			mux.Get("/reservations/{id}", handlers.Repo.AdminAPIReservation)
+			mux.Put("/reservations/{id}", handlers.Repo.AdminAPIModifyReservation)
+			mux.Delete("/reservations/{id}", handlers.Repo.AdminAPICancelReservation)
+			mux.Post("/reservations/{id}/process", handlers.Repo.AdminAPIProcessReservation)
+			mux.Post("/blocks", handlers.Repo.AdminAPISetBlocks)
+		})
+
+		mux.Route("/users", func(mux chi.Router) {
+			mux.Use(Admin, EveryProperty)
+			mux.Get("/", handlers.Repo.AdminUsers)
+			mux.Get("/new", handlers.Repo.AdminNewUser)
+			mux.Post("/new", handlers.Repo.AdminPostNewUser)
+			mux.Get("/{id}", handlers.Repo.AdminShowUser)
+			mux.Post("/{id}", handlers.Repo.AdminPostShowUser)
+			mux.Post("/{id}/reset-password/do", handlers.Repo.AdminResetUserPassword)
+			mux.Post("/{id}/unlock/do", handlers.Repo.AdminUnlockUser)
+			mux.Post("/{id}/two-factor/reset/do", handlers.Repo.AdminResetUserTwoFactor)
+			mux.Post("/{id}/sessions/revoke/do", handlers.Repo.AdminRevokeUserSessions)
+			mux.Post("/{id}/sessions/{session}/revoke/do", handlers.Repo.AdminRevokeSession)
+			mux.Post("/{id}/delete/do", handlers.Repo.AdminDeleteUser)
+		})
+
+		mux.Route("/booking-rules", func(mux chi.Router) {
+			mux.Use(Admin, EveryProperty)
+			mux.Get("/", handlers.Repo.AdminBookingRules)
+			mux.Get("/new", handlers.Repo.AdminNewBookingRule)
+			mux.Post("/new", handlers.Repo.AdminPostNewBookingRule)
+			mux.Get("/{id}", handlers.Repo.AdminShowBookingRule)
+			mux.Post("/{id}", handlers.Repo.AdminPostShowBookingRule)
+			mux.Post("/{id}/delete/do", handlers.Repo.AdminDeleteBookingRule)
+		})
+
+		mux.Route("/properties", func(mux chi.Router) {
+			mux.Use(Admin)
+			mux.Get("/", handlers.Repo.AdminProperties)
+			mux.With(EveryProperty).Get("/new", handlers.Repo.AdminNewProperty)
+			mux.With(EveryProperty).Post("/new", handlers.Repo.AdminPostNewProperty)
+			mux.Get("/{id}", handlers.Repo.AdminShowProperty)
+			mux.Post("/{id}", handlers.Repo.AdminPostShowProperty)
+			mux.With(EveryProperty).Post("/{id}/rooms", handlers.Repo.AdminMoveRoom)
+			mux.With(EveryProperty).Post("/{id}/delete/do", handlers.Repo.AdminDeleteProperty)
+		})
+
+		mux.Route("/webhooks", func(mux chi.Router) {
+			mux.Use(Admin, EveryProperty)
+			mux.Get("/", handlers.Repo.AdminWebhooks)
+			mux.Get("/new", handlers.Repo.AdminNewWebhook)
+			mux.Post("/new", handlers.Repo.AdminPostNewWebhook)
+			mux.Get("/{id}", handlers.Repo.AdminShowWebhook)
+			mux.Post("/{id}", handlers.Repo.AdminPostShowWebhook)
+			mux.Post("/{id}/ping/do", handlers.Repo.AdminPingWebhook)
+			mux.Post("/{id}/delete/do", handlers.Repo.AdminDeleteWebhook)
+		})
 	})
 
 	return mux
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"net/http"
 	"testing"
 
 	"github.com/adewidyatamadb/GoBookings/internal/config"
@@ -20,3 +21,39 @@ func TestRoutes(t *testing.T) {
 		t.Error(fmt.Sprintf("type is not *chi.Mux, type is %T", v))
 	}
 }
+
+func TestRoutes_PostActions(t *testing.T) {
+	var app config.AppConfig
+
+	mux := routes(&app).(*chi.Mux)
+
+	methods := make(map[string][]string)
+	err := chi.Walk(mux, func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		methods[route] = append(methods[route], method)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// actions that change data have to be posted with the CSRF token
+	var tableTest = []string{
+		"/admin/users/{id}/reset-password/do",
+		"/admin/users/{id}/delete/do",
+		"/admin/users/{id}/unlock/do",
+		"/admin/users/{id}/two-factor/reset/do",
+		"/admin/users/{id}/sessions/revoke/do",
+		"/admin/users/{id}/sessions/{session}/revoke/do",
+		"/admin/guests/{id}/merge/{duplicate}/do",
+		"/admin/webhooks/{id}/ping/do",
+		"/admin/webhooks/{id}/delete/do",
+		"/admin/booking-rules/{id}/delete/do",
+		"/admin/properties/{id}/delete/do",
+	}
+
+	for _, route := range tableTest {
+		if got := methods[route]; len(got) != 1 || got[0] != http.MethodPost {
+			t.Errorf("case - %s: expected only POST but got %v", route, got)
+		}
+	}
+}
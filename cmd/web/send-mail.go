@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"html"
 	"io/ioutil"
 	"log"
 	"strings"
@@ -45,6 +46,7 @@ func sendMsg(m models.MailData) {
 
 		mailTemplate := string(data)
 		msgToSend := strings.Replace(mailTemplate, "[%body%]", m.Content, 1)
+		msgToSend = strings.Replace(msgToSend, "[%brand%]", html.EscapeString(m.Brand), 1)
 		email.SetBody(mail.TextHTML, msgToSend)
 	}
 
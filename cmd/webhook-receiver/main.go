@@ -0,0 +1,59 @@
+// Command webhook-receiver is a local endpoint to try the webhooks of the admin panel with, it checks the
+// signature of every request and prints the event it received.
+//
+//	go run ./cmd/webhook-receiver -secret whsec_...
+//
+// and add a webhook for http://localhost:9090/hooks in the admin panel
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/adewidyatamadb/GoBookings/internal/webhooks"
+)
+
+// tolerance is how far the timestamp of a request may be from the time it is received
+const tolerance = 5 * time.Minute
+
+func main() {
+	addr := flag.String("addr", "localhost:9090", "address to listen on")
+	path := flag.String("path", "/hooks", "path to receive webhooks on")
+	secret := flag.String("secret", "", "signing secret of the webhook, empty accepts requests without checking them")
+	status := flag.Int("status", http.StatusNoContent, "status code to answer with, use 500 to see deliveries retried")
+	flag.Parse()
+
+	http.HandleFunc(*path, func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if *secret != "" {
+			err = webhooks.Verify(*secret, r.Header, body, time.Now(), tolerance)
+			if err != nil {
+				log.Printf("rejected delivery %s: %v", r.Header.Get(webhooks.DeliveryHeader), err)
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+		}
+
+		var out bytes.Buffer
+		if err := json.Indent(&out, body, "", "  "); err != nil {
+			out.Reset()
+			out.Write(body)
+		}
+		log.Printf("delivery %s: %s\n%s", r.Header.Get(webhooks.DeliveryHeader), r.Header.Get(webhooks.EventHeader), out.String())
+
+		w.WriteHeader(*status)
+	})
+
+	log.Printf("Receiving webhooks on http://%s%s", *addr, *path)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
@@ -0,0 +1,489 @@
+// Package booking holds the rules of quoting stays, making and changing reservations and blocking rooms, for the
+// web pages and the JSON API alike. What happens is published on the event bus of the application, so that the
+// emails, webhooks and the audit log follow without the service knowing about them.
+package booking
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adewidyatamadb/GoBookings/internal/config"
+	"github.com/adewidyatamadb/GoBookings/internal/dates"
+	"github.com/adewidyatamadb/GoBookings/internal/events"
+	"github.com/adewidyatamadb/GoBookings/internal/models"
+	"github.com/adewidyatamadb/GoBookings/internal/repository"
+	"github.com/asaskevich/govalidator"
+)
+
+// Service makes and changes reservations in the repository
+type Service struct {
+	App *config.AppConfig
+	DB  repository.DatabaseRepo
+
+	now func() time.Time
+}
+
+// New returns a service for db that holds reservations and publishes events as configured in a
+func New(a *config.AppConfig, db repository.DatabaseRepo) *Service {
+	return &Service{
+		App: a,
+		DB:  db,
+		now: time.Now,
+	}
+}
+
+// ValidationError lists the fields of a request that are missing or invalid, with a message for each
+type ValidationError struct {
+	Fields map[string]string
+}
+
+func (e *ValidationError) Error() string {
+	fields := make([]string, 0, len(e.Fields))
+	for field := range e.Fields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return "invalid " + strings.Join(fields, ", ")
+}
+
+// Messages returns the problems in the order of their fields
+func (e *ValidationError) Messages() []string {
+	fields := make([]string, 0, len(e.Fields))
+	for field := range e.Fields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	messages := make([]string, 0, len(fields))
+	for _, field := range fields {
+		messages = append(messages, e.Fields[field])
+	}
+	return messages
+}
+
+// add records the first problem of field
+func (e *ValidationError) add(field, message string) {
+	if _, ok := e.Fields[field]; !ok {
+		e.Fields[field] = message
+	}
+}
+
+// required records every field of values that is blank
+func (e *ValidationError) required(values map[string]string) {
+	for field, value := range values {
+		if strings.TrimSpace(value) == "" {
+			e.add(field, "This field cannot be blank")
+		}
+	}
+}
+
+// err returns e when it lists a problem, nil otherwise
+func (e *ValidationError) err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+func newValidationError() *ValidationError {
+	return &ValidationError{Fields: make(map[string]string)}
+}
+
+// today returns the current day in the time zone of the application
+func (s *Service) today() dates.Date {
+	loc := s.App.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	return dates.Of(s.now().In(loc))
+}
+
+// property returns property propertyID with the current day in its time zone, a propertyID of 0 is no property
+// and the day of the application
+func (s *Service) property(ctx context.Context, propertyID int) (models.Property, dates.Date, error) {
+	if propertyID == 0 {
+		return models.Property{}, s.today(), nil
+	}
+
+	p, err := s.DB.GetPropertyByID(ctx, propertyID)
+	if err != nil {
+		return p, dates.Date{}, err
+	}
+	loc, err := p.Location()
+	if err != nil {
+		return p, dates.Date{}, err
+	}
+	if loc == nil {
+		return p, s.today(), nil
+	}
+	return p, dates.Of(s.now().In(loc)), nil
+}
+
+// checkStay records the problems of a stay from start to end under startField and endField: an arrival before
+// today at the property and a departure that is not after the arrival
+func (s *Service) checkStay(invalid *ValidationError, today, start, end dates.Date, startField, endField string) {
+	if start.Before(today) {
+		invalid.add(startField, "The arrival date cannot be in the past")
+	}
+	if !end.After(start) {
+		invalid.add(endField, "The departure date must be after the arrival date")
+	}
+}
+
+// checkGuest adds the problems of the guest details of res to invalid, guest emails are sent to its address
+func checkGuest(invalid *ValidationError, res models.Reservation) {
+	invalid.required(map[string]string{"first_name": res.FirstName, "last_name": res.LastName, "email": res.Email})
+	if len(res.FirstName) < 3 {
+		invalid.add("first_name", "This field must be at least 3 characters long")
+	}
+	if !govalidator.IsEmail(res.Email) {
+		invalid.add("email", "Invalid email address")
+	}
+}
+
+// meta returns the metadata of an event caused by the staff user userID, 0 for guests
+func (s *Service) meta(userID int) events.Meta {
+	return events.Meta{At: s.now(), UserID: userID}
+}
+
+// Quote is what the service can offer for a stay in a room
+type Quote struct {
+	Room models.Room
+	// Property is the property of the room
+	Property  models.Property
+	StartDate dates.Date
+	EndDate   dates.Date
+	Nights    int
+	Available bool
+	// Reasons are the booking rules the stay does not meet, the room is then not available
+	Reasons []string
+}
+
+// QuoteStay returns whether room roomID is free from start to end and allowed by the booking rules, stays in the
+// past or without a night are a *ValidationError with the fields start and end
+func (s *Service) QuoteStay(ctx context.Context, roomID int, start, end dates.Date) (Quote, error) {
+	room, err := s.DB.GetRoomByID(ctx, roomID)
+	if err != nil {
+		return Quote{}, err
+	}
+	room.ID = roomID
+
+	p, today, err := s.property(ctx, room.PropertyID)
+	if err != nil {
+		return Quote{}, err
+	}
+
+	invalid := newValidationError()
+	s.checkStay(invalid, today, start, end, "start", "end")
+	if err := invalid.err(); err != nil {
+		return Quote{}, err
+	}
+
+	available, err := s.DB.SearchAvailabilityByDatesByRoomID(ctx, start, end, roomID)
+	if err != nil {
+		return Quote{}, err
+	}
+
+	reasons, err := s.ruleReasons(ctx, room, start, end, today)
+	if err != nil {
+		return Quote{}, err
+	}
+
+	return Quote{
+		Room:      room,
+		Property:  p,
+		StartDate: start,
+		EndDate:   end,
+		Nights:    start.DaysUntil(end),
+		Available: available && len(reasons) == 0,
+		Reasons:   reasons,
+	}, nil
+}
+
+// Exclusion is a free room the booking rules do not allow for a stay, with the reasons why
+type Exclusion struct {
+	Room    models.Room
+	Reasons []string
+}
+
+// Search are the rooms found for a stay
+type Search struct {
+	// Rooms are free and allowed by the booking rules
+	Rooms []models.Room
+	// Excluded are free but not allowed by the booking rules
+	Excluded []Exclusion
+}
+
+// SearchRooms returns the rooms of property propertyID that are free from start to end, checked like QuoteStay
+// does, split into the rooms the booking rules allow and those they exclude. A propertyID of 0 searches the rooms
+// of every property
+func (s *Service) SearchRooms(ctx context.Context, propertyID int, start, end dates.Date) (Search, error) {
+	var search Search
+
+	_, today, err := s.property(ctx, propertyID)
+	if err != nil {
+		return search, err
+	}
+
+	invalid := newValidationError()
+	s.checkStay(invalid, today, start, end, "start", "end")
+	if err := invalid.err(); err != nil {
+		return search, err
+	}
+
+	free, err := s.DB.SearchAvailabilityForAllRooms(ctx, start, end)
+	if err != nil {
+		return search, err
+	}
+	var rooms []models.Room
+	for _, room := range free {
+		if propertyID == 0 || room.PropertyID == propertyID {
+			rooms = append(rooms, room)
+		}
+	}
+	if len(rooms) == 0 {
+		return search, nil
+	}
+
+	rules, err := s.DB.AllBookingRules(ctx)
+	if err != nil {
+		return search, err
+	}
+
+	for _, room := range rooms {
+		problems := checkRules(rules, room, start, end, today, "start", "end")
+		if len(problems) > 0 {
+			search.Excluded = append(search.Excluded, Exclusion{Room: room, Reasons: messages(problems)})
+			continue
+		}
+		search.Rooms = append(search.Rooms, room)
+	}
+
+	return search, nil
+}
+
+// NewReservation is a request to reserve a room
+type NewReservation struct {
+	RoomID    int
+	StartDate dates.Date
+	EndDate   dates.Date
+	FirstName string
+	LastName  string
+	Email     string
+	Phone     string
+	// GuestID is the profile of the logged in guest, 0 files the reservation under the profile of Email
+	GuestID int
+	// Verified is set when the guest proved to own Email, the reservation is then never held
+	Verified bool
+	// UserID is the staff user making the reservation, 0 for guests
+	UserID int
+}
+
+// CreateReservation reserves the room of req, held until the guest confirms the email address when bookings are
+// verified. On a *ValidationError the reservation is returned as far as it was built, to show the form again
+func (s *Service) CreateReservation(ctx context.Context, req NewReservation) (models.Reservation, error) {
+	res := models.Reservation{
+		FirstName: req.FirstName,
+		LastName:  req.LastName,
+		Email:     req.Email,
+		Phone:     req.Phone,
+		StartDate: req.StartDate,
+		EndDate:   req.EndDate,
+		RoomID:    req.RoomID,
+		GuestID:   req.GuestID,
+	}
+
+	room, err := s.DB.GetRoomByID(ctx, req.RoomID)
+	if err != nil {
+		return res, err
+	}
+	res.Room = models.Room{ID: req.RoomID, RoomName: room.RoomName, PropertyID: room.PropertyID}
+
+	_, today, err := s.property(ctx, room.PropertyID)
+	if err != nil {
+		return res, err
+	}
+
+	invalid := newValidationError()
+	s.checkStay(invalid, today, res.StartDate, res.EndDate, "start_date", "end_date")
+	// the booking rules only make sense for a stay of at least a night
+	if len(invalid.Fields) == 0 {
+		rules, err := s.DB.AllBookingRules(ctx)
+		if err != nil {
+			return res, err
+		}
+		for _, p := range checkRules(rules, res.Room, res.StartDate, res.EndDate, today, "start_date", "end_date") {
+			invalid.add(p.field, p.message)
+		}
+	}
+	checkGuest(invalid, res)
+	if err := invalid.err(); err != nil {
+		return res, err
+	}
+
+	// reservations made without logging in are kept with the guest profile of the email address
+	if res.GuestID == 0 {
+		res.GuestID, err = s.DB.FindOrCreateGuest(ctx, models.Guest{
+			FirstName: res.FirstName,
+			LastName:  res.LastName,
+			Email:     strings.ToLower(strings.TrimSpace(res.Email)),
+			Phone:     res.Phone,
+		})
+		if err != nil {
+			return res, err
+		}
+	}
+
+	if s.App.VerifyBookings && !req.Verified {
+		res.HoldUntil = s.now().Add(s.App.HoldTTL)
+	}
+
+	res.ID, err = s.DB.InsertReservation(ctx, res)
+	if err != nil {
+		return res, err
+	}
+
+	err = s.DB.InsertRoomRestriction(ctx, models.RoomRestriction{
+		StartDate:     res.StartDate,
+		EndDate:       res.EndDate,
+		RoomID:        res.RoomID,
+		ReservationID: res.ID,
+		RestrictionID: 1,
+	})
+	if err != nil {
+		// someone else booked the room since the search, so drop the orphaned reservation
+		_ = s.DB.DeleteReservation(ctx, res.ID)
+		return res, err
+	}
+
+	if res.Pending() {
+		s.App.Events.Publish(ctx, events.ReservationHeld{Meta: s.meta(req.UserID), Reservation: res})
+	} else {
+		s.App.Events.Publish(ctx, events.ReservationCreated{Meta: s.meta(req.UserID), Reservation: res})
+	}
+
+	return res, nil
+}
+
+// ConfirmReservation confirms the held reservation res once the guest confirmed the email address,
+// repository.ErrNotFound means the hold expired and the room was released
+func (s *Service) ConfirmReservation(ctx context.Context, res models.Reservation) (models.Reservation, error) {
+	err := s.DB.ConfirmReservation(ctx, res.ID, s.now())
+	if err != nil {
+		return res, err
+	}
+
+	res.HoldUntil = time.Time{}
+	s.App.Events.Publish(ctx, events.ReservationCreated{Meta: s.meta(0), Reservation: res})
+
+	return res, nil
+}
+
+// Changes are the guest details of a reservation staff can change
+type Changes struct {
+	FirstName string
+	LastName  string
+	Email     string
+	Phone     string
+}
+
+// ModifyReservation changes the guest details of reservation id. On a *ValidationError the reservation is
+// returned with the changes, to show the form again
+func (s *Service) ModifyReservation(ctx context.Context, id int, c Changes, userID int) (models.Reservation, error) {
+	res, err := s.DB.GetReservationByID(ctx, id)
+	if err != nil {
+		return res, err
+	}
+
+	res.FirstName = c.FirstName
+	res.LastName = c.LastName
+	res.Email = c.Email
+	res.Phone = c.Phone
+
+	invalid := newValidationError()
+	checkGuest(invalid, res)
+	if err := invalid.err(); err != nil {
+		return res, err
+	}
+
+	err = s.DB.UpdateReservation(ctx, res)
+	if err != nil {
+		return res, err
+	}
+	s.App.Events.Publish(ctx, events.ReservationUpdated{Meta: s.meta(userID), Reservation: res})
+
+	return res, nil
+}
+
+// ProcessReservation marks reservation id as processed
+func (s *Service) ProcessReservation(ctx context.Context, id, userID int) (models.Reservation, error) {
+	res, err := s.DB.GetReservationByID(ctx, id)
+	if err != nil {
+		return res, err
+	}
+
+	err = s.DB.UpdateProcessedForReservation(ctx, id, 1)
+	if err != nil {
+		return res, err
+	}
+	res.Processed = 1
+	s.App.Events.Publish(ctx, events.ReservationProcessed{Meta: s.meta(userID), Reservation: res})
+
+	return res, nil
+}
+
+// CancelReservation deletes reservation id and returns how it was
+func (s *Service) CancelReservation(ctx context.Context, id, userID int) (models.Reservation, error) {
+	res, err := s.DB.GetReservationByID(ctx, id)
+	if err != nil {
+		return res, err
+	}
+
+	err = s.DB.DeleteReservation(ctx, id)
+	if err != nil {
+		return res, err
+	}
+	s.App.Events.Publish(ctx, events.ReservationCancelled{Meta: s.meta(userID), Reservation: res})
+
+	return res, nil
+}
+
+// Block is a night a room is blocked for
+type Block struct {
+	RoomID int
+	Date   dates.Date
+}
+
+// BlockChanges are the blocks to add and the ids of the blocks to remove
+type BlockChanges struct {
+	Add    []Block
+	Remove []int
+}
+
+// SetBlocks removes and adds the blocks of c and returns how many nights were not blocked because they are reserved
+func (s *Service) SetBlocks(ctx context.Context, c BlockChanges, userID int) (int, error) {
+	for _, id := range c.Remove {
+		err := s.DB.DeleteBlockByID(ctx, id)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return 0, fmt.Errorf("removing block %d: %w", id, err)
+		}
+	}
+
+	reserved := 0
+	for _, b := range c.Add {
+		err := s.DB.InsertBlockForRoom(ctx, b.RoomID, b.Date)
+		if errors.Is(err, repository.ErrUnavailable) {
+			reserved++
+			continue
+		} else if err != nil {
+			return reserved, fmt.Errorf("blocking room %d: %w", b.RoomID, err)
+		}
+		s.App.Events.Publish(ctx, events.BlockAdded{Meta: s.meta(userID), RoomID: b.RoomID, Date: b.Date})
+	}
+
+	return reserved, nil
+}
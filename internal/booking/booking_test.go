@@ -0,0 +1,557 @@
+package booking
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/adewidyatamadb/GoBookings/internal/config"
+	"github.com/adewidyatamadb/GoBookings/internal/dates"
+	"github.com/adewidyatamadb/GoBookings/internal/events"
+	"github.com/adewidyatamadb/GoBookings/internal/models"
+	"github.com/adewidyatamadb/GoBookings/internal/repository"
+	"github.com/adewidyatamadb/GoBookings/internal/repository/dbrepo"
+)
+
+var now = time.Date(2021, 10, 19, 12, 0, 0, 0, time.UTC)
+
+// newTestService returns a service over a memory repository, with the names of the published events
+func newTestService(verify bool) (*Service, *[]string) {
+	app := &config.AppConfig{
+		VerifyBookings: verify,
+		HoldTTL:        time.Hour,
+		Events:         events.New(log.New(io.Discard, "", 0)),
+	}
+
+	published := []string{}
+	app.Events.Subscribe("test", func(ctx context.Context, e events.Event) error {
+		published = append(published, e.Name())
+		return nil
+	})
+
+	s := New(app, dbrepo.NewMemoryRepo(app))
+	s.now = func() time.Time { return now }
+	return s, &published
+}
+
+func validRequest() NewReservation {
+	return NewReservation{
+		RoomID:    1,
+		StartDate: dates.New(2021, 11, 1),
+		EndDate:   dates.New(2021, 11, 3),
+		FirstName: "John",
+		LastName:  "Smith",
+		Email:     "John@Smith.com",
+		Phone:     "555-555-5555",
+	}
+}
+
+func TestService_QuoteStay(t *testing.T) {
+	s, _ := newTestService(false)
+	ctx := context.Background()
+	req := validRequest()
+
+	quote, err := s.QuoteStay(ctx, 1, req.StartDate, req.EndDate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !quote.Available || quote.Nights != 2 || quote.Room.RoomName != "General's Quarters" {
+		t.Errorf("unexpected quote %+v", quote)
+	}
+
+	if _, err := s.CreateReservation(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	quote, err = s.QuoteStay(ctx, 1, req.StartDate, req.EndDate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quote.Available {
+		t.Error("reserved room quoted as available")
+	}
+
+	search, err := s.SearchRooms(ctx, 0, req.StartDate, req.EndDate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(search.Rooms) != 1 || search.Rooms[0].ID != 2 || len(search.Excluded) != 0 {
+		t.Errorf("expected only room 2 to be free, got %+v", search)
+	}
+
+	_, err = s.QuoteStay(ctx, 99, req.StartDate, req.EndDate)
+	if !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for an unknown room, got %v", err)
+	}
+}
+
+func TestService_CreateReservation(t *testing.T) {
+	var tableTest = []struct {
+		name      string
+		change    func(r *NewReservation)
+		verify    bool
+		invalid   []string
+		err       error
+		held      bool
+		published []string
+	}{
+		{"valid", func(r *NewReservation) {}, false, nil, nil, false, []string{models.EventReservationCreated}},
+		{"held", func(r *NewReservation) {}, true, nil, nil, true, []string{"reservation.held"}},
+		{"verified guest", func(r *NewReservation) { r.Verified = true }, true, nil, nil, false, []string{models.EventReservationCreated}},
+		{"missing fields", func(r *NewReservation) { r.FirstName = ""; r.LastName = "" }, false, []string{"first_name", "last_name"}, nil, false, []string{}},
+		{"short name", func(r *NewReservation) { r.FirstName = "Jo" }, false, []string{"first_name"}, nil, false, []string{}},
+		{"invalid email", func(r *NewReservation) { r.Email = "john" }, false, []string{"email"}, nil, false, []string{}},
+		{"unknown room", func(r *NewReservation) { r.RoomID = 99 }, false, nil, repository.ErrNotFound, false, []string{}},
+		{"arrival today", func(r *NewReservation) { r.StartDate = dates.New(2021, 10, 19) }, false, nil, nil, false, []string{models.EventReservationCreated}},
+		{"arrival in the past", func(r *NewReservation) { r.StartDate = dates.New(2021, 10, 18) }, false, []string{"start_date"}, nil, false, []string{}},
+		{"no nights", func(r *NewReservation) { r.EndDate = r.StartDate }, false, []string{"end_date"}, nil, false, []string{}},
+		{"end before start", func(r *NewReservation) { r.EndDate = r.StartDate.AddDays(-1) }, false, []string{"end_date"}, nil, false, []string{}},
+	}
+
+	for _, e := range tableTest {
+		s, published := newTestService(e.verify)
+		req := validRequest()
+		e.change(&req)
+
+		res, err := s.CreateReservation(context.Background(), req)
+
+		var invalid *ValidationError
+		switch {
+		case len(e.invalid) > 0:
+			if !errors.As(err, &invalid) {
+				t.Errorf("case - %s: expected a validation error, got %v", e.name, err)
+				continue
+			}
+			for _, field := range e.invalid {
+				if invalid.Fields[field] == "" {
+					t.Errorf("case - %s: expected a problem with %s, got %v", e.name, field, invalid.Fields)
+				}
+			}
+		case e.err != nil:
+			if !errors.Is(err, e.err) {
+				t.Errorf("case - %s: expected %v, got %v", e.name, e.err, err)
+			}
+		case err != nil:
+			t.Errorf("case - %s: unexpected error %v", e.name, err)
+			continue
+		default:
+			if res.ID == 0 || res.GuestID == 0 {
+				t.Errorf("case - %s: reservation or guest not saved: %+v", e.name, res)
+			}
+			if res.Pending() != e.held {
+				t.Errorf("case - %s: expected held to be %v", e.name, e.held)
+			}
+			if e.held && !res.HoldUntil.Equal(now.Add(time.Hour)) {
+				t.Errorf("case - %s: expected hold until %v, got %v", e.name, now.Add(time.Hour), res.HoldUntil)
+			}
+			guest, err := s.DB.GetGuestByID(context.Background(), res.GuestID)
+			if err != nil || guest.Email != "john@smith.com" {
+				t.Errorf("case - %s: expected guest john@smith.com, got %+v, %v", e.name, guest, err)
+			}
+		}
+
+		if len(*published) != len(e.published) {
+			t.Errorf("case - %s: expected events %v, got %v", e.name, e.published, *published)
+			continue
+		}
+		for i := range e.published {
+			if (*published)[i] != e.published[i] {
+				t.Errorf("case - %s: expected events %v, got %v", e.name, e.published, *published)
+			}
+		}
+	}
+}
+
+func TestService_CreateReservationUnavailable(t *testing.T) {
+	s, published := newTestService(false)
+	ctx := context.Background()
+
+	if _, err := s.CreateReservation(ctx, validRequest()); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := s.CreateReservation(ctx, validRequest())
+	if !errors.Is(err, repository.ErrUnavailable) {
+		t.Errorf("expected ErrUnavailable, got %v", err)
+	}
+	if len(*published) != 1 {
+		t.Errorf("expected only the first reservation to be published, got %v", *published)
+	}
+
+	all, err := s.DB.GetAllReservations(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 {
+		t.Errorf("expected the second reservation to be removed, got %d reservations", len(all))
+	}
+}
+
+func TestService_ConfirmReservation(t *testing.T) {
+	s, published := newTestService(true)
+	ctx := context.Background()
+
+	res, err := s.CreateReservation(ctx, validRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err = s.ConfirmReservation(ctx, res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Pending() {
+		t.Error("confirmed reservation is still held")
+	}
+	if (*published)[len(*published)-1] != models.EventReservationCreated {
+		t.Errorf("expected %s to be published last, got %v", models.EventReservationCreated, *published)
+	}
+}
+
+func TestService_ChangeReservation(t *testing.T) {
+	s, published := newTestService(false)
+	ctx := context.Background()
+
+	res, err := s.CreateReservation(ctx, validRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.ModifyReservation(ctx, res.ID, Changes{FirstName: "Jane"}, 1)
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) || invalid.Fields["last_name"] == "" || invalid.Fields["email"] == "" {
+		t.Errorf("expected last_name and email to be required, got %v", err)
+	}
+
+	_, err = s.ModifyReservation(ctx, res.ID, Changes{FirstName: "Jo", LastName: "Doe", Email: "jane@"}, 1)
+	if !errors.As(err, &invalid) || invalid.Fields["first_name"] == "" || invalid.Fields["email"] != "Invalid email address" {
+		t.Errorf("expected the name length and the email address to be checked like new reservations, got %v", err)
+	}
+	saved, _ := s.DB.GetReservationByID(ctx, res.ID)
+	if saved.Email != res.Email {
+		t.Errorf("expected the invalid changes not to be saved but got %+v", saved)
+	}
+
+	changed, err := s.ModifyReservation(ctx, res.ID, Changes{FirstName: "Jane", LastName: "Doe", Email: "jane@doe.com"}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, _ = s.DB.GetReservationByID(ctx, res.ID)
+	if changed.FirstName != "Jane" || saved.FirstName != "Jane" || saved.Email != "jane@doe.com" {
+		t.Errorf("changes not saved: %+v", saved)
+	}
+
+	if _, err := s.ProcessReservation(ctx, res.ID, 1); err != nil {
+		t.Fatal(err)
+	}
+	saved, _ = s.DB.GetReservationByID(ctx, res.ID)
+	if saved.Processed != 1 {
+		t.Error("reservation not processed")
+	}
+
+	cancelled, err := s.CancelReservation(ctx, res.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cancelled.FirstName != "Jane" {
+		t.Errorf("expected the cancelled reservation as it was, got %+v", cancelled)
+	}
+	if _, err := s.DB.GetReservationByID(ctx, res.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected the reservation to be deleted, got %v", err)
+	}
+
+	if _, err := s.CancelReservation(ctx, res.ID, 1); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound cancelling twice, got %v", err)
+	}
+
+	expected := []string{
+		models.EventReservationCreated,
+		models.EventReservationUpdated,
+		models.EventReservationProcessed,
+		models.EventReservationCancelled,
+	}
+	if len(*published) != len(expected) {
+		t.Fatalf("expected events %v, got %v", expected, *published)
+	}
+	for i := range expected {
+		if (*published)[i] != expected[i] {
+			t.Errorf("expected events %v, got %v", expected, *published)
+		}
+	}
+}
+
+func TestService_SetBlocks(t *testing.T) {
+	s, published := newTestService(false)
+	ctx := context.Background()
+	req := validRequest()
+
+	if _, err := s.CreateReservation(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+
+	reserved, err := s.SetBlocks(ctx, BlockChanges{Add: []Block{
+		{RoomID: 1, Date: req.StartDate},
+		{RoomID: 2, Date: req.StartDate},
+	}}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reserved != 1 {
+		t.Errorf("expected 1 reserved night, got %d", reserved)
+	}
+
+	blocks, err := s.DB.GetRestrictionForRoomByDate(ctx, 2, req.StartDate, req.EndDate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 1 {
+		t.Fatalf("expected 1 block for room 2, got %d", len(blocks))
+	}
+
+	reserved, err = s.SetBlocks(ctx, BlockChanges{Remove: []int{blocks[0].ID, 999}}, 1)
+	if err != nil || reserved != 0 {
+		t.Errorf("unexpected result removing blocks: %d, %v", reserved, err)
+	}
+	blocks, _ = s.DB.GetRestrictionForRoomByDate(ctx, 2, req.StartDate, req.EndDate)
+	if len(blocks) != 0 {
+		t.Errorf("expected the block of room 2 to be removed, got %d", len(blocks))
+	}
+
+	expected := []string{models.EventReservationCreated, models.EventBlockCreated}
+	if len(*published) != len(expected) || (*published)[1] != expected[1] {
+		t.Errorf("expected events %v, got %v", expected, *published)
+	}
+}
+
+func TestService_today(t *testing.T) {
+	s, _ := newTestService(false)
+	// 12:00 UTC is already the next day in Kiribati
+	s.App.Location = time.FixedZone("Kiribati", 14*60*60)
+
+	if today := s.today(); !today.Equal(dates.New(2021, 10, 20)) {
+		t.Errorf("expected the 20th at the property but got %s", today)
+	}
+
+	_, err := s.QuoteStay(context.Background(), 1, dates.New(2021, 10, 19), dates.New(2021, 10, 21))
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) || invalid.Fields["start"] == "" {
+		t.Errorf("expected the 19th to be in the past at the property but got %v", err)
+	}
+}
+
+func TestCheckRules(t *testing.T) {
+	today := dates.New(2021, 10, 19)
+	summer := models.BookingRule{
+		Name:          "Summer",
+		RoomID:        1,
+		Start:         dates.New(2022, 6, 1),
+		End:           dates.New(2022, 8, 31),
+		MinNights:     7,
+		ArrivalDays:   models.WeekdaysOf(time.Saturday),
+		DepartureDays: models.WeekdaysOf(time.Saturday),
+	}
+	house := models.BookingRule{Name: "House", PropertyID: 1, MaxNights: 14, MinNotice: 2, MaxAdvance: 365}
+
+	var tableTest = []struct {
+		name     string
+		roomID   int
+		property int
+		start    dates.Date
+		end      dates.Date
+		expected []string
+	}{
+		{"allowed", 1, 1, dates.New(2021, 11, 1), dates.New(2021, 11, 3), nil},
+		{"short notice", 1, 1, dates.New(2021, 10, 20), dates.New(2021, 10, 22), []string{"start_date: Book at least 2 days before arrival (House)"}},
+		{"too long", 2, 1, dates.New(2021, 11, 1), dates.New(2021, 11, 16), []string{"end_date: The stay cannot be longer than 14 nights (House)"}},
+		{"too long at another property", 3, 2, dates.New(2021, 11, 1), dates.New(2021, 11, 16), nil},
+		{"too far ahead", 2, 1, dates.New(2022, 10, 20), dates.New(2022, 10, 22), []string{"start_date: Arrivals can be booked at most 365 days ahead (House)"}},
+		{"summer week", 1, 1, dates.New(2022, 7, 2), dates.New(2022, 7, 9), nil},
+		{"summer other room", 2, 1, dates.New(2022, 7, 4), dates.New(2022, 7, 6), nil},
+		{"summer weekdays", 1, 1, dates.New(2022, 7, 4), dates.New(2022, 7, 6), []string{
+			"end_date: The stay must be at least 7 nights (Summer)",
+			"start_date: Arrivals are on Sat only (Summer)",
+			"end_date: Departures are on Sat only (Summer)",
+		}},
+		{"arrival before summer", 1, 1, dates.New(2022, 5, 30), dates.New(2022, 6, 2), nil},
+	}
+
+	for _, e := range tableTest {
+		var got []string
+		room := models.Room{ID: e.roomID, PropertyID: e.property}
+		for _, p := range checkRules([]models.BookingRule{summer, house}, room, e.start, e.end, today, "start_date", "end_date") {
+			got = append(got, p.field+": "+p.message)
+		}
+		if len(got) != len(e.expected) {
+			t.Errorf("case - %s: expected %v but got %v", e.name, e.expected, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != e.expected[i] {
+				t.Errorf("case - %s: expected %q but got %q", e.name, e.expected[i], got[i])
+			}
+		}
+	}
+}
+
+func TestService_BookingRules(t *testing.T) {
+	s, published := newTestService(false)
+	ctx := context.Background()
+	req := validRequest()
+
+	_, err := s.DB.InsertBookingRule(ctx, models.BookingRule{Name: "Weekends", RoomID: 2, MinNights: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	search, err := s.SearchRooms(ctx, 0, req.StartDate, req.EndDate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(search.Rooms) != 1 || search.Rooms[0].ID != 1 {
+		t.Errorf("expected only room 1 to be allowed, got %+v", search.Rooms)
+	}
+	if len(search.Excluded) != 1 || search.Excluded[0].Room.ID != 2 || len(search.Excluded[0].Reasons) != 1 ||
+		search.Excluded[0].Reasons[0] != "The stay must be at least 3 nights (Weekends)" {
+		t.Errorf("expected room 2 to be excluded for the minimum stay, got %+v", search.Excluded)
+	}
+
+	quote, err := s.QuoteStay(ctx, 2, req.StartDate, req.EndDate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quote.Available || len(quote.Reasons) != 1 {
+		t.Errorf("expected room 2 not to be available because of the rule, got %+v", quote)
+	}
+
+	req.RoomID = 2
+	_, err = s.CreateReservation(ctx, req)
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) || invalid.Fields["end_date"] != "The stay must be at least 3 nights (Weekends)" {
+		t.Errorf("expected the minimum stay to be enforced, got %v", err)
+	}
+	if len(*published) != 0 {
+		t.Errorf("expected no events, got %v", *published)
+	}
+
+	req.EndDate = req.StartDate.AddDays(3)
+	if _, err = s.CreateReservation(ctx, req); err != nil {
+		t.Errorf("expected a stay of 3 nights to be allowed, got %v", err)
+	}
+}
+
+func TestService_BookingRules_Property(t *testing.T) {
+	s, _ := newTestService(false)
+	ctx := context.Background()
+	req := validRequest()
+
+	id, err := s.DB.InsertProperty(ctx, models.Property{Name: "Island Lodge", Slug: "island-lodge"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.DB.MoveRoom(ctx, 2, id); err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.DB.InsertBookingRule(ctx, models.BookingRule{Name: "Lodge weeks", PropertyID: id, MinNights: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	search, err := s.SearchRooms(ctx, 0, req.StartDate, req.EndDate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(search.Excluded) != 1 || search.Excluded[0].Room.ID != 2 {
+		t.Errorf("expected only the room of the lodge to be excluded, got %+v", search.Excluded)
+	}
+
+	quote, err := s.QuoteStay(ctx, 1, req.StartDate, req.EndDate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !quote.Available {
+		t.Errorf("expected the rule of the lodge not to apply to room 1, got %+v", quote)
+	}
+
+	if _, err = s.CreateReservation(ctx, req); err != nil {
+		t.Errorf("expected the rule of the lodge not to apply to room 1, got %v", err)
+	}
+	req.RoomID = 2
+	_, err = s.CreateReservation(ctx, req)
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) || invalid.Fields["end_date"] != "The stay must be at least 7 nights (Lodge weeks)" {
+		t.Errorf("expected the rule of the lodge to apply to its room, got %v", err)
+	}
+}
+
+func TestService_Properties(t *testing.T) {
+	s, _ := newTestService(false)
+	ctx := context.Background()
+	req := validRequest()
+
+	// 12:00 UTC is already the next day on Kiritimati
+	id, err := s.DB.InsertProperty(ctx, models.Property{Name: "Island Lodge", Slug: "island-lodge", TimeZone: "Pacific/Kiritimati", Currency: "AUD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.DB.MoveRoom(ctx, 2, id); err != nil {
+		t.Fatal(err)
+	}
+
+	var tableTest = []struct {
+		name       string
+		propertyID int
+		expected   []int
+	}{
+		{"every property", 0, []int{1, 2}},
+		{"first property", 1, []int{1}},
+		{"island lodge", id, []int{2}},
+	}
+
+	for _, e := range tableTest {
+		search, err := s.SearchRooms(ctx, e.propertyID, req.StartDate, req.EndDate)
+		if err != nil {
+			t.Errorf("case - %s: %v", e.name, err)
+			continue
+		}
+		var got []int
+		for _, room := range search.Rooms {
+			got = append(got, room.ID)
+		}
+		if len(got) != len(e.expected) {
+			t.Errorf("case - %s: expected rooms %v but got %v", e.name, e.expected, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != e.expected[i] {
+				t.Errorf("case - %s: expected rooms %v but got %v", e.name, e.expected, got)
+			}
+		}
+	}
+
+	quote, err := s.QuoteStay(ctx, 2, req.StartDate, req.EndDate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quote.Property.ID != id || quote.Property.Currency != "AUD" {
+		t.Errorf("expected the quote of room 2 to be in the currency of its property but got %+v", quote.Property)
+	}
+
+	today := dates.Of(now)
+	if _, err = s.QuoteStay(ctx, 1, today, today.AddDays(2)); err != nil {
+		t.Errorf("expected an arrival today to be allowed at the first property but got %v", err)
+	}
+	_, err = s.QuoteStay(ctx, 2, today, today.AddDays(2))
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) || invalid.Fields["start"] == "" {
+		t.Errorf("expected the arrival to be in the past at the island lodge but got %v", err)
+	}
+
+	req.RoomID = 2
+	req.StartDate, req.EndDate = today, today.AddDays(2)
+	_, err = s.CreateReservation(ctx, req)
+	if !errors.As(err, &invalid) || invalid.Fields["start_date"] == "" {
+		t.Errorf("expected a reservation arriving in the past at the island lodge to be refused but got %v", err)
+	}
+}
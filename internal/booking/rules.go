@@ -0,0 +1,85 @@
+package booking
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/adewidyatamadb/GoBookings/internal/dates"
+	"github.com/adewidyatamadb/GoBookings/internal/models"
+)
+
+// ruleProblem is a booking rule a stay does not meet, under the field of the date it is about
+type ruleProblem struct {
+	field   string
+	message string
+}
+
+// plural returns n with noun, made plural unless n is 1
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// checkRules returns the problems of a stay in room from start to end booked on today with every rule of rules
+// that applies to it, the fields are startField and endField
+func checkRules(rules []models.BookingRule, room models.Room, start, end, today dates.Date, startField, endField string) []ruleProblem {
+	var problems []ruleProblem
+	nights := start.DaysUntil(end)
+	notice := today.DaysUntil(start)
+
+	for _, rule := range rules {
+		if !rule.Applies(room, start) {
+			continue
+		}
+
+		add := func(field, format string, args ...interface{}) {
+			problems = append(problems, ruleProblem{
+				field:   field,
+				message: fmt.Sprintf(format, args...) + fmt.Sprintf(" (%s)", rule.Name),
+			})
+		}
+
+		if rule.MinNights > 0 && nights < rule.MinNights {
+			add(endField, "The stay must be at least %s", plural(rule.MinNights, "night"))
+		}
+		if rule.MaxNights > 0 && nights > rule.MaxNights {
+			add(endField, "The stay cannot be longer than %s", plural(rule.MaxNights, "night"))
+		}
+		if rule.MinNotice > 0 && notice < rule.MinNotice {
+			add(startField, "Book at least %s before arrival", plural(rule.MinNotice, "day"))
+		}
+		if rule.MaxAdvance > 0 && notice > rule.MaxAdvance {
+			add(startField, "Arrivals can be booked at most %s ahead", plural(rule.MaxAdvance, "day"))
+		}
+		if !rule.ArrivalDays.Has(start.Weekday()) {
+			add(startField, "Arrivals are on %s only", rule.ArrivalDays)
+		}
+		if !rule.DepartureDays.Has(end.Weekday()) {
+			add(endField, "Departures are on %s only", rule.DepartureDays)
+		}
+	}
+
+	return problems
+}
+
+// messages returns the messages of problems
+func messages(problems []ruleProblem) []string {
+	var list []string
+	for _, p := range problems {
+		list = append(list, p.message)
+	}
+	return list
+}
+
+// ruleReasons returns why the booking rules do not allow a stay in room from start to end booked on today, none
+// when they do
+func (s *Service) ruleReasons(ctx context.Context, room models.Room, start, end, today dates.Date) ([]string, error) {
+	rules, err := s.DB.AllBookingRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return messages(checkRules(rules, room, start, end, today, "start", "end")), nil
+}
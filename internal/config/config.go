@@ -3,11 +3,26 @@ package config
 import (
 	"html/template"
 	"log"
+	"net"
+	"time"
 
+	"github.com/adewidyatamadb/GoBookings/internal/dates"
+	"github.com/adewidyatamadb/GoBookings/internal/events"
 	"github.com/adewidyatamadb/GoBookings/internal/models"
+	"github.com/adewidyatamadb/GoBookings/internal/ratelimit"
+	"github.com/adewidyatamadb/GoBookings/internal/scheduler"
+	"github.com/adewidyatamadb/GoBookings/internal/throttle"
 	"github.com/alexedwards/scs/v2"
 )
 
+// Default formats of dates, the ones the site used before they were configurable
+const (
+	DefaultDateFormat      = "02-Jan-2006"
+	DefaultDateInputFormat = "02-01-2006"
+	// DefaultDatePickerFormat is DefaultDateInputFormat for the date picker
+	DefaultDatePickerFormat = "dd-mm-yyyy"
+)
+
 // AppConfig holds the application config
 type AppConfig struct {
 	UseCache      bool
@@ -17,4 +32,102 @@ type AppConfig struct {
 	InProduction  bool
 	Session       *scs.SessionManager
 	MailChan      chan models.MailData
+	QueryTimeout  time.Duration
+	BaseURL       string
+	Secret        []byte
+	LoginAccounts *throttle.Limiter
+	LoginIPs      *throttle.Limiter
+	// TwoFactorLevel is the access level from which staff must use two-factor authentication, 0 keeps it optional
+	TwoFactorLevel int
+	// PersistentSessions is set when sessions are kept in the database and can be listed per user
+	PersistentSessions bool
+	// TrustedProxies are the proxies whose X-Forwarded-For header is believed when looking up client IP addresses
+	TrustedProxies []*net.IPNet
+	// SearchLimit and BookingLimit rate limit the public availability and booking endpoints per client IP, nil disables them
+	SearchLimit  *ratelimit.Limiter
+	BookingLimit *ratelimit.Limiter
+	// VerifyBookings holds reservations for HoldTTL until the guest follows the link emailed to confirm the address
+	VerifyBookings bool
+	HoldTTL        time.Duration
+	// PreArrivalDays, CheckOutReminder and PostStayDays schedule the guest emails: arrival instructions up to
+	// PreArrivalDays before arrival, a reminder on the day of departure and a thank you PostStayDays after it,
+	// 0 and false turn them off. ReviewURL is linked from the thank you when set
+	PreArrivalDays   int
+	CheckOutReminder bool
+	PostStayDays     int
+	ReviewURL        string
+	// Scheduler runs the background jobs, nil when none are running
+	Scheduler *scheduler.Scheduler
+	// Events passes the events published by the handlers to the mail, audit, webhook and metrics subscribers,
+	// EventCounter is the metrics subscriber
+	Events       *events.Bus
+	EventCounter *events.Counter
+	// Location is the time zone of the jobs and of the properties without their own, which decides what day it is, nil is UTC
+	Location *time.Location
+	// DateFormat is how dates are shown, DateInputFormat how they are typed into forms, which accept ISO 8601
+	// dates too, and DatePickerFormat is DateInputFormat for the date picker. Empty formats are the defaults
+	DateFormat       string
+	DateInputFormat  string
+	DatePickerFormat string
+}
+
+// Now returns the current time in the time zone of the application
+func (a *AppConfig) Now() time.Time {
+	if a.Location == nil {
+		return time.Now().UTC()
+	}
+	return time.Now().In(a.Location)
+}
+
+// Today returns the current day in the time zone of the application
+func (a *AppConfig) Today() dates.Date {
+	return dates.Of(a.Now())
+}
+
+// TimeAt returns t on the clock of property p, in the time zone of the application when p has none. Time zones
+// are checked when properties are saved, an unknown one falls back the same way
+func (a *AppConfig) TimeAt(p models.Property, t time.Time) time.Time {
+	loc, err := p.Location()
+	if err != nil || loc == nil {
+		loc = a.Location
+	}
+	if loc == nil {
+		return t.UTC()
+	}
+	return t.In(loc)
+}
+
+// NowAt returns the current time in the time zone of property p
+func (a *AppConfig) NowAt(p models.Property) time.Time {
+	return a.TimeAt(p, time.Now())
+}
+
+// TodayAt returns the current day at property p
+func (a *AppConfig) TodayAt(p models.Property) dates.Date {
+	return dates.Of(a.NowAt(p))
+}
+
+// FormatDate shows d the way the property writes dates
+func (a *AppConfig) FormatDate(d dates.Date) string {
+	if a.DateFormat == "" {
+		return d.Format(DefaultDateFormat)
+	}
+	return d.Format(a.DateFormat)
+}
+
+// InputDate writes d the way it is typed into forms
+func (a *AppConfig) InputDate(d dates.Date) string {
+	return d.Format(a.dateInputFormat())
+}
+
+// ParseDate reads a date typed into a form, in the input format or as an ISO 8601 date
+func (a *AppConfig) ParseDate(value string) (dates.Date, error) {
+	return dates.Parse(value, a.dateInputFormat())
+}
+
+func (a *AppConfig) dateInputFormat() string {
+	if a.DateInputFormat == "" {
+		return DefaultDateInputFormat
+	}
+	return a.DateInputFormat
 }
@@ -0,0 +1,240 @@
+// Package dates has the calendar day type of stays. A Date has no time of day and no time zone, so the night of
+// the 19th is the same night wherever the server runs, and "today" is always asked for in the time zone of the
+// property.
+package dates
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ISO is the ISO 8601 layout of a date, which the JSON API uses and every date input accepts
+const ISO = "2006-01-02"
+
+// ErrInvalid is returned for a value that is not a date in any of the accepted layouts
+var ErrInvalid = errors.New("invalid date")
+
+// Date is a calendar day, kept as midnight UTC. The zero value is January 1, year 1
+type Date struct {
+	t time.Time
+}
+
+// New returns the date of year, month and day, normalizing them like time.Date does
+func New(year int, month time.Month, day int) Date {
+	return Date{time.Date(year, month, day, 0, 0, 0, 0, time.UTC)}
+}
+
+// Of returns the day t falls on in the location of t
+func Of(t time.Time) Date {
+	return New(t.Date())
+}
+
+// Today returns the current day in loc, a nil loc is UTC
+func Today(loc *time.Location) Date {
+	if loc == nil {
+		loc = time.UTC
+	}
+	return Of(time.Now().In(loc))
+}
+
+// Parse parses value with the first of layouts that fits, or as an ISO date when none does
+func Parse(value string, layouts ...string) (Date, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range layouts {
+		t, err := time.Parse(layout, value)
+		if err == nil {
+			return Of(t), nil
+		}
+	}
+	if t, err := time.Parse(ISO, value); err == nil {
+		return Of(t), nil
+	}
+	return Date{}, fmt.Errorf("%w %q", ErrInvalid, value)
+}
+
+// Time returns midnight UTC of d
+func (d Date) Time() time.Time {
+	return d.t
+}
+
+// In returns midnight of d in loc
+func (d Date) In(loc *time.Location) time.Time {
+	return time.Date(d.t.Year(), d.t.Month(), d.t.Day(), 0, 0, 0, 0, loc)
+}
+
+// IsZero reports whether d is the zero date
+func (d Date) IsZero() bool {
+	return d.t.IsZero()
+}
+
+// Year returns the year of d
+func (d Date) Year() int {
+	return d.t.Year()
+}
+
+// Month returns the month of d
+func (d Date) Month() time.Month {
+	return d.t.Month()
+}
+
+// Day returns the day of the month of d
+func (d Date) Day() int {
+	return d.t.Day()
+}
+
+// Weekday returns the day of the week of d
+func (d Date) Weekday() time.Weekday {
+	return d.t.Weekday()
+}
+
+// AddDays returns the date n days after d, or before it for a negative n
+func (d Date) AddDays(n int) Date {
+	return Date{d.t.AddDate(0, 0, n)}
+}
+
+// AddDate returns d plus years, months and days, normalizing it like time.Time.AddDate does
+func (d Date) AddDate(years, months, days int) Date {
+	return Date{d.t.AddDate(years, months, days)}
+}
+
+// DaysUntil returns the number of days from d to e, the number of nights of a stay from d to e
+func (d Date) DaysUntil(e Date) int {
+	return int(e.t.Sub(d.t).Hours() / 24)
+}
+
+// Before reports whether d is before e
+func (d Date) Before(e Date) bool {
+	return d.t.Before(e.t)
+}
+
+// After reports whether d is after e
+func (d Date) After(e Date) bool {
+	return d.t.After(e.t)
+}
+
+// Equal reports whether d and e are the same day
+func (d Date) Equal(e Date) bool {
+	return d.t.Equal(e.t)
+}
+
+// Format formats d with a time.Time layout, the time of day in it is midnight UTC
+func (d Date) Format(layout string) string {
+	return d.t.Format(layout)
+}
+
+// String returns d as an ISO date
+func (d Date) String() string {
+	return d.t.Format(ISO)
+}
+
+// MarshalText returns d as an ISO date, which is how dates are written to JSON and sessions
+func (d Date) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText reads an ISO date
+func (d *Date) UnmarshalText(text []byte) error {
+	t, err := time.Parse(ISO, string(text))
+	if err != nil {
+		return fmt.Errorf("%w %q, use %s", ErrInvalid, text, ISO)
+	}
+	*d = Of(t)
+	return nil
+}
+
+// MarshalBinary returns d as an ISO date for gob, which sessions are encoded with
+func (d Date) MarshalBinary() ([]byte, error) {
+	return d.MarshalText()
+}
+
+// UnmarshalBinary reads a date encoded by MarshalBinary
+func (d *Date) UnmarshalBinary(data []byte) error {
+	return d.UnmarshalText(data)
+}
+
+// Scan reads a date column, which the drivers return as a time or as text
+func (d *Date) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case time.Time:
+		*d = Of(v)
+		return nil
+	case string:
+		return d.scanText(v)
+	case []byte:
+		return d.scanText(string(v))
+	case nil:
+		*d = Date{}
+		return nil
+	}
+	return fmt.Errorf("cannot scan %T into a date", src)
+}
+
+func (d *Date) scanText(s string) error {
+	// the date comes first in every layout the drivers use
+	if len(s) < len(ISO) {
+		return fmt.Errorf("%w %q", ErrInvalid, s)
+	}
+	return d.UnmarshalText([]byte(s[:len(ISO)]))
+}
+
+// Value writes d to a date column as midnight UTC
+func (d Date) Value() (driver.Value, error) {
+	return d.t, nil
+}
+
+// pickerTokens are the parts of a time.Time layout that the date picker of the site has an equivalent for
+var pickerTokens = []struct{ layout, picker string }{
+	{"2006", "yyyy"},
+	{"January", "MM"},
+	{"Jan", "M"},
+	{"01", "mm"},
+	{"02", "dd"},
+	{"06", "yy"},
+	{"1", "m"},
+	{"2", "d"},
+}
+
+// PickerFormat translates the layout of a date input to the format of the date picker on the site, layouts with
+// anything but a day, month and year separated by punctuation or spaces are refused
+func PickerFormat(layout string) (string, error) {
+	var b strings.Builder
+	var day, month, year bool
+
+	for rest := layout; rest != ""; {
+		matched := false
+		for _, tok := range pickerTokens {
+			if strings.HasPrefix(rest, tok.layout) {
+				b.WriteString(tok.picker)
+				rest = rest[len(tok.layout):]
+				switch tok.layout {
+				case "02", "2":
+					day = true
+				case "2006", "06":
+					year = true
+				default:
+					month = true
+				}
+				matched = true
+				break
+			}
+		}
+		if matched {
+			continue
+		}
+
+		c := rest[0]
+		if strings.IndexByte("-/. ,", c) < 0 {
+			return "", fmt.Errorf("date layout %q: only day, month, year and separators are allowed", layout)
+		}
+		b.WriteByte(c)
+		rest = rest[1:]
+	}
+
+	if !day || !month || !year {
+		return "", fmt.Errorf("date layout %q needs a day, a month and a year", layout)
+	}
+	return b.String(), nil
+}
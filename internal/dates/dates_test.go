@@ -0,0 +1,178 @@
+package dates
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	var tableTest = []struct {
+		name     string
+		value    string
+		layouts  []string
+		expected Date
+		valid    bool
+	}{
+		{"layout", "19-10-2021", []string{"02-01-2006"}, New(2021, 10, 19), true},
+		{"iso", "2021-10-19", []string{"02-01-2006"}, New(2021, 10, 19), true},
+		{"iso without layouts", " 2021-10-19 ", nil, New(2021, 10, 19), true},
+		{"second layout", "10/19/2021", []string{"02-01-2006", "01/02/2006"}, New(2021, 10, 19), true},
+		{"invalid day", "31-02-2021", []string{"02-01-2006"}, Date{}, false},
+		{"not a date", "tomorrow", []string{"02-01-2006"}, Date{}, false},
+		{"empty", "", nil, Date{}, false},
+	}
+
+	for _, e := range tableTest {
+		d, err := Parse(e.value, e.layouts...)
+		if e.valid && err != nil {
+			t.Errorf("case - %s: unexpected error %v", e.name, err)
+		}
+		if !e.valid && !errors.Is(err, ErrInvalid) {
+			t.Errorf("case - %s: expected ErrInvalid but got %v", e.name, err)
+		}
+		if !d.Equal(e.expected) {
+			t.Errorf("case - %s: expected %s but got %s", e.name, e.expected, d)
+		}
+	}
+}
+
+func TestParse_KeepsLayouts(t *testing.T) {
+	layouts := make([]string, 1, 2)
+	layouts[0] = "02-01-2006"
+	spare := layouts[:2]
+	spare[1] = "01/02/2006"
+
+	_, _ = Parse("not a date", layouts...)
+
+	if spare[1] != "01/02/2006" {
+		t.Errorf("expected the spare capacity of the layouts to be left alone but got %q", spare[1])
+	}
+}
+
+func TestOf(t *testing.T) {
+	tokyo := time.FixedZone("Tokyo", 9*60*60)
+	newYork := time.FixedZone("New York", -4*60*60)
+	instant := time.Date(2021, 10, 19, 23, 30, 0, 0, time.UTC)
+
+	if d := Of(instant.In(tokyo)); !d.Equal(New(2021, 10, 20)) {
+		t.Errorf("expected the 20th in Tokyo but got %s", d)
+	}
+	if d := Of(instant.In(newYork)); !d.Equal(New(2021, 10, 19)) {
+		t.Errorf("expected the 19th in New York but got %s", d)
+	}
+	if got := New(2021, 10, 19).In(tokyo); !got.Equal(time.Date(2021, 10, 19, 0, 0, 0, 0, tokyo)) {
+		t.Errorf("expected midnight in Tokyo but got %v", got)
+	}
+}
+
+func TestDate_Arithmetic(t *testing.T) {
+	d := New(2021, 10, 30)
+
+	if got := d.AddDays(3); !got.Equal(New(2021, 11, 2)) {
+		t.Errorf("expected 2021-11-02 but got %s", got)
+	}
+	if got := d.AddDate(0, 1, 0); got.String() != "2021-11-30" {
+		t.Errorf("expected 2021-11-30 but got %s", got)
+	}
+	// the clocks change on the 31st in Europe, which must not turn a night into 23 or 25 hours
+	if n := d.DaysUntil(New(2021, 11, 2)); n != 3 {
+		t.Errorf("expected 3 nights but got %d", n)
+	}
+	if !d.Before(d.AddDays(1)) || !d.After(d.AddDays(-1)) || d.Before(d) {
+		t.Error("wrong ordering of dates")
+	}
+	if d.Weekday() != time.Saturday {
+		t.Errorf("expected a saturday but got %s", d.Weekday())
+	}
+}
+
+func TestDate_Encoding(t *testing.T) {
+	type stay struct {
+		Start Date `json:"start"`
+	}
+	d := New(2021, 10, 19)
+
+	out, err := json.Marshal(stay{d})
+	if err != nil || string(out) != `{"start":"2021-10-19"}` {
+		t.Errorf("unexpected json %s, %v", out, err)
+	}
+
+	var in stay
+	if err := json.Unmarshal([]byte(`{"start":"2021-10-19"}`), &in); err != nil || !in.Start.Equal(d) {
+		t.Errorf("unexpected date %s, %v", in.Start, err)
+	}
+	if err := json.Unmarshal([]byte(`{"start":"19-10-2021"}`), &in); !errors.Is(err, ErrInvalid) {
+		t.Errorf("expected ErrInvalid but got %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(stay{d}); err != nil {
+		t.Fatal(err)
+	}
+	var decoded stay
+	if err := gob.NewDecoder(&buf).Decode(&decoded); err != nil || !decoded.Start.Equal(d) {
+		t.Errorf("unexpected gob date %s, %v", decoded.Start, err)
+	}
+}
+
+func TestDate_Scan(t *testing.T) {
+	var tableTest = []struct {
+		name     string
+		src      interface{}
+		expected Date
+		valid    bool
+	}{
+		{"time", time.Date(2021, 10, 19, 0, 0, 0, 0, time.UTC), New(2021, 10, 19), true},
+		{"text", "2021-10-19 00:00:00+00:00", New(2021, 10, 19), true},
+		{"bytes", []byte("2021-10-19"), New(2021, 10, 19), true},
+		{"null", nil, Date{}, true},
+		{"short", "2021", Date{}, false},
+		{"number", 20211019, Date{}, false},
+	}
+
+	for _, e := range tableTest {
+		var d Date
+		err := d.Scan(e.src)
+		if e.valid != (err == nil) {
+			t.Errorf("case - %s: unexpected error %v", e.name, err)
+		}
+		if !d.Equal(e.expected) {
+			t.Errorf("case - %s: expected %s but got %s", e.name, e.expected, d)
+		}
+	}
+
+	v, _ := New(2021, 10, 19).Value()
+	if v != time.Date(2021, 10, 19, 0, 0, 0, 0, time.UTC) {
+		t.Errorf("expected midnight UTC but got %v", v)
+	}
+}
+
+func TestPickerFormat(t *testing.T) {
+	var tableTest = []struct {
+		layout   string
+		expected string
+		valid    bool
+	}{
+		{"02-01-2006", "dd-mm-yyyy", true},
+		{"01/02/2006", "mm/dd/yyyy", true},
+		{"2006-01-02", "yyyy-mm-dd", true},
+		{"2 Jan 2006", "d M yyyy", true},
+		{"January 2, 2006", "MM d, yyyy", true},
+		{"02-01", "", false},
+		{"02-01-2006 15:04", "", false},
+	}
+
+	for _, e := range tableTest {
+		got, err := PickerFormat(e.layout)
+		if e.valid != (err == nil) {
+			t.Errorf("case - %s: unexpected error %v", e.layout, err)
+		}
+		if got != e.expected {
+			t.Errorf("case - %s: expected %q but got %q", e.layout, e.expected, got)
+		}
+	}
+}
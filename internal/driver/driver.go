@@ -9,9 +9,16 @@ import (
 	_ "github.com/jackc/pgx/v4/stdlib"
 )
 
+// Supported database drivers
+const (
+	Postgres = "postgres"
+	SQLite   = "sqlite"
+)
+
 //DB holds the database connection pool
 type DB struct {
-	SQL *sql.DB
+	SQL    *sql.DB
+	Driver string
 }
 
 var dbConn = &DB{}
@@ -32,6 +39,7 @@ func ConnectSQL(dsn string) (*DB, error) {
 	d.SetConnMaxLifetime(maxDBLifetime)
 
 	dbConn.SQL = d
+	dbConn.Driver = Postgres
 
 	err = testDB(d)
 	if err != nil {
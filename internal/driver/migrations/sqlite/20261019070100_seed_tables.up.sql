@@ -0,0 +1,10 @@
+insert into rooms (room_name, created_at, updated_at) values
+  ('General''s Quarters', '2021-08-07 00:00:00', '2021-08-08 00:00:00'),
+  ('Major''s Suite', '2021-08-08 00:00:00', '2021-08-08 00:00:00');
+
+insert into restrictions (restriction_name, created_at, updated_at) values
+  ('Reservation', '2020-11-18 00:00:00', '2020-11-18 00:00:00'),
+  ('Owner Block', '2020-11-19 00:00:00', '2020-11-19 00:00:00');
+
+insert into users (first_name, last_name, email, password, access_level, created_at, updated_at) values
+  ('Admin', 'Fortnight', 'admin@admin.com', '$2a$12$vpUqEp802ZW9SwjS6wtBzOq.ICo7aSmzXOl82.XmfMEobCYN/xWMS', 3, '2021-11-11 00:00:00', '2021-11-11 00:00:00');
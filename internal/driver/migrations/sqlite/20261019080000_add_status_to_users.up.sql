@@ -0,0 +1,2 @@
+alter table users add column active boolean not null default 1;
+alter table users add column must_change_password boolean not null default 0;
@@ -0,0 +1 @@
+alter table users add column session_version integer not null default 0;
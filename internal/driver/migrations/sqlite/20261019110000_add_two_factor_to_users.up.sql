@@ -0,0 +1,13 @@
+alter table users add column totp_secret varchar(255) not null default '';
+alter table users add column totp_enabled boolean not null default 0;
+
+create table if not exists recovery_codes (
+  id integer primary key autoincrement,
+  user_id integer not null references users (id) on delete cascade on update cascade,
+  code_hash varchar(255) not null,
+  used_at datetime,
+  created_at datetime not null,
+  updated_at datetime not null
+);
+
+create index if not exists recovery_codes_user_id_idx on recovery_codes (user_id);
@@ -0,0 +1,15 @@
+create table if not exists sessions (
+  id integer primary key autoincrement,
+  token varchar(255) not null,
+  data blob not null,
+  expiry datetime not null,
+  user_id integer,
+  ip varchar(255) not null default '',
+  user_agent varchar(255) not null default '',
+  created_at datetime not null,
+  updated_at datetime not null
+);
+
+create unique index if not exists sessions_token_idx on sessions (token);
+create index if not exists sessions_expiry_idx on sessions (expiry);
+create index if not exists sessions_user_id_idx on sessions (user_id);
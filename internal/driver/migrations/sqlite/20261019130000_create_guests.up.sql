@@ -0,0 +1,17 @@
+create table if not exists guests (
+  id integer primary key autoincrement,
+  first_name varchar(255) not null default '',
+  last_name varchar(255) not null default '',
+  email varchar(255) not null,
+  phone varchar(255) not null default '',
+  password varchar(60) not null,
+  email_verified boolean not null default 0,
+  created_at datetime not null,
+  updated_at datetime not null
+);
+
+create unique index if not exists guests_email_idx on guests (email);
+
+alter table reservations add column guest_id integer references guests (id) on delete set null on update cascade;
+
+create index if not exists reservations_guest_id_idx on reservations (guest_id);
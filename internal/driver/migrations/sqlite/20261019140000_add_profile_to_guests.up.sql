@@ -0,0 +1,24 @@
+alter table guests add column phone_key varchar(255) not null default '';
+alter table guests add column notes text not null default '';
+alter table guests add column tags varchar(255) not null default '';
+
+create index if not exists guests_phone_key_idx on guests (phone_key);
+
+update guests set phone_key = replace(replace(replace(replace(replace(replace(phone, ' ', ''), '-', ''), '(', ''), ')', ''), '.', ''), '+', '');
+
+-- one profile per email address for the reservations made before guests were kept, named after the latest one
+insert into guests (first_name, last_name, email, phone, phone_key, password, email_verified, created_at, updated_at)
+select r.first_name, r.last_name, lower(trim(r.email)), r.phone,
+  replace(replace(replace(replace(replace(replace(r.phone, ' ', ''), '-', ''), '(', ''), ')', ''), '.', ''), '+', ''),
+  '', 0, datetime('now'), datetime('now')
+from reservations r
+where r.guest_id is null
+  and lower(trim(r.email)) not in (select email from guests)
+  and r.id = (
+    select r2.id from reservations r2
+    where lower(trim(r2.email)) = lower(trim(r.email))
+    order by r2.start_date desc, r2.id desc limit 1
+  );
+
+update reservations set guest_id = (select g.id from guests g where g.email = lower(trim(reservations.email)))
+where guest_id is null;
@@ -0,0 +1,3 @@
+alter table reservations add column hold_expires_at datetime;
+
+create index if not exists reservations_hold_expires_at_idx on reservations (hold_expires_at);
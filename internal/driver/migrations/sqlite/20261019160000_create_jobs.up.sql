@@ -0,0 +1,18 @@
+create table if not exists job_locks (
+  name varchar(255) primary key,
+  owner varchar(255) not null,
+  scheduled_for datetime not null,
+  locked_until datetime not null
+);
+
+create table if not exists job_runs (
+  id integer primary key autoincrement,
+  name varchar(255) not null,
+  owner varchar(255) not null,
+  scheduled_for datetime not null,
+  started_at datetime not null,
+  finished_at datetime not null,
+  error text not null default ''
+);
+
+create index if not exists job_runs_name_started_at_idx on job_runs (name, started_at);
@@ -0,0 +1,10 @@
+create table if not exists guest_mails (
+  id integer primary key autoincrement,
+  reservation_id integer not null references reservations (id) on delete cascade on update cascade,
+  kind varchar(255) not null,
+  email varchar(255) not null,
+  subject varchar(255) not null,
+  sent_at datetime not null
+);
+
+create unique index if not exists guest_mails_reservation_id_kind_idx on guest_mails (reservation_id, kind);
@@ -0,0 +1,26 @@
+create table if not exists webhooks (
+  id integer primary key autoincrement,
+  url varchar(255) not null,
+  secret varchar(255) not null,
+  events text not null default '',
+  active boolean not null default true,
+  created_at datetime not null,
+  updated_at datetime not null
+);
+
+create table if not exists webhook_deliveries (
+  id integer primary key autoincrement,
+  webhook_id integer not null references webhooks (id) on delete cascade on update cascade,
+  event varchar(255) not null,
+  payload text not null,
+  status varchar(255) not null default 'pending',
+  attempts integer not null default 0,
+  response_code integer not null default 0,
+  error text not null default '',
+  next_attempt_at datetime not null,
+  delivered_at datetime,
+  created_at datetime not null
+);
+
+create index if not exists webhook_deliveries_status_next_attempt_at_idx on webhook_deliveries (status, next_attempt_at);
+create index if not exists webhook_deliveries_webhook_id_created_at_idx on webhook_deliveries (webhook_id, created_at);
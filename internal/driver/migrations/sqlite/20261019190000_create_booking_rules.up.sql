@@ -0,0 +1,17 @@
+create table if not exists booking_rules (
+  id integer primary key autoincrement,
+  name varchar(255) not null,
+  room_id integer references rooms (id) on delete cascade on update cascade,
+  start_date date,
+  end_date date,
+  min_nights integer not null default 0,
+  max_nights integer not null default 0,
+  min_notice integer not null default 0,
+  max_advance integer not null default 0,
+  arrival_days integer not null default 0,
+  departure_days integer not null default 0,
+  created_at datetime not null,
+  updated_at datetime not null
+);
+
+create index if not exists booking_rules_room_id_idx on booking_rules (room_id);
@@ -0,0 +1,34 @@
+create table if not exists properties (
+  id integer primary key autoincrement,
+  name varchar(255) not null,
+  slug varchar(255) not null,
+  host varchar(255) not null default '',
+  time_zone varchar(255) not null default '',
+  currency varchar(255) not null default '',
+  mail_from varchar(255) not null default '',
+  owner_email varchar(255) not null default '',
+  description text not null default '',
+  created_at datetime not null,
+  updated_at datetime not null
+);
+
+create unique index if not exists properties_slug_idx on properties (slug);
+create unique index if not exists properties_host_idx on properties (host) where host <> '';
+
+insert into properties (name, slug, currency, mail_from, owner_email, description, created_at, updated_at) values
+  ('Fort Smythe Bed and Breakfast', 'fort-smythe', 'USD', 'fort@smythe.com', 'me@here.com', 'Your home away from home, set on the majestic waters of the Atlantic Ocean, this will be a vacation to remember.', '2026-10-19 00:00:00', '2026-10-19 00:00:00');
+
+alter table rooms add column property_id integer not null default 1;
+
+create index if not exists rooms_property_id_idx on rooms (property_id);
+
+create table if not exists user_properties (
+  id integer primary key autoincrement,
+  user_id integer not null references users (id) on delete cascade on update cascade,
+  property_id integer not null references properties (id) on delete cascade on update cascade,
+  created_at datetime not null,
+  updated_at datetime not null
+);
+
+create unique index if not exists user_properties_user_id_property_id_idx on user_properties (user_id, property_id);
+create index if not exists user_properties_property_id_idx on user_properties (property_id);
@@ -0,0 +1 @@
+alter table users add column totp_counter integer not null default 0;
@@ -0,0 +1 @@
+alter table guests add column pending_password varchar(60) not null default '';
@@ -0,0 +1,7 @@
+alter table booking_rules add column property_id integer not null default 1;
+
+create index if not exists booking_rules_property_id_idx on booking_rules (property_id);
+
+-- the rules of a room have the property of the room
+update booking_rules set property_id = (select rm.property_id from rooms rm where rm.id = booking_rules.room_id)
+where room_id is not null;
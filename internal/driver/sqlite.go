@@ -0,0 +1,99 @@
+package driver
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+//go:embed migrations/sqlite/*.sql
+var sqliteMigrations embed.FS
+
+// ConnectSQLite opens the sqlite database at path and brings its schema up to date
+func ConnectSQLite(path string) (*DB, error) {
+	dsn := fmt.Sprintf("file:%s?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", path)
+
+	d, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// sqlite allows a single writer, so a single connection avoids SQLITE_BUSY errors
+	d.SetMaxOpenConns(1)
+	d.SetConnMaxLifetime(maxDBLifetime)
+
+	err = testDB(d)
+	if err != nil {
+		return nil, err
+	}
+
+	err = migrateSQLite(d)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DB{SQL: d, Driver: SQLite}, nil
+}
+
+// migrateSQLite applies the embedded sqlite migrations that have not been run yet
+func migrateSQLite(d *sql.DB) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := d.ExecContext(ctx, `create table if not exists schema_migration (version varchar(14) primary key)`)
+	if err != nil {
+		return err
+	}
+
+	files, err := fs.Glob(sqliteMigrations, "migrations/sqlite/*.up.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		version := strings.SplitN(file[len("migrations/sqlite/"):], "_", 2)[0]
+
+		var applied int
+		err = d.QueryRowContext(ctx, `select count(*) from schema_migration where version = ?`, version).Scan(&applied)
+		if err != nil {
+			return err
+		}
+		if applied > 0 {
+			continue
+		}
+
+		stmts, err := sqliteMigrations.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		tx, err := d.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+
+		if _, err = tx.ExecContext(ctx, string(stmts)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %s: %w", file, err)
+		}
+
+		if _, err = tx.ExecContext(ctx, `insert into schema_migration (version) values (?)`, version); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
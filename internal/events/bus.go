@@ -0,0 +1,66 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// Handler reacts to an event, it is called for every event and ignores the ones it is not interested in
+type Handler func(ctx context.Context, e Event) error
+
+type subscriber struct {
+	name   string
+	handle Handler
+}
+
+// Bus hands every published event to its subscribers in the order they subscribed. Publishing waits for the
+// subscribers, so they must be quick and pass slow work on, as the mail channel and the webhook queue do
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers []subscriber
+	errorLog    *log.Logger
+}
+
+// New returns a bus without subscribers that logs the errors of subscribers to errorLog
+func New(errorLog *log.Logger) *Bus {
+	return &Bus{errorLog: errorLog}
+}
+
+// Subscribe adds h under name, the name is used in the log when it fails
+func (b *Bus) Subscribe(name string, h Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.subscribers = append(b.subscribers, subscriber{name: name, handle: h})
+}
+
+// Publish hands e to every subscriber, a subscriber that fails or panics is logged and does not keep e from
+// the others. Publishing to a nil bus does nothing
+func (b *Bus) Publish(ctx context.Context, e Event) {
+	if b == nil {
+		return
+	}
+
+	b.mu.RLock()
+	subscribers := b.subscribers
+	b.mu.RUnlock()
+
+	for _, s := range subscribers {
+		if err := b.deliver(ctx, s, e); err != nil {
+			b.errorLog.Printf("%s subscriber failed on %s: %v", s.name, e.Name(), err)
+		}
+	}
+}
+
+// deliver calls s with e and turns a panic into an error
+func (b *Bus) deliver(ctx context.Context, s subscriber, e Event) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return s.handle(ctx, e)
+}
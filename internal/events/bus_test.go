@@ -0,0 +1,45 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestBus_Publish(t *testing.T) {
+	var out bytes.Buffer
+	b := New(log.New(&out, "", 0))
+
+	var calls []string
+	b.Subscribe("first", func(ctx context.Context, e Event) error {
+		calls = append(calls, "first")
+		return errors.New("mail server down")
+	})
+	b.Subscribe("second", func(ctx context.Context, e Event) error {
+		calls = append(calls, "second")
+		panic("boom")
+	})
+	b.Subscribe("third", func(ctx context.Context, e Event) error {
+		calls = append(calls, "third")
+		return nil
+	})
+
+	b.Publish(context.Background(), BlockAdded{RoomID: 1})
+
+	if strings.Join(calls, ",") != "first,second,third" {
+		t.Errorf("expected every subscriber to be called in order but got %v", calls)
+	}
+	for _, expected := range []string{"first subscriber failed on block.created: mail server down", "second subscriber failed on block.created: panic: boom"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected the log to contain %q but got %q", expected, out.String())
+		}
+	}
+}
+
+func TestBus_PublishNil(t *testing.T) {
+	var b *Bus
+	b.Publish(context.Background(), BlockAdded{RoomID: 1})
+}
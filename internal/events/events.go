@@ -0,0 +1,101 @@
+// Package events passes the things that happen to reservations and blocks from the code that makes them happen
+// to the subscribers that react to them, such as the emails, the audit log, webhooks and metrics.
+package events
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/adewidyatamadb/GoBookings/internal/dates"
+	"github.com/adewidyatamadb/GoBookings/internal/models"
+)
+
+// Event is something that happened, Name is the same as the webhook event name
+type Event interface {
+	Name() string
+	Metadata() Meta
+}
+
+// Meta is what every event records besides its data
+type Meta struct {
+	// At is when it happened
+	At time.Time
+	// UserID is the staff user who did it, 0 for guests and background jobs
+	UserID int
+}
+
+// Metadata returns m, events get it by embedding Meta
+func (m Meta) Metadata() Meta {
+	return m
+}
+
+// ReservationHeld is published when a reservation is held until the guest confirms the email address
+type ReservationHeld struct {
+	Meta
+	Reservation models.Reservation
+}
+
+// ReservationCreated is published when a reservation is confirmed, either when it is made or when the guest
+// confirms a held one
+type ReservationCreated struct {
+	Meta
+	Reservation models.Reservation
+}
+
+// ReservationUpdated is published when staff change the guest details of a reservation
+type ReservationUpdated struct {
+	Meta
+	Reservation models.Reservation
+}
+
+// ReservationProcessed is published when staff mark a reservation as processed
+type ReservationProcessed struct {
+	Meta
+	Reservation models.Reservation
+}
+
+// ReservationCancelled is published when a reservation is deleted, Reservation is how it was before
+type ReservationCancelled struct {
+	Meta
+	Reservation models.Reservation
+}
+
+// BlockAdded is published when a room is blocked for a night
+type BlockAdded struct {
+	Meta
+	RoomID int
+	Date   dates.Date
+}
+
+// Name returns "reservation.held"
+func (e ReservationHeld) Name() string { return "reservation.held" }
+
+// Name returns models.EventReservationCreated
+func (e ReservationCreated) Name() string { return models.EventReservationCreated }
+
+// Name returns models.EventReservationUpdated
+func (e ReservationUpdated) Name() string { return models.EventReservationUpdated }
+
+// Name returns models.EventReservationProcessed
+func (e ReservationProcessed) Name() string { return models.EventReservationProcessed }
+
+// Name returns models.EventReservationCancelled
+func (e ReservationCancelled) Name() string { return models.EventReservationCancelled }
+
+// Name returns models.EventBlockCreated
+func (e BlockAdded) Name() string { return models.EventBlockCreated }
+
+func (e ReservationHeld) String() string      { return reservationString(e.Reservation) }
+func (e ReservationCreated) String() string   { return reservationString(e.Reservation) }
+func (e ReservationUpdated) String() string   { return reservationString(e.Reservation) }
+func (e ReservationProcessed) String() string { return reservationString(e.Reservation) }
+func (e ReservationCancelled) String() string { return reservationString(e.Reservation) }
+
+func (e BlockAdded) String() string {
+	return fmt.Sprintf("room %d on %s", e.RoomID, e.Date)
+}
+
+// reservationString describes a reservation in the audit log by its ids, without the details of the guest
+func reservationString(res models.Reservation) string {
+	return fmt.Sprintf("reservation %d of room %d", res.ID, res.RoomID)
+}
@@ -0,0 +1,69 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// AuditLog returns a subscriber that writes every event with who caused it to l. Events describe themselves
+// by the ids of what they are about, an event that does not is logged by its name only, so guest details never
+// end up in the log
+func AuditLog(l *log.Logger) Handler {
+	return func(ctx context.Context, e Event) error {
+		by := "by a guest"
+		if id := e.Metadata().UserID; id != 0 {
+			by = fmt.Sprintf("by user %d", id)
+		}
+		if s, ok := e.(fmt.Stringer); ok {
+			l.Printf("AUDIT %s: %s %s", e.Name(), s, by)
+		} else {
+			l.Printf("AUDIT %s: %s", e.Name(), by)
+		}
+		return nil
+	}
+}
+
+// Counter counts the events published since it was created
+type Counter struct {
+	mu     sync.Mutex
+	since  time.Time
+	counts map[string]int
+}
+
+// NewCounter returns a counter that starts at now
+func NewCounter(now time.Time) *Counter {
+	return &Counter{since: now, counts: make(map[string]int)}
+}
+
+// Handle is the subscriber that counts e
+func (c *Counter) Handle(ctx context.Context, e Event) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.counts[e.Name()]++
+	return nil
+}
+
+// EventCount is the number of events of one name
+type EventCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// Counts returns when the counter started and the count of every event published since, sorted by name
+func (c *Counter) Counts() (time.Time, []EventCount) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	counts := make([]EventCount, 0, len(c.counts))
+	for name, n := range c.counts {
+		counts = append(counts, EventCount{Name: name, Count: n})
+	}
+	sort.Slice(counts, func(i, j int) bool { return counts[i].Name < counts[j].Name })
+
+	return c.since, counts
+}
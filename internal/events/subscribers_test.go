@@ -0,0 +1,76 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adewidyatamadb/GoBookings/internal/dates"
+	"github.com/adewidyatamadb/GoBookings/internal/models"
+)
+
+// undescribed is an event without a String method
+type undescribed struct {
+	Meta
+	Reservation models.Reservation
+}
+
+func (e undescribed) Name() string { return "test.undescribed" }
+
+func TestAuditLog(t *testing.T) {
+	day := dates.New(2021, 10, 19)
+	res := models.Reservation{ID: 7, RoomID: 1, StartDate: day, EndDate: day.AddDays(2), FirstName: "John", LastName: "Smith",
+		Email: "john@smith.com", Phone: "555-555-5555"}
+
+	var tableTest = []struct {
+		name     string
+		event    Event
+		expected string
+	}{
+		{"guest", ReservationCreated{Reservation: res}, "AUDIT reservation.created: reservation 7 of room 1 by a guest"},
+		{"staff", ReservationCancelled{Meta: Meta{UserID: 3}, Reservation: res}, "AUDIT reservation.cancelled: reservation 7 of room 1 by user 3"},
+		{"without description", undescribed{Reservation: res}, "AUDIT test.undescribed: by a guest"},
+		{"block", BlockAdded{Meta: Meta{UserID: 1}, RoomID: 2, Date: day}, "AUDIT block.created: room 2 on 2021-10-19 by user 1"},
+	}
+
+	for _, test := range tableTest {
+		var out bytes.Buffer
+		_ = AuditLog(log.New(&out, "", 0))(context.Background(), test.event)
+
+		if strings.TrimSpace(out.String()) != test.expected {
+			t.Errorf("case - %s: expected %q but got %q", test.name, test.expected, out.String())
+		}
+		for _, detail := range []string{"John", "Smith", "john@smith.com", "555"} {
+			if strings.Contains(out.String(), detail) {
+				t.Errorf("case - %s: expected no guest details in the audit log but found %s", test.name, detail)
+			}
+		}
+	}
+}
+
+func TestCounter(t *testing.T) {
+	start := time.Date(2021, 10, 19, 14, 0, 0, 0, time.UTC)
+	c := NewCounter(start)
+
+	for _, e := range []Event{ReservationCreated{}, BlockAdded{}, ReservationCreated{}} {
+		_ = c.Handle(context.Background(), e)
+	}
+
+	since, counts := c.Counts()
+	if !since.Equal(start) {
+		t.Errorf("expected the counts since %v but got %v", start, since)
+	}
+	expected := []EventCount{{models.EventBlockCreated, 1}, {models.EventReservationCreated, 2}}
+	if len(counts) != len(expected) {
+		t.Fatalf("expected %v but got %v", expected, counts)
+	}
+	for i := range expected {
+		if counts[i] != expected[i] {
+			t.Errorf("expected %v but got %v", expected, counts)
+			break
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/url"
 	"strings"
+	"unicode"
 
 	"github.com/asaskevich/govalidator"
 )
@@ -60,3 +61,38 @@ func (f *Form) IsEmail(field string) {
 		f.Errors.Add(field, "Invalid email address")
 	}
 }
+
+// Matches checks that field holds the same value as other, e.g. a password confirmation
+func (f *Form) Matches(field, other string) {
+	if f.Get(field) != f.Get(other) {
+		f.Errors.Add(field, "This field does not match")
+	}
+}
+
+// MinPasswordLength is the shortest password accepted by IsPassword
+const MinPasswordLength = 10
+
+// IsPassword checks a new password against the password policy, it has to be
+// long enough, mix letters with digits and must not contain the email address
+func (f *Form) IsPassword(field, email string) {
+	x := f.Get(field)
+
+	var letters, digits bool
+	for _, r := range x {
+		switch {
+		case unicode.IsLetter(r):
+			letters = true
+		case unicode.IsDigit(r):
+			digits = true
+		}
+	}
+
+	switch {
+	case len(x) < MinPasswordLength:
+		f.Errors.Add(field, fmt.Sprintf("The password must be at least %d characters long", MinPasswordLength))
+	case !letters || !digits:
+		f.Errors.Add(field, "The password must contain both letters and digits")
+	case email != "" && strings.Contains(strings.ToLower(x), strings.ToLower(email)):
+		f.Errors.Add(field, "The password must not contain your email address")
+	}
+}
@@ -134,3 +134,54 @@ func TestForm_IsEmail(t *testing.T) {
 		}
 	}
 }
+
+func TestForm_Matches(t *testing.T) {
+	var tableTest = []struct {
+		name         string
+		value        string
+		confirmation string
+		valid        bool
+	}{
+		{"matching", "secret", "secret", true},
+		{"different", "secret", "Secret", false},
+		{"missing confirmation", "secret", "", false},
+	}
+
+	for _, test := range tableTest {
+		data := url.Values{}
+		data.Add("password", test.value)
+		data.Add("confirm_password", test.confirmation)
+		form := New(data)
+		form.Matches("confirm_password", "password")
+
+		if form.Valid() != test.valid {
+			t.Errorf("case - %s: test return %v, wanted %v", test.name, form.Valid(), test.valid)
+		}
+	}
+}
+
+func TestForm_IsPassword(t *testing.T) {
+	var tableTest = []struct {
+		name     string
+		password string
+		valid    bool
+	}{
+		{"valid", "correct horse 42", true},
+		{"too short", "abc123", false},
+		{"letters only", "correcthorsebattery", false},
+		{"digits only", "12345678901", false},
+		{"contains email", "jane@here.com2026", false},
+		{"contains email in other case", "JANE@here.com2026", false},
+	}
+
+	for _, test := range tableTest {
+		data := url.Values{}
+		data.Add("password", test.password)
+		form := New(data)
+		form.IsPassword("password", "jane@here.com")
+
+		if form.Valid() != test.valid {
+			t.Errorf("case - %s: test return %v, wanted %v", test.name, form.Valid(), test.valid)
+		}
+	}
+}
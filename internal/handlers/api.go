@@ -0,0 +1,417 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/adewidyatamadb/GoBookings/internal/booking"
+	"github.com/adewidyatamadb/GoBookings/internal/dates"
+	"github.com/adewidyatamadb/GoBookings/internal/models"
+	"github.com/adewidyatamadb/GoBookings/internal/repository"
+	"github.com/go-chi/chi/v5"
+)
+
+// maxAPIBody is the largest request body the JSON API reads
+const maxAPIBody = 1 << 16
+
+// apiRoom is a room in the JSON API
+type apiRoom struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// apiProperty is the property of a room in the JSON API
+type apiProperty struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Currency string `json:"currency"`
+}
+
+// apiExcludedRoom is a free room the booking rules do not allow, with the reasons why
+type apiExcludedRoom struct {
+	apiRoom
+	Reasons []string `json:"reasons"`
+}
+
+// apiReservation is a reservation in the JSON API
+type apiReservation struct {
+	ID        int     `json:"id"`
+	Room      apiRoom `json:"room"`
+	StartDate string  `json:"start_date"`
+	EndDate   string  `json:"end_date"`
+	FirstName string  `json:"first_name"`
+	LastName  string  `json:"last_name"`
+	Email     string  `json:"email"`
+	Phone     string  `json:"phone"`
+	Processed bool    `json:"processed"`
+	// HoldUntil is set while the reservation waits for the guest to confirm the email address
+	HoldUntil *time.Time `json:"hold_until,omitempty"`
+}
+
+func newAPIReservation(res models.Reservation) apiReservation {
+	a := apiReservation{
+		ID:        res.ID,
+		Room:      apiRoom{ID: res.RoomID, Name: res.Room.RoomName},
+		StartDate: res.StartDate.String(),
+		EndDate:   res.EndDate.String(),
+		FirstName: res.FirstName,
+		LastName:  res.LastName,
+		Email:     res.Email,
+		Phone:     res.Phone,
+		Processed: res.Processed == 1,
+	}
+	if res.Pending() {
+		a.HoldUntil = &res.HoldUntil
+	}
+	return a
+}
+
+// apiError is the response of a failed API request, Errors lists the invalid fields
+type apiError struct {
+	OK      bool              `json:"ok"`
+	Message string            `json:"message"`
+	Errors  map[string]string `json:"errors,omitempty"`
+}
+
+// writeJSON sends v as the JSON response with status
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	out, _ := json.MarshalIndent(v, "", "     ")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(out)
+}
+
+// writeAPIError sends the response for err, validation errors list the invalid fields
+func (m *Repository) writeAPIError(w http.ResponseWriter, err error) {
+	var invalid *booking.ValidationError
+	if errors.As(err, &invalid) {
+		writeJSON(w, http.StatusUnprocessableEntity, apiError{Message: "Invalid request", Errors: invalid.Fields})
+		return
+	}
+
+	status := statusForError(err)
+	message := http.StatusText(status)
+	switch status {
+	case http.StatusNotFound:
+		message = "Not found"
+	case http.StatusConflict:
+		message = "The room is not available for these dates"
+	case http.StatusInternalServerError:
+		// the cause stays in the log
+		m.App.ErrorLog.Println(err)
+	}
+	writeJSON(w, status, apiError{Message: message})
+}
+
+// decodeAPIRequest reads the JSON body of r into v, it only accepts JSON so that forms on other sites cannot
+// post to the API
+func decodeAPIRequest(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		writeJSON(w, http.StatusUnsupportedMediaType, apiError{Message: "Send the request as application/json"})
+		return false
+	}
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		writeJSON(w, http.StatusBadRequest, apiError{Message: fmt.Sprintf("Invalid JSON: %v", err)})
+		return false
+	}
+	return true
+}
+
+// apiDates reads the start and end query parameters, invalid dates are added to problems
+func apiDates(r *http.Request, problems map[string]string) (dates.Date, dates.Date) {
+	var start, end dates.Date
+	parseAPIDate(r.URL.Query().Get("start"), "start", &start, problems)
+	parseAPIDate(r.URL.Query().Get("end"), "end", &end, problems)
+	return start, end
+}
+
+// parseAPIDate parses the ISO 8601 date value into *d, an invalid date is added to problems under field
+func parseAPIDate(value, field string, d *dates.Date, problems map[string]string) {
+	var err error
+	*d, err = dates.Parse(value)
+	if err != nil {
+		problems[field] = "Use an ISO 8601 date like 2021-10-19"
+	}
+}
+
+// APIQuote tells whether a room is free for the dates in the start and end query parameters
+func (m *Repository) APIQuote(w http.ResponseWriter, r *http.Request) {
+	roomID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, apiError{Message: "Not found"})
+		return
+	}
+
+	problems := make(map[string]string)
+	start, end := apiDates(r, problems)
+	if len(problems) > 0 {
+		m.writeAPIError(w, &booking.ValidationError{Fields: problems})
+		return
+	}
+
+	quote, err := m.Booking.QuoteStay(r.Context(), roomID, start, end)
+	if err != nil {
+		m.writeAPIError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		OK        bool        `json:"ok"`
+		Room      apiRoom     `json:"room"`
+		Property  apiProperty `json:"property"`
+		StartDate string      `json:"start_date"`
+		EndDate   string      `json:"end_date"`
+		Nights    int         `json:"nights"`
+		Available bool        `json:"available"`
+		Reasons   []string    `json:"reasons"`
+	}{
+		OK:        true,
+		Room:      apiRoom{ID: quote.Room.ID, Name: quote.Room.RoomName},
+		Property:  apiProperty{ID: quote.Property.ID, Name: quote.Property.Name, Currency: quote.Property.Currency},
+		StartDate: quote.StartDate.String(),
+		EndDate:   quote.EndDate.String(),
+		Nights:    quote.Nights,
+		Available: quote.Available,
+		Reasons:   append([]string{}, quote.Reasons...),
+	})
+}
+
+// APIAvailability lists the rooms free for the dates in the start and end query parameters
+func (m *Repository) APIAvailability(w http.ResponseWriter, r *http.Request) {
+	problems := make(map[string]string)
+	start, end := apiDates(r, problems)
+	if len(problems) > 0 {
+		m.writeAPIError(w, &booking.ValidationError{Fields: problems})
+		return
+	}
+
+	p, err := m.requestProperty(r)
+	if err != nil {
+		m.writeAPIError(w, err)
+		return
+	}
+
+	search, err := m.Booking.SearchRooms(r.Context(), p.ID, start, end)
+	if err != nil {
+		m.writeAPIError(w, err)
+		return
+	}
+
+	resp := struct {
+		OK       bool              `json:"ok"`
+		Rooms    []apiRoom         `json:"rooms"`
+		Excluded []apiExcludedRoom `json:"excluded"`
+	}{OK: true, Rooms: []apiRoom{}, Excluded: []apiExcludedRoom{}}
+	for _, room := range search.Rooms {
+		resp.Rooms = append(resp.Rooms, apiRoom{ID: room.ID, Name: room.RoomName})
+	}
+	for _, e := range search.Excluded {
+		resp.Excluded = append(resp.Excluded, apiExcludedRoom{
+			apiRoom: apiRoom{ID: e.Room.ID, Name: e.Room.RoomName},
+			Reasons: e.Reasons,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// apiReservationRequest is the body of APICreateReservation and, without the room and dates, of
+// AdminAPIModifyReservation
+type apiReservationRequest struct {
+	RoomID    int    `json:"room_id"`
+	StartDate string `json:"start_date"`
+	EndDate   string `json:"end_date"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Email     string `json:"email"`
+	Phone     string `json:"phone"`
+}
+
+// APICreateReservation reserves a room, it is held like a reservation made on the site when bookings are verified
+func (m *Repository) APICreateReservation(w http.ResponseWriter, r *http.Request) {
+	var body apiReservationRequest
+	if !decodeAPIRequest(w, r, &body) {
+		return
+	}
+
+	req := booking.NewReservation{
+		RoomID:    body.RoomID,
+		FirstName: body.FirstName,
+		LastName:  body.LastName,
+		Email:     body.Email,
+		Phone:     body.Phone,
+	}
+	problems := make(map[string]string)
+	parseAPIDate(body.StartDate, "start_date", &req.StartDate, problems)
+	parseAPIDate(body.EndDate, "end_date", &req.EndDate, problems)
+	if len(problems) > 0 {
+		m.writeAPIError(w, &booking.ValidationError{Fields: problems})
+		return
+	}
+
+	res, err := m.Booking.CreateReservation(r.Context(), req)
+	if err != nil {
+		m.writeAPIError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, struct {
+		OK          bool           `json:"ok"`
+		Reservation apiReservation `json:"reservation"`
+	}{true, newAPIReservation(res)})
+}
+
+// writeAPIReservation sends res as the response of the admin API
+func writeAPIReservation(w http.ResponseWriter, res models.Reservation) {
+	writeJSON(w, http.StatusOK, struct {
+		OK          bool           `json:"ok"`
+		Reservation apiReservation `json:"reservation"`
+	}{true, newAPIReservation(res)})
+}
+
+// apiInStaffScope reports whether reservation id is in a room of a property the logged in user manages, and
+// answers as if it did not exist otherwise
+func (m *Repository) apiInStaffScope(w http.ResponseWriter, r *http.Request, id int) bool {
+	ok, err := m.inStaffScope(r, id)
+	if err == nil && !ok {
+		err = repository.ErrNotFound
+	}
+	if err != nil {
+		m.writeAPIError(w, err)
+		return false
+	}
+	return true
+}
+
+// AdminAPIReservation sends a reservation
+func (m *Repository) AdminAPIReservation(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	if !m.apiInStaffScope(w, r, id) {
+		return
+	}
+
+	res, err := m.DB.GetReservationByID(r.Context(), id)
+	if err != nil {
+		m.writeAPIError(w, err)
+		return
+	}
+
+	writeAPIReservation(w, res)
+}
+
+// AdminAPIModifyReservation changes the guest details of a reservation
+func (m *Repository) AdminAPIModifyReservation(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+
+	var body apiReservationRequest
+	if !decodeAPIRequest(w, r, &body) {
+		return
+	}
+	if !m.apiInStaffScope(w, r, id) {
+		return
+	}
+
+	res, err := m.Booking.ModifyReservation(r.Context(), id, booking.Changes{
+		FirstName: body.FirstName,
+		LastName:  body.LastName,
+		Email:     body.Email,
+		Phone:     body.Phone,
+	}, m.App.Session.GetInt(r.Context(), "user_id"))
+	if err != nil {
+		m.writeAPIError(w, err)
+		return
+	}
+
+	writeAPIReservation(w, res)
+}
+
+// AdminAPIProcessReservation marks a reservation as processed
+func (m *Repository) AdminAPIProcessReservation(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	if !m.apiInStaffScope(w, r, id) {
+		return
+	}
+
+	res, err := m.Booking.ProcessReservation(r.Context(), id, m.App.Session.GetInt(r.Context(), "user_id"))
+	if err != nil {
+		m.writeAPIError(w, err)
+		return
+	}
+
+	writeAPIReservation(w, res)
+}
+
+// AdminAPICancelReservation deletes a reservation and sends it as it was
+func (m *Repository) AdminAPICancelReservation(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	if !m.apiInStaffScope(w, r, id) {
+		return
+	}
+
+	res, err := m.Booking.CancelReservation(r.Context(), id, m.App.Session.GetInt(r.Context(), "user_id"))
+	if err != nil {
+		m.writeAPIError(w, err)
+		return
+	}
+
+	writeAPIReservation(w, res)
+}
+
+// AdminAPISetBlocks adds and removes blocks, nights that are reserved are not blocked and counted in the response
+func (m *Repository) AdminAPISetBlocks(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Add []struct {
+			RoomID int    `json:"room_id"`
+			Date   string `json:"date"`
+		} `json:"add"`
+		Remove []int `json:"remove"`
+	}
+	if !decodeAPIRequest(w, r, &body) {
+		return
+	}
+
+	scope, err := m.staffScope(r)
+	if err != nil {
+		m.writeAPIError(w, err)
+		return
+	}
+
+	changes := booking.BlockChanges{Remove: body.Remove}
+	problems := make(map[string]string)
+	if !scope.all && len(body.Remove) > 0 {
+		// blocks are removed by id, which does not tell the property
+		problems["remove"] = "Remove the blocks of your rooms on the reservations calendar"
+	}
+	for i, b := range body.Add {
+		block := booking.Block{RoomID: b.RoomID}
+		if !scope.Has(b.RoomID) {
+			problems[fmt.Sprintf("add[%d].room_id", i)] = "Choose a room of a property you manage"
+		}
+		parseAPIDate(b.Date, fmt.Sprintf("add[%d].date", i), &block.Date, problems)
+		changes.Add = append(changes.Add, block)
+	}
+	if len(problems) > 0 {
+		m.writeAPIError(w, &booking.ValidationError{Fields: problems})
+		return
+	}
+
+	reserved, err := m.Booking.SetBlocks(r.Context(), changes, m.App.Session.GetInt(r.Context(), "user_id"))
+	if err != nil {
+		m.writeAPIError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		OK       bool `json:"ok"`
+		Reserved int  `json:"reserved"`
+	}{true, reserved})
+}
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// apiRequest returns a request of staff user 1 with body sent as contentType and the chi url param id
+func apiRequest(method, target, id, contentType, body string) *http.Request {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+
+	ctx := getCTX(r)
+	session.Put(ctx, "user_id", 1)
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", id)
+
+	return r.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+}
+
+func TestRepository_APIQuote(t *testing.T) {
+	var tableTest = []struct {
+		name               string
+		id                 string
+		query              string
+		failing            string
+		expectedStatusCode int
+		expectedAvailable  bool
+	}{
+		{"available", "1", "start=2050-01-01&end=2050-01-03", "", http.StatusOK, true},
+		{"unavailable", "2", "start=2050-01-01&end=2050-01-03", "", http.StatusOK, false},
+		{"invalid dates", "1", "start=01-01-2050&end=2050-01-03", "", http.StatusUnprocessableEntity, false},
+		{"unknown room", "5", "start=2050-01-01&end=2050-01-03", "", http.StatusNotFound, false},
+		{"invalid room", "x", "start=2050-01-01&end=2050-01-03", "", http.StatusNotFound, false},
+		{"database error", "1", "start=2050-01-01&end=2050-01-03", "SearchAvailabilityByDatesByRoomID", http.StatusInternalServerError, false},
+	}
+	defer resetTestDB()
+
+	for _, e := range tableTest {
+		testDB.failOn(e.failing)
+		w := httptest.NewRecorder()
+		r := apiRequest("GET", "/api/v1/rooms/"+e.id+"/quote?"+e.query, e.id, "", "")
+
+		handler := http.HandlerFunc(Repo.APIQuote)
+		handler.ServeHTTP(w, r)
+
+		if w.Code != e.expectedStatusCode {
+			t.Errorf("case - %s: expected code %d but got %d", e.name, e.expectedStatusCode, w.Code)
+			continue
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+
+		var resp struct {
+			OK        bool `json:"ok"`
+			Nights    int  `json:"nights"`
+			Available bool `json:"available"`
+			Property  struct {
+				ID       int    `json:"id"`
+				Currency string `json:"currency"`
+			} `json:"property"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("case - %s: cannot parse json: %v", e.name, err)
+		}
+		if !resp.OK || resp.Nights != 2 || resp.Available != e.expectedAvailable || resp.Property.ID != 1 || resp.Property.Currency != "USD" {
+			t.Errorf("case - %s: unexpected quote %+v", e.name, resp)
+		}
+	}
+}
+
+func TestRepository_APIAvailability(t *testing.T) {
+	var tableTest = []struct {
+		name               string
+		query              string
+		expectedStatusCode int
+	}{
+		{"valid", "start=2050-03-01&end=2050-03-03", http.StatusOK},
+		{"arrival in the past", "start=2020-03-01&end=2020-03-03", http.StatusUnprocessableEntity},
+		{"missing end", "start=2050-01-01", http.StatusUnprocessableEntity},
+		{"excluded by a booking rule", "start=2050-07-04&end=2050-07-06", http.StatusOK},
+	}
+
+	for _, e := range tableTest {
+		w := httptest.NewRecorder()
+		r := apiRequest("GET", "/api/v1/availability?"+e.query, "", "", "")
+
+		handler := http.HandlerFunc(Repo.APIAvailability)
+		handler.ServeHTTP(w, r)
+
+		if w.Code != e.expectedStatusCode {
+			t.Errorf("case - %s: expected code %d but got %d", e.name, e.expectedStatusCode, w.Code)
+		}
+		if w.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("case - %s: expected a json response", e.name)
+		}
+	}
+}
+
+func TestRepository_APICreateReservation(t *testing.T) {
+	var tableTest = []struct {
+		name               string
+		contentType        string
+		body               string
+		expectedStatusCode int
+		expectedField      string
+	}{
+		{"valid", "application/json", `{"room_id": 1, "start_date": "2050-01-01", "end_date": "2050-01-03", "first_name": "John", "last_name": "Smith", "email": "john@smith.com"}`, http.StatusCreated, ""},
+		{"not json", "application/x-www-form-urlencoded", `room_id=1`, http.StatusUnsupportedMediaType, ""},
+		{"broken json", "application/json", `{"room_id": 1`, http.StatusBadRequest, ""},
+		{"unknown field", "application/json", `{"room": 1}`, http.StatusBadRequest, ""},
+		{"invalid date", "application/json", `{"room_id": 1, "start_date": "01-01-2050", "end_date": "2050-01-03"}`, http.StatusUnprocessableEntity, "start_date"},
+		{"booking rule", "application/json", `{"room_id": 1, "start_date": "2050-07-04", "end_date": "2050-07-06", "first_name": "John", "last_name": "Smith", "email": "john@smith.com"}`, http.StatusUnprocessableEntity, "end_date"},
+		{"invalid email", "application/json", `{"room_id": 1, "start_date": "2050-01-01", "end_date": "2050-01-03", "first_name": "John", "last_name": "Smith", "email": "john"}`, http.StatusUnprocessableEntity, "email"},
+		{"unknown room", "application/json", `{"room_id": 5, "start_date": "2050-01-01", "end_date": "2050-01-03", "first_name": "John", "last_name": "Smith", "email": "john@smith.com"}`, http.StatusNotFound, ""},
+		{"unavailable", "application/json", `{"room_id": 2, "start_date": "2050-01-01", "end_date": "2050-01-03", "first_name": "John", "last_name": "Smith", "email": "john@smith.com"}`, http.StatusConflict, ""},
+	}
+
+	defer resetTestDB()
+
+	for _, e := range tableTest {
+		w := httptest.NewRecorder()
+		r := apiRequest("POST", "/api/v1/reservations", "", e.contentType, e.body)
+
+		handler := http.HandlerFunc(Repo.APICreateReservation)
+		handler.ServeHTTP(w, r)
+
+		if w.Code != e.expectedStatusCode {
+			t.Errorf("case - %s: expected code %d but got %d: %s", e.name, e.expectedStatusCode, w.Code, w.Body.String())
+			continue
+		}
+
+		if e.expectedField != "" {
+			var resp apiError
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("case - %s: cannot parse json: %v", e.name, err)
+			}
+			if resp.Errors[e.expectedField] == "" {
+				t.Errorf("case - %s: expected a problem with %s but got %v", e.name, e.expectedField, resp.Errors)
+			}
+		}
+	}
+}
+
+func TestRepository_AdminAPIReservation(t *testing.T) {
+	var tableTest = []struct {
+		name               string
+		method             string
+		id                 string
+		body               string
+		handler            http.HandlerFunc
+		expectedStatusCode int
+	}{
+		{"get", "GET", "1", "", Repo.AdminAPIReservation, http.StatusOK},
+		{"get unknown", "GET", "100", "", Repo.AdminAPIReservation, http.StatusNotFound},
+		{"modify", "PUT", "1", `{"first_name": "Jane", "last_name": "Smith", "email": "jane@smith.com"}`, Repo.AdminAPIModifyReservation, http.StatusOK},
+		{"modify invalid", "PUT", "1", `{"first_name": "Jane"}`, Repo.AdminAPIModifyReservation, http.StatusUnprocessableEntity},
+		{"modify invalid email", "PUT", "1", `{"first_name": "Jane", "last_name": "Smith", "email": "jane@"}`, Repo.AdminAPIModifyReservation, http.StatusUnprocessableEntity},
+		{"modify unknown", "PUT", "100", `{"first_name": "Jane", "last_name": "Smith", "email": "jane@smith.com"}`, Repo.AdminAPIModifyReservation, http.StatusNotFound},
+		{"process", "POST", "1", "", Repo.AdminAPIProcessReservation, http.StatusOK},
+		{"process unknown", "POST", "100", "", Repo.AdminAPIProcessReservation, http.StatusNotFound},
+		{"cancel", "DELETE", "1", "", Repo.AdminAPICancelReservation, http.StatusOK},
+		{"cancel unknown", "DELETE", "100", "", Repo.AdminAPICancelReservation, http.StatusNotFound},
+	}
+
+	defer resetTestDB()
+
+	for _, e := range tableTest {
+		w := httptest.NewRecorder()
+		r := apiRequest(e.method, "/admin/api/reservations/"+e.id, e.id, "application/json", e.body)
+
+		e.handler.ServeHTTP(w, r)
+
+		if w.Code != e.expectedStatusCode {
+			t.Errorf("case - %s: expected code %d but got %d: %s", e.name, e.expectedStatusCode, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestRepository_AdminAPISetBlocks(t *testing.T) {
+	var tableTest = []struct {
+		name               string
+		body               string
+		expectedStatusCode int
+	}{
+		{"valid", `{"add": [{"room_id": 1, "date": "2050-01-01"}], "remove": [12]}`, http.StatusOK},
+		{"invalid date", `{"add": [{"room_id": 1, "date": "tomorrow"}]}`, http.StatusUnprocessableEntity},
+	}
+
+	defer resetTestDB()
+
+	for _, e := range tableTest {
+		w := httptest.NewRecorder()
+		r := apiRequest("POST", "/admin/api/blocks", "", "application/json", e.body)
+
+		handler := http.HandlerFunc(Repo.AdminAPISetBlocks)
+		handler.ServeHTTP(w, r)
+
+		if w.Code != e.expectedStatusCode {
+			t.Errorf("case - %s: expected code %d but got %d: %s", e.name, e.expectedStatusCode, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adewidyatamadb/GoBookings/internal/dates"
+	"github.com/adewidyatamadb/GoBookings/internal/forms"
+	"github.com/adewidyatamadb/GoBookings/internal/helpers"
+	"github.com/adewidyatamadb/GoBookings/internal/models"
+	"github.com/adewidyatamadb/GoBookings/internal/render"
+	"github.com/adewidyatamadb/GoBookings/internal/repository"
+	"github.com/go-chi/chi/v5"
+)
+
+// bookingRuleForm validates the posted booking rule form and copies it into rule, a rule of a room is for the
+// property of the room
+func (m *Repository) bookingRuleForm(r *http.Request, rule *models.BookingRule) (*forms.Form, error) {
+	form := forms.New(r.PostForm)
+	form.Required("name")
+
+	rule.Name = strings.TrimSpace(r.Form.Get("name"))
+	rule.PropertyID, _ = strconv.Atoi(r.Form.Get("property_id"))
+	rule.RoomID, _ = strconv.Atoi(r.Form.Get("room_id"))
+
+	if rule.RoomID != 0 {
+		rooms, err := m.DB.GetAllRooms(r.Context())
+		if err != nil {
+			return form, err
+		}
+		found := false
+		for _, room := range rooms {
+			if room.ID != rule.RoomID {
+				continue
+			}
+			found = true
+			if rule.PropertyID == 0 {
+				rule.PropertyID = room.PropertyID
+			} else if rule.PropertyID != room.PropertyID {
+				form.Errors.Add("room_id", "Choose a room of the property")
+			}
+		}
+		if !found {
+			form.Errors.Add("room_id", "Choose a room of the property")
+		}
+	} else {
+		properties, err := m.Properties(r.Context())
+		if err != nil {
+			return form, err
+		}
+		found := false
+		for _, p := range properties {
+			found = found || p.ID == rule.PropertyID
+		}
+		if !found {
+			form.Errors.Add("property_id", "Choose the property of the rule")
+		}
+	}
+
+	for field, d := range map[string]*dates.Date{"start": &rule.Start, "end": &rule.End} {
+		*d = dates.Date{}
+		value := strings.TrimSpace(r.Form.Get(field))
+		if value == "" {
+			continue
+		}
+		parsed, err := m.App.ParseDate(value)
+		if err != nil {
+			p, err := m.cachedProperty(r.Context(), rule.PropertyID)
+			if err != nil {
+				return form, err
+			}
+			form.Errors.Add(field, "Enter a date like "+m.App.InputDate(m.App.TodayAt(p)))
+			continue
+		}
+		*d = parsed
+	}
+	if !rule.Start.IsZero() && !rule.End.IsZero() && rule.End.Before(rule.Start) {
+		form.Errors.Add("end", "The season cannot end before it starts")
+	}
+
+	for field, n := range map[string]*int{
+		"min_nights":  &rule.MinNights,
+		"max_nights":  &rule.MaxNights,
+		"min_notice":  &rule.MinNotice,
+		"max_advance": &rule.MaxAdvance,
+	} {
+		*n = 0
+		value := strings.TrimSpace(r.Form.Get(field))
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			form.Errors.Add(field, "Enter a number of 0 or more, 0 is no limit")
+			continue
+		}
+		*n = parsed
+	}
+	if rule.MaxNights > 0 && rule.MaxNights < rule.MinNights {
+		form.Errors.Add("max_nights", "The maximum stay cannot be shorter than the minimum stay")
+	}
+	if rule.MaxAdvance > 0 && rule.MaxAdvance < rule.MinNotice {
+		form.Errors.Add("max_advance", "The booking horizon cannot be shorter than the notice")
+	}
+
+	rule.ArrivalDays = postedWeekdays(r.Form["arrival_days"])
+	rule.DepartureDays = postedWeekdays(r.Form["departure_days"])
+
+	return form, nil
+}
+
+// postedWeekdays returns the set of the posted day numbers, 0 for Sunday
+func postedWeekdays(values []string) models.Weekdays {
+	var days []time.Weekday
+	for _, v := range values {
+		d, err := strconv.Atoi(v)
+		if err == nil && d >= int(time.Sunday) && d <= int(time.Saturday) {
+			days = append(days, time.Weekday(d))
+		}
+	}
+	return models.WeekdaysOf(days...)
+}
+
+// renderBookingRuleForm renders the page to create or edit a booking rule, a new rule is for the first property
+func (m *Repository) renderBookingRuleForm(w http.ResponseWriter, r *http.Request, rule models.BookingRule, form *forms.Form) {
+	rooms, err := m.DB.GetAllRooms(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	properties, err := m.Properties(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	if rule.PropertyID == 0 && len(properties) > 0 {
+		rule.PropertyID = properties[0].ID
+	}
+
+	data := make(map[string]interface{})
+	data["rule"] = rule
+	data["rooms"] = rooms
+	data["properties"] = properties
+	data["weekdays"] = models.AllWeekdays
+
+	render.Template(w, r, "admin-booking-rule.page.html", &models.TemplateData{
+		Data: data,
+		Form: form,
+	})
+}
+
+// AdminBookingRules lists the booking rules with the names of their properties
+func (m *Repository) AdminBookingRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := m.DB.AllBookingRules(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	properties, err := m.Properties(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	names := make(map[int]string, len(properties))
+	for _, p := range properties {
+		names[p.ID] = p.Name
+	}
+
+	data := make(map[string]interface{})
+	data["rules"] = rules
+	data["property_names"] = names
+
+	render.Template(w, r, "admin-booking-rules.page.html", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminNewBookingRule shows the form to add a booking rule
+func (m *Repository) AdminNewBookingRule(w http.ResponseWriter, r *http.Request) {
+	m.renderBookingRuleForm(w, r, models.BookingRule{}, forms.New(nil))
+}
+
+// AdminPostNewBookingRule adds a booking rule
+func (m *Repository) AdminPostNewBookingRule(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	var rule models.BookingRule
+	form, err := m.bookingRuleForm(r, &rule)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	if !form.Valid() {
+		m.renderBookingRuleForm(w, r, rule, form)
+		return
+	}
+
+	_, err = m.DB.InsertBookingRule(r.Context(), rule)
+	if errors.Is(err, repository.ErrConstraint) {
+		form.Errors.Add("room_id", "Choose a room of the property")
+		m.renderBookingRuleForm(w, r, rule, form)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Booking rule added")
+	http.Redirect(w, r, "/admin/booking-rules", http.StatusSeeOther)
+}
+
+// AdminShowBookingRule shows the form to edit a booking rule
+func (m *Repository) AdminShowBookingRule(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+
+	rule, err := m.DB.GetBookingRuleByID(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.renderBookingRuleForm(w, r, rule, forms.New(nil))
+}
+
+// AdminPostShowBookingRule updates a booking rule
+func (m *Repository) AdminPostShowBookingRule(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+
+	rule, err := m.DB.GetBookingRuleByID(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form, err := m.bookingRuleForm(r, &rule)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	if !form.Valid() {
+		m.renderBookingRuleForm(w, r, rule, form)
+		return
+	}
+
+	err = m.DB.UpdateBookingRule(r.Context(), rule)
+	if errors.Is(err, repository.ErrNotFound) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	} else if errors.Is(err, repository.ErrConstraint) {
+		form.Errors.Add("room_id", "Choose a room of the property")
+		m.renderBookingRuleForm(w, r, rule, form)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Changes saved")
+	http.Redirect(w, r, fmt.Sprintf("/admin/booking-rules/%d", id), http.StatusSeeOther)
+}
+
+// AdminDeleteBookingRule deletes a booking rule
+func (m *Repository) AdminDeleteBookingRule(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+
+	err := m.DB.DeleteBookingRule(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		m.App.Session.Put(r.Context(), "error", "Booking rule not found")
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	} else {
+		m.App.Session.Put(r.Context(), "flash", "Booking rule deleted")
+	}
+
+	http.Redirect(w, r, "/admin/booking-rules", http.StatusSeeOther)
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adewidyatamadb/GoBookings/internal/models"
+)
+
+func TestRepository_AdminBookingRules(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := userRequest("GET", "/admin/booking-rules", "", nil)
+
+	handler := http.HandlerFunc(Repo.AdminBookingRules)
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected code %d but got %d", http.StatusOK, w.Code)
+	}
+	for _, expected := range []string{"Long stays", "Fort Smythe Bed and Breakfast", "All rooms", "Summer weeks", "General&#39;s Quarters", "Sat"} {
+		if !strings.Contains(w.Body.String(), expected) {
+			t.Errorf("expected to find %s but did not", expected)
+		}
+	}
+}
+
+func TestRepository_AdminShowBookingRule(t *testing.T) {
+	var tableTest = []struct {
+		name               string
+		id                 string
+		expectedStatusCode int
+		expectedHTML       []string
+	}{
+		{"season of a room", "2", http.StatusOK, []string{"Summer weeks", `value="7"`, `id="arrival-6" class="form-check-input" value="6" checked`, `<option value="1" selected>Fort Smythe Bed and Breakfast</option>`}},
+		{"new rule", "new", http.StatusNotFound, nil},
+		{"non-existent rule", "100", http.StatusNotFound, nil},
+	}
+
+	for _, test := range tableTest {
+		w := httptest.NewRecorder()
+		r := userRequest("GET", "/admin/booking-rules/"+test.id, test.id, nil)
+
+		handler := http.HandlerFunc(Repo.AdminShowBookingRule)
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.expectedStatusCode {
+			t.Errorf("case - %s: expected code %d but got %d", test.name, test.expectedStatusCode, w.Code)
+		}
+
+		for _, expected := range test.expectedHTML {
+			if !strings.Contains(w.Body.String(), expected) {
+				t.Errorf("case - %s: expected to find %s but did not", test.name, expected)
+			}
+		}
+	}
+}
+
+func TestRepository_AdminPostNewBookingRule(t *testing.T) {
+	var tableTest = []struct {
+		name               string
+		posted             map[string]string
+		expectedStatusCode int
+		expectedHTML       string
+	}{
+		{"valid rule", map[string]string{"name": "Weekends", "room_id": "1", "min_nights": "2"}, http.StatusSeeOther, ""},
+		{"season", map[string]string{"name": "Summer", "property_id": "1", "start": "2050-07-01", "end": "2050-08-31", "max_advance": "365"}, http.StatusSeeOther, ""},
+		{"unknown property", map[string]string{"name": "Summer", "property_id": "9"}, http.StatusOK, "Choose the property of the rule"},
+		{"room of another property", map[string]string{"name": "Weekends", "property_id": "2", "room_id": "1"}, http.StatusOK, "Choose a room of the property"},
+		{"missing name", map[string]string{"min_nights": "2"}, http.StatusOK, "This field cannot be blank"},
+		{"invalid date", map[string]string{"name": "Summer", "start": "summer"}, http.StatusOK, "Enter a date like"},
+		{"season ends before it starts", map[string]string{"name": "Summer", "start": "2050-08-31", "end": "2050-07-01"}, http.StatusOK, "The season cannot end before it starts"},
+		{"negative limit", map[string]string{"name": "Notice", "min_notice": "-1"}, http.StatusOK, "Enter a number of 0 or more"},
+		{"maximum below minimum", map[string]string{"name": "Stays", "min_nights": "7", "max_nights": "3"}, http.StatusOK, "The maximum stay cannot be shorter than the minimum stay"},
+		{"horizon below notice", map[string]string{"name": "Notice", "min_notice": "30", "max_advance": "7"}, http.StatusOK, "The booking horizon cannot be shorter than the notice"},
+		{"unknown room", map[string]string{"name": "Annex", "room_id": "9"}, http.StatusOK, "Choose a room of the property"},
+	}
+
+	defer resetTestDB()
+
+	for _, test := range tableTest {
+		postedData := url.Values{}
+		for key, value := range test.posted {
+			postedData.Add(key, value)
+		}
+
+		w := httptest.NewRecorder()
+		r := userRequest("POST", "/admin/booking-rules/new", "", postedData)
+
+		handler := http.HandlerFunc(Repo.AdminPostNewBookingRule)
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.expectedStatusCode {
+			t.Errorf("case - %s: expected code %d but got %d", test.name, test.expectedStatusCode, w.Code)
+		}
+
+		if test.expectedHTML != "" && !strings.Contains(w.Body.String(), test.expectedHTML) {
+			t.Errorf("case - %s: expected to find %s but did not", test.name, test.expectedHTML)
+		}
+	}
+}
+
+func TestRepository_AdminPostShowBookingRule(t *testing.T) {
+	var tableTest = []struct {
+		name               string
+		id                 string
+		minNights          string
+		expectedStatusCode int
+		expectedHTML       string
+	}{
+		{"update rule", "2", "5", http.StatusSeeOther, ""},
+		{"invalid limit", "2", "a week", http.StatusOK, "Enter a number of 0 or more"},
+		{"non-existent rule", "100", "5", http.StatusNotFound, ""},
+	}
+
+	defer resetTestDB()
+
+	for _, test := range tableTest {
+		postedData := url.Values{}
+		postedData.Add("name", "Summer weeks")
+		postedData.Add("room_id", "1")
+		postedData.Add("min_nights", test.minNights)
+		postedData.Add("arrival_days", "6")
+
+		w := httptest.NewRecorder()
+		r := userRequest("POST", "/admin/booking-rules/"+test.id, test.id, postedData)
+
+		handler := http.HandlerFunc(Repo.AdminPostShowBookingRule)
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.expectedStatusCode {
+			t.Errorf("case - %s: expected code %d but got %d", test.name, test.expectedStatusCode, w.Code)
+		}
+
+		if test.expectedHTML != "" && !strings.Contains(w.Body.String(), test.expectedHTML) {
+			t.Errorf("case - %s: expected to find %s but did not", test.name, test.expectedHTML)
+		}
+	}
+}
+
+func TestRepository_AdminDeleteBookingRule(t *testing.T) {
+	var tableTest = []struct {
+		name          string
+		id            string
+		expectedFlash string
+	}{
+		{"existing rule", "1", "flash"},
+		{"non-existent rule", "100", "error"},
+	}
+
+	defer resetTestDB()
+
+	for _, test := range tableTest {
+		w := httptest.NewRecorder()
+		r := userRequest("POST", "/admin/booking-rules/"+test.id+"/delete/do", test.id, nil)
+
+		handler := http.HandlerFunc(Repo.AdminDeleteBookingRule)
+		handler.ServeHTTP(w, r)
+
+		if w.Code != http.StatusSeeOther {
+			t.Errorf("case - %s: expected code %d but got %d", test.name, http.StatusSeeOther, w.Code)
+		}
+
+		if !session.Exists(r.Context(), test.expectedFlash) {
+			t.Errorf("case - %s: expected a %s message", test.name, test.expectedFlash)
+		}
+	}
+}
+
+func TestPostedWeekdays(t *testing.T) {
+	days := postedWeekdays([]string{"6", "0", "7", "x"})
+	if days != models.WeekdaysOf(time.Saturday, time.Sunday) {
+		t.Errorf("expected Sat, Sun but got %s", days)
+	}
+}
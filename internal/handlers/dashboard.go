@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/adewidyatamadb/GoBookings/internal/dates"
+	"github.com/adewidyatamadb/GoBookings/internal/helpers"
+	"github.com/adewidyatamadb/GoBookings/internal/models"
+	"github.com/adewidyatamadb/GoBookings/internal/render"
+)
+
+// maxDashboardDays is the longest range the dashboard reports on
+const maxDashboardDays = 366
+
+// errDashboardRange is returned for a dashboard range that cannot be reported on
+var errDashboardRange = errors.New("the end date must be on or after the start date and within a year of it")
+
+// dashboardRange returns the range of the start and end query parameters, the current month by default
+func dashboardRange(r *http.Request, today dates.Date) (start, end dates.Date, err error) {
+	start = dates.New(today.Year(), today.Month(), 1)
+	end = start.AddDate(0, 1, -1)
+
+	if s := r.URL.Query().Get("start"); s != "" {
+		start, err = dates.Parse(s)
+		if err != nil {
+			return start, end, errDashboardRange
+		}
+	}
+	if e := r.URL.Query().Get("end"); e != "" {
+		end, err = dates.Parse(e)
+		if err != nil {
+			return start, end, errDashboardRange
+		}
+	}
+
+	if end.Before(start) || start.DaysUntil(end) >= maxDashboardDays {
+		return start, end, errDashboardRange
+	}
+
+	return start, end, nil
+}
+
+// dashboardStats returns the dashboard figures of the rooms of scope from start to end. What day it is differs
+// between time zones, so the rooms of each property are counted with the current time at that property
+func (m *Repository) dashboardStats(ctx context.Context, start, end dates.Date, scope roomScope) (models.DashboardStats, error) {
+	rooms, err := m.roomProperties(ctx)
+	if err != nil {
+		return models.DashboardStats{}, err
+	}
+
+	propertyRooms := make(map[int][]int)
+	for roomID, propertyID := range rooms {
+		if scope.Has(roomID) {
+			propertyRooms[propertyID] = append(propertyRooms[propertyID], roomID)
+		}
+	}
+	if len(propertyRooms) == 0 {
+		return m.DB.DashboardStats(ctx, start, end, m.App.Now(), []int{})
+	}
+
+	propertyIDs := make([]int, 0, len(propertyRooms))
+	for id := range propertyRooms {
+		propertyIDs = append(propertyIDs, id)
+	}
+	sort.Ints(propertyIDs)
+
+	var stats models.DashboardStats
+	for i, id := range propertyIDs {
+		p, err := m.cachedProperty(ctx, id)
+		if err != nil {
+			return stats, err
+		}
+		s, err := m.DB.DashboardStats(ctx, start, end, m.App.NowAt(p), propertyRooms[id])
+		if err != nil {
+			return stats, err
+		}
+		if i == 0 {
+			stats = s
+			continue
+		}
+
+		stats.Total.Booked += s.Total.Booked
+		stats.Total.Nights += s.Total.Nights
+		stats.Rooms = append(stats.Rooms, s.Rooms...)
+		stats.Arrivals += s.Arrivals
+		stats.Departures += s.Departures
+		stats.PickUp7 += s.PickUp7
+		stats.PickUp30 += s.PickUp30
+		for j := range stats.LeadTimes {
+			stats.LeadTimes[j].Count += s.LeadTimes[j].Count
+		}
+	}
+	sort.Slice(stats.Rooms, func(i, j int) bool { return stats.Rooms[i].Room.RoomName < stats.Rooms[j].Room.RoomName })
+
+	return stats, nil
+}
+
+// AdminDashboard shows occupancy and booking figures for a date range
+func (m *Repository) AdminDashboard(w http.ResponseWriter, r *http.Request) {
+	p, err := m.requestProperty(r)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	start, end, err := dashboardRange(r, m.App.TodayAt(p))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Invalid date range, "+err.Error())
+		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+		return
+	}
+
+	scope, err := m.staffScope(r)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	stats, err := m.dashboardStats(r.Context(), start, end, scope)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["stats"] = stats
+
+	stringMap := make(map[string]string)
+	stringMap["start"] = start.String()
+	stringMap["end"] = end.String()
+
+	render.Template(w, r, "admin-dashboard.page.html", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
+
+type occupancyJSON struct {
+	RoomID       int     `json:"room_id,omitempty"`
+	RoomName     string  `json:"room_name,omitempty"`
+	BookedNights int     `json:"booked_nights"`
+	Nights       int     `json:"nights"`
+	Rate         float64 `json:"rate"`
+}
+
+type leadTimeJSON struct {
+	Label   string `json:"label"`
+	MinDays int    `json:"min_days"`
+	MaxDays int    `json:"max_days"`
+	Count   int    `json:"count"`
+}
+
+type dashboardJSON struct {
+	OK              bool            `json:"ok"`
+	Message         string          `json:"message,omitempty"`
+	Start           string          `json:"start,omitempty"`
+	End             string          `json:"end,omitempty"`
+	Occupancy       *occupancyJSON  `json:"occupancy,omitempty"`
+	Rooms           []occupancyJSON `json:"rooms,omitempty"`
+	ArrivalsToday   int             `json:"arrivals_today"`
+	DeparturesToday int             `json:"departures_today"`
+	PickUp7         int             `json:"pick_up_7_days"`
+	PickUp30        int             `json:"pick_up_30_days"`
+	LeadTimes       []leadTimeJSON  `json:"lead_times,omitempty"`
+}
+
+// newOccupancyJSON returns the JSON form of an occupancy
+func newOccupancyJSON(o models.Occupancy) occupancyJSON {
+	return occupancyJSON{
+		RoomID:       o.Room.ID,
+		RoomName:     o.Room.RoomName,
+		BookedNights: o.Booked,
+		Nights:       o.Nights,
+		Rate:         o.Rate(),
+	}
+}
+
+// writeDashboardJSON writes a dashboard response with the status code
+func writeDashboardJSON(w http.ResponseWriter, status int, resp dashboardJSON) {
+	out, _ := json.MarshalIndent(resp, "", "     ")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(out)
+}
+
+// AdminDashboardJSON sends the dashboard figures for a date range as JSON, for charts
+func (m *Repository) AdminDashboardJSON(w http.ResponseWriter, r *http.Request) {
+	p, err := m.requestProperty(r)
+	if err != nil {
+		log.Println(err)
+		writeDashboardJSON(w, http.StatusInternalServerError, dashboardJSON{Message: "Error querying database"})
+		return
+	}
+
+	start, end, err := dashboardRange(r, m.App.TodayAt(p))
+	if err != nil {
+		writeDashboardJSON(w, http.StatusBadRequest, dashboardJSON{Message: err.Error()})
+		return
+	}
+
+	scope, err := m.staffScope(r)
+	if err != nil {
+		log.Println(err)
+		writeDashboardJSON(w, http.StatusInternalServerError, dashboardJSON{Message: "Error querying database"})
+		return
+	}
+
+	stats, err := m.dashboardStats(r.Context(), start, end, scope)
+	if err != nil {
+		log.Println(err)
+		writeDashboardJSON(w, http.StatusInternalServerError, dashboardJSON{Message: "Error querying database"})
+		return
+	}
+
+	total := newOccupancyJSON(stats.Total)
+	resp := dashboardJSON{
+		OK:              true,
+		Start:           stats.Start.String(),
+		End:             stats.End.String(),
+		Occupancy:       &total,
+		Rooms:           []occupancyJSON{},
+		ArrivalsToday:   stats.Arrivals,
+		DeparturesToday: stats.Departures,
+		PickUp7:         stats.PickUp7,
+		PickUp30:        stats.PickUp30,
+	}
+	for _, o := range stats.Rooms {
+		resp.Rooms = append(resp.Rooms, newOccupancyJSON(o))
+	}
+	for _, lt := range stats.LeadTimes {
+		resp.LeadTimes = append(resp.LeadTimes, leadTimeJSON{Label: lt.Label, MinDays: lt.Min, MaxDays: lt.Max, Count: lt.Count})
+	}
+
+	writeDashboardJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/adewidyatamadb/GoBookings/internal/dates"
+	"github.com/adewidyatamadb/GoBookings/internal/models"
+)
+
+func TestDashboardRange(t *testing.T) {
+	today := dates.New(2021, 10, 19)
+
+	var tableTest = []struct {
+		name          string
+		query         string
+		expectedStart string
+		expectedEnd   string
+		expectedError bool
+	}{
+		{"default", "", "2021-10-01", "2021-10-31", false},
+		{"range", "?start=2021-01-01&end=2021-03-31", "2021-01-01", "2021-03-31", false},
+		{"single day", "?start=2021-10-19&end=2021-10-19", "2021-10-19", "2021-10-19", false},
+		{"end before start", "?start=2021-10-19&end=2021-10-18", "", "", true},
+		{"over a year", "?start=2021-01-01&end=2022-01-02", "", "", true},
+		{"invalid start", "?start=19-10-2021", "", "", true},
+		{"invalid end", "?end=tomorrow", "", "", true},
+	}
+
+	for _, test := range tableTest {
+		r := httptest.NewRequest("GET", "/admin/dashboard"+test.query, nil)
+
+		start, end, err := dashboardRange(r, today)
+		if (err != nil) != test.expectedError {
+			t.Errorf("case - %s: expected error %t but got %v", test.name, test.expectedError, err)
+			continue
+		}
+		if test.expectedError {
+			continue
+		}
+
+		if start.String() != test.expectedStart || end.String() != test.expectedEnd {
+			t.Errorf("case - %s: expected %s - %s but got %s - %s", test.name, test.expectedStart, test.expectedEnd, start, end)
+		}
+	}
+}
+
+func TestRepository_AdminDashboard(t *testing.T) {
+	var tableTest = []struct {
+		name               string
+		query              string
+		expectedStatusCode int
+		expectedHTML       []string
+	}{
+		{"current month", "", http.StatusOK, []string{"Major&#39;s Suite", "1 / 1", "Shown once rooms have prices"}},
+		{"invalid range", "?start=2021-10-19&end=2021-10-18", http.StatusSeeOther, nil},
+	}
+
+	for _, test := range tableTest {
+		w := httptest.NewRecorder()
+		r := userRequest("GET", "/admin/dashboard"+test.query, "", nil)
+
+		handler := http.HandlerFunc(Repo.AdminDashboard)
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.expectedStatusCode {
+			t.Errorf("case - %s: expected code %d but got %d", test.name, test.expectedStatusCode, w.Code)
+		}
+
+		for _, html := range test.expectedHTML {
+			if !strings.Contains(w.Body.String(), html) {
+				t.Errorf("case - %s: expected to find %s but did not", test.name, html)
+			}
+		}
+	}
+}
+
+func TestRepository_AdminDashboardJSON(t *testing.T) {
+	today := app.Today().String()
+
+	var tableTest = []struct {
+		name               string
+		query              string
+		expectedStatusCode int
+		expectedOK         bool
+		expectedBooked     int
+	}{
+		{"today", "?start=" + today + "&end=" + today, http.StatusOK, true, 1},
+		{"invalid range", "?start=2021-10-19&end=2021-10-18", http.StatusBadRequest, false, 0},
+	}
+
+	for _, test := range tableTest {
+		w := httptest.NewRecorder()
+		r := userRequest("GET", "/admin/dashboard.json"+test.query, "", nil)
+
+		handler := http.HandlerFunc(Repo.AdminDashboardJSON)
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.expectedStatusCode {
+			t.Errorf("case - %s: expected code %d but got %d", test.name, test.expectedStatusCode, w.Code)
+		}
+
+		var resp dashboardJSON
+		err := json.Unmarshal(w.Body.Bytes(), &resp)
+		if err != nil {
+			t.Errorf("case - %s: failed to parse json: %v", test.name, err)
+			continue
+		}
+		if resp.OK != test.expectedOK {
+			t.Errorf("case - %s: expected ok %t but got %t", test.name, test.expectedOK, resp.OK)
+		}
+		if !resp.OK {
+			continue
+		}
+
+		if resp.Occupancy == nil || resp.Occupancy.BookedNights != test.expectedBooked || resp.Occupancy.Nights != 2 || resp.Occupancy.Rate != 0.5 {
+			t.Errorf("case - %s: expected %d of 2 nights booked but got %+v", test.name, test.expectedBooked, resp.Occupancy)
+		}
+		if len(resp.Rooms) != 2 || resp.Rooms[0].BookedNights != 1 || resp.Rooms[0].Rate != 1 {
+			t.Errorf("case - %s: expected the quarters to be booked but got %+v", test.name, resp.Rooms)
+		}
+		// the 9 confirmed reservations of the fixtures were all booked just now
+		if resp.ArrivalsToday != 1 || resp.PickUp7 != 9 || resp.PickUp30 != 9 {
+			t.Errorf("case - %s: expected 1 arrival and 9 reservations booked this week but got %+v", test.name, resp)
+		}
+		if len(resp.LeadTimes) != 5 || resp.LeadTimes[0].Count != 1 {
+			t.Errorf("case - %s: expected the arrival to be booked the same day but got %+v", test.name, resp.LeadTimes)
+		}
+	}
+}
+
+func TestRepository_AdminDashboard_Scoped(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := scopedRequest("GET", "/admin/dashboard", "", nil)
+
+	handler := http.HandlerFunc(Repo.AdminDashboard)
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected code %d but got %d", http.StatusOK, w.Code)
+	}
+	if strings.Contains(w.Body.String(), "Major&#39;s Suite") {
+		t.Error("expected the rooms of other properties to be hidden")
+	}
+
+	today := app.Today().String()
+	w = httptest.NewRecorder()
+	r = scopedRequest("GET", "/admin/dashboard.json?start="+today+"&end="+today, "", nil)
+
+	handler = http.HandlerFunc(Repo.AdminDashboardJSON)
+	handler.ServeHTTP(w, r)
+
+	var resp dashboardJSON
+	err := json.Unmarshal(w.Body.Bytes(), &resp)
+	if err != nil {
+		t.Fatalf("failed to parse json: %v", err)
+	}
+	if !resp.OK || len(resp.Rooms) != 0 || resp.ArrivalsToday != 0 {
+		t.Errorf("expected no rooms nor arrivals of other properties but got %+v", resp)
+	}
+}
+
+func TestRepository_dashboardStats_TimeZones(t *testing.T) {
+	defer resetTestDB()
+	ctx := context.Background()
+
+	// a day apart at least: the quarters stay at Fort Smythe at UTC+14 and the suite moves to Harbour House at UTC-12
+	for id, zone := range map[int]string{1: "Pacific/Kiritimati", 2: "Etc/GMT+12"} {
+		p, err := testDB.GetPropertyByID(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.TimeZone = zone
+		if err := testDB.UpdateProperty(ctx, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	Repo.forgetProperties()
+	if err := testDB.MoveRoom(ctx, 2, 2); err != nil {
+		t.Fatal(err)
+	}
+	// reservation 4 arrives today in UTC
+	if err := testDB.DeleteReservation(ctx, 4); err != nil {
+		t.Fatal(err)
+	}
+
+	properties, err := Repo.Properties(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// room 1 is at property 1 and room 2 at property 2 now
+	for _, p := range properties {
+		today := app.TodayAt(p)
+		_, err := testDB.InsertReservation(ctx, models.Reservation{FirstName: "Ann", LastName: "Lee", Email: "ann@lee.com", RoomID: p.ID, StartDate: today, EndDate: today.AddDays(1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	today := app.Today()
+	stats, err := Repo.dashboardStats(ctx, today.AddDays(-1), today.AddDays(1), roomScope{all: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Arrivals != 2 {
+		t.Errorf("expected the arrivals of today at each property but got %d", stats.Arrivals)
+	}
+	if len(stats.Rooms) != 2 || stats.Rooms[0].Room.RoomName != "General's Quarters" {
+		t.Errorf("expected the rooms of both properties by name but got %+v", stats.Rooms)
+	}
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/adewidyatamadb/GoBookings/internal/dates"
+	"github.com/adewidyatamadb/GoBookings/internal/helpers"
+	"github.com/adewidyatamadb/GoBookings/internal/models"
+	"github.com/adewidyatamadb/GoBookings/internal/render"
+)
+
+// daySheet lists the guests arriving, staying over and departing on a day
+type daySheet struct {
+	Day        dates.Date
+	Arrivals   []models.Reservation
+	InHouse    []models.Reservation
+	Departures []models.Reservation
+}
+
+// daySheetDay returns the day of the date query parameter, today by default
+func daySheetDay(r *http.Request, today dates.Date) (dates.Date, error) {
+	if d := r.URL.Query().Get("date"); d != "" {
+		return dates.Parse(d)
+	}
+	return today, nil
+}
+
+// loadDaySheet returns the day sheet of day for the rooms of scope
+func (m *Repository) loadDaySheet(ctx context.Context, day dates.Date, scope roomScope) (daySheet, error) {
+	reservations, err := m.DB.ReservationsOnDay(ctx, day)
+	if err != nil {
+		return daySheet{}, err
+	}
+
+	sheet := daySheet{Day: day}
+	for _, res := range scopedReservations(reservations, scope) {
+		switch {
+		case res.StartDate.Equal(day):
+			sheet.Arrivals = append(sheet.Arrivals, res)
+		case res.EndDate.Equal(day):
+			sheet.Departures = append(sheet.Departures, res)
+		default:
+			sheet.InHouse = append(sheet.InHouse, res)
+		}
+	}
+
+	return sheet, nil
+}
+
+// renderDaySheet renders the day sheet of the date query parameter with the page template
+func (m *Repository) renderDaySheet(w http.ResponseWriter, r *http.Request, page string) {
+	p, err := m.requestProperty(r)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	day, err := daySheetDay(r, m.App.TodayAt(p))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Invalid date")
+		http.Redirect(w, r, "/admin/day-sheet", http.StatusSeeOther)
+		return
+	}
+
+	scope, err := m.staffScope(r)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	sheet, err := m.loadDaySheet(r.Context(), day, scope)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	properties, err := m.managedProperties(r)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["sheet"] = sheet
+	data["properties"] = properties
+
+	stringMap := make(map[string]string)
+	stringMap["date"] = day.String()
+	stringMap["previous"] = day.AddDays(-1).String()
+	stringMap["next"] = day.AddDays(1).String()
+
+	render.Template(w, r, page, &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
+
+// AdminDaySheet shows the guests arriving, staying over and departing on a day
+func (m *Repository) AdminDaySheet(w http.ResponseWriter, r *http.Request) {
+	m.renderDaySheet(w, r, "admin-day-sheet.page.html")
+}
+
+// AdminDaySheetPrint shows the day sheet without the admin layout, for printing
+func (m *Repository) AdminDaySheetPrint(w http.ResponseWriter, r *http.Request) {
+	m.renderDaySheet(w, r, "day-sheet-print.page.html")
+}
+
+// daySheetMail is the body of the day sheet email
+var daySheetMail = template.Must(template.New("day-sheet-mail").Funcs(template.FuncMap{"humanDate": render.HumanDate}).Parse(`
+	<strong>Day sheet for {{.Day.Format "Monday"}} {{humanDate .Day}}</strong>
+	<p><strong>Arrivals</strong></p>
+	{{template "guests" .Arrivals}}
+	<p><strong>In house</strong></p>
+	{{template "guests" .InHouse}}
+	<p><strong>Departures</strong></p>
+	{{template "guests" .Departures}}
+	{{define "guests"}}
+		{{if .}}
+			<ul>
+			{{range .}}
+				<li>{{.Room.RoomName}}: {{.FirstName}} {{.LastName}}, {{.Email}} {{.Phone}}{{with .Guest.Notes}} &ndash; {{.}}{{end}}</li>
+			{{end}}
+			</ul>
+		{{else}}
+			<p>None</p>
+		{{end}}
+	{{end}}
+`))
+
+// SendDaySheet emails every property owner the day sheet of the day after now, the next day where the property is
+func (m *Repository) SendDaySheet(ctx context.Context, now time.Time) error {
+	properties, err := m.DB.AllProperties(ctx)
+	if err != nil {
+		return err
+	}
+	rooms, err := m.roomProperties(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range properties {
+		if p.OwnerEmail == "" {
+			continue
+		}
+
+		scope := roomScope{rooms: make(map[int]bool)}
+		for roomID, propertyID := range rooms {
+			scope.rooms[roomID] = propertyID == p.ID
+		}
+
+		day := dates.Of(m.App.TimeAt(p, now)).AddDays(1)
+		sheet, err := m.loadDaySheet(ctx, day, scope)
+		if err != nil {
+			return err
+		}
+
+		var buf bytes.Buffer
+		err = daySheetMail.Execute(&buf, sheet)
+		if err != nil {
+			return err
+		}
+
+		m.App.MailChan <- propertyMail(p, models.MailData{
+			To:       p.OwnerEmail,
+			Subject:  "Day sheet for " + m.App.FormatDate(day),
+			Content:  buf.String(),
+			Template: "basic.html",
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adewidyatamadb/GoBookings/internal/dates"
+	"github.com/adewidyatamadb/GoBookings/internal/models"
+)
+
+func TestRepository_loadDaySheet(t *testing.T) {
+	day := dates.New(2021, 10, 19)
+
+	sheet, err := Repo.loadDaySheet(context.Background(), day, roomScope{all: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !sheet.Day.Equal(day) {
+		t.Errorf("expected the sheet of %s but got %s", day, sheet.Day)
+	}
+	if len(sheet.Arrivals) != 1 || sheet.Arrivals[0].ID != 1 {
+		t.Errorf("expected reservation 1 to arrive but got %+v", sheet.Arrivals)
+	}
+	if len(sheet.InHouse) != 1 || sheet.InHouse[0].ID != 2 {
+		t.Errorf("expected reservation 2 to stay over but got %+v", sheet.InHouse)
+	}
+	if len(sheet.Departures) != 1 || sheet.Departures[0].ID != 3 {
+		t.Errorf("expected reservation 3 to depart but got %+v", sheet.Departures)
+	}
+
+	sheet, err = Repo.loadDaySheet(context.Background(), day, roomScope{rooms: map[int]bool{99: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sheet.Arrivals)+len(sheet.InHouse)+len(sheet.Departures) != 0 {
+		t.Errorf("expected no reservations outside the rooms of the scope but got %+v", sheet)
+	}
+}
+
+func TestRepository_AdminDaySheet(t *testing.T) {
+	var tableTest = []struct {
+		name               string
+		url                string
+		handler            http.HandlerFunc
+		expectedStatusCode int
+		expectedHTML       []string
+	}{
+		{"day sheet", "/admin/day-sheet?date=2021-10-19", Repo.AdminDaySheet, http.StatusOK,
+			[]string{"Tuesday 19-Oct-2021", "Prefers a late check-in", "do-not-rent", "555-555-5555", "date=2021-10-20", "date=2021-10-18"}},
+		{"today", "/admin/day-sheet", Repo.AdminDaySheet, http.StatusOK, []string{app.Today().Format("Monday 02-Jan-2006")}},
+		{"print view", "/admin/day-sheet/print?date=2021-10-19", Repo.AdminDaySheetPrint, http.StatusOK,
+			[]string{"day sheet for Tuesday 19-Oct-2021", "Prefers a late check-in", "window.print()"}},
+		{"invalid date", "/admin/day-sheet?date=19-10-2021", Repo.AdminDaySheet, http.StatusSeeOther, nil},
+	}
+
+	for _, test := range tableTest {
+		w := httptest.NewRecorder()
+		r := userRequest("GET", test.url, "", nil)
+
+		test.handler.ServeHTTP(w, r)
+
+		if w.Code != test.expectedStatusCode {
+			t.Errorf("case - %s: expected code %d but got %d", test.name, test.expectedStatusCode, w.Code)
+		}
+
+		for _, html := range test.expectedHTML {
+			if !strings.Contains(w.Body.String(), html) {
+				t.Errorf("case - %s: expected to find %s but did not", test.name, html)
+			}
+		}
+	}
+}
+
+func TestDaySheetMail(t *testing.T) {
+	sheet, err := Repo.loadDaySheet(context.Background(), dates.New(2021, 10, 19), roomScope{all: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sheet.InHouse[0].Guest.Notes = "<script>"
+
+	var buf bytes.Buffer
+	err = daySheetMail.Execute(&buf, sheet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mail := buf.String()
+	for _, s := range []string{"Tuesday 19-Oct-2021", "Major&#39;s Suite: John Smith", "Prefers a late check-in", "Johnny Smith", "&lt;script&gt;"} {
+		if !strings.Contains(mail, s) {
+			t.Errorf("expected the day sheet email to contain %s but it did not", s)
+		}
+	}
+}
+
+func TestRepository_SendDaySheet(t *testing.T) {
+	testApp := app
+	testApp.MailChan = make(chan models.MailData, 10)
+	repo := newTestRepo(&testApp)
+
+	err := repo.SendDaySheet(context.Background(), time.Date(2021, 10, 18, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every property gets its own sheet, property 2 has no rooms in the fixtures
+	sheets := make(map[string]models.MailData)
+	for len(testApp.MailChan) > 0 {
+		msg := <-testApp.MailChan
+		sheets[msg.To] = msg
+	}
+	if len(sheets) != 2 {
+		t.Fatalf("expected a day sheet for each of the 2 owners but got %d", len(sheets))
+	}
+
+	fort := sheets["me@here.com"]
+	if fort.From != "fort@smythe.com" || fort.Brand != "Fort Smythe Bed and Breakfast" || !strings.Contains(fort.Content, "Johnny Smith") {
+		t.Errorf("unexpected day sheet of property 1 %+v", fort)
+	}
+	harbour := sheets["owner@harbour.example.com"]
+	if harbour.From != "stay@harbour.example.com" || harbour.Brand != "Harbour House" || strings.Contains(harbour.Content, "Johnny Smith") {
+		t.Errorf("unexpected day sheet of property 2 %+v", harbour)
+	}
+
+	// at 23:30 UTC it is the next day in Lisbon already, where Harbour House is
+	err = repo.SendDaySheet(context.Background(), time.Date(2021, 10, 18, 23, 30, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for len(testApp.MailChan) > 0 {
+		msg := <-testApp.MailChan
+		sheets[msg.To] = msg
+	}
+	if subject := sheets["me@here.com"].Subject; subject != "Day sheet for 19-Oct-2021" {
+		t.Errorf("expected the sheet of the next day at property 1 but got %q", subject)
+	}
+	if subject := sheets["owner@harbour.example.com"].Subject; subject != "Day sheet for 20-Oct-2021" {
+		t.Errorf("expected the sheet of the next day at property 2 but got %q", subject)
+	}
+}
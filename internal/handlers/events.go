@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/adewidyatamadb/GoBookings/internal/events"
+)
+
+// MailEvent is the event subscriber that emails guests and the owner about new reservations
+func (m *Repository) MailEvent(ctx context.Context, e events.Event) error {
+	switch e := e.(type) {
+	case events.ReservationHeld:
+		return m.sendHoldConfirmation(ctx, e.Reservation)
+	case events.ReservationCreated:
+		return m.sendReservationEmails(ctx, e.Reservation)
+	}
+	return nil
+}
+
+// metricsJSON is the response of AdminMetricsJSON
+type metricsJSON struct {
+	Since  time.Time           `json:"since"`
+	Events []events.EventCount `json:"events"`
+}
+
+// AdminMetricsJSON sends how many events of each kind were published since the server started
+func (m *Repository) AdminMetricsJSON(w http.ResponseWriter, r *http.Request) {
+	var resp metricsJSON
+	if m.App.EventCounter != nil {
+		resp.Since, resp.Events = m.App.EventCounter.Counts()
+	}
+	if resp.Events == nil {
+		resp.Events = []events.EventCount{}
+	}
+
+	out, _ := json.MarshalIndent(resp, "", "     ")
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(out)
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adewidyatamadb/GoBookings/internal/dates"
+	"github.com/adewidyatamadb/GoBookings/internal/events"
+	"github.com/adewidyatamadb/GoBookings/internal/models"
+)
+
+func TestRepository_MailEvent(t *testing.T) {
+	testApp := app
+	testApp.MailChan = make(chan models.MailData, 10)
+	repo := newTestRepo(&testApp)
+
+	day := dates.New(2021, 10, 19)
+	res := models.Reservation{ID: 7, FirstName: "John", Email: "john@smith.com", StartDate: day, EndDate: day.AddDays(2), RoomID: 1, Room: models.Room{RoomName: "General's Quarters"}}
+	held := res
+	held.HoldUntil = time.Now().Add(time.Hour)
+
+	var tableTest = []struct {
+		name             string
+		event            events.Event
+		expectedSubjects []string
+	}{
+		{"held", events.ReservationHeld{Reservation: held}, []string{"Confirm your reservation"}},
+		{"created", events.ReservationCreated{Reservation: res}, []string{"Reservation Confirmation", "Reservation Notification"}},
+		{"cancelled", events.ReservationCancelled{Reservation: res}, nil},
+	}
+
+	for _, test := range tableTest {
+		err := repo.MailEvent(context.Background(), test.event)
+		if err != nil {
+			t.Errorf("case - %s: %v", test.name, err)
+		}
+
+		var subjects []string
+		for len(testApp.MailChan) > 0 {
+			msg := <-testApp.MailChan
+			subjects = append(subjects, msg.Subject)
+			// the room belongs to property 1, which sends as fort@smythe.com and notifies me@here.com
+			if msg.From != "fort@smythe.com" {
+				t.Errorf("case - %s: expected %s to be sent from fort@smythe.com but got %s", test.name, msg.Subject, msg.From)
+			}
+			if msg.Subject == "Reservation Notification" && msg.To != "me@here.com" {
+				t.Errorf("case - %s: expected the owner me@here.com to be notified but got %s", test.name, msg.To)
+			}
+		}
+		if strings.Join(subjects, ",") != strings.Join(test.expectedSubjects, ",") {
+			t.Errorf("case - %s: expected emails %v but got %v", test.name, test.expectedSubjects, subjects)
+		}
+	}
+}
+
+func TestRepository_AdminMetricsJSON(t *testing.T) {
+	app.Events.Publish(context.Background(), events.BlockAdded{RoomID: 1})
+
+	w := httptest.NewRecorder()
+	r := userRequest("GET", "/admin/metrics.json", "", nil)
+
+	handler := http.HandlerFunc(Repo.AdminMetricsJSON)
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected code %d but got %d", http.StatusOK, w.Code)
+	}
+
+	var resp metricsJSON
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("cannot parse json: %v", err)
+	}
+
+	found := false
+	for _, c := range resp.Events {
+		if c.Name == models.EventBlockCreated && c.Count > 0 {
+			found = true
+		}
+	}
+	if !found || resp.Since.IsZero() {
+		t.Errorf("expected the block to be counted but got %+v", resp)
+	}
+}
@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/adewidyatamadb/GoBookings/internal/config"
+	"github.com/adewidyatamadb/GoBookings/internal/dates"
+	"github.com/adewidyatamadb/GoBookings/internal/models"
+	"github.com/adewidyatamadb/GoBookings/internal/repository"
+	"github.com/adewidyatamadb/GoBookings/internal/repository/dbrepo"
+	"github.com/adewidyatamadb/GoBookings/internal/totp"
+)
+
+// Credentials of the fixtures, every user and guest with an account logs in with fixturePassword but
+// lockout@here.com, who is one failed login away from being locked out
+const (
+	fixturePassword     = "password"
+	fixtureTOTPSecret   = "JBSWY3DPEHPK3PXP"
+	fixtureRecoveryCode = "ABCDE-FGHIJ"
+)
+
+// errTestDB is the error of the test database methods made to fail with failOn
+var errTestDB = errors.New("test database error")
+
+// testDB is the database of the handler tests, an in-memory repository holding the fixtures
+var testDB = &fixtureRepo{}
+
+// fixtureRepo is an in-memory repository whose method failing returns errTestDB
+type fixtureRepo struct {
+	repository.DatabaseRepo
+	failing string
+}
+
+// failOn makes method fail until the fixtures are reset
+func (f *fixtureRepo) failOn(method string) {
+	f.failing = method
+}
+
+// InsertReservation fails when failing on it
+func (f *fixtureRepo) InsertReservation(ctx context.Context, res models.Reservation) (int, error) {
+	if f.failing == "InsertReservation" {
+		return 0, errTestDB
+	}
+	return f.DatabaseRepo.InsertReservation(ctx, res)
+}
+
+// InsertRoomRestriction fails when failing on it
+func (f *fixtureRepo) InsertRoomRestriction(ctx context.Context, res models.RoomRestriction) error {
+	if f.failing == "InsertRoomRestriction" {
+		return errTestDB
+	}
+	return f.DatabaseRepo.InsertRoomRestriction(ctx, res)
+}
+
+// SearchAvailabilityByDatesByRoomID fails when failing on it
+func (f *fixtureRepo) SearchAvailabilityByDatesByRoomID(ctx context.Context, start, end dates.Date, roomID int) (bool, error) {
+	if f.failing == "SearchAvailabilityByDatesByRoomID" {
+		return false, errTestDB
+	}
+	return f.DatabaseRepo.SearchAvailabilityByDatesByRoomID(ctx, start, end, roomID)
+}
+
+// SearchAvailabilityForAllRooms fails when failing on it
+func (f *fixtureRepo) SearchAvailabilityForAllRooms(ctx context.Context, start, end dates.Date) ([]models.Room, error) {
+	if f.failing == "SearchAvailabilityForAllRooms" {
+		return nil, errTestDB
+	}
+	return f.DatabaseRepo.SearchAvailabilityForAllRooms(ctx, start, end)
+}
+
+// resetTestDB fills the test database with the fixtures again, tests changing them defer it
+func resetTestDB() {
+	db := dbrepo.NewMemoryRepo(&app)
+	if err := seedFixtures(db, app.Today()); err != nil {
+		log.Fatal("cannot load the fixtures: ", err)
+	}
+
+	testDB.DatabaseRepo = db
+	testDB.failing = ""
+	if Repo != nil {
+		Repo.forgetProperties()
+	}
+}
+
+// newTestRepo creates a new repository backed by the test database
+func newTestRepo(a *config.AppConfig) *Repository {
+	return newRepository(a, testDB)
+}
+
+// seedFixtures adds the fixtures of the handler tests to the seeded in-memory repository db, around
+// today and a day sheet for Tuesday 19-Oct-2021:
+//
+//   - property 1 has the rooms, General's Quarters (1) and Major's Suite (2), property 2 has none
+//   - user 1 is the admin me@here.com, 2 is staff, 3 has to change the password, 4 is disabled, 5 has failed
+//     to log in 4 times, 6 uses two-factor authentication, 7 is an admin of property 2 only and 8 is locked out
+//   - guest 1 has a verified account, a VIP with notes, guest 2 registered without verifying the email, guest 3
+//     booked without registering and is marked do-not-rent, guest 4 has not followed the verification link yet
+//   - reservations 1 to 3 arrive, stay over and depart on the day sheet, 4 arrives today, 5 departs today and
+//     6 and 7 left in the last days, reservations 5 and 6 were made by guest 1 before registering and the
+//     post-stay email of 7 was sent. Reservations 8 and 9 book the suite around 1-Jan-2050 and 12-Oct-2050,
+//     10 is held for guest 2 and the hold of 11 expired, the quarters are blocked on 31-Dec-2049
+//   - booking rule 1 limits the stays at property 1 to 30 nights, rule 2 only takes stays of a week from
+//     Saturdays in the quarters in summer 2050
+//   - webhook 1 gets every event and has a delivered and a pending delivery, webhook 2 is disabled
+func seedFixtures(db repository.DatabaseRepo, today dates.Date) error {
+	ctx := context.Background()
+
+	_, err := db.InsertProperty(ctx, models.Property{
+		Name:        "Harbour House",
+		Slug:        "harbour-house",
+		Host:        "harbour.example.com",
+		TimeZone:    "Europe/Lisbon",
+		Currency:    "EUR",
+		MailFrom:    "stay@harbour.example.com",
+		OwnerEmail:  "owner@harbour.example.com",
+		Description: "Rooms on the quay.",
+	})
+	if err != nil {
+		return err
+	}
+
+	admin, err := db.GetUserByID(ctx, 1)
+	if err != nil {
+		return err
+	}
+	admin.Email = "me@here.com"
+	if err := db.UpdateUser(ctx, admin); err != nil {
+		return err
+	}
+
+	users := []struct {
+		user     models.User
+		password string
+	}{
+		{models.User{FirstName: "John", LastName: "Smith", Email: "john@smith.com", AccessLevel: models.AccessLevelStaff, Active: true}, fixturePassword},
+		{models.User{FirstName: "Rita", LastName: "Reset", Email: "reset@here.com", AccessLevel: models.AccessLevelStaff, Active: true, MustChangePassword: true}, fixturePassword},
+		{models.User{FirstName: "Dan", LastName: "Disabled", Email: "disabled@here.com", AccessLevel: models.AccessLevelStaff}, fixturePassword},
+		{models.User{FirstName: "Lou", LastName: "Lockout", Email: "lockout@here.com", AccessLevel: models.AccessLevelStaff, Active: true, FailedLogins: 4}, "another password 42"},
+		{models.User{FirstName: "Tom", LastName: "Factor", Email: "twofactor@here.com", AccessLevel: models.AccessLevelStaff, Active: true}, fixturePassword},
+		{models.User{FirstName: "Hannah", LastName: "Harbour", Email: "harbour@here.com", AccessLevel: models.AccessLevelAdmin, Active: true}, fixturePassword},
+		{models.User{FirstName: "Larry", LastName: "Locked", Email: "locked@here.com", AccessLevel: models.AccessLevelStaff, Active: true}, fixturePassword},
+	}
+	for _, u := range users {
+		if _, err := db.InsertUser(ctx, u.user, u.password); err != nil {
+			return err
+		}
+	}
+
+	if err := db.EnableTOTP(ctx, 6, fixtureTOTPSecret, []string{fixtureRecoveryCode}); err != nil {
+		return err
+	}
+	// the code of the previous period was used to log in
+	if err := db.UseTOTPCounter(ctx, 6, time.Now().Unix()/int64(totp.Period/time.Second)-1); err != nil {
+		return err
+	}
+	if err := db.SetUserProperties(ctx, 7, []int{2}); err != nil {
+		return err
+	}
+	if err := db.LockUser(ctx, 8, time.Now().Add(time.Hour)); err != nil {
+		return err
+	}
+
+	for _, s := range []models.Session{
+		{Token: "firefox", UserID: 1, IP: "192.0.2.1", UserAgent: "Firefox", Expiry: time.Now().Add(time.Hour)},
+		{Token: "safari", UserID: 1, IP: "192.0.2.2", UserAgent: "Safari", Expiry: time.Now().Add(time.Hour)},
+	} {
+		if err := db.CommitSession(ctx, s); err != nil {
+			return err
+		}
+	}
+
+	john := models.Guest{FirstName: "John", LastName: "Smith", Email: "john@smith.com", Phone: "555-555-5555"}
+	if _, err := db.InsertGuest(ctx, john, fixturePassword); err != nil {
+		return err
+	}
+	if err := db.VerifyGuestEmail(ctx, 1); err != nil {
+		return err
+	}
+	john.ID, john.Notes, john.Tags = 1, "Prefers a late check-in", []string{models.TagVIP}
+	if err := db.UpdateGuestProfile(ctx, john); err != nil {
+		return err
+	}
+
+	jane := models.Guest{FirstName: "Jane", LastName: "Doe", Email: "jane@doe.com"}
+	if _, err := db.FindOrCreateGuest(ctx, jane); err != nil {
+		return err
+	}
+	if err := db.UpdateGuestPassword(ctx, 2, fixturePassword); err != nil {
+		return err
+	}
+
+	johnny := models.Guest{FirstName: "Johnny", LastName: "Smith", Email: "j.smith@work.com", Phone: "(555) 555 5555"}
+	if _, err := db.FindOrCreateGuest(ctx, johnny); err != nil {
+		return err
+	}
+	johnny.ID, johnny.Tags = 3, []string{models.TagDoNotRent}
+	if err := db.UpdateGuestProfile(ctx, johnny); err != nil {
+		return err
+	}
+
+	if _, err := db.InsertGuest(ctx, models.Guest{FirstName: "Pat", LastName: "Lee", Email: "pending@here.com"}, fixturePassword); err != nil {
+		return err
+	}
+
+	day := dates.New(2021, 10, 19)
+	reservations := []models.Reservation{
+		{FirstName: "John", LastName: "Smith", Email: "john@smith.com", Phone: "555-555-5555", GuestID: 1, RoomID: 2, StartDate: day, EndDate: day.AddDays(2)},
+		{FirstName: "Jane", LastName: "Doe", Email: "jane@doe.com", GuestID: 2, RoomID: 1, StartDate: day.AddDays(-1), EndDate: day.AddDays(1)},
+		{FirstName: "Johnny", LastName: "Smith", Email: "j.smith@work.com", GuestID: 3, RoomID: 2, StartDate: day.AddDays(-3), EndDate: day},
+		{FirstName: "John", LastName: "Smith", Email: "john@smith.com", Phone: "555-555-5555", GuestID: 1, RoomID: 1, StartDate: today, EndDate: today.AddDays(2)},
+		{FirstName: "John", LastName: "Smith", Email: "john@smith.com", RoomID: 2, StartDate: today.AddDays(-2), EndDate: today},
+		{FirstName: "John", LastName: "Smith", Email: "john@smith.com", RoomID: 2, StartDate: today.AddDays(-5), EndDate: today.AddDays(-2)},
+		{FirstName: "Jack", LastName: "Doe", Email: "jack@doe.com", RoomID: 1, StartDate: today.AddDays(-4), EndDate: today.AddDays(-1)},
+		{FirstName: "Peter", LastName: "Parker", Email: "peter@parker.com", RoomID: 2, StartDate: dates.New(2049, 12, 30), EndDate: dates.New(2050, 1, 3)},
+		{FirstName: "Peter", LastName: "Parker", Email: "peter@parker.com", RoomID: 2, StartDate: dates.New(2050, 10, 11), EndDate: dates.New(2050, 10, 14)},
+		{FirstName: "Jane", LastName: "Doe", Email: "jane@doe.com", GuestID: 2, RoomID: 1, StartDate: dates.New(2050, 3, 10), EndDate: dates.New(2050, 3, 12),
+			HoldUntil: time.Now().Add(time.Hour)},
+		{FirstName: "Jane", LastName: "Doe", Email: "jane@doe.com", GuestID: 2, RoomID: 1, StartDate: dates.New(2050, 3, 20), EndDate: dates.New(2050, 3, 22),
+			HoldUntil: time.Now().Add(-time.Minute)},
+	}
+	for _, res := range reservations {
+		id, err := db.InsertReservation(ctx, res)
+		if err != nil {
+			return err
+		}
+
+		err = db.InsertRoomRestriction(ctx, models.RoomRestriction{
+			StartDate:     res.StartDate,
+			EndDate:       res.EndDate,
+			RoomID:        res.RoomID,
+			ReservationID: id,
+			RestrictionID: 1,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := db.InsertBlockForRoom(ctx, 1, dates.New(2049, 12, 31)); err != nil {
+		return err
+	}
+
+	for _, mail := range []models.GuestMail{
+		{ReservationID: 1, Kind: models.GuestMailPreArrival, Email: "john@smith.com", Subject: "Your stay at Fort Smythe", SentAt: time.Date(2021, 10, 16, 9, 0, 0, 0, time.UTC)},
+		{ReservationID: 7, Kind: models.GuestMailPostStay, Email: "jack@doe.com", Subject: "Thank you for staying with us", SentAt: time.Now()},
+	} {
+		if _, err := db.LogGuestMail(ctx, mail); err != nil {
+			return err
+		}
+	}
+
+	rules := []models.BookingRule{
+		{Name: "Long stays", PropertyID: 1, MaxNights: 30},
+		{
+			Name:        "Summer weeks",
+			PropertyID:  1,
+			RoomID:      1,
+			Start:       dates.New(2050, 7, 1),
+			End:         dates.New(2050, 8, 31),
+			MinNights:   7,
+			ArrivalDays: models.WeekdaysOf(time.Saturday),
+		},
+	}
+	for _, rule := range rules {
+		if _, err := db.InsertBookingRule(ctx, rule); err != nil {
+			return err
+		}
+	}
+
+	webhooks := []models.Webhook{
+		{URL: "https://accounting.example.com/hooks", Secret: "accounting-secret", Events: models.WebhookEvents, Active: true},
+		{URL: "https://housekeeping.example.com/hooks", Secret: "housekeeping-secret", Events: []string{models.EventReservationCancelled}},
+	}
+	for _, h := range webhooks {
+		if _, err := db.InsertWebhook(ctx, h); err != nil {
+			return err
+		}
+	}
+
+	created := time.Date(2021, 10, 19, 14, 0, 0, 0, time.UTC)
+	deliveries := []models.WebhookDelivery{
+		{WebhookID: 1, Event: models.EventReservationCreated, Payload: `{"event":"reservation.created"}`, Status: models.DeliveryDelivered,
+			Attempts: 1, ResponseCode: 200, CreatedAt: created, NextAttemptAt: created, DeliveredAt: created.Add(time.Second)},
+		{WebhookID: 1, Event: models.EventReservationUpdated, Payload: `{"event":"reservation.updated"}`, Status: models.DeliveryPending,
+			Attempts: 1, Error: "connection refused", CreatedAt: created.Add(time.Hour), NextAttemptAt: created.Add(time.Hour + time.Minute)},
+	}
+	for _, d := range deliveries {
+		if _, err := db.InsertWebhookDelivery(ctx, d); err != nil {
+			return err
+		}
+	}
+
+	started := time.Date(2021, 10, 19, 14, 1, 0, 0, time.UTC)
+	runs := []models.JobRun{
+		{Name: "release-expired-holds", Owner: "test", ScheduledFor: started.Add(-time.Minute), StartedAt: started.Add(-time.Minute), FinishedAt: started.Add(-time.Minute)},
+		{Name: "release-expired-holds", Owner: "test", ScheduledFor: started, StartedAt: started, FinishedAt: started.Add(time.Second), Error: "database is locked"},
+	}
+	for _, run := range runs {
+		if err := db.InsertJobRun(ctx, run); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
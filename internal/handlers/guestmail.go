@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"html/template"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/adewidyatamadb/GoBookings/internal/dates"
+	"github.com/adewidyatamadb/GoBookings/internal/models"
+	"github.com/adewidyatamadb/GoBookings/internal/render"
+)
+
+// pathToEmailTemplates is where the guest email templates are kept, they are read on every run so edits apply
+// without a restart
+var pathToEmailTemplates = "./email-templates"
+
+// postStayCatchUp is how many days late a thank you is still sent, for instance after the application was down
+const postStayCatchUp = 7
+
+// guestMailData is what the guest email templates are executed with
+type guestMailData struct {
+	models.Reservation
+	Nights    int
+	ReviewURL string
+	// Property is the property of the room
+	Property models.Property
+}
+
+// guestMailRange is a kind of guest email with the range of reservation dates it is due for
+type guestMailRange struct {
+	kind     string
+	from, to dates.Date
+}
+
+// guestMailsDue returns the enabled kinds of guest email with the reservation dates they are due for on day
+func (m *Repository) guestMailsDue(day dates.Date) []guestMailRange {
+	var due []guestMailRange
+	if m.App.PreArrivalDays > 0 {
+		// late bookings still get the arrival instructions
+		due = append(due, guestMailRange{models.GuestMailPreArrival, day, day.AddDays(m.App.PreArrivalDays)})
+	}
+	if m.App.CheckOutReminder {
+		due = append(due, guestMailRange{models.GuestMailCheckOut, day, day})
+	}
+	if m.App.PostStayDays > 0 {
+		last := day.AddDays(-m.App.PostStayDays)
+		due = append(due, guestMailRange{models.GuestMailPostStay, last.AddDays(-postStayCatchUp), last})
+	}
+	return due
+}
+
+// guestMailTemplate parses the template of a kind of guest email, which defines its "subject" and "body" and
+// can show dates the way the property writes them with humanDate
+func guestMailTemplate(kind string) (*template.Template, error) {
+	name := fmt.Sprintf("guest-%s.html", kind)
+	return template.New(name).Funcs(template.FuncMap{"humanDate": render.HumanDate}).ParseFiles(filepath.Join(pathToEmailTemplates, name))
+}
+
+// renderGuestMail returns the subject and body of a guest email
+func renderGuestMail(t *template.Template, data guestMailData) (string, string, error) {
+	var subject, body bytes.Buffer
+
+	err := t.ExecuteTemplate(&subject, "subject", data)
+	if err != nil {
+		return "", "", err
+	}
+	err = t.ExecuteTemplate(&body, "body", data)
+	if err != nil {
+		return "", "", err
+	}
+
+	return html.UnescapeString(strings.TrimSpace(subject.String())), body.String(), nil
+}
+
+// SendGuestMails emails the guests the pre-arrival, check-out and post-stay emails due at the time now and logs
+// them per reservation, so that each is sent once. The emails of each property are due on the day it is there.
+// Held reservations are skipped and deleted ones are gone, so cancelled stays are not mailed. It returns how many
+// emails were sent
+func (m *Repository) SendGuestMails(ctx context.Context, now time.Time) (int, error) {
+	properties, err := m.DB.AllProperties(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if len(properties) == 0 {
+		properties = []models.Property{{}}
+	}
+	byID := make(map[int]models.Property, len(properties))
+	for _, p := range properties {
+		byID[p.ID] = p
+	}
+	rooms, err := m.roomProperties(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	// rooms without a known property belong to the first one
+	propertyOf := func(roomID int) int {
+		if _, ok := byID[rooms[roomID]]; ok {
+			return rooms[roomID]
+		}
+		return properties[0].ID
+	}
+
+	sent := 0
+	for _, p := range properties {
+		for _, due := range m.guestMailsDue(dates.Of(m.App.TimeAt(p, now))) {
+			t, err := guestMailTemplate(due.kind)
+			if err != nil {
+				return sent, err
+			}
+
+			reservations, err := m.DB.ReservationsWithoutGuestMail(ctx, due.kind, due.from, due.to)
+			if err != nil {
+				return sent, err
+			}
+
+			for _, res := range reservations {
+				if propertyOf(res.RoomID) != p.ID {
+					continue
+				}
+
+				subject, body, err := renderGuestMail(t, guestMailData{
+					Reservation: res,
+					Nights:      res.StartDate.DaysUntil(res.EndDate),
+					ReviewURL:   m.App.ReviewURL,
+					Property:    p,
+				})
+				if err != nil {
+					return sent, fmt.Errorf("%s email for reservation %d: %w", due.kind, res.ID, err)
+				}
+
+				// the log comes first, an email is rather missed than sent twice
+				logged, err := m.DB.LogGuestMail(ctx, models.GuestMail{
+					ReservationID: res.ID,
+					Kind:          due.kind,
+					Email:         res.Email,
+					Subject:       subject,
+					SentAt:        now,
+				})
+				if err != nil {
+					return sent, err
+				}
+				if !logged {
+					continue
+				}
+
+				m.App.MailChan <- propertyMail(p, models.MailData{
+					To:       res.Email,
+					Subject:  subject,
+					Content:  body,
+					Template: "basic.html",
+				})
+				sent++
+			}
+		}
+	}
+
+	return sent, nil
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adewidyatamadb/GoBookings/internal/dates"
+	"github.com/adewidyatamadb/GoBookings/internal/models"
+)
+
+func TestRepository_guestMailsDue(t *testing.T) {
+	day := dates.New(2021, 10, 19)
+	defer func(preArrival, postStay int, checkOut bool) {
+		app.PreArrivalDays, app.PostStayDays, app.CheckOutReminder = preArrival, postStay, checkOut
+	}(app.PreArrivalDays, app.PostStayDays, app.CheckOutReminder)
+
+	app.PreArrivalDays, app.CheckOutReminder, app.PostStayDays = 3, true, 1
+	due := Repo.guestMailsDue(day)
+
+	expected := []guestMailRange{
+		{models.GuestMailPreArrival, day, dates.New(2021, 10, 22)},
+		{models.GuestMailCheckOut, day, day},
+		{models.GuestMailPostStay, dates.New(2021, 10, 11), dates.New(2021, 10, 18)},
+	}
+	if len(due) != len(expected) {
+		t.Fatalf("expected %d kinds of email due but got %+v", len(expected), due)
+	}
+	for i := range expected {
+		if due[i].kind != expected[i].kind || !due[i].from.Equal(expected[i].from) || !due[i].to.Equal(expected[i].to) {
+			t.Errorf("expected %+v but got %+v", expected[i], due[i])
+		}
+	}
+
+	app.PreArrivalDays, app.CheckOutReminder, app.PostStayDays = 0, false, 0
+	if due := Repo.guestMailsDue(day); len(due) != 0 {
+		t.Errorf("expected no emails due when they are turned off but got %+v", due)
+	}
+}
+
+func TestRenderGuestMail(t *testing.T) {
+	res := models.Reservation{
+		FirstName: "John",
+		StartDate: dates.New(2021, 10, 19),
+		EndDate:   dates.New(2021, 10, 21),
+		Room:      models.Room{RoomName: "Major's Suite"},
+	}
+
+	var tableTest = []struct {
+		name            string
+		kind            string
+		reviewURL       string
+		expectedSubject string
+		expectedBody    []string
+	}{
+		{"pre-arrival", models.GuestMailPreArrival, "", "Your stay at Fort Smythe starts Tuesday 19-Oct-2021", []string{"Dear John", "Major&#39;s Suite", "(2 nights)", "Arrival instructions"}},
+		{"check-out", models.GuestMailCheckOut, "", "Check-out today", []string{"Check-out is until 11am today"}},
+		{"post-stay", models.GuestMailPostStay, "https://example.com/review", "Thank you for staying with us", []string{"19-Oct-2021", `href="https://example.com/review"`}},
+	}
+
+	for _, test := range tableTest {
+		tmpl, err := guestMailTemplate(test.kind)
+		if err != nil {
+			t.Errorf("case - %s: %v", test.name, err)
+			continue
+		}
+
+		subject, body, err := renderGuestMail(tmpl, guestMailData{Reservation: res, Nights: 2, ReviewURL: test.reviewURL, Property: models.Property{Name: "Fort Smythe"}})
+		if err != nil {
+			t.Errorf("case - %s: %v", test.name, err)
+			continue
+		}
+
+		if subject != test.expectedSubject {
+			t.Errorf("case - %s: expected subject %q but got %q", test.name, test.expectedSubject, subject)
+		}
+		for _, s := range test.expectedBody {
+			if !strings.Contains(body, s) {
+				t.Errorf("case - %s: expected the body to contain %s but it did not", test.name, s)
+			}
+		}
+	}
+}
+
+func TestRepository_SendGuestMails(t *testing.T) {
+	defer func(preArrival, postStay int, checkOut bool) {
+		app.PreArrivalDays, app.PostStayDays, app.CheckOutReminder = preArrival, postStay, checkOut
+	}(app.PreArrivalDays, app.PostStayDays, app.CheckOutReminder)
+
+	var tableTest = []struct {
+		name          string
+		preArrival    int
+		checkOut      bool
+		postStay      int
+		expectedCount int
+	}{
+		{"all", 3, true, 1, 3},
+		{"pre-arrival only", 3, false, 0, 1},
+		{"none", 0, false, 0, 0},
+	}
+
+	defer resetTestDB()
+
+	for _, test := range tableTest {
+		resetTestDB()
+		app.PreArrivalDays, app.CheckOutReminder, app.PostStayDays = test.preArrival, test.checkOut, test.postStay
+
+		// reservation 7 of the post-stay emails was sent by another instance
+		n, err := Repo.SendGuestMails(context.Background(), time.Now())
+		if err != nil {
+			t.Errorf("case - %s: %v", test.name, err)
+		}
+		if n != test.expectedCount {
+			t.Errorf("case - %s: expected %d emails to be sent but got %d", test.name, test.expectedCount, n)
+		}
+	}
+}
+
+func TestRepository_SendGuestMails_TimeZones(t *testing.T) {
+	defer func(checkOut bool) { app.CheckOutReminder = checkOut }(app.CheckOutReminder)
+	app.CheckOutReminder = true
+
+	testApp := app
+	testApp.MailChan = make(chan models.MailData, 10)
+	repo := newTestRepo(&testApp)
+
+	defer resetTestDB()
+	ctx := context.Background()
+
+	// the suite is moved to Harbour House in Lisbon, where it is a day later at 23:30 UTC
+	err := testDB.MoveRoom(ctx, 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, res := range []models.Reservation{
+		{FirstName: "Ann", LastName: "Fort", Email: "ann@fort.com", RoomID: 1, StartDate: dates.New(2050, 5, 8), EndDate: dates.New(2050, 5, 11)},
+		{FirstName: "Ben", LastName: "Harbour", Email: "ben@harbour.com", RoomID: 2, StartDate: dates.New(2050, 5, 8), EndDate: dates.New(2050, 5, 11)},
+	} {
+		if _, err := testDB.InsertReservation(ctx, res); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := repo.SendGuestMails(ctx, time.Date(2050, 5, 10, 23, 30, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 || len(testApp.MailChan) != 1 {
+		t.Fatalf("expected 1 check-out reminder but got %d", n)
+	}
+	if msg := <-testApp.MailChan; msg.To != "ben@harbour.com" || msg.Brand != "Harbour House" {
+		t.Errorf("expected the reminder of the guest leaving Harbour House but got %+v", msg)
+	}
+}
+
+func TestRepository_AdminShowReservation_GuestMails(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := userRequest("GET", "/admin/reservations/all/1/show", "1", nil)
+
+	handler := http.HandlerFunc(Repo.AdminShowReservation)
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected code %d but got %d", http.StatusOK, w.Code)
+	}
+	for _, html := range []string{"Your stay at Fort Smythe", "pre-arrival", "16-Oct-2021 09:00"} {
+		if !strings.Contains(w.Body.String(), html) {
+			t.Errorf("expected to find %s but did not", html)
+		}
+	}
+}
@@ -0,0 +1,513 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adewidyatamadb/GoBookings/internal/forms"
+	"github.com/adewidyatamadb/GoBookings/internal/helpers"
+	"github.com/adewidyatamadb/GoBookings/internal/models"
+	"github.com/adewidyatamadb/GoBookings/internal/render"
+	"github.com/adewidyatamadb/GoBookings/internal/repository"
+	"github.com/adewidyatamadb/GoBookings/internal/urlsigner"
+)
+
+// verifyLinkTTL is how long an email verification link can be used
+const verifyLinkTTL = 24 * time.Hour
+
+// verifyBinding binds a verification link to the email address and the registration it activates,
+// registering again with the address invalidates the links sent before
+func verifyBinding(g models.Guest) string {
+	return g.Email + "\n" + g.PendingPassword
+}
+
+// guestEmail returns the stored form of the email address of a guest
+func guestEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// currentGuest returns the logged in guest, guests deleted since they logged in are logged out
+func (m *Repository) currentGuest(r *http.Request) (models.Guest, bool) {
+	id := m.App.Session.GetInt(r.Context(), "guest_id")
+	if id == 0 {
+		return models.Guest{}, false
+	}
+
+	g, err := m.DB.GetGuestByID(r.Context(), id)
+	if err != nil {
+		if !errors.Is(err, repository.ErrNotFound) {
+			log.Println(err)
+		}
+		m.App.Session.Remove(r.Context(), "guest_id")
+		return g, false
+	}
+
+	return g, true
+}
+
+// sendVerification emails g a link to verify the email address, which activates a pending
+// registration and shows the guest the reservations made with it, from the property of the request r
+func (m *Repository) sendVerification(r *http.Request, g models.Guest) error {
+	p, err := m.requestProperty(r)
+	if err != nil {
+		return err
+	}
+
+	link, err := urlsigner.New(m.App.Secret).Sign(
+		fmt.Sprintf("%s/guest/verify?id=%d", m.App.BaseURL, g.ID),
+		time.Now().Add(verifyLinkTTL),
+		verifyBinding(g),
+	)
+	if err != nil {
+		return err
+	}
+
+	htmlMessage := fmt.Sprintf(`
+		<strong>Verify your email address</strong>
+		<br>
+		Dear %s: <br>
+		Please follow <a href="%s">this link</a> within the next 24 hours to verify your email address.
+		Reservations you made with this address before you registered will then show in your bookings.
+		If you did not register, you can ignore this email.
+	`, g.FirstName, link)
+
+	m.App.MailChan <- propertyMail(p, models.MailData{
+		To:       g.Email,
+		Subject:  "Verify your email address",
+		Content:  htmlMessage,
+		Template: "basic.html",
+	})
+
+	return nil
+}
+
+// logInGuest starts a new session for the guest g
+func (m *Repository) logInGuest(r *http.Request, g models.Guest) {
+	_ = m.App.Session.RenewToken(r.Context())
+	m.App.Session.Put(r.Context(), "guest_id", g.ID)
+}
+
+// GuestRegister shows the guest registration form
+func (m *Repository) GuestRegister(w http.ResponseWriter, r *http.Request) {
+	data := make(map[string]interface{})
+	data["guest"] = models.Guest{}
+
+	render.Template(w, r, "guest-register.page.html", &models.TemplateData{
+		Form: forms.New(nil),
+		Data: data,
+	})
+}
+
+// PostGuestRegister registers a guest and emails a verification link, the guest can log in once
+// the email address is verified so nobody takes over a profile by registering with its address
+func (m *Repository) PostGuestRegister(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	g := models.Guest{
+		FirstName: r.Form.Get("first_name"),
+		LastName:  r.Form.Get("last_name"),
+		Email:     guestEmail(r.Form.Get("email")),
+		Phone:     r.Form.Get("phone"),
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("first_name", "last_name", "email", "password", "confirm_password")
+	form.IsEmail("email")
+	form.IsPassword("password", g.Email)
+	form.Matches("confirm_password", "password")
+
+	if form.Valid() {
+		g.ID, err = m.DB.InsertGuest(r.Context(), g, r.Form.Get("password"))
+		if errors.Is(err, repository.ErrConstraint) {
+			form.Errors.Add("email", "An account with this email already exists, please log in")
+		} else if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		data := make(map[string]interface{})
+		data["guest"] = g
+
+		render.Template(w, r, "guest-register.page.html", &models.TemplateData{
+			Form: form,
+			Data: data,
+		})
+		return
+	}
+
+	// the verification link is bound to the registration as it was stored
+	g, err = m.DB.GetGuestByID(r.Context(), g.ID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.sendVerification(r, g)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Welcome! Check your email and follow the link to activate your account")
+	http.Redirect(w, r, "/guest/login", http.StatusSeeOther)
+}
+
+// GuestLogin shows the guest login form
+func (m *Repository) GuestLogin(w http.ResponseWriter, r *http.Request) {
+	render.Template(w, r, "guest-login.page.html", &models.TemplateData{
+		Form: forms.New(nil),
+	})
+}
+
+// PostGuestLogin logs a guest in, failed logins are throttled like staff logins
+func (m *Repository) PostGuestLogin(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	email := guestEmail(r.Form.Get("email"))
+	// guests and staff may share an email address, their failed logins are counted apart
+	account := "guest:" + email
+
+	form := forms.New(r.PostForm)
+	form.Required("email", "password")
+	form.IsEmail("email")
+	if !form.Valid() {
+		render.Template(w, r, "guest-login.page.html", &models.TemplateData{
+			Form: form,
+		})
+		return
+	}
+
+	if m.loginThrottled(r, account) {
+		m.App.Session.Put(r.Context(), "error", tooManyLogins)
+		http.Redirect(w, r, "/guest/login", http.StatusSeeOther)
+		return
+	}
+
+	id, err := m.DB.AuthenticateGuest(r.Context(), email, r.Form.Get("password"))
+	if errors.Is(err, repository.ErrInvalidCredentials) {
+		m.App.LoginIPs.Fail(helpers.ClientIP(r))
+		m.App.LoginAccounts.Fail(loginAccount(account))
+		m.App.Session.Put(r.Context(), "error", "Invalid login credentials")
+		http.Redirect(w, r, "/guest/login", http.StatusSeeOther)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	m.App.LoginAccounts.Reset(loginAccount(account))
+
+	m.logInGuest(r, models.Guest{ID: id})
+
+	m.App.Session.Put(r.Context(), "flash", "Logged in successfully")
+	http.Redirect(w, r, "/guest/bookings", http.StatusSeeOther)
+}
+
+// GuestLogout logs the guest out
+func (m *Repository) GuestLogout(w http.ResponseWriter, r *http.Request) {
+	m.App.Session.Remove(r.Context(), "guest_id")
+	_ = m.App.Session.RenewToken(r.Context())
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// GuestBookings shows the upcoming and past reservations of the logged in guest
+func (m *Repository) GuestBookings(w http.ResponseWriter, r *http.Request) {
+	g, ok := m.currentGuest(r)
+	if !ok {
+		m.App.Session.Put(r.Context(), "error", "Please log in to see your bookings")
+		http.Redirect(w, r, "/guest/login", http.StatusSeeOther)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["guest"] = g
+
+	// the profile may hold reservations anyone made with the email address, so they
+	// are only shown once the guest proved to own it
+	if g.EmailVerified {
+		reservations, err := m.DB.GuestReservations(r.Context(), g.ID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		rooms, err := m.roomProperties(r.Context())
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		// stays are upcoming until the departure day has passed at the property
+		var upcoming, past []models.Reservation
+		for _, res := range reservations {
+			p, err := m.cachedProperty(r.Context(), rooms[res.RoomID])
+			if err != nil {
+				helpers.ServerError(w, err)
+				return
+			}
+			if res.EndDate.Before(m.App.TodayAt(p)) {
+				past = append(past, res)
+			} else {
+				upcoming = append([]models.Reservation{res}, upcoming...)
+			}
+		}
+
+		data["upcoming"] = upcoming
+		data["past"] = past
+	}
+
+	render.Template(w, r, "guest-bookings.page.html", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// PostGuestResendVerification emails the logged in guest a new verification link
+func (m *Repository) PostGuestResendVerification(w http.ResponseWriter, r *http.Request) {
+	g, ok := m.currentGuest(r)
+	if !ok {
+		http.Redirect(w, r, "/guest/login", http.StatusSeeOther)
+		return
+	}
+
+	if !g.EmailVerified {
+		err := m.sendVerification(r, g)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		m.App.Session.Put(r.Context(), "flash", "A new verification link is on its way")
+	}
+
+	http.Redirect(w, r, "/guest/bookings", http.StatusSeeOther)
+}
+
+// GuestVerify verifies the email address of a guest from a signed link and adds the
+// reservations made with the address before to the guest's bookings
+func (m *Repository) GuestVerify(w http.ResponseWriter, r *http.Request) {
+	invalid := func() {
+		m.App.Session.Put(r.Context(), "error", "This verification link is invalid or has expired, please use the latest link or register again")
+		http.Redirect(w, r, "/guest/login", http.StatusSeeOther)
+	}
+
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		invalid()
+		return
+	}
+
+	g, err := m.DB.GetGuestByID(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		invalid()
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = urlsigner.New(m.App.Secret).Verify(r.URL.RequestURI(), verifyBinding(g), time.Now())
+	if errors.Is(err, urlsigner.ErrInvalidSignature) || errors.Is(err, urlsigner.ErrExpired) {
+		invalid()
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.DB.VerifyGuestEmail(r.Context(), g.ID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	claimed, err := m.DB.ClaimReservations(r.Context(), g.ID, g.Email)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	msg := "Your email address has been verified"
+	if claimed > 0 {
+		msg = fmt.Sprintf("%s, %d earlier reservations were added to your bookings", msg, claimed)
+	}
+	m.App.Session.Put(r.Context(), "flash", msg)
+
+	if m.App.Session.GetInt(r.Context(), "guest_id") != g.ID {
+		http.Redirect(w, r, "/guest/login", http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, "/guest/bookings", http.StatusSeeOther)
+}
+
+// GuestForgotPassword shows the form to request a password reset link for a guest account
+func (m *Repository) GuestForgotPassword(w http.ResponseWriter, r *http.Request) {
+	render.Template(w, r, "guest-forgot-password.page.html", &models.TemplateData{
+		Form: forms.New(nil),
+	})
+}
+
+// PostGuestForgotPassword emails a password reset link to a guest, it responds the same way
+// whether the email belongs to a guest account or not
+func (m *Repository) PostGuestForgotPassword(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("email")
+	form.IsEmail("email")
+	if !form.Valid() {
+		render.Template(w, r, "guest-forgot-password.page.html", &models.TemplateData{
+			Form: form,
+		})
+		return
+	}
+
+	g, err := m.DB.GetGuestByEmail(r.Context(), guestEmail(r.Form.Get("email")))
+	if err == nil && g.HasAccount() {
+		link, err := urlsigner.New(m.App.Secret).Sign(
+			fmt.Sprintf("%s/guest/reset-password?id=%d", m.App.BaseURL, g.ID),
+			time.Now().Add(resetLinkTTL),
+			g.Password,
+		)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		htmlMessage := fmt.Sprintf(`
+			<strong>Password reset</strong>
+			<br>
+			Dear %s: <br>
+			Someone asked to reset the password of your account. If it was you, follow
+			<a href="%s">this link</a> within the next hour to choose a new password.
+			Otherwise you can ignore this email.
+		`, g.FirstName, link)
+
+		p, err := m.requestProperty(r)
+		if err != nil {
+			log.Println(err)
+		} else {
+			m.App.MailChan <- propertyMail(p, models.MailData{
+				To:       g.Email,
+				Subject:  "Reset your password",
+				Content:  htmlMessage,
+				Template: "basic.html",
+			})
+		}
+	} else if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		log.Println(err)
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "If an account exists for this email, a reset link is on its way")
+	http.Redirect(w, r, "/guest/login", http.StatusSeeOther)
+}
+
+// resetGuest returns the guest of a signed password reset request, the link stops
+// working once it expires or the password has been changed
+func (m *Repository) resetGuest(r *http.Request) (models.Guest, error) {
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		return models.Guest{}, urlsigner.ErrInvalidSignature
+	}
+
+	g, err := m.DB.GetGuestByID(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return g, urlsigner.ErrInvalidSignature
+	} else if err != nil {
+		return g, err
+	}
+	if !g.HasAccount() {
+		return g, urlsigner.ErrInvalidSignature
+	}
+
+	err = urlsigner.New(m.App.Secret).Verify(r.URL.RequestURI(), g.Password, time.Now())
+	return g, err
+}
+
+// guestResetLinkError handles a guest reset link that cannot be used
+func (m *Repository) guestResetLinkError(w http.ResponseWriter, r *http.Request, err error) {
+	if !errors.Is(err, urlsigner.ErrInvalidSignature) && !errors.Is(err, urlsigner.ErrExpired) {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "error", "This reset link is invalid or has expired, please request a new one")
+	http.Redirect(w, r, "/guest/forgot-password", http.StatusSeeOther)
+}
+
+// GuestResetPassword shows the form to choose a new guest password from a reset link
+func (m *Repository) GuestResetPassword(w http.ResponseWriter, r *http.Request) {
+	_, err := m.resetGuest(r)
+	if err != nil {
+		m.guestResetLinkError(w, r, err)
+		return
+	}
+
+	stringMap := make(map[string]string)
+	stringMap["action"] = r.URL.RequestURI()
+
+	render.Template(w, r, "reset-password.page.html", &models.TemplateData{
+		Form:      forms.New(nil),
+		StringMap: stringMap,
+	})
+}
+
+// PostGuestResetPassword stores the new guest password from a reset link and logs the guest out
+func (m *Repository) PostGuestResetPassword(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	g, err := m.resetGuest(r)
+	if err != nil {
+		m.guestResetLinkError(w, r, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("password", "confirm_password")
+	form.IsPassword("password", g.Email)
+	form.Matches("confirm_password", "password")
+
+	if !form.Valid() {
+		stringMap := make(map[string]string)
+		stringMap["action"] = r.URL.RequestURI()
+
+		render.Template(w, r, "reset-password.page.html", &models.TemplateData{
+			Form:      form,
+			StringMap: stringMap,
+		})
+		return
+	}
+
+	err = m.DB.UpdateGuestPassword(r.Context(), g.ID, r.Form.Get("password"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Remove(r.Context(), "guest_id")
+	_ = m.App.Session.RenewToken(r.Context())
+
+	m.App.Session.Put(r.Context(), "flash", "Your password has been reset, please log in")
+	http.Redirect(w, r, "/guest/login", http.StatusSeeOther)
+}
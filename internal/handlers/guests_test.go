@@ -0,0 +1,402 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adewidyatamadb/GoBookings/internal/models"
+	"github.com/adewidyatamadb/GoBookings/internal/urlsigner"
+)
+
+// guestRequest builds a request for the guest pages, logged in as guestID unless it is 0
+func guestRequest(method, target string, guestID int, postedData url.Values) *http.Request {
+	var r *http.Request
+	if postedData != nil {
+		r = httptest.NewRequest(method, target, strings.NewReader(postedData.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		r = httptest.NewRequest(method, target, nil)
+	}
+
+	r = r.WithContext(getCTX(r))
+	if guestID > 0 {
+		session.Put(r.Context(), "guest_id", guestID)
+	}
+
+	return r
+}
+
+func TestRepository_PostGuestRegister(t *testing.T) {
+	var tableTest = []struct {
+		name               string
+		email              string
+		password           string
+		confirmation       string
+		expectedStatusCode int
+		expectedHTML       string
+	}{
+		{"valid", "new@guest.com", "long enough 42", "long enough 42", http.StatusSeeOther, ""},
+		{"email taken", "jane@doe.com", "long enough 42", "long enough 42", http.StatusOK, "already exists"},
+		{"invalid email", "nobody", "long enough 42", "long enough 42", http.StatusOK, "Invalid email address"},
+		{"not matching", "new@guest.com", "long enough 42", "long enough 43", http.StatusOK, "does not match"},
+		{"too short", "new@guest.com", "short 42", "short 42", http.StatusOK, "at least 10 characters"},
+	}
+
+	defer resetTestDB()
+
+	for _, test := range tableTest {
+		postedData := url.Values{}
+		postedData.Add("first_name", "John")
+		postedData.Add("last_name", "Smith")
+		postedData.Add("email", test.email)
+		postedData.Add("password", test.password)
+		postedData.Add("confirm_password", test.confirmation)
+
+		w := httptest.NewRecorder()
+		r := guestRequest("POST", "/guest/register", 0, postedData)
+
+		handler := http.HandlerFunc(Repo.PostGuestRegister)
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.expectedStatusCode {
+			t.Errorf("case - %s: expected code %d but got %d", test.name, test.expectedStatusCode, w.Code)
+		}
+
+		if test.expectedHTML != "" && !strings.Contains(w.Body.String(), test.expectedHTML) {
+			t.Errorf("case - %s: expected to find %s but did not", test.name, test.expectedHTML)
+		}
+
+		if w.Code == http.StatusSeeOther {
+			actualLoc, _ := w.Result().Location()
+			if actualLoc.String() != "/guest/login" {
+				t.Errorf("case - %s: expected location /guest/login, but got location %s", test.name, actualLoc.String())
+			}
+		}
+
+		if id := session.GetInt(r.Context(), "guest_id"); id != 0 {
+			t.Errorf("case - %s: expected the guest not to be logged in before verifying the email but got %d", test.name, id)
+		}
+	}
+}
+
+func TestRepository_PostGuestLogin(t *testing.T) {
+	var tableTest = []struct {
+		name               string
+		email              string
+		password           string
+		expectedStatusCode int
+		expectedLocation   string
+		expectedGuestID    int
+	}{
+		{"valid", "john@smith.com", "password", http.StatusSeeOther, "/guest/bookings", 1},
+		{"email in other case", "John@Smith.com", "password", http.StatusSeeOther, "/guest/bookings", 1},
+		{"wrong password", "jane@doe.com", "wrong", http.StatusSeeOther, "/guest/login", 0},
+		{"pending registration", "pending@here.com", "password", http.StatusSeeOther, "/guest/login", 0},
+		{"invalid email", "nobody", "password", http.StatusOK, "", 0},
+	}
+
+	defer resetTestDB()
+
+	for _, test := range tableTest {
+		postedData := url.Values{}
+		postedData.Add("email", test.email)
+		postedData.Add("password", test.password)
+
+		w := httptest.NewRecorder()
+		r := guestRequest("POST", "/guest/login", 0, postedData)
+
+		handler := http.HandlerFunc(Repo.PostGuestLogin)
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.expectedStatusCode {
+			t.Errorf("case - %s: expected code %d but got %d", test.name, test.expectedStatusCode, w.Code)
+		}
+
+		if test.expectedLocation != "" {
+			actualLoc, _ := w.Result().Location()
+			if actualLoc.String() != test.expectedLocation {
+				t.Errorf("case - %s: expected location %s, but got location %s", test.name, test.expectedLocation, actualLoc.String())
+			}
+		}
+
+		if id := session.GetInt(r.Context(), "guest_id"); id != test.expectedGuestID {
+			t.Errorf("case - %s: expected guest %d to be logged in but got %d", test.name, test.expectedGuestID, id)
+		}
+	}
+}
+
+func TestRepository_GuestBookings(t *testing.T) {
+	var tableTest = []struct {
+		name               string
+		guestID            int
+		expectedStatusCode int
+		expectedHTML       []string
+		hiddenHTML         string
+	}{
+		{"verified guest", 1, http.StatusOK, []string{"Major&#39;s Suite", "General&#39;s Quarters"}, "Resend verification email"},
+		{"unverified guest", 2, http.StatusOK, []string{"Resend verification email"}, "Major&#39;s Suite"},
+		{"logged out", 0, http.StatusSeeOther, nil, ""},
+		{"deleted guest", 100, http.StatusSeeOther, nil, ""},
+	}
+
+	for _, test := range tableTest {
+		w := httptest.NewRecorder()
+		r := guestRequest("GET", "/guest/bookings", test.guestID, nil)
+
+		handler := http.HandlerFunc(Repo.GuestBookings)
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.expectedStatusCode {
+			t.Errorf("case - %s: expected code %d but got %d", test.name, test.expectedStatusCode, w.Code)
+		}
+
+		for _, html := range test.expectedHTML {
+			if !strings.Contains(w.Body.String(), html) {
+				t.Errorf("case - %s: expected to find %s but did not", test.name, html)
+			}
+		}
+
+		if test.hiddenHTML != "" && strings.Contains(w.Body.String(), test.hiddenHTML) {
+			t.Errorf("case - %s: expected not to find %s but did", test.name, test.hiddenHTML)
+		}
+	}
+}
+
+// verifyLink returns the path and query of a verification link for a guest of the fixtures
+func verifyLink(t *testing.T, id string, g models.Guest, expires time.Time) string {
+	t.Helper()
+
+	link, err := urlsigner.New(app.Secret).Sign(app.BaseURL+"/guest/verify?id="+id, expires, verifyBinding(g))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return strings.TrimPrefix(link, app.BaseURL)
+}
+
+func TestRepository_GuestVerify(t *testing.T) {
+	john := models.Guest{Email: "john@smith.com"}
+	pending, err := testDB.GetGuestByID(context.Background(), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resetTestDB()
+
+	var tableTest = []struct {
+		name             string
+		link             string
+		guestID          int
+		expectedLocation string
+		expectedFlash    string
+	}{
+		{"logged in", verifyLink(t, "1", john, time.Now().Add(time.Hour)), 1, "/guest/bookings", "2 earlier reservations"},
+		{"logged out", verifyLink(t, "1", john, time.Now().Add(time.Hour)), 0, "/guest/login", "verified"},
+		{"pending registration", verifyLink(t, "4", pending, time.Now().Add(time.Hour)), 0, "/guest/login", "verified"},
+		{"replaced registration", verifyLink(t, "4", models.Guest{Email: pending.Email, PendingPassword: "older"}, time.Now().Add(time.Hour)), 0, "/guest/login", ""},
+		{"expired link", verifyLink(t, "1", john, time.Now().Add(-time.Minute)), 1, "/guest/login", ""},
+		{"other email", verifyLink(t, "1", models.Guest{Email: "old@smith.com"}, time.Now().Add(time.Hour)), 1, "/guest/login", ""},
+		{"unknown guest", verifyLink(t, "100", john, time.Now().Add(time.Hour)), 0, "/guest/login", ""},
+		{"unsigned", "/guest/verify?id=1", 1, "/guest/login", ""},
+	}
+
+	for _, test := range tableTest {
+		w := httptest.NewRecorder()
+		r := guestRequest("GET", test.link, test.guestID, nil)
+
+		handler := http.HandlerFunc(Repo.GuestVerify)
+		handler.ServeHTTP(w, r)
+
+		actualLoc, _ := w.Result().Location()
+		if actualLoc.String() != test.expectedLocation {
+			t.Errorf("case - %s: expected location %s, but got location %s", test.name, test.expectedLocation, actualLoc.String())
+		}
+
+		flash := session.GetString(r.Context(), "flash")
+		if test.expectedFlash == "" && flash != "" || !strings.Contains(flash, test.expectedFlash) {
+			t.Errorf("case - %s: expected the flash message to contain %q but got %q", test.name, test.expectedFlash, flash)
+		}
+	}
+}
+
+func TestRepository_Reservation_GuestPrefill(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := guestRequest("GET", "/make-reservation", 1, nil)
+	session.Put(r.Context(), "reservation", models.Reservation{
+		RoomID: 1,
+		Room: models.Room{
+			ID:       1,
+			RoomName: "General's Quarters",
+		},
+	})
+
+	handler := http.HandlerFunc(Repo.Reservation)
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected code %d but got %d", http.StatusOK, w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "john@smith.com") || !strings.Contains(w.Body.String(), "555-555-5555") {
+		t.Error("expected the reservation form to be filled in with the details of the guest")
+	}
+}
+
+func TestRepository_PostReservation_Guest(t *testing.T) {
+	var tableTest = []struct {
+		name            string
+		guestID         int
+		email           string
+		expectedGuestID int
+	}{
+		{"logged in guest", 1, "other@smith.com", 1},
+		{"anonymous with known email", 0, "John@Smith.com", 1},
+		{"anonymous with new email and a known phone number", 0, "new@guest.com", 5},
+	}
+
+	defer resetTestDB()
+
+	for _, test := range tableTest {
+		resetTestDB()
+		postedData := url.Values{}
+		postedData.Add("start_date", "11-10-2050")
+		postedData.Add("end_date", "12-10-2050")
+		postedData.Add("room_id", "1")
+		postedData.Add("first_name", "John")
+		postedData.Add("last_name", "Smith")
+		postedData.Add("email", test.email)
+		postedData.Add("phone", "555-555-5555")
+
+		w := httptest.NewRecorder()
+		r := guestRequest("POST", "/make-reservation", test.guestID, postedData)
+
+		handler := http.HandlerFunc(Repo.PostReservation)
+		handler.ServeHTTP(w, r)
+
+		res, ok := session.Get(r.Context(), "reservation").(models.Reservation)
+		if !ok {
+			t.Errorf("case - %s: expected the reservation to be kept in the session", test.name)
+			continue
+		}
+		if res.GuestID != test.expectedGuestID {
+			t.Errorf("case - %s: expected the reservation to belong to guest %d but got %d", test.name, test.expectedGuestID, res.GuestID)
+		}
+	}
+}
+
+func TestRepository_PostGuestForgotPassword(t *testing.T) {
+	var tableTest = []struct {
+		name               string
+		email              string
+		expectedStatusCode int
+		expectedLocation   string
+	}{
+		{"account", "john@smith.com", http.StatusSeeOther, "/guest/login"},
+		{"no account", "j.smith@work.com", http.StatusSeeOther, "/guest/login"},
+		{"pending registration", "pending@here.com", http.StatusSeeOther, "/guest/login"},
+		{"unknown email", "nobody@here.com", http.StatusSeeOther, "/guest/login"},
+		{"invalid email", "nobody", http.StatusOK, ""},
+	}
+
+	defer resetTestDB()
+
+	for _, test := range tableTest {
+		postedData := url.Values{}
+		postedData.Add("email", test.email)
+
+		w := httptest.NewRecorder()
+		r := guestRequest("POST", "/guest/forgot-password", 0, postedData)
+
+		handler := http.HandlerFunc(Repo.PostGuestForgotPassword)
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.expectedStatusCode {
+			t.Errorf("case - %s: expected code %d but got %d", test.name, test.expectedStatusCode, w.Code)
+		}
+
+		if test.expectedLocation != "" {
+			actualLoc, _ := w.Result().Location()
+			if actualLoc.String() != test.expectedLocation {
+				t.Errorf("case - %s: expected location %s, but got location %s", test.name, test.expectedLocation, actualLoc.String())
+			}
+		}
+	}
+}
+
+// guestResetLink returns the path and query of a reset link for a guest of the fixtures
+func guestResetLink(t *testing.T, id, password string, expires time.Time) string {
+	t.Helper()
+
+	link, err := urlsigner.New(app.Secret).Sign(app.BaseURL+"/guest/reset-password?id="+id, expires, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return strings.TrimPrefix(link, app.BaseURL)
+}
+
+func TestRepository_GuestResetPassword(t *testing.T) {
+	john, err := testDB.GetGuestByID(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resetTestDB()
+
+	valid := guestResetLink(t, "1", john.Password, time.Now().Add(time.Hour))
+
+	var tableTest = []struct {
+		name               string
+		method             string
+		link               string
+		password           string
+		expectedStatusCode int
+		expectedLocation   string
+	}{
+		{"show form", "GET", valid, "", http.StatusOK, ""},
+		{"expired link", "GET", guestResetLink(t, "1", john.Password, time.Now().Add(-time.Minute)), "", http.StatusSeeOther, "/guest/forgot-password"},
+		{"used link", "GET", guestResetLink(t, "1", "old hash", time.Now().Add(time.Hour)), "", http.StatusSeeOther, "/guest/forgot-password"},
+		{"tampered link", "GET", strings.Replace(valid, "id=1", "id=2", 1), "", http.StatusSeeOther, "/guest/forgot-password"},
+		{"no account", "GET", guestResetLink(t, "4", "", time.Now().Add(time.Hour)), "", http.StatusSeeOther, "/guest/forgot-password"},
+		{"unknown guest", "GET", guestResetLink(t, "100", john.Password, time.Now().Add(time.Hour)), "", http.StatusSeeOther, "/guest/forgot-password"},
+		{"weak password", "POST", valid, "weak", http.StatusOK, ""},
+		{"reset", "POST", valid, "long enough 42", http.StatusSeeOther, "/guest/login"},
+		{"used link after the reset", "GET", valid, "", http.StatusSeeOther, "/guest/forgot-password"},
+		{"reset with expired link", "POST", guestResetLink(t, "1", john.Password, time.Now().Add(-time.Minute)), "long enough 42", http.StatusSeeOther, "/guest/forgot-password"},
+	}
+
+	for _, test := range tableTest {
+		var postedData url.Values
+		if test.method == "POST" {
+			postedData = url.Values{}
+			postedData.Add("password", test.password)
+			postedData.Add("confirm_password", test.password)
+		}
+
+		w := httptest.NewRecorder()
+		r := guestRequest(test.method, test.link, 1, postedData)
+
+		handler := http.HandlerFunc(Repo.GuestResetPassword)
+		if test.method == "POST" {
+			handler = Repo.PostGuestResetPassword
+		}
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.expectedStatusCode {
+			t.Errorf("case - %s: expected code %d but got %d", test.name, test.expectedStatusCode, w.Code)
+		}
+
+		if test.expectedLocation != "" {
+			actualLoc, _ := w.Result().Location()
+			if actualLoc.String() != test.expectedLocation {
+				t.Errorf("case - %s: expected location %s, but got location %s", test.name, test.expectedLocation, actualLoc.String())
+			}
+		}
+
+		if test.name == "reset" && session.GetInt(r.Context(), "guest_id") != 0 {
+			t.Errorf("case - %s: expected the guest to be logged out after the reset", test.name)
+		}
+	}
+}
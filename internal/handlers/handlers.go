@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -9,7 +11,9 @@ import (
 	"strings"
 	"time"
 
+	"github.com/adewidyatamadb/GoBookings/internal/booking"
 	"github.com/adewidyatamadb/GoBookings/internal/config"
+	"github.com/adewidyatamadb/GoBookings/internal/dates"
 	"github.com/adewidyatamadb/GoBookings/internal/driver"
 	"github.com/adewidyatamadb/GoBookings/internal/forms"
 	"github.com/adewidyatamadb/GoBookings/internal/helpers"
@@ -25,26 +29,36 @@ var Repo *Repository
 
 // Repository is the repository type
 type Repository struct {
-	App *config.AppConfig
-	DB  repository.DatabaseRepo
+	App     *config.AppConfig
+	DB      repository.DatabaseRepo
+	Booking *booking.Service
+	// properties caches the property list every request is matched against
+	properties propertyCache
 }
 
-// NewRepo creates a new repository
+// NewRepo creates a new repository backed by the database driver of db
 func NewRepo(a *config.AppConfig, db *driver.DB) *Repository {
-	return &Repository{
-		App: a,
-		DB:  dbrepo.NewPostgresRepo(db.SQL, a),
+	if db.Driver == driver.SQLite {
+		return newRepository(a, dbrepo.NewSQLiteRepo(db.SQL, a))
 	}
+
+	return newRepository(a, dbrepo.NewPostgresRepo(db.SQL, a))
 }
 
-// NewTestRepo creates a new test repository
-func NewTestRepo(a *config.AppConfig) *Repository {
+// newRepository returns the handlers for a backed by repo
+func newRepository(a *config.AppConfig, repo repository.DatabaseRepo) *Repository {
 	return &Repository{
-		App: a,
-		DB:  dbrepo.NewTestingRepo(a),
+		App:     a,
+		DB:      repo,
+		Booking: booking.New(a, repo),
 	}
 }
 
+// NewDemoRepo creates a new repository backed by an in-memory database
+func NewDemoRepo(a *config.AppConfig) *Repository {
+	return newRepository(a, dbrepo.NewMemoryRepo(a))
+}
+
 // NewHandlers sets the repository for the handlers
 func NewHandlers(r *Repository) {
 	Repo = r
@@ -70,16 +84,24 @@ func (m *Repository) Reservation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	room, err := m.DB.GetRoomByID(res.RoomID)
+	room, err := m.DB.GetRoomByID(r.Context(), res.RoomID)
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "cannot find the room")
+		m.App.Session.Put(r.Context(), "error", roomErrorMessage(err))
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
 	res.Room.RoomName = room.RoomName
 
-	sd := res.StartDate.Format("02-01-2006")
-	ed := res.EndDate.Format("02-01-2006")
+	// logged in guests find their details filled in
+	if g, ok := m.currentGuest(r); ok && res.Email == "" {
+		res.FirstName = g.FirstName
+		res.LastName = g.LastName
+		res.Email = g.Email
+		res.Phone = g.Phone
+	}
+
+	sd := m.App.InputDate(res.StartDate)
+	ed := m.App.InputDate(res.EndDate)
 
 	stringMap := make(map[string]string)
 	stringMap["start_date"] = sd
@@ -116,47 +138,44 @@ func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 	start := r.Form.Get("start_date")
 	end := r.Form.Get("end_date")
 
-	layout := "02-01-2006"
-	startDate, err := time.Parse(layout, start)
+	startDate, err := m.App.ParseDate(start)
 	if err != nil {
 		m.App.Session.Put(r.Context(), "error", "cannot parse arrival date!")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
-	endDate, err := time.Parse(layout, end)
+	endDate, err := m.App.ParseDate(end)
 	if err != nil {
 		m.App.Session.Put(r.Context(), "error", "cannot parse departure date!")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
-	}
-
-	room, err := m.DB.GetRoomByID(roomID)
-	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "cannot find the room")
-		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
 
-	reservation := models.Reservation{
+	g, loggedIn := m.currentGuest(r)
+	req := booking.NewReservation{
+		RoomID:    roomID,
+		StartDate: startDate,
+		EndDate:   endDate,
 		FirstName: r.Form.Get("first_name"),
 		LastName:  r.Form.Get("last_name"),
 		Email:     r.Form.Get("email"),
 		Phone:     r.Form.Get("phone"),
-		StartDate: startDate,
-		EndDate:   endDate,
-		RoomID:    roomID,
-		Room: models.Room{
-			ID:       roomID,
-			RoomName: room.RoomName,
-		},
+		UserID:    m.App.Session.GetInt(r.Context(), "user_id"),
+	}
+	if loggedIn {
+		req.GuestID = g.ID
+		// guests who verified the address they book with already proved they can be reached there
+		req.Verified = g.EmailVerified && g.Email == guestEmail(req.Email)
 	}
 
-	form := forms.New(r.PostForm)
-
-	form.Required("first_name", "last_name", "email")
-	form.MinLength("first_name", 3)
-	form.IsEmail("email")
+	reservation, err := m.Booking.CreateReservation(r.Context(), req)
+	var invalid *booking.ValidationError
+	if errors.As(err, &invalid) {
+		form := forms.New(r.PostForm)
+		for field, message := range invalid.Fields {
+			form.Errors.Add(field, message)
+		}
 
-	if !form.Valid() {
 		data := make(map[string]interface{})
 		data["reservation"] = reservation
 		render.Template(w, r, "make-reservation.page.html", &models.TemplateData{
@@ -164,28 +183,31 @@ func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 			Data: data,
 		})
 		return
-	}
-
-	newReservationID, err := m.DB.InsertReservation(reservation)
-	if err != nil {
+	} else if errors.Is(err, repository.ErrUnavailable) {
+		m.App.Session.Put(r.Context(), "error", "Sorry, the room is no longer available for these dates")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	} else if errors.Is(err, repository.ErrNotFound) {
+		m.App.Session.Put(r.Context(), "error", roomErrorMessage(err))
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	} else if err != nil {
 		m.App.Session.Put(r.Context(), "error", "cannot insert reservation into the database!")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
 
-	restriction := models.RoomRestriction{
-		StartDate:     reservation.StartDate,
-		EndDate:       reservation.EndDate,
-		RoomID:        reservation.RoomID,
-		ReservationID: newReservationID,
-		RestrictionID: 1,
-	}
+	m.App.Session.Put(r.Context(), "reservation", reservation)
+
+	http.Redirect(w, r, "/reservation-summary", http.StatusSeeOther)
+}
 
-	err = m.DB.InsertRoomRestriction(restriction)
+// sendReservationEmails sends the confirmation of a reservation to the guest and the notification to the owner
+// of the property of the room
+func (m *Repository) sendReservationEmails(ctx context.Context, res models.Reservation) error {
+	p, err := m.propertyOf(ctx, res.RoomID)
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "cannot insert room restriction into the database!")
-		http.Redirect(w, r, "/", http.StatusSeeOther)
-		return
+		return err
 	}
 
 	// send notifications - to guest
@@ -194,37 +216,34 @@ func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 		<br>
 		Dear %s: <br>
 		This is to confirm your reservation from %s to %s.
-	`, reservation.FirstName, reservation.StartDate.Format("02-Jan-2006"), reservation.EndDate.Format("02-Jan-2006"))
+	`, res.FirstName, m.App.FormatDate(res.StartDate), m.App.FormatDate(res.EndDate))
 
-	msg := models.MailData{
-		To:       reservation.Email,
-		From:     "fort@smythe.com",
+	m.App.MailChan <- propertyMail(p, models.MailData{
+		To:       res.Email,
 		Subject:  "Reservation Confirmation",
 		Content:  htmlMessage,
 		Template: "basic.html",
-	}
+	})
 
-	m.App.MailChan <- msg
+	if p.OwnerEmail == "" {
+		return nil
+	}
 
 	// send notifications - owner
 	htmlMessage = fmt.Sprintf(`
 		<strong>Reservation Notification</strong>
 		<br>
 		A reservation has been made for %s from %s to %s.
-	`, reservation.Room.RoomName, reservation.StartDate.Format("02-Jan-2006"), reservation.EndDate.Format("02-Jan-2006"))
+	`, res.Room.RoomName, m.App.FormatDate(res.StartDate), m.App.FormatDate(res.EndDate))
 
-	msg = models.MailData{
-		To:      "me@here.com",
-		From:    "fort@smythe.com",
+	m.App.MailChan <- models.MailData{
+		To:      p.OwnerEmail,
+		From:    p.MailFrom,
 		Subject: "Reservation Notification",
 		Content: htmlMessage,
 	}
 
-	m.App.MailChan <- msg
-
-	m.App.Session.Put(r.Context(), "reservation", reservation)
-
-	http.Redirect(w, r, "/reservation-summary", http.StatusSeeOther)
+	return nil
 }
 
 // ReservationSummary displays the reservation summary page
@@ -236,12 +255,19 @@ func (m *Repository) ReservationSummary(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	sd := reservation.StartDate.Format("02-Jan-2006")
-	ed := reservation.EndDate.Format("02-Jan-2006")
+	p, err := m.propertyOf(r.Context(), reservation.RoomID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	sd := m.App.FormatDate(reservation.StartDate)
+	ed := m.App.FormatDate(reservation.EndDate)
 
 	stringMap := make(map[string]string)
 	stringMap["start_date"] = sd
 	stringMap["end_date"] = ed
+	stringMap["hold_until"] = m.holdUntil(p, reservation)
 
 	m.App.Session.Remove(r.Context(), "reservation")
 	data := make(map[string]interface{})
@@ -280,35 +306,46 @@ func (m *Repository) PostAvailability(w http.ResponseWriter, r *http.Request) {
 	start := r.Form.Get("start")
 	end := r.Form.Get("end")
 
-	layout := "02-01-2006"
-	startDate, err := time.Parse(layout, start)
+	startDate, err := m.App.ParseDate(start)
 	if err != nil {
 		m.App.Session.Put(r.Context(), "error", "cannot parse arrival date!")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
-	endDate, err := time.Parse(layout, end)
+	endDate, err := m.App.ParseDate(end)
 	if err != nil {
 		m.App.Session.Put(r.Context(), "error", "cannot parse departure date!")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
 
-	rooms, err := m.DB.SearchAvailabilityForAllRooms(startDate, endDate)
+	p, err := m.requestProperty(r)
 	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	search, err := m.Booking.SearchRooms(r.Context(), p.ID, startDate, endDate)
+	var invalid *booking.ValidationError
+	if errors.As(err, &invalid) {
+		m.App.Session.Put(r.Context(), "error", strings.Join(invalid.Messages(), ", "))
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	} else if err != nil {
 		m.App.Session.Put(r.Context(), "error", "cannot retrieve rooms data from the database!")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
 
-	if len(rooms) == 0 {
+	if len(search.Rooms) == 0 && len(search.Excluded) == 0 {
 		m.App.Session.Put(r.Context(), "error", "No Rooms Available!")
 		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
 		return
 	}
 
 	data := make(map[string]interface{})
-	data["rooms"] = rooms
+	data["rooms"] = search.Rooms
+	data["excluded"] = search.Excluded
 
 	res := models.Reservation{
 		StartDate: startDate,
@@ -354,6 +391,34 @@ type jsonResponse struct {
 	EndDate   string `json:"end_date"`
 }
 
+// statusForError maps a repository error to the http status code to respond with
+func statusForError(err error) int {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, repository.ErrUnavailable):
+		return http.StatusConflict
+	case errors.Is(err, repository.ErrInvalidCredentials):
+		return http.StatusUnauthorized
+	case errors.Is(err, repository.ErrDisabled):
+		return http.StatusForbidden
+	case errors.Is(err, repository.ErrLocked):
+		return http.StatusTooManyRequests
+	case errors.Is(err, repository.ErrConstraint):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// roomErrorMessage returns the message shown to the user when a room cannot be loaded
+func roomErrorMessage(err error) string {
+	if errors.Is(err, repository.ErrNotFound) {
+		return "The selected room does not exist"
+	}
+	return "cannot find the room"
+}
+
 // AvailabilityJSON handles request for availability and send JSON response
 func (m *Repository) AvailabilityJSON(w http.ResponseWriter, r *http.Request) {
 	// parsing req body
@@ -367,16 +432,11 @@ func (m *Repository) AvailabilityJSON(w http.ResponseWriter, r *http.Request) {
 
 		out, _ := json.MarshalIndent(resp, "", "     ")
 		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
 		w.Write(out)
 		return
 	}
 
-	sd := r.Form.Get("start")
-	ed := r.Form.Get("end")
-	layout := "02-01-2006"
-	startDate, _ := time.Parse(layout, sd)
-	endDate, _ := time.Parse(layout, ed)
-
 	roomID, err := strconv.Atoi(r.Form.Get("room_id"))
 	if err != nil {
 		//cannot convert room id, so return appropiate json
@@ -387,29 +447,33 @@ func (m *Repository) AvailabilityJSON(w http.ResponseWriter, r *http.Request) {
 
 		out, _ := json.MarshalIndent(resp, "", "     ")
 		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
 		w.Write(out)
 		return
 	}
 
-	available, err := m.DB.SearchAvailabilityByDatesByRoomID(startDate, endDate, roomID)
+	startDate, err := m.App.ParseDate(r.Form.Get("start"))
 	if err != nil {
-		//cannot retrieve data from database, so return appropiate json
-		resp := jsonResponse{
-			OK:      false,
-			Message: "Error connecting to the database",
-		}
+		m.invalidDatesJSON(w, roomID)
+		return
+	}
+	endDate, err := m.App.ParseDate(r.Form.Get("end"))
+	if err != nil {
+		m.invalidDatesJSON(w, roomID)
+		return
+	}
 
-		out, _ := json.MarshalIndent(resp, "", "     ")
-		w.Header().Set("Content-Type", "application/json")
-		w.Write(out)
+	quote, err := m.Booking.QuoteStay(r.Context(), roomID, startDate, endDate)
+	if err != nil {
+		m.availabilityError(w, roomID, err)
 		return
 	}
 
 	resp := jsonResponse{
-		OK:        available,
-		Message:   "",
-		StartDate: sd,
-		EndDate:   ed,
+		OK:        quote.Available,
+		Message:   strings.Join(quote.Reasons, ", "),
+		StartDate: startDate.String(),
+		EndDate:   endDate.String(),
 		RoomID:    strconv.Itoa(roomID),
 	}
 
@@ -419,29 +483,90 @@ func (m *Repository) AvailabilityJSON(w http.ResponseWriter, r *http.Request) {
 	w.Write(out)
 }
 
-// BookRoom takes URL parameters, builds a sessional variable, and takes user to make reservation page
-func (m *Repository) BookRoom(w http.ResponseWriter, r *http.Request) {
-	roomID, _ := strconv.Atoi(r.URL.Query().Get("id"))
-	sd := r.URL.Query().Get("s")
-	ed := r.URL.Query().Get("e")
+// invalidDatesJSON writes the JSON response for an availability lookup with dates that cannot be parsed
+func (m *Repository) invalidDatesJSON(w http.ResponseWriter, roomID int) {
+	resp := jsonResponse{
+		OK:      false,
+		Message: "Invalid dates",
+		RoomID:  strconv.Itoa(roomID),
+	}
 
-	layout := "02-01-2006"
-	startDate, _ := time.Parse(layout, sd)
-	endDate, _ := time.Parse(layout, ed)
+	out, _ := json.MarshalIndent(resp, "", "     ")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write(out)
+}
 
-	var res models.Reservation
+// availabilityError writes the JSON response for a failed availability lookup
+func (m *Repository) availabilityError(w http.ResponseWriter, roomID int, err error) {
+	status := statusForError(err)
+
+	//cannot retrieve data from database, so return appropiate json
+	resp := jsonResponse{
+		OK:      false,
+		Message: "Error connecting to the database",
+		RoomID:  strconv.Itoa(roomID),
+	}
+	var invalid *booking.ValidationError
+	if errors.As(err, &invalid) {
+		status = http.StatusUnprocessableEntity
+		resp.Message = strings.Join(invalid.Messages(), ", ")
+	} else if status == http.StatusNotFound {
+		resp.Message = "Room not found"
+	}
+
+	out, _ := json.MarshalIndent(resp, "", "     ")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(out)
+}
 
-	room, err := m.DB.GetRoomByID(roomID)
+// BookRoom takes URL parameters, builds a sessional variable, and takes user to make reservation page
+func (m *Repository) BookRoom(w http.ResponseWriter, r *http.Request) {
+	roomID, _ := strconv.Atoi(r.URL.Query().Get("id"))
+	startDate, err := m.App.ParseDate(r.URL.Query().Get("s"))
 	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "cannot parse arrival date!")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+	endDate, err := m.App.ParseDate(r.URL.Query().Get("e"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "cannot parse departure date!")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
+	quote, err := m.Booking.QuoteStay(r.Context(), roomID, startDate, endDate)
+	var invalid *booking.ValidationError
+	if errors.As(err, &invalid) {
+		m.App.Session.Put(r.Context(), "error", strings.Join(invalid.Messages(), ", "))
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	} else if errors.Is(err, repository.ErrNotFound) {
+		m.App.Session.Put(r.Context(), "error", roomErrorMessage(err))
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	} else if err != nil {
 		m.App.Session.Put(r.Context(), "error", "cannot retrieve room data from the database!")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
+	} else if len(quote.Reasons) > 0 {
+		m.App.Session.Put(r.Context(), "error", strings.Join(quote.Reasons, ", "))
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	} else if !quote.Available {
+		m.App.Session.Put(r.Context(), "error", "Sorry, the room is no longer available for these dates")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
 	}
 
-	res.Room.RoomName = room.RoomName
-	res.RoomID = roomID
-	res.StartDate = startDate
-	res.EndDate = endDate
+	res := models.Reservation{
+		StartDate: quote.StartDate,
+		EndDate:   quote.EndDate,
+		RoomID:    roomID,
+		Room:      quote.Room,
+	}
 
 	m.App.Session.Put(r.Context(), "reservation", res)
 	http.Redirect(w, r, "/make-reservation", http.StatusSeeOther)
@@ -481,16 +606,49 @@ func (m *Repository) PostShowLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	id, _, err := m.DB.Authenticate(email, password)
-	if err != nil {
+	if m.loginThrottled(r, email) {
+		m.App.Session.Put(r.Context(), "error", tooManyLogins)
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	id, _, err := m.DB.Authenticate(r.Context(), email, password)
+	if errors.Is(err, repository.ErrInvalidCredentials) {
+		m.loginFailed(r, email)
 		m.App.Session.Put(r.Context(), "error", "Invalid login credentials")
 		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 		return
+	} else if errors.Is(err, repository.ErrLocked) {
+		m.App.Session.Put(r.Context(), "error", tooManyLogins)
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	} else if errors.Is(err, repository.ErrDisabled) {
+		m.App.Session.Put(r.Context(), "error", "Your account has been disabled")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	} else if err != nil {
+		log.Println(err)
+		m.App.Session.Put(r.Context(), "error", "Unable to log in right now, please try again")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	u, err := m.DB.GetUserByID(r.Context(), id)
+	if err != nil {
+		log.Println(err)
+		m.App.Session.Put(r.Context(), "error", "Unable to log in right now, please try again")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	if u.TOTPEnabled {
+		m.App.Session.Put(r.Context(), "pending_user_id", u.ID)
+		m.App.Session.Put(r.Context(), "pending_since", int(time.Now().Unix()))
+		http.Redirect(w, r, "/user/login/two-factor", http.StatusSeeOther)
+		return
 	}
 
-	m.App.Session.Put(r.Context(), "user_id", id)
-	m.App.Session.Put(r.Context(), "flash", "Logged in successfully")
-	http.Redirect(w, r, "/", http.StatusSeeOther)
+	m.completeLogin(w, r, u)
 }
 
 func (m *Repository) Logout(w http.ResponseWriter, r *http.Request) {
@@ -500,20 +658,22 @@ func (m *Repository) Logout(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 }
 
-func (m *Repository) AdminDashboard(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "admin-dashboard.page.html", &models.TemplateData{})
-}
-
 // AdminNewReservations shows all new reservations in admin panel
 func (m *Repository) AdminNewReservations(w http.ResponseWriter, r *http.Request) {
-	reservations, err := m.DB.GetAllNewReservations()
+	reservations, err := m.DB.GetAllNewReservations(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	scope, err := m.staffScope(r)
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
 
 	data := make(map[string]interface{})
-	data["reservations"] = reservations
+	data["reservations"] = scopedReservations(reservations, scope)
 
 	render.Template(w, r, "admin-new-reservations.page.html", &models.TemplateData{
 		Data: data,
@@ -522,14 +682,20 @@ func (m *Repository) AdminNewReservations(w http.ResponseWriter, r *http.Request
 
 // AdminAllReservations shows all reservations in admin panel
 func (m *Repository) AdminAllReservations(w http.ResponseWriter, r *http.Request) {
-	reservations, err := m.DB.GetAllReservations()
+	reservations, err := m.DB.GetAllReservations(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	scope, err := m.staffScope(r)
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
 
 	data := make(map[string]interface{})
-	data["reservations"] = reservations
+	data["reservations"] = scopedReservations(reservations, scope)
 
 	render.Template(w, r, "admin-all-reservations.page.html", &models.TemplateData{
 		Data: data,
@@ -556,19 +722,54 @@ func (m *Repository) AdminShowReservation(w http.ResponseWriter, r *http.Request
 	stringMap["year"] = year
 
 	// get the reservation from the database
-	res, err := m.DB.GetReservationByID(id)
+	res, err := m.DB.GetReservationByID(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	scope, err := m.staffScope(r)
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
+	if !scope.Has(res.RoomID) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
 
+	m.renderReservation(w, r, res, stringMap, forms.New(nil))
+}
+
+// renderReservation renders the admin page of a reservation with the profile of its guest and the emails sent
+func (m *Repository) renderReservation(w http.ResponseWriter, r *http.Request, res models.Reservation, stringMap map[string]string, form *forms.Form) {
 	data := make(map[string]interface{})
 	data["reservation"] = res
 
+	// staff see at a glance who the guest is, e.g. a VIP or someone not to rent to
+	if res.GuestID > 0 {
+		g, err := m.DB.GetGuestByID(r.Context(), res.GuestID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		data["guest"] = g
+	}
+
+	mails, err := m.DB.GuestMails(r.Context(), res.ID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	data["guest_mails"] = mails
+
 	render.Template(w, r, "admin-show-reservation.page.html", &models.TemplateData{
 		StringMap: stringMap,
 		Data:      data,
-		Form:      forms.New(nil),
+		Form:      form,
 	})
 }
 
@@ -590,26 +791,43 @@ func (m *Repository) AdminPostShowReservation(w http.ResponseWriter, r *http.Req
 	stringMap := make(map[string]string)
 	stringMap["src"] = src
 
-	res, err := m.DB.GetReservationByID(id)
+	month := r.Form.Get("month")
+	year := r.Form.Get("year")
+
+	ok, err := m.inStaffScope(r, id)
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
+	if !ok {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
 
-	res.FirstName = r.Form.Get("first_name")
-	res.LastName = r.Form.Get("last_name")
-	res.Email = r.Form.Get("email")
-	res.Phone = r.Form.Get("phone")
-
-	err = m.DB.UpdateReservation(res)
-	if err != nil {
+	res, err := m.Booking.ModifyReservation(r.Context(), id, booking.Changes{
+		FirstName: r.Form.Get("first_name"),
+		LastName:  r.Form.Get("last_name"),
+		Email:     r.Form.Get("email"),
+		Phone:     r.Form.Get("phone"),
+	}, m.App.Session.GetInt(r.Context(), "user_id"))
+	var invalid *booking.ValidationError
+	if errors.As(err, &invalid) {
+		form := forms.New(r.PostForm)
+		for field, message := range invalid.Fields {
+			form.Errors.Add(field, message)
+		}
+		stringMap["month"] = month
+		stringMap["year"] = year
+		m.renderReservation(w, r, res, stringMap, form)
+		return
+	} else if errors.Is(err, repository.ErrNotFound) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
 
-	month := r.Form.Get("month")
-	year := r.Form.Get("year")
-
 	m.App.Session.Put(r.Context(), "flash", "Changes saved")
 
 	if year == "" {
@@ -620,15 +838,25 @@ func (m *Repository) AdminPostShowReservation(w http.ResponseWriter, r *http.Req
 
 }
 
+// calendarKeyLayout is how the days of the reservations calendar are named in its maps and form fields
+const calendarKeyLayout = "2-01-2006"
+
 // AdminReservationsCalendar display the reservations calendar
 func (m *Repository) AdminReservationsCalendar(w http.ResponseWriter, r *http.Request) {
+	p, err := m.requestProperty(r)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
 	// assume there is no month/year spesified
-	now := time.Now()
+	today := m.App.TodayAt(p)
+	now := dates.New(today.Year(), today.Month(), 1)
 
 	if r.URL.Query().Get("y") != "" {
 		year, _ := strconv.Atoi(r.URL.Query().Get("y"))
 		month, _ := strconv.Atoi(r.URL.Query().Get("m"))
-		now = time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+		now = dates.New(year, time.Month(month), 1)
 	}
 
 	data := make(map[string]interface{})
@@ -653,20 +881,25 @@ func (m *Repository) AdminReservationsCalendar(w http.ResponseWriter, r *http.Re
 	stringMap["this_month_year"] = now.Format("2006")
 
 	// get the first and last days of the month
-	currentYear, currentMonth, _ := now.Date()
-	currentLocation := now.Location()
-	firstOfMonth := time.Date(currentYear, currentMonth, 1, 0, 0, 0, 0, currentLocation)
+	firstOfMonth := now
 	lastOfMonth := firstOfMonth.AddDate(0, 1, -1)
 
 	intMap := make(map[string]int)
 	intMap["days_in_month"] = lastOfMonth.Day()
 
-	rooms, err := m.DB.GetAllRooms()
+	rooms, err := m.DB.GetAllRooms(r.Context())
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
 
+	scope, err := m.staffScope(r)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	rooms = scopedRooms(rooms, scope)
+
 	data["rooms"] = rooms
 
 	for _, room := range rooms {
@@ -674,13 +907,13 @@ func (m *Repository) AdminReservationsCalendar(w http.ResponseWriter, r *http.Re
 		reservationMap := make(map[string]int)
 		blockMap := make(map[string]int)
 
-		for d := firstOfMonth; !d.After(lastOfMonth); d = d.AddDate(0, 0, 1) {
-			reservationMap[d.Format("2-01-2006")] = 0
-			blockMap[d.Format("2-01-2006")] = 0
+		for d := firstOfMonth; !d.After(lastOfMonth); d = d.AddDays(1) {
+			reservationMap[d.Format(calendarKeyLayout)] = 0
+			blockMap[d.Format(calendarKeyLayout)] = 0
 		}
 
 		// get all the restriction for the current room
-		restrictions, err := m.DB.GetRestrictionForRoomByDate(room.ID, firstOfMonth, lastOfMonth)
+		restrictions, err := m.DB.GetRestrictionForRoomByDate(r.Context(), room.ID, firstOfMonth, lastOfMonth)
 		if err != nil {
 			helpers.ServerError(w, err)
 		}
@@ -688,12 +921,12 @@ func (m *Repository) AdminReservationsCalendar(w http.ResponseWriter, r *http.Re
 		for _, restriction := range restrictions {
 			if restriction.ReservationID > 0 {
 				//it's a reservation
-				for d := restriction.StartDate; !d.After(restriction.EndDate); d = d.AddDate(0, 0, 1) {
-					reservationMap[d.Format("2-01-2006")] = restriction.ReservationID
+				for d := restriction.StartDate; !d.After(restriction.EndDate); d = d.AddDays(1) {
+					reservationMap[d.Format(calendarKeyLayout)] = restriction.ReservationID
 				}
 			} else {
 				// it's a block
-				blockMap[restriction.StartDate.Format("2-01-2006")] = restriction.ID
+				blockMap[restriction.StartDate.Format(calendarKeyLayout)] = restriction.ID
 			}
 		}
 
@@ -722,13 +955,21 @@ func (m *Repository) AdminPostReservationsCalendar(w http.ResponseWriter, r *htt
 	month, _ := strconv.Atoi(r.Form.Get("m"))
 
 	// process blocks
-	rooms, err := m.DB.GetAllRooms()
+	rooms, err := m.DB.GetAllRooms(r.Context())
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
 
+	scope, err := m.staffScope(r)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	rooms = scopedRooms(rooms, scope)
+
 	form := forms.New(r.PostForm)
+	var changes booking.BlockChanges
 
 	for _, room := range rooms {
 		// Get the block map from the session.
@@ -747,10 +988,7 @@ func (m *Repository) AdminPostReservationsCalendar(w http.ResponseWriter, r *htt
 				if val > 0 {
 					if !form.Has(fmt.Sprintf("remove_block_%d_%s", room.ID, name)) {
 						// delete the restriction by id
-						err := m.DB.DeleteBlockByID(value)
-						if err != nil {
-							log.Println(err)
-						}
+						changes.Remove = append(changes.Remove, value)
 					}
 				}
 			}
@@ -761,16 +999,31 @@ func (m *Repository) AdminPostReservationsCalendar(w http.ResponseWriter, r *htt
 	for name, _ := range r.PostForm {
 		if strings.HasPrefix(name, "add_block") {
 			exploded := strings.Split(name, "_")
-			roomID, _ := strconv.Atoi(exploded[2])
-			t, _ := time.Parse("2-01-2006", exploded[3])
-			// insert a new block
-			err := m.DB.InsertBlockForRoom(roomID, t)
+			if len(exploded) != 4 {
+				continue
+			}
+			roomID, err := strconv.Atoi(exploded[2])
+			if err != nil || !scope.Has(roomID) {
+				continue
+			}
+			d, err := dates.Parse(exploded[3], calendarKeyLayout)
 			if err != nil {
-				log.Println(err)
+				continue
 			}
+			// insert a new block
+			changes.Add = append(changes.Add, booking.Block{RoomID: roomID, Date: d})
 		}
 	}
 
+	reserved, err := m.Booking.SetBlocks(r.Context(), changes, m.App.Session.GetInt(r.Context(), "user_id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	if reserved > 0 {
+		m.App.Session.Put(r.Context(), "warning", "Some nights are already reserved and were not blocked")
+	}
+
 	m.App.Session.Put(r.Context(), "flash", "Changes saved")
 	http.Redirect(w, r, fmt.Sprintf("/admin/reservations-calendar?y=%d&m=%d", year, month), http.StatusSeeOther)
 }
@@ -780,13 +1033,28 @@ func (m *Repository) AdminProcessReservation(w http.ResponseWriter, r *http.Requ
 	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
 	src := chi.URLParam(r, "src")
 
-	_ = m.DB.UpdateProcessedForReservation(id, 1)
+	ok, err := m.inStaffScope(r, id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	if !ok {
+		err = repository.ErrNotFound
+	} else {
+		_, err = m.Booking.ProcessReservation(r.Context(), id, m.App.Session.GetInt(r.Context(), "user_id"))
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		m.App.Session.Put(r.Context(), "error", "Reservation not found")
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	} else {
+		m.App.Session.Put(r.Context(), "flash", "Reservation marked as processed")
+	}
 
 	year := r.URL.Query().Get("y")
 	month := r.URL.Query().Get("m")
 
-	m.App.Session.Put(r.Context(), "flash", "Reservation marked as processed")
-
 	if year == "" {
 		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
 	} else {
@@ -800,13 +1068,28 @@ func (m *Repository) AdminDeleteReservation(w http.ResponseWriter, r *http.Reque
 	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
 	src := chi.URLParam(r, "src")
 
-	_ = m.DB.DeleteReservation(id)
+	ok, err := m.inStaffScope(r, id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	if !ok {
+		err = repository.ErrNotFound
+	} else {
+		_, err = m.Booking.CancelReservation(r.Context(), id, m.App.Session.GetInt(r.Context(), "user_id"))
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		m.App.Session.Put(r.Context(), "error", "Reservation not found")
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	} else {
+		m.App.Session.Put(r.Context(), "flash", "Reservation deleted")
+	}
 
 	year := r.URL.Query().Get("y")
 	month := r.URL.Query().Get("m")
 
-	m.App.Session.Put(r.Context(), "flash", "Reservation deleted")
-
 	if year == "" {
 		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
 	} else {
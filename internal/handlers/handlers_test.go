@@ -3,18 +3,21 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/http/cookiejar"
 	"net/http/httptest"
 	"net/url"
 	"strings"
 	"testing"
-	"time"
 
 	"github.com/adewidyatamadb/GoBookings/internal/config"
+	"github.com/adewidyatamadb/GoBookings/internal/dates"
 	"github.com/adewidyatamadb/GoBookings/internal/driver"
 	"github.com/adewidyatamadb/GoBookings/internal/models"
+	"github.com/adewidyatamadb/GoBookings/internal/repository"
 	"github.com/go-chi/chi/v5"
 )
 
@@ -45,10 +48,25 @@ func TestGetHandlers(t *testing.T) {
 		//admin route
 		{"login", "/user/login", "GET", http.StatusOK},
 		{"logout", "/user/logout", "GET", http.StatusOK},
+	}
+
+	// the staff pages are requested by the logged in administrator
+	var staffTests = []struct {
+		name               string
+		url                string
+		method             string
+		expectedStatusCode int
+	}{
 		{"dashboard", "/admin/dashboard", "GET", http.StatusOK},
 		{"new reservation", "/admin/reservations-new", "GET", http.StatusOK},
 		{"all reservation", "/admin/reservations-all", "GET", http.StatusOK},
 		{"show reservation", "/admin/reservations/new/1/show", "GET", http.StatusOK},
+		{"staff users", "/admin/users", "GET", http.StatusOK},
+		{"new staff user", "/admin/users/new", "GET", http.StatusOK},
+		{"show staff user", "/admin/users/1", "GET", http.StatusOK},
+		{"non-existent staff user", "/admin/users/100", "GET", http.StatusNotFound},
+		{"change password", "/user/change-password", "GET", http.StatusOK},
+		{"two-factor settings", "/user/two-factor", "GET", http.StatusOK},
 	}
 
 	routes := getRoutes()
@@ -56,8 +74,12 @@ func TestGetHandlers(t *testing.T) {
 	ts := httptest.NewTLSServer(routes)
 	defer ts.Close()
 
+	jar, _ := cookiejar.New(nil)
+	client := ts.Client()
+	client.Jar = jar
+
 	for _, test := range tableTest {
-		resp, err := ts.Client().Get(ts.URL + test.url)
+		resp, err := client.Get(ts.URL + test.url)
 		if err != nil {
 			t.Log(err)
 			t.Fatal(err)
@@ -67,6 +89,26 @@ func TestGetHandlers(t *testing.T) {
 			t.Errorf("for %s, expected status code %d  but got %d", test.name, test.expectedStatusCode, resp.StatusCode)
 		}
 	}
+
+	defer resetTestDB()
+	_, err := client.PostForm(ts.URL+"/user/login", url.Values{
+		"email":    {"me@here.com"},
+		"password": {fixturePassword},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range staffTests {
+		resp, err := client.Get(ts.URL + test.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.StatusCode != test.expectedStatusCode {
+			t.Errorf("for %s, expected status code %d  but got %d", test.name, test.expectedStatusCode, resp.StatusCode)
+		}
+	}
 }
 
 func TestRepository_Reservation(t *testing.T) {
@@ -123,84 +165,97 @@ func TestRepository_PostReservation(t *testing.T) {
 	var tableTest = []struct {
 		name               string
 		params             []postData
+		failing            string
 		expectedStatusCode int
 	}{
 		{"intended case", []postData{
-			{key: "start_date", value: "11-10-2021"},
-			{key: "end_date", value: "12-10-2021"},
+			{key: "start_date", value: "11-10-2050"},
+			{key: "end_date", value: "12-10-2050"},
 			{key: "room_id", value: "1"},
 			{key: "first_name", value: "John"},
 			{key: "last_name", value: "Smith"},
 			{key: "email", value: "john@smith.com"},
 			{key: "phone", value: "555-555-5555"},
-		}, http.StatusSeeOther},
+		}, "", http.StatusSeeOther},
 		{"invalid arrival date", []postData{
 			{key: "start_date", value: "invalid"},
-			{key: "end_date", value: "12-10-2021"},
+			{key: "end_date", value: "12-10-2050"},
 			{key: "room_id", value: "1"},
 			{key: "first_name", value: "John"},
 			{key: "last_name", value: "Smith"},
 			{key: "email", value: "john@smith.com"},
 			{key: "phone", value: "555-555-5555"},
-		}, http.StatusSeeOther},
+		}, "", http.StatusSeeOther},
 		{"invalid departure date", []postData{
-			{key: "start_date", value: "12-10-2021"},
+			{key: "start_date", value: "12-10-2050"},
 			{key: "end_date", value: "invalid"},
 			{key: "room_id", value: "1"},
 			{key: "first_name", value: "John"},
 			{key: "last_name", value: "Smith"},
 			{key: "email", value: "john@smith.com"},
 			{key: "phone", value: "555-555-5555"},
-		}, http.StatusSeeOther},
+		}, "", http.StatusSeeOther},
 		{"invalid room id", []postData{
-			{key: "start_date", value: "12-10-2021"},
-			{key: "end_date", value: "13-10-2021"},
+			{key: "start_date", value: "12-10-2050"},
+			{key: "end_date", value: "13-10-2050"},
 			{key: "room_id", value: "invalid"},
 			{key: "first_name", value: "John"},
 			{key: "last_name", value: "Smith"},
 			{key: "email", value: "john@smith.com"},
 			{key: "phone", value: "555-555-5555"},
-		}, http.StatusSeeOther},
+		}, "", http.StatusSeeOther},
 		{"room not exist", []postData{
-			{key: "start_date", value: "12-10-2021"},
-			{key: "end_date", value: "13-10-2021"},
+			{key: "start_date", value: "12-10-2050"},
+			{key: "end_date", value: "13-10-2050"},
 			{key: "room_id", value: "99"},
 			{key: "first_name", value: "John"},
 			{key: "last_name", value: "Smith"},
 			{key: "email", value: "john@smith.com"},
 			{key: "phone", value: "555-555-5555"},
-		}, http.StatusSeeOther},
+		}, "", http.StatusSeeOther},
 		{"invalid user data", []postData{
-			{key: "start_date", value: "12-10-2021"},
-			{key: "end_date", value: "13-10-2021"},
+			{key: "start_date", value: "12-10-2050"},
+			{key: "end_date", value: "13-10-2050"},
 			{key: "room_id", value: "1"},
 			{key: "first_name", value: "a"},
 			{key: "last_name", value: "Smith"},
 			{key: "email", value: "john@smith.com"},
 			{key: "phone", value: "555-555-5555"},
-		}, http.StatusOK},
+		}, "", http.StatusOK},
 		{"failed to insert reservation data", []postData{
-			{key: "start_date", value: "12-10-2021"},
-			{key: "end_date", value: "13-10-2021"},
-			{key: "room_id", value: "2"},
+			{key: "start_date", value: "12-10-2050"},
+			{key: "end_date", value: "13-10-2050"},
+			{key: "room_id", value: "1"},
 			{key: "first_name", value: "John"},
 			{key: "last_name", value: "Smith"},
 			{key: "email", value: "john@smith.com"},
 			{key: "phone", value: "555-555-5555"},
-		}, http.StatusSeeOther},
+		}, "InsertReservation", http.StatusSeeOther},
 		{"failed to insert room restriction data", []postData{
-			{key: "start_date", value: "12-10-2021"},
-			{key: "end_date", value: "13-10-2021"},
-			{key: "room_id", value: "100"},
+			{key: "start_date", value: "12-10-2050"},
+			{key: "end_date", value: "13-10-2050"},
+			{key: "room_id", value: "1"},
 			{key: "first_name", value: "John"},
 			{key: "last_name", value: "Smith"},
 			{key: "email", value: "john@smith.com"},
 			{key: "phone", value: "555-555-5555"},
-		}, http.StatusSeeOther},
-		{"body missing", []postData{}, http.StatusSeeOther},
+		}, "InsertRoomRestriction", http.StatusSeeOther},
+		{"room booked in the meantime", []postData{
+			{key: "start_date", value: "12-10-2050"},
+			{key: "end_date", value: "13-10-2050"},
+			{key: "room_id", value: "2"},
+			{key: "first_name", value: "John"},
+			{key: "last_name", value: "Smith"},
+			{key: "email", value: "john@smith.com"},
+			{key: "phone", value: "555-555-5555"},
+		}, "", http.StatusSeeOther},
+		{"body missing", []postData{}, "", http.StatusSeeOther},
 	}
 
+	defer resetTestDB()
+
 	for _, test := range tableTest {
+		testDB.failOn(test.failing)
 		postedData := url.Values{}
 		var r *http.Request
 		if test.name != "body missing" {
@@ -252,12 +307,11 @@ func TestRepository_ReservationSummary(t *testing.T) {
 	}
 
 	for _, test := range tableTest {
-		start := "11-11-2021"
-		end := "12-11-2021"
+		start := "11-11-2050"
+		end := "12-11-2050"
 
-		layout := "02-01-2006"
-		startDate, _ := time.Parse(layout, start)
-		endDate, _ := time.Parse(layout, end)
+		startDate, _ := app.ParseDate(start)
+		endDate, _ := app.ParseDate(end)
 
 		reservation := models.Reservation{
 			StartDate: startDate,
@@ -290,32 +344,52 @@ func TestRepository_PostAvailability(t *testing.T) {
 	var tableTest = []struct {
 		name               string
 		params             []postData
+		failing            string
 		expectedStatusCode int
 	}{
 		{"intended case", []postData{
-			{key: "start", value: "11-11-2021"},
-			{key: "end", value: "12-11-2021"},
-		}, http.StatusOK},
+			{key: "start", value: "11-11-2050"},
+			{key: "end", value: "12-11-2050"},
+		}, "", http.StatusOK},
 		{"cannot retrieve rooms data", []postData{
-			{key: "start", value: "01-01-2021"},
-			{key: "end", value: "12-11-2021"},
-		}, http.StatusSeeOther},
+			{key: "start", value: "01-01-2050"},
+			{key: "end", value: "12-11-2050"},
+		}, "SearchAvailabilityForAllRooms", http.StatusSeeOther},
 		{"there are no room available", []postData{
-			{key: "start", value: "30-12-2020"},
-			{key: "end", value: "02-01-2021"},
-		}, http.StatusSeeOther},
+			{key: "start", value: "30-12-2049"},
+			{key: "end", value: "02-01-2050"},
+		}, "", http.StatusSeeOther},
 		{"failed parsing arrival date", []postData{
 			{key: "start", value: "a"},
-			{key: "end", value: "02-01-2021"},
-		}, http.StatusSeeOther},
+			{key: "end", value: "02-01-2050"},
+		}, "", http.StatusSeeOther},
 		{"failed parsing departure date", []postData{
-			{key: "start", value: "30-12-2020"},
+			{key: "start", value: "30-12-2049"},
 			{key: "end", value: "b"},
-		}, http.StatusSeeOther},
-		{"missing request body", []postData{}, http.StatusSeeOther},
+		}, "", http.StatusSeeOther},
+		{"arrival in the past", []postData{
+			{key: "start", value: "01-01-2020"},
+			{key: "end", value: "03-01-2020"},
+		}, "", http.StatusSeeOther},
+		{"departure before arrival", []postData{
+			{key: "start", value: "12-11-2050"},
+			{key: "end", value: "11-11-2050"},
+		}, "", http.StatusSeeOther},
+		{"rooms excluded by booking rules", []postData{
+			{key: "start", value: "04-07-2050"},
+			{key: "end", value: "06-07-2050"},
+		}, "", http.StatusOK},
+		{"iso dates", []postData{
+			{key: "start", value: "2050-11-11"},
+			{key: "end", value: "2050-11-12"},
+		}, "", http.StatusOK},
+		{"missing request body", []postData{}, "", http.StatusSeeOther},
 	}
 
+	defer resetTestDB()
+
 	for _, test := range tableTest {
+		testDB.failOn(test.failing)
 		postedData := url.Values{}
 		var r *http.Request
 		if test.name != "missing request body" {
@@ -401,34 +475,59 @@ func TestRepository_AvailabilityJSON(t *testing.T) {
 		value string
 	}
 	var tableTest = []struct {
-		name       string
-		params     []postData
-		expectedOK bool
+		name               string
+		params             []postData
+		failing            string
+		expectedOK         bool
+		expectedStatusCode int
 	}{
 		{"room available", []postData{
-			{key: "start", value: "11-10-2021"},
-			{key: "end", value: "12-10-2021"},
+			{key: "start", value: "11-10-2050"},
+			{key: "end", value: "12-10-2050"},
 			{key: "room_id", value: "1"},
-		}, true},
+		}, "", true, http.StatusOK},
 		{"room not available", []postData{
-			{key: "start", value: "11-10-2021"},
-			{key: "end", value: "12-10-2021"},
-			{key: "room_id", value: "3"},
-		}, false},
+			{key: "start", value: "11-10-2050"},
+			{key: "end", value: "12-10-2050"},
+			{key: "room_id", value: "2"},
+		}, "", false, http.StatusOK},
+		{"room excluded by a booking rule", []postData{
+			{key: "start", value: "04-07-2050"},
+			{key: "end", value: "06-07-2050"},
+			{key: "room_id", value: "1"},
+		}, "", false, http.StatusOK},
 		{"room id invalid", []postData{
-			{key: "start", value: "11-10-2021"},
-			{key: "end", value: "12-10-2021"},
+			{key: "start", value: "11-10-2050"},
+			{key: "end", value: "12-10-2050"},
 			{key: "room_id", value: "a"},
-		}, false},
+		}, "", false, http.StatusBadRequest},
+		{"room not found", []postData{
+			{key: "start", value: "11-10-2050"},
+			{key: "end", value: "12-10-2050"},
+			{key: "room_id", value: "50"},
+		}, "", false, http.StatusNotFound},
 		{"cannot retrieve data from the database", []postData{
-			{key: "start", value: "11-10-2021"},
-			{key: "end", value: "12-10-2021"},
-			{key: "room_id", value: "100"},
-		}, false},
-		{"invalid form", []postData{}, false},
+			{key: "start", value: "11-10-2050"},
+			{key: "end", value: "12-10-2050"},
+			{key: "room_id", value: "1"},
+		}, "SearchAvailabilityByDatesByRoomID", false, http.StatusInternalServerError},
+		{"invalid dates", []postData{
+			{key: "start", value: "tomorrow"},
+			{key: "end", value: "12-10-2050"},
+			{key: "room_id", value: "1"},
+		}, "", false, http.StatusBadRequest},
+		{"departure before arrival", []postData{
+			{key: "start", value: "12-10-2050"},
+			{key: "end", value: "11-10-2050"},
+			{key: "room_id", value: "1"},
+		}, "", false, http.StatusUnprocessableEntity},
+		{"invalid form", []postData{}, "", false, http.StatusInternalServerError},
 	}
 
+	defer resetTestDB()
+
 	for _, test := range tableTest {
+		testDB.failOn(test.failing)
 		// case - rooms are not available
 		postedData := url.Values{}
 		var r *http.Request
@@ -467,6 +566,9 @@ func TestRepository_AvailabilityJSON(t *testing.T) {
 		if j.OK != test.expectedOK {
 			t.Errorf("case - %s: reservation handler returned wrong response: got %v, wanted %v", test.name, j.OK, test.expectedOK)
 		}
+		if w.Code != test.expectedStatusCode {
+			t.Errorf("case - %s: reservation handler returned wrong response code: got %d, wanted %d", test.name, w.Code, test.expectedStatusCode)
+		}
 	}
 }
 
@@ -479,17 +581,38 @@ func TestRepository_BookRoom(t *testing.T) {
 		name               string
 		params             []parameters
 		expectedStatusCode int
+		expectedLocation   string
 	}{
 		{"intended case", []parameters{
 			{key: "id", value: "1"},
-			{key: "start_date", value: "11-11-2021"},
-			{key: "end_date", value: "12-11-2021"},
-		}, http.StatusSeeOther},
+			{key: "start_date", value: "11-11-2050"},
+			{key: "end_date", value: "12-11-2050"},
+		}, http.StatusSeeOther, "/make-reservation"},
+		{"iso dates", []parameters{
+			{key: "id", value: "1"},
+			{key: "start_date", value: "2050-11-11"},
+			{key: "end_date", value: "2050-11-12"},
+		}, http.StatusSeeOther, "/make-reservation"},
 		{"invalid id", []parameters{
-			{key: "id", value: "3"},
-			{key: "start_date", value: "11-11-2021"},
-			{key: "end_date", value: "12-11-2021"},
-		}, http.StatusSeeOther},
+			{key: "id", value: "4"},
+			{key: "start_date", value: "11-11-2050"},
+			{key: "end_date", value: "12-11-2050"},
+		}, http.StatusSeeOther, "/"},
+		{"invalid date", []parameters{
+			{key: "id", value: "1"},
+			{key: "start_date", value: "31-02-2050"},
+			{key: "end_date", value: "12-11-2050"},
+		}, http.StatusSeeOther, "/search-availability"},
+		{"arrival in the past", []parameters{
+			{key: "id", value: "1"},
+			{key: "start_date", value: "11-11-2020"},
+			{key: "end_date", value: "12-11-2020"},
+		}, http.StatusSeeOther, "/search-availability"},
+		{"booking rule", []parameters{
+			{key: "id", value: "1"},
+			{key: "start_date", value: "04-07-2050"},
+			{key: "end_date", value: "06-07-2050"},
+		}, http.StatusSeeOther, "/search-availability"},
 	}
 
 	for _, test := range tableTest {
@@ -505,6 +628,9 @@ func TestRepository_BookRoom(t *testing.T) {
 		if w.Code != test.expectedStatusCode {
 			t.Errorf("case - %s: reservation handler returned wrong response code: got %d, wanted %d", test.name, w.Code, test.expectedStatusCode)
 		}
+		if loc := w.Header().Get("Location"); loc != test.expectedLocation {
+			t.Errorf("case - %s: expected location %s but got %s", test.name, test.expectedLocation, loc)
+		}
 	}
 }
 
@@ -517,11 +643,18 @@ var loginTests = []struct {
 }{
 	{"valid credential", "me@here.com", http.StatusSeeOther, "", "/"},
 	{"invalid credential", "jack@here.com", http.StatusSeeOther, "", "/user/login"},
+	{"password change required", "reset@here.com", http.StatusSeeOther, "", "/user/change-password"},
+	{"disabled account", "disabled@here.com", http.StatusSeeOther, "", "/user/login"},
+	{"locked account", "locked@here.com", http.StatusSeeOther, "", "/user/login"},
+	{"failure locking the account", "lockout@here.com", http.StatusSeeOther, "", "/user/login"},
+	{"two-factor authentication", "twofactor@here.com", http.StatusSeeOther, "", "/user/login/two-factor"},
 	{"invalid data", "j", http.StatusOK, `action="/user/login"`, ""},
 }
 
 func TestLogin(t *testing.T) {
 	// range through all tests
+	defer resetTestDB()
+
 	for _, test := range loginTests {
 		postedData := url.Values{}
 		postedData.Add("email", test.email)
@@ -578,11 +711,13 @@ func TestRepository_AdminPostShowReservation(t *testing.T) {
 		{"update from new reservations page", "2021", "11", "cal", http.StatusSeeOther, "/admin/reservations-calendar?y=2021&m=11"},
 	}
 
+	defer resetTestDB()
+
 	for _, test := range tableTest {
 		postedData := url.Values{}
 		postedData.Add("first_name", "John")
 		postedData.Add("last_name", "John")
-		postedData.Add("email", "John")
+		postedData.Add("email", "john@smith.com")
 		postedData.Add("phone", "John")
 		postedData.Add("month", test.month)
 		postedData.Add("year", test.year)
@@ -591,6 +726,7 @@ func TestRepository_AdminPostShowReservation(t *testing.T) {
 		req := httptest.NewRequest("POST", fmt.Sprintf("/admin/reservations/%s/1", test.src), strings.NewReader(postedData.Encode()))
 		ctx := getCTX(req)
 		req = req.WithContext(ctx)
+		session.Put(ctx, "user_id", 1)
 
 		// set the req header
 		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
@@ -631,6 +767,7 @@ func TestRepository_AdminReservationsCalendar(t *testing.T) {
 		r := httptest.NewRequest("GET", fmt.Sprintf("/admin/reservations-calendar?y=%s&m=%s", test.year, test.month), nil)
 		ctx := getCTX(r)
 		r = r.WithContext(ctx)
+		session.Put(ctx, "user_id", 1)
 
 		handler := http.HandlerFunc(Repo.AdminReservationsCalendar)
 
@@ -656,9 +793,13 @@ func TestRepository_AdminPostReservationsCalendar(t *testing.T) {
 		{"removing block and adding block", "2", "2021", http.StatusSeeOther, "/admin/reservations-calendar?y=2021&m=2", true, true},
 	}
 
+	defer resetTestDB()
+
 	for _, test := range tableTest {
+		resetTestDB()
+		// 12 is the owner block of the quarters in the fixtures
 		blockMap := make(map[string]int)
-		blockMap["11-2-2021"] = 1
+		blockMap["11-2-2021"] = 12
 		postedData := url.Values{}
 		postedData.Add("m", test.month)
 		postedData.Add("y", test.year)
@@ -675,7 +816,9 @@ func TestRepository_AdminPostReservationsCalendar(t *testing.T) {
 		req := httptest.NewRequest("POST", "/reservation-calendar", strings.NewReader(postedData.Encode()))
 		ctx := getCTX(req)
 		req = req.WithContext(ctx)
+		session.Put(ctx, "user_id", 1)
 		session.Put(req.Context(), "block_map_1", blockMap)
+		session.Put(req.Context(), "block_map_2", map[string]int{})
 
 		// set the req header
 		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
@@ -713,6 +856,8 @@ func TestRepository_AdminProcessReservation(t *testing.T) {
 		{"update from reservations calendar page", "2021", "2", "cal", http.StatusSeeOther, "/admin/reservations-calendar?y=2021&m=2"},
 	}
 
+	defer resetTestDB()
+
 	for _, test := range tableTest {
 		w := httptest.NewRecorder()
 		r := httptest.NewRequest("GET", fmt.Sprintf("/admin/process-reservation/%s/1/do?y=%s&m=%s", test.src, test.year, test.month), nil)
@@ -720,6 +865,7 @@ func TestRepository_AdminProcessReservation(t *testing.T) {
 		rctx.URLParams.Add("id", "1")
 		rctx.URLParams.Add("src", test.src)
 		ctx := getCTX(r)
+		session.Put(ctx, "user_id", 1)
 		r = r.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
 
 		handler := http.HandlerFunc(Repo.AdminProcessReservation)
@@ -752,13 +898,17 @@ func TestRepository_AdminDeleteReservation(t *testing.T) {
 		{"delete from reservations calendar page", "2021", "2", "cal", http.StatusSeeOther, "/admin/reservations-calendar?y=2021&m=2"},
 	}
 
+	defer resetTestDB()
+
 	for _, test := range tableTest {
+		resetTestDB()
 		w := httptest.NewRecorder()
 		r := httptest.NewRequest("GET", fmt.Sprintf("/admin/delete-reservation/%s/1/do?y=%s&m=%s", test.src, test.year, test.month), nil)
 		rctx := chi.NewRouteContext()
 		rctx.URLParams.Add("id", "1")
 		rctx.URLParams.Add("src", test.src)
 		ctx := getCTX(r)
+		session.Put(ctx, "user_id", 1)
 		r = r.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
 
 		handler := http.HandlerFunc(Repo.AdminDeleteReservation)
@@ -787,3 +937,108 @@ func getCTX(req *http.Request) context.Context {
 
 	return ctx
 }
+
+func TestRepository_CancelledRequestContext(t *testing.T) {
+	r := httptest.NewRequest("GET", "/admin/reservations-all", nil)
+	ctx, cancel := context.WithCancel(getCTX(r))
+	cancel()
+	r = r.WithContext(ctx)
+
+	w := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.AdminAllReservations)
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected code %d for a cancelled request but got %d", http.StatusInternalServerError, w.Code)
+	}
+}
+
+func TestReservationFlowWithMemoryRepo(t *testing.T) {
+	testRepo := Repo
+	NewHandlers(NewDemoRepo(&app))
+	defer NewHandlers(testRepo)
+
+	ts := httptest.NewTLSServer(getRoutes())
+	defer ts.Close()
+
+	jar, _ := cookiejar.New(nil)
+	client := ts.Client()
+	client.Jar = jar
+
+	// search for availability, which puts the dates in the session
+	resp, err := client.PostForm(ts.URL+"/search-availability", url.Values{
+		"start": {"11-10-2099"},
+		"end":   {"13-10-2099"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected search availability to return %d but got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	// choose a room, which follows the redirect to the reservation form
+	resp, err = client.Get(ts.URL + "/choose-room/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Request.URL.Path != "/make-reservation" || resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected to land on the reservation form but got %s with %d", resp.Request.URL.Path, resp.StatusCode)
+	}
+
+	resp, err = client.PostForm(ts.URL+"/make-reservation", url.Values{
+		"start_date": {"11-10-2099"},
+		"end_date":   {"13-10-2099"},
+		"room_id":    {"1"},
+		"first_name": {"John"},
+		"last_name":  {"Smith"},
+		"email":      {"john@smith.com"},
+		"phone":      {"555-555-5555"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Request.URL.Path != "/reservation-summary" || resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected to land on the reservation summary but got %s with %d", resp.Request.URL.Path, resp.StatusCode)
+	}
+
+	reservations, err := Repo.DB.GetAllReservations(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reservations) != 1 || reservations[0].LastName != "Smith" {
+		t.Fatalf("expected the reservation to be stored but got %+v", reservations)
+	}
+
+	start := dates.New(2099, 10, 12)
+	available, err := Repo.DB.SearchAvailabilityByDatesByRoomID(context.Background(), start, start.AddDays(1), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if available {
+		t.Error("expected the booked room to be unavailable")
+	}
+}
+
+func TestStatusForError(t *testing.T) {
+	var tableTest = []struct {
+		name               string
+		err                error
+		expectedStatusCode int
+	}{
+		{"not found", repository.ErrNotFound, http.StatusNotFound},
+		{"unavailable", repository.ErrUnavailable, http.StatusConflict},
+		{"invalid credentials", repository.ErrInvalidCredentials, http.StatusUnauthorized},
+		{"disabled", repository.ErrDisabled, http.StatusForbidden},
+		{"locked", repository.ErrLocked, http.StatusTooManyRequests},
+		{"wrapped constraint", fmt.Errorf("%w: room 9 does not exist", repository.ErrConstraint), http.StatusUnprocessableEntity},
+		{"unknown error", errors.New("some error"), http.StatusInternalServerError},
+	}
+
+	for _, test := range tableTest {
+		if status := statusForError(test.err); status != test.expectedStatusCode {
+			t.Errorf("case - %s: got status %d, wanted %d", test.name, status, test.expectedStatusCode)
+		}
+	}
+}
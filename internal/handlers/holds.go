@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/adewidyatamadb/GoBookings/internal/dates"
+	"github.com/adewidyatamadb/GoBookings/internal/helpers"
+	"github.com/adewidyatamadb/GoBookings/internal/models"
+	"github.com/adewidyatamadb/GoBookings/internal/repository"
+	"github.com/adewidyatamadb/GoBookings/internal/urlsigner"
+)
+
+// holdUntil returns when the hold of res ends, on the clock of property p
+func (m *Repository) holdUntil(p models.Property, res models.Reservation) string {
+	t := m.App.TimeAt(p, res.HoldUntil)
+	return t.Format("15:04") + " on " + m.App.FormatDate(dates.Of(t))
+}
+
+// sendHoldConfirmation emails the guest of a held reservation a link to confirm it, the link expires with the hold
+func (m *Repository) sendHoldConfirmation(ctx context.Context, res models.Reservation) error {
+	p, err := m.propertyOf(ctx, res.RoomID)
+	if err != nil {
+		return err
+	}
+
+	link, err := urlsigner.New(m.App.Secret).Sign(
+		fmt.Sprintf("%s/reservation/confirm?id=%d", m.App.BaseURL, res.ID),
+		res.HoldUntil,
+		guestEmail(res.Email),
+	)
+	if err != nil {
+		return err
+	}
+
+	htmlMessage := fmt.Sprintf(`
+		<strong>Confirm your reservation</strong>
+		<br>
+		Dear %s: <br>
+		We are holding %s for you from %s to %s.
+		Please follow <a href="%s">this link</a> before %s to confirm your reservation, the room is released otherwise.
+	`, res.FirstName, res.Room.RoomName, m.App.FormatDate(res.StartDate), m.App.FormatDate(res.EndDate),
+		link, m.holdUntil(p, res))
+
+	m.App.MailChan <- propertyMail(p, models.MailData{
+		To:       res.Email,
+		Subject:  "Confirm your reservation",
+		Content:  htmlMessage,
+		Template: "basic.html",
+	})
+
+	return nil
+}
+
+// ConfirmReservation confirms a held reservation from the signed link emailed to the guest
+func (m *Repository) ConfirmReservation(w http.ResponseWriter, r *http.Request) {
+	released := func() {
+		m.App.Session.Put(r.Context(), "error", "This reservation is no longer held, please search for availability and book again")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+	}
+
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+
+	res, err := m.DB.GetReservationByID(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		released()
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = urlsigner.New(m.App.Secret).Verify(r.URL.RequestURI(), guestEmail(res.Email), time.Now())
+	if errors.Is(err, urlsigner.ErrExpired) {
+		released()
+		return
+	} else if errors.Is(err, urlsigner.ErrInvalidSignature) {
+		m.App.Session.Put(r.Context(), "error", "This confirmation link is invalid")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if !res.Pending() {
+		m.App.Session.Put(r.Context(), "flash", "Your reservation is already confirmed")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	res, err = m.Booking.ConfirmReservation(r.Context(), res)
+	if errors.Is(err, repository.ErrNotFound) {
+		released()
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "reservation", res)
+	m.App.Session.Put(r.Context(), "flash", "Your reservation is confirmed")
+	http.Redirect(w, r, "/reservation-summary", http.StatusSeeOther)
+}
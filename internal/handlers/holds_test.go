@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adewidyatamadb/GoBookings/internal/models"
+	"github.com/adewidyatamadb/GoBookings/internal/urlsigner"
+)
+
+// confirmLink returns the path and query of a link confirming a reservation of the fixtures
+func confirmLink(t *testing.T, id, email string, expires time.Time) string {
+	t.Helper()
+
+	link, err := urlsigner.New(app.Secret).Sign(app.BaseURL+"/reservation/confirm?id="+id, expires, email)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return strings.TrimPrefix(link, app.BaseURL)
+}
+
+func TestRepository_PostReservation_Hold(t *testing.T) {
+	app.VerifyBookings = true
+	app.HoldTTL = 30 * time.Minute
+	defer func() { app.VerifyBookings = false }()
+
+	var tableTest = []struct {
+		name            string
+		guestID         int
+		email           string
+		expectedPending bool
+	}{
+		{"anonymous", 0, "new@guest.com", true},
+		{"verified guest", 1, "John@Smith.com", false},
+		{"verified guest with other email", 1, "other@smith.com", true},
+		{"unverified guest", 2, "jane@doe.com", true},
+	}
+
+	defer resetTestDB()
+
+	for _, test := range tableTest {
+		resetTestDB()
+		postedData := url.Values{}
+		postedData.Add("start_date", "11-10-2050")
+		postedData.Add("end_date", "12-10-2050")
+		postedData.Add("room_id", "1")
+		postedData.Add("first_name", "John")
+		postedData.Add("last_name", "Smith")
+		postedData.Add("email", test.email)
+		postedData.Add("phone", "555-555-5555")
+
+		w := httptest.NewRecorder()
+		r := guestRequest("POST", "/make-reservation", test.guestID, postedData)
+
+		handler := http.HandlerFunc(Repo.PostReservation)
+		handler.ServeHTTP(w, r)
+
+		if w.Code != http.StatusSeeOther {
+			t.Errorf("case - %s: expected code %d but got %d", test.name, http.StatusSeeOther, w.Code)
+		}
+
+		res, ok := session.Get(r.Context(), "reservation").(models.Reservation)
+		if !ok {
+			t.Errorf("case - %s: expected the reservation to be kept in the session", test.name)
+			continue
+		}
+		if res.Pending() != test.expectedPending {
+			t.Errorf("case - %s: expected the reservation to be pending %t but got %t", test.name, test.expectedPending, res.Pending())
+		}
+		if res.Pending() && res.HoldUntil.Sub(time.Now().Add(app.HoldTTL)).Abs() > time.Minute {
+			t.Errorf("case - %s: expected the room to be held for %s but it is held until %s", test.name, app.HoldTTL, res.HoldUntil)
+		}
+	}
+}
+
+func TestRepository_ConfirmReservation(t *testing.T) {
+	var tableTest = []struct {
+		name             string
+		link             string
+		expectedLocation string
+		expectedFlash    string
+		expectedError    string
+	}{
+		{"held", confirmLink(t, "10", "jane@doe.com", time.Now().Add(time.Hour)), "/reservation-summary", "is confirmed", ""},
+		{"already confirmed", confirmLink(t, "1", "john@smith.com", time.Now().Add(time.Hour)), "/", "already confirmed", ""},
+		{"released meanwhile", confirmLink(t, "11", "jane@doe.com", time.Now().Add(time.Hour)), "/search-availability", "", "no longer held"},
+		{"released", confirmLink(t, "100", "jane@doe.com", time.Now().Add(time.Hour)), "/search-availability", "", "no longer held"},
+		{"expired link", confirmLink(t, "10", "jane@doe.com", time.Now().Add(-time.Minute)), "/search-availability", "", "no longer held"},
+		{"other email", confirmLink(t, "10", "john@smith.com", time.Now().Add(time.Hour)), "/", "", "invalid"},
+		{"unsigned", "/reservation/confirm?id=10", "/", "", "invalid"},
+	}
+	defer resetTestDB()
+
+	for _, test := range tableTest {
+		resetTestDB()
+		w := httptest.NewRecorder()
+		r := guestRequest("GET", test.link, 0, nil)
+
+		handler := http.HandlerFunc(Repo.ConfirmReservation)
+		handler.ServeHTTP(w, r)
+
+		actualLoc, _ := w.Result().Location()
+		if actualLoc == nil || actualLoc.String() != test.expectedLocation {
+			t.Errorf("case - %s: expected location %s, but got location %v", test.name, test.expectedLocation, actualLoc)
+		}
+
+		flash := session.GetString(r.Context(), "flash")
+		if test.expectedFlash == "" && flash != "" || !strings.Contains(flash, test.expectedFlash) {
+			t.Errorf("case - %s: expected the flash message to contain %q but got %q", test.name, test.expectedFlash, flash)
+		}
+
+		errorMsg := session.GetString(r.Context(), "error")
+		if test.expectedError == "" && errorMsg != "" || !strings.Contains(errorMsg, test.expectedError) {
+			t.Errorf("case - %s: expected the error message to contain %q but got %q", test.name, test.expectedError, errorMsg)
+		}
+
+		res, ok := session.Get(r.Context(), "reservation").(models.Reservation)
+		if ok != (test.expectedLocation == "/reservation-summary") || ok && res.Pending() {
+			t.Errorf("case - %s: expected only a confirmed reservation to be kept in the session", test.name)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r := guestRequest("GET", "/reservation/confirm?id=invalid", 0, nil)
+	http.HandlerFunc(Repo.ConfirmReservation).ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("case - invalid id: expected code %d but got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestRepository_ReservationSummary_Hold(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := guestRequest("GET", "/reservation-summary", 0, nil)
+	session.Put(r.Context(), "reservation", models.Reservation{
+		Email:     "jane@doe.com",
+		HoldUntil: time.Date(2021, 10, 11, 14, 30, 0, 0, time.UTC),
+	})
+
+	handler := http.HandlerFunc(Repo.ReservationSummary)
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected code %d but got %d", http.StatusOK, w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "until 14:30 on 11-Oct-2021") || !strings.Contains(w.Body.String(), "emailed to jane@doe.com") {
+		t.Error("expected the summary to tell the guest to confirm the reservation")
+	}
+}
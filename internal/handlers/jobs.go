@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/adewidyatamadb/GoBookings/internal/helpers"
+	"github.com/adewidyatamadb/GoBookings/internal/models"
+	"github.com/adewidyatamadb/GoBookings/internal/render"
+	"github.com/adewidyatamadb/GoBookings/internal/scheduler"
+)
+
+// jobHistoryShown is how many runs of each job the jobs page lists
+const jobHistoryShown = 10
+
+// jobView is a background job with its latest runs, newest first
+type jobView struct {
+	scheduler.Status
+	Runs []models.JobRun
+}
+
+// AdminJobs shows the background jobs with their schedules, next runs and run history
+func (m *Repository) AdminJobs(w http.ResponseWriter, r *http.Request) {
+	var jobs []jobView
+	if m.App.Scheduler != nil {
+		for _, status := range m.App.Scheduler.Jobs() {
+			runs, err := m.DB.JobRuns(r.Context(), status.Name, jobHistoryShown)
+			if err != nil {
+				helpers.ServerError(w, err)
+				return
+			}
+			jobs = append(jobs, jobView{Status: status, Runs: runs})
+		}
+	}
+
+	data := make(map[string]interface{})
+	data["jobs"] = jobs
+
+	render.Template(w, r, "admin-jobs.page.html", &models.TemplateData{
+		Data: data,
+	})
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adewidyatamadb/GoBookings/internal/scheduler"
+)
+
+func TestRepository_AdminJobs(t *testing.T) {
+	noop := func(ctx context.Context) error { return nil }
+
+	jobs := scheduler.New(Repo.DB, "test")
+	if err := jobs.Add("release-expired-holds", "* * * * *", time.Minute, noop); err != nil {
+		t.Fatal(err)
+	}
+	if err := jobs.Add("day-sheet-mail", "30 18 * * *", time.Minute, noop); err != nil {
+		t.Fatal(err)
+	}
+
+	var tableTest = []struct {
+		name         string
+		scheduler    *scheduler.Scheduler
+		expectedHTML []string
+	}{
+		{"no scheduler", nil, []string{"No background jobs are running"}},
+		{"jobs", jobs, []string{"release-expired-holds", "<code>30 18 * * *</code>", "database is locked", "Not run yet", "19-Oct-2021 14:01"}},
+	}
+
+	defer func() { Repo.App.Scheduler = nil }()
+
+	for _, test := range tableTest {
+		Repo.App.Scheduler = test.scheduler
+
+		w := httptest.NewRecorder()
+		r := guestRequest("GET", "/admin/jobs", 0, nil)
+
+		handler := http.HandlerFunc(Repo.AdminJobs)
+		handler.ServeHTTP(w, r)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("case - %s: expected code %d but got %d", test.name, http.StatusOK, w.Code)
+		}
+
+		for _, html := range test.expectedHTML {
+			if !strings.Contains(w.Body.String(), html) {
+				t.Errorf("case - %s: expected to find %s but did not", test.name, html)
+			}
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/adewidyatamadb/GoBookings/internal/helpers"
+	"github.com/adewidyatamadb/GoBookings/internal/models"
+	"github.com/adewidyatamadb/GoBookings/internal/repository"
+	"github.com/adewidyatamadb/GoBookings/internal/throttle"
+)
+
+// AccountLoginPolicy throttles failed logins per email address, users reaching
+// MaxFailures are also locked out in the database until an admin unlocks them or the lockout ends
+var AccountLoginPolicy = throttle.Policy{
+	FreeAttempts: 2,
+	BaseDelay:    time.Second,
+	MaxDelay:     30 * time.Second,
+	MaxFailures:  5,
+	Lockout:      15 * time.Minute,
+	Window:       time.Hour,
+}
+
+// IPLoginPolicy throttles failed logins per client IP address
+var IPLoginPolicy = throttle.Policy{
+	FreeAttempts: 10,
+	BaseDelay:    time.Second,
+	MaxDelay:     time.Minute,
+	MaxFailures:  50,
+	Lockout:      time.Hour,
+	Window:       time.Hour,
+}
+
+// tooManyLogins is shown for throttled and locked logins alike, so it does not tell whether the email exists
+const tooManyLogins = "Too many failed login attempts, please try again later"
+
+// loginAccount returns the throttle key of the email address of a login
+func loginAccount(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// loginThrottled reports whether the account or the IP address of a login has to wait
+func (m *Repository) loginThrottled(r *http.Request, email string) bool {
+	return m.App.LoginAccounts.Wait(loginAccount(email)) > 0 || m.App.LoginIPs.Wait(helpers.ClientIP(r)) > 0
+}
+
+// loginFailed throttles the account and the IP address of a failed login and
+// locks the user out once the account reaches the maximum number of failures
+func (m *Repository) loginFailed(r *http.Request, email string) {
+	m.App.LoginIPs.Fail(helpers.ClientIP(r))
+	m.App.LoginAccounts.Fail(loginAccount(email))
+
+	u, err := m.DB.RecordFailedLogin(r.Context(), email)
+	if errors.Is(err, repository.ErrNotFound) {
+		return
+	} else if err != nil {
+		log.Println(err)
+		return
+	}
+
+	if u.FailedLogins < AccountLoginPolicy.MaxFailures {
+		return
+	}
+
+	err = m.DB.LockUser(r.Context(), u.ID, time.Now().Add(AccountLoginPolicy.Lockout))
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	htmlMessage := fmt.Sprintf(`
+		<strong>Account locked</strong>
+		<br>
+		Dear %s: <br>
+		Your account has been locked for %d minutes after %d failed login attempts.
+		If this was not you, <a href="%s/user/forgot-password">reset your password</a>
+		once the lockout is over, or ask an administrator to unlock your account.
+	`, u.FirstName, int(AccountLoginPolicy.Lockout.Minutes()), AccountLoginPolicy.MaxFailures, m.App.BaseURL)
+
+	p, err := m.requestProperty(r)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	msg := propertyMail(p, models.MailData{
+		To:       u.Email,
+		Subject:  "Your account has been locked",
+		Content:  htmlMessage,
+		Template: "basic.html",
+	})
+	// a slow mail worker must neither hold up the login nor tell by the response time that the lockout fired
+	go func() { m.App.MailChan <- msg }()
+}
+
+// loginSucceeded forgets the failed logins of the account of u
+func (m *Repository) loginSucceeded(r *http.Request, u models.User) {
+	m.App.LoginAccounts.Reset(loginAccount(u.Email))
+
+	if u.FailedLogins > 0 || !u.LockedUntil.IsZero() {
+		if err := m.DB.UnlockUser(r.Context(), u.ID); err != nil {
+			log.Println(err)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adewidyatamadb/GoBookings/internal/models"
+)
+
+// postLogin posts the login form from remoteAddr and returns the error put in the session
+func postLogin(email, remoteAddr string) (int, string) {
+	postedData := url.Values{}
+	postedData.Add("email", email)
+	postedData.Add("password", "password")
+
+	req := httptest.NewRequest("POST", "/user/login", strings.NewReader(postedData.Encode()))
+	req.RemoteAddr = remoteAddr
+	req = req.WithContext(getCTX(req))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	w := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.PostShowLogin)
+	handler.ServeHTTP(w, req)
+
+	return w.Code, session.GetString(req.Context(), "error")
+}
+
+func TestLogin_ThrottlesAccount(t *testing.T) {
+	var tableTest = []struct {
+		name          string
+		email         string
+		expectedError string
+	}{
+		{"first failure", "jill@here.com", "Invalid login credentials"},
+		{"last free attempt", "jill@here.com", "Invalid login credentials"},
+		{"first delayed failure", "JILL@here.com", "Invalid login credentials"},
+		{"throttled", "jill@here.com", tooManyLogins},
+		{"other account", "jack@here.com", "Invalid login credentials"},
+	}
+
+	for _, test := range tableTest {
+		code, msg := postLogin(test.email, "198.51.100.1:1234")
+		if code != http.StatusSeeOther {
+			t.Errorf("case - %s: expected code %d but got %d", test.name, http.StatusSeeOther, code)
+		}
+		if msg != test.expectedError {
+			t.Errorf("case - %s: expected error %q but got %q", test.name, test.expectedError, msg)
+		}
+	}
+}
+
+func TestLogin_ThrottlesIP(t *testing.T) {
+	for i := 0; i <= IPLoginPolicy.FreeAttempts; i++ {
+		postLogin(fmt.Sprintf("user%d@here.com", i), "198.51.100.2:1234")
+	}
+
+	_, msg := postLogin("me@here.com", "198.51.100.2:1234")
+	if msg != tooManyLogins {
+		t.Errorf("expected a valid login from a throttled IP address to be refused but got %q", msg)
+	}
+
+	_, msg = postLogin("me@here.com", "198.51.100.3:1234")
+	if msg != "" {
+		t.Errorf("expected a login from another IP address to succeed but got %q", msg)
+	}
+}
+
+func TestLogin_LockoutMailDoesNotBlock(t *testing.T) {
+	defer resetTestDB()
+
+	a := *Repo.App
+	a.MailChan = make(chan models.MailData)
+	m := newRepository(&a, Repo.DB)
+
+	r := userRequest("POST", "/user/login", "", nil)
+
+	done := make(chan struct{})
+	go func() {
+		m.loginFailed(r, "lockout@here.com")
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected the failed login to return before the lockout email is taken from the mail channel")
+	}
+
+	select {
+	case msg := <-a.MailChan:
+		if msg.Subject != "Your account has been locked" {
+			t.Errorf("expected the lockout email but got %q", msg.Subject)
+		}
+	case <-time.After(time.Second):
+		t.Error("expected the lockout email to be sent")
+	}
+}
@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/adewidyatamadb/GoBookings/internal/forms"
+	"github.com/adewidyatamadb/GoBookings/internal/helpers"
+	"github.com/adewidyatamadb/GoBookings/internal/models"
+	"github.com/adewidyatamadb/GoBookings/internal/render"
+	"github.com/adewidyatamadb/GoBookings/internal/repository"
+	"github.com/adewidyatamadb/GoBookings/internal/urlsigner"
+)
+
+// resetLinkTTL is how long a password reset link can be used
+const resetLinkTTL = time.Hour
+
+// ChangePassword shows the form to choose a new password
+func (m *Repository) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	u, err := m.DB.GetUserByID(r.Context(), m.App.Session.GetInt(r.Context(), "user_id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.renderChangePassword(w, r, u, forms.New(nil))
+}
+
+// renderChangePassword renders the change password page, users that have to
+// change their password after logging in are not asked for the current one
+func (m *Repository) renderChangePassword(w http.ResponseWriter, r *http.Request, u models.User, form *forms.Form) {
+	intMap := make(map[string]int)
+	if u.MustChangePassword {
+		intMap["must_change_password"] = 1
+	}
+
+	render.Template(w, r, "change-password.page.html", &models.TemplateData{
+		Form:   form,
+		IntMap: intMap,
+	})
+}
+
+// PostChangePassword stores the new password of the logged in user
+func (m *Repository) PostChangePassword(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	u, err := m.DB.GetUserByID(r.Context(), m.App.Session.GetInt(r.Context(), "user_id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("password", "confirm_password")
+	form.IsPassword("password", u.Email)
+	form.Matches("confirm_password", "password")
+
+	if !u.MustChangePassword {
+		form.Required("current_password")
+		_, _, err = m.DB.Authenticate(r.Context(), u.Email, r.Form.Get("current_password"))
+		if errors.Is(err, repository.ErrInvalidCredentials) {
+			form.Errors.Add("current_password", "Your current password is incorrect")
+		} else if errors.Is(err, repository.ErrLocked) {
+			form.Errors.Add("current_password", tooManyLogins)
+		} else if errors.Is(err, repository.ErrDisabled) {
+			_ = m.App.Session.Destroy(r.Context())
+			_ = m.App.Session.RenewToken(r.Context())
+			m.App.Session.Put(r.Context(), "error", "Your account has been disabled")
+			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+			return
+		} else if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		m.renderChangePassword(w, r, u, form)
+		return
+	}
+
+	err = m.DB.UpdatePassword(r.Context(), u.ID, r.Form.Get("password"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	// the new password logs out every other session, keep this one
+	_ = m.App.Session.RenewToken(r.Context())
+	m.App.Session.Put(r.Context(), "session_version", u.SessionVersion+1)
+
+	m.App.Session.Put(r.Context(), "flash", "Your password has been changed")
+	http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+}
+
+// ForgotPassword shows the form to request a password reset link
+func (m *Repository) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	render.Template(w, r, "forgot-password.page.html", &models.TemplateData{
+		Form: forms.New(nil),
+	})
+}
+
+// PostForgotPassword emails a password reset link, it responds the same way
+// whether the email belongs to a user or not
+func (m *Repository) PostForgotPassword(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("email")
+	form.IsEmail("email")
+	if !form.Valid() {
+		render.Template(w, r, "forgot-password.page.html", &models.TemplateData{
+			Form: form,
+		})
+		return
+	}
+
+	u, err := m.DB.GetUserByEmail(r.Context(), r.Form.Get("email"))
+	if err == nil && u.Active {
+		link, err := urlsigner.New(m.App.Secret).Sign(
+			fmt.Sprintf("%s/user/reset-password?id=%d", m.App.BaseURL, u.ID),
+			time.Now().Add(resetLinkTTL),
+			u.Password,
+		)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		htmlMessage := fmt.Sprintf(`
+			<strong>Password reset</strong>
+			<br>
+			Dear %s: <br>
+			Someone asked to reset the password of your account. If it was you, follow
+			<a href="%s">this link</a> within the next hour to choose a new password.
+			Otherwise you can ignore this email.
+		`, u.FirstName, link)
+
+		p, err := m.requestProperty(r)
+		if err != nil {
+			log.Println(err)
+		} else {
+			m.App.MailChan <- propertyMail(p, models.MailData{
+				To:       u.Email,
+				Subject:  "Reset your password",
+				Content:  htmlMessage,
+				Template: "basic.html",
+			})
+		}
+	} else if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		log.Println(err)
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "If an account exists for this email, a reset link is on its way")
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+// resetUser returns the user of a signed password reset request, the link stops
+// working once it expires or the password has been changed
+func (m *Repository) resetUser(r *http.Request) (models.User, error) {
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		return models.User{}, urlsigner.ErrInvalidSignature
+	}
+
+	u, err := m.DB.GetUserByID(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return u, urlsigner.ErrInvalidSignature
+	} else if err != nil {
+		return u, err
+	}
+	if !u.Active {
+		return u, urlsigner.ErrInvalidSignature
+	}
+
+	err = urlsigner.New(m.App.Secret).Verify(r.URL.RequestURI(), u.Password, time.Now())
+	return u, err
+}
+
+// resetLinkError handles a reset link that cannot be used
+func (m *Repository) resetLinkError(w http.ResponseWriter, r *http.Request, err error) {
+	if !errors.Is(err, urlsigner.ErrInvalidSignature) && !errors.Is(err, urlsigner.ErrExpired) {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "error", "This reset link is invalid or has expired, please request a new one")
+	http.Redirect(w, r, "/user/forgot-password", http.StatusSeeOther)
+}
+
+// ResetPassword shows the form to choose a new password from a reset link
+func (m *Repository) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	_, err := m.resetUser(r)
+	if err != nil {
+		m.resetLinkError(w, r, err)
+		return
+	}
+
+	stringMap := make(map[string]string)
+	stringMap["action"] = r.URL.RequestURI()
+
+	render.Template(w, r, "reset-password.page.html", &models.TemplateData{
+		Form:      forms.New(nil),
+		StringMap: stringMap,
+	})
+}
+
+// PostResetPassword stores the new password from a reset link and logs the user out everywhere
+func (m *Repository) PostResetPassword(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	u, err := m.resetUser(r)
+	if err != nil {
+		m.resetLinkError(w, r, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("password", "confirm_password")
+	form.IsPassword("password", u.Email)
+	form.Matches("confirm_password", "password")
+
+	if !form.Valid() {
+		stringMap := make(map[string]string)
+		stringMap["action"] = r.URL.RequestURI()
+
+		render.Template(w, r, "reset-password.page.html", &models.TemplateData{
+			Form:      form,
+			StringMap: stringMap,
+		})
+		return
+	}
+
+	err = m.DB.UpdatePassword(r.Context(), u.ID, r.Form.Get("password"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	_ = m.App.Session.Destroy(r.Context())
+	_ = m.App.Session.RenewToken(r.Context())
+
+	m.App.Session.Put(r.Context(), "flash", "Your password has been reset, please log in")
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adewidyatamadb/GoBookings/internal/urlsigner"
+)
+
+func TestRepository_PostChangePassword(t *testing.T) {
+	var tableTest = []struct {
+		name               string
+		userID             int
+		current            string
+		password           string
+		confirmation       string
+		expectedStatusCode int
+		expectedLocation   string
+		expectedHTML       string
+	}{
+		{"valid", 1, "password", "long enough 42", "long enough 42", http.StatusSeeOther, "/admin/dashboard", ""},
+		{"too short", 1, "password", "short 42", "short 42", http.StatusOK, "", "at least 10 characters"},
+		{"not matching", 1, "password", "long enough 42", "long enough 43", http.StatusOK, "", "does not match"},
+		{"contains email", 1, "password", "me@here.com 42", "me@here.com 42", http.StatusOK, "", "must not contain your email"},
+		{"wrong current password", 2, "wrong", "long enough 42", "long enough 42", http.StatusOK, "", "current password is incorrect"},
+		{"forced change without current password", 3, "", "long enough 42", "long enough 42", http.StatusSeeOther, "/admin/dashboard", ""},
+		{"locked out", 8, "password", "long enough 42", "long enough 42", http.StatusOK, "", "Too many failed login attempts"},
+		{"disabled", 4, "password", "long enough 42", "long enough 42", http.StatusSeeOther, "/user/login", ""},
+	}
+
+	defer resetTestDB()
+
+	for _, test := range tableTest {
+		resetTestDB()
+		postedData := url.Values{}
+		postedData.Add("current_password", test.current)
+		postedData.Add("password", test.password)
+		postedData.Add("confirm_password", test.confirmation)
+
+		w := httptest.NewRecorder()
+		r := userRequest("POST", "/user/change-password", "", postedData)
+		session.Put(r.Context(), "user_id", test.userID)
+
+		handler := http.HandlerFunc(Repo.PostChangePassword)
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.expectedStatusCode {
+			t.Errorf("case - %s: expected code %d but got %d", test.name, test.expectedStatusCode, w.Code)
+		}
+
+		if test.expectedHTML != "" && !strings.Contains(w.Body.String(), test.expectedHTML) {
+			t.Errorf("case - %s: expected to find %s but did not", test.name, test.expectedHTML)
+		}
+
+		if test.expectedLocation != "" {
+			location, _ := w.Result().Location()
+			if location.String() != test.expectedLocation {
+				t.Errorf("case - %s: expected location %s but got %s", test.name, test.expectedLocation, location.String())
+			}
+		}
+
+		if test.expectedLocation == "/admin/dashboard" && session.GetInt(r.Context(), "session_version") != 1 {
+			t.Errorf("case - %s: expected the session to move to the new session version", test.name)
+		}
+	}
+}
+
+func TestRepository_PostForgotPassword(t *testing.T) {
+	var tableTest = []struct {
+		name               string
+		email              string
+		expectedStatusCode int
+		expectedLocation   string
+	}{
+		{"known email", "me@here.com", http.StatusSeeOther, "/user/login"},
+		{"unknown email", "nobody@here.com", http.StatusSeeOther, "/user/login"},
+		{"disabled user", "disabled@here.com", http.StatusSeeOther, "/user/login"},
+		{"invalid email", "nobody", http.StatusOK, ""},
+	}
+
+	defer resetTestDB()
+
+	for _, test := range tableTest {
+		postedData := url.Values{}
+		postedData.Add("email", test.email)
+
+		req := httptest.NewRequest("POST", "/user/forgot-password", strings.NewReader(postedData.Encode()))
+		req = req.WithContext(getCTX(req))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		w := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.PostForgotPassword)
+		handler.ServeHTTP(w, req)
+
+		if w.Code != test.expectedStatusCode {
+			t.Errorf("case - %s: expected code %d but got %d", test.name, test.expectedStatusCode, w.Code)
+		}
+
+		if test.expectedLocation != "" {
+			actualLoc, _ := w.Result().Location()
+			if actualLoc.String() != test.expectedLocation {
+				t.Errorf("case - %s: expected location %s, but got location %s", test.name, test.expectedLocation, actualLoc.String())
+			}
+		}
+	}
+}
+
+// resetLink returns the path and query of a reset link for a user of the fixtures
+func resetLink(t *testing.T, id, password string, expires time.Time) string {
+	t.Helper()
+
+	link, err := urlsigner.New(app.Secret).Sign(app.BaseURL+"/user/reset-password?id="+id, expires, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return strings.TrimPrefix(link, app.BaseURL)
+}
+
+func TestRepository_ResetPassword(t *testing.T) {
+	admin, err := testDB.GetUserByID(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	disabled, err := testDB.GetUserByID(context.Background(), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resetTestDB()
+
+	valid := resetLink(t, "1", admin.Password, time.Now().Add(time.Hour))
+
+	var tableTest = []struct {
+		name               string
+		method             string
+		link               string
+		password           string
+		expectedStatusCode int
+		expectedLocation   string
+	}{
+		{"show form", "GET", valid, "", http.StatusOK, ""},
+		{"expired link", "GET", resetLink(t, "1", admin.Password, time.Now().Add(-time.Minute)), "", http.StatusSeeOther, "/user/forgot-password"},
+		{"tampered link", "GET", strings.Replace(valid, "id=1", "id=2", 1), "", http.StatusSeeOther, "/user/forgot-password"},
+		{"disabled user", "GET", resetLink(t, "4", disabled.Password, time.Now().Add(time.Hour)), "", http.StatusSeeOther, "/user/forgot-password"},
+		{"unknown user", "GET", resetLink(t, "100", admin.Password, time.Now().Add(time.Hour)), "", http.StatusSeeOther, "/user/forgot-password"},
+		{"weak password", "POST", valid, "weak", http.StatusOK, ""},
+		{"reset", "POST", valid, "long enough 42", http.StatusSeeOther, "/user/login"},
+		{"used link after the reset", "GET", valid, "", http.StatusSeeOther, "/user/forgot-password"},
+		{"reset with expired link", "POST", resetLink(t, "1", admin.Password, time.Now().Add(-time.Minute)), "long enough 42", http.StatusSeeOther, "/user/forgot-password"},
+	}
+
+	for _, test := range tableTest {
+		var req *http.Request
+		if test.method == "POST" {
+			postedData := url.Values{}
+			postedData.Add("password", test.password)
+			postedData.Add("confirm_password", test.password)
+			req = httptest.NewRequest("POST", test.link, strings.NewReader(postedData.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		} else {
+			req = httptest.NewRequest("GET", test.link, nil)
+		}
+		req = req.WithContext(getCTX(req))
+
+		w := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.ResetPassword)
+		if test.method == "POST" {
+			handler = Repo.PostResetPassword
+		}
+		handler.ServeHTTP(w, req)
+
+		if w.Code != test.expectedStatusCode {
+			t.Errorf("case - %s: expected code %d but got %d", test.name, test.expectedStatusCode, w.Code)
+		}
+
+		if test.expectedLocation != "" {
+			actualLoc, _ := w.Result().Location()
+			if actualLoc.String() != test.expectedLocation {
+				t.Errorf("case - %s: expected location %s, but got location %s", test.name, test.expectedLocation, actualLoc.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/adewidyatamadb/GoBookings/internal/dates"
+	"github.com/adewidyatamadb/GoBookings/internal/forms"
+	"github.com/adewidyatamadb/GoBookings/internal/helpers"
+	"github.com/adewidyatamadb/GoBookings/internal/models"
+	"github.com/adewidyatamadb/GoBookings/internal/render"
+	"github.com/adewidyatamadb/GoBookings/internal/repository"
+	"github.com/go-chi/chi/v5"
+)
+
+// parseTags returns the tags typed into the guest profile form, lower case with dashes for spaces
+func parseTags(s string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, t := range strings.Split(s, ",") {
+		t = strings.Join(strings.Fields(strings.ToLower(t)), "-")
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		tags = append(tags, t)
+	}
+	return tags
+}
+
+// stayNights returns the number of nights booked by reservations
+func stayNights(reservations []models.Reservation) int {
+	nights := 0
+	for _, res := range reservations {
+		nights += res.StartDate.DaysUntil(res.EndDate)
+	}
+	return nights
+}
+
+// guestInScope reports whether guest guestID stayed in a room of scope
+func (m *Repository) guestInScope(r *http.Request, scope roomScope, guestID int) (bool, error) {
+	if scope.all {
+		return true, nil
+	}
+
+	reservations, err := m.DB.GuestReservations(r.Context(), guestID)
+	if err != nil {
+		return false, err
+	}
+	return len(scopedReservations(reservations, scope)) > 0, nil
+}
+
+// scopedGuests returns the guests of guests who stayed in a room of scope, with their stays counted in it
+func (m *Repository) scopedGuests(r *http.Request, guests []models.Guest, scope roomScope) ([]models.Guest, error) {
+	if scope.all {
+		return guests, nil
+	}
+
+	reservations, err := m.DB.GetAllReservations(r.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	stays := make(map[int]int)
+	lastStays := make(map[int]dates.Date)
+	for _, res := range scopedReservations(reservations, scope) {
+		if res.GuestID == 0 {
+			continue
+		}
+		stays[res.GuestID]++
+		if last, ok := lastStays[res.GuestID]; !ok || res.StartDate.After(last) {
+			lastStays[res.GuestID] = res.StartDate
+		}
+	}
+
+	var list []models.Guest
+	for _, g := range guests {
+		if stays[g.ID] == 0 {
+			continue
+		}
+		g.Stays = stays[g.ID]
+		g.LastStay = lastStays[g.ID]
+		list = append(list, g)
+	}
+	return list, nil
+}
+
+// renderGuestProfile renders the profile of g with the guest's stay history and possible duplicates in scope
+func (m *Repository) renderGuestProfile(w http.ResponseWriter, r *http.Request, g models.Guest, scope roomScope, form *forms.Form) {
+	reservations, err := m.DB.GuestReservations(r.Context(), g.ID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	reservations = scopedReservations(reservations, scope)
+
+	candidates, err := m.DB.GuestDuplicates(r.Context(), g)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	var duplicates []models.Guest
+	for _, d := range candidates {
+		ok, err := m.guestInScope(r, scope, d.ID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		if ok {
+			duplicates = append(duplicates, d)
+		}
+	}
+
+	data := make(map[string]interface{})
+	data["guest"] = g
+	data["reservations"] = reservations
+	data["duplicates"] = duplicates
+
+	intMap := make(map[string]int)
+	intMap["stays"] = len(reservations)
+	intMap["nights"] = stayNights(reservations)
+
+	stringMap := make(map[string]string)
+	stringMap["tags"] = strings.Join(g.Tags, ", ")
+
+	render.Template(w, r, "admin-guest.page.html", &models.TemplateData{
+		Form:      form,
+		Data:      data,
+		IntMap:    intMap,
+		StringMap: stringMap,
+	})
+}
+
+// guestFromURL loads the guest of the id URL parameter with the scope of the logged in user, guests who
+// did not stay at a property the user manages are not found. It writes the error response when it fails
+func (m *Repository) guestFromURL(w http.ResponseWriter, r *http.Request) (models.Guest, roomScope, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusNotFound)
+		return models.Guest{}, roomScope{}, false
+	}
+
+	g, err := m.DB.GetGuestByID(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return g, roomScope{}, false
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return g, roomScope{}, false
+	}
+
+	scope, err := m.staffScope(r)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return g, scope, false
+	}
+	ok, err := m.guestInScope(r, scope, g.ID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return g, scope, false
+	}
+	if !ok {
+		helpers.ClientError(w, http.StatusNotFound)
+		return g, scope, false
+	}
+
+	return g, scope, true
+}
+
+// AdminGuests lists the guests who stayed at the properties the logged in user manages, optionally
+// searched by name, email address or phone number
+func (m *Repository) AdminGuests(w http.ResponseWriter, r *http.Request) {
+	search := r.URL.Query().Get("q")
+
+	guests, err := m.DB.AllGuests(r.Context(), search)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	scope, err := m.staffScope(r)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	guests, err = m.scopedGuests(r, guests, scope)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["guests"] = guests
+
+	stringMap := make(map[string]string)
+	stringMap["q"] = search
+
+	render.Template(w, r, "admin-guests.page.html", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
+
+// AdminShowGuest shows the profile of a guest
+func (m *Repository) AdminShowGuest(w http.ResponseWriter, r *http.Request) {
+	g, scope, ok := m.guestFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	m.renderGuestProfile(w, r, g, scope, forms.New(nil))
+}
+
+// AdminPostShowGuest updates the name, phone number, notes and tags of a guest
+func (m *Repository) AdminPostShowGuest(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	g, scope, ok := m.guestFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	g.FirstName = r.Form.Get("first_name")
+	g.LastName = r.Form.Get("last_name")
+	g.Phone = r.Form.Get("phone")
+	g.Notes = strings.TrimSpace(r.Form.Get("notes"))
+	g.Tags = parseTags(r.Form.Get("tags"))
+
+	form := forms.New(r.PostForm)
+	form.Required("first_name", "last_name")
+
+	if !form.Valid() {
+		m.renderGuestProfile(w, r, g, scope, form)
+		return
+	}
+
+	err = m.DB.UpdateGuestProfile(r.Context(), g)
+	if errors.Is(err, repository.ErrNotFound) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Changes saved")
+	http.Redirect(w, r, fmt.Sprintf("/admin/guests/%d", g.ID), http.StatusSeeOther)
+}
+
+// AdminMergeGuest merges a duplicate profile into the profile of the guest
+func (m *Repository) AdminMergeGuest(w http.ResponseWriter, r *http.Request) {
+	g, scope, ok := m.guestFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	duplicateID, err := strconv.Atoi(chi.URLParam(r, "duplicate"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+
+	// staff of some properties only merge guests who stayed at them
+	inScope, err := m.guestInScope(r, scope, duplicateID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	if !inScope {
+		err = repository.ErrNotFound
+	} else {
+		err = m.DB.MergeGuests(r.Context(), g.ID, duplicateID)
+	}
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		m.App.Session.Put(r.Context(), "error", "Guest not found, it may have been merged already")
+	case errors.Is(err, repository.ErrConstraint):
+		m.App.Session.Put(r.Context(), "error", "The other guest registered an account, merge this guest into theirs instead")
+	case err != nil:
+		helpers.ServerError(w, err)
+		return
+	default:
+		m.App.Session.Put(r.Context(), "flash", "Guests merged")
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/admin/guests/%d", g.ID), http.StatusSeeOther)
+}
@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/adewidyatamadb/GoBookings/internal/dates"
+	"github.com/adewidyatamadb/GoBookings/internal/models"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestParseTags(t *testing.T) {
+	var tableTest = []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{"empty", "", nil},
+		{"single", "VIP", []string{"vip"}},
+		{"spaces", " vip ,  Do Not Rent", []string{"vip", "do-not-rent"}},
+		{"duplicates", "vip, VIP,,", []string{"vip"}},
+	}
+
+	for _, test := range tableTest {
+		if tags := parseTags(test.input); !reflect.DeepEqual(tags, test.expected) {
+			t.Errorf("case - %s: expected %v but got %v", test.name, test.expected, tags)
+		}
+	}
+}
+
+func TestStayNights(t *testing.T) {
+	start := dates.New(2026, 3, 27)
+	reservations := []models.Reservation{
+		{StartDate: start, EndDate: start.AddDays(3)},
+		{StartDate: start.AddDate(0, 1, 0), EndDate: start.AddDate(0, 1, 1)},
+	}
+
+	if nights := stayNights(reservations); nights != 4 {
+		t.Errorf("expected 4 nights but got %d", nights)
+	}
+}
+
+func TestRepository_AdminGuests(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := userRequest("GET", "/admin/guests?q=smith", "", nil)
+
+	handler := http.HandlerFunc(Repo.AdminGuests)
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected code %d but got %d", http.StatusOK, w.Code)
+	}
+
+	for _, html := range []string{"Smith, John", "j.smith@work.com", "do-not-rent", `value="smith"`} {
+		if !strings.Contains(w.Body.String(), html) {
+			t.Errorf("expected to find %s but did not", html)
+		}
+	}
+}
+
+func TestRepository_AdminGuests_Scoped(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := scopedRequest("GET", "/admin/guests?q=smith", "", nil)
+
+	handler := http.HandlerFunc(Repo.AdminGuests)
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected code %d but got %d", http.StatusOK, w.Code)
+	}
+
+	if strings.Contains(w.Body.String(), "Smith, John") {
+		t.Error("expected the guests who did not stay at property 2 to be hidden")
+	}
+}
+
+func TestRepository_AdminShowGuest(t *testing.T) {
+	var tableTest = []struct {
+		name               string
+		id                 string
+		scoped             bool
+		expectedStatusCode int
+		expectedHTML       []string
+	}{
+		{"with history and duplicates", "1", false, http.StatusOK, []string{"Prefers a late check-in", "Major&#39;s Suite", "Possible Duplicates", "j.smith@work.com"}},
+		{"do not rent", "3", false, http.StatusOK, []string{"marked do-not-rent"}},
+		{"unknown guest", "100", false, http.StatusNotFound, nil},
+		{"invalid id", "invalid", false, http.StatusNotFound, nil},
+		{"guest of another property", "1", true, http.StatusNotFound, nil},
+	}
+
+	for _, test := range tableTest {
+		w := httptest.NewRecorder()
+		var r *http.Request
+		if test.scoped {
+			r = scopedRequest("GET", "/admin/guests/"+test.id, test.id, nil)
+		} else {
+			r = userRequest("GET", "/admin/guests/"+test.id, test.id, nil)
+		}
+
+		handler := http.HandlerFunc(Repo.AdminShowGuest)
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.expectedStatusCode {
+			t.Errorf("case - %s: expected code %d but got %d", test.name, test.expectedStatusCode, w.Code)
+		}
+
+		for _, html := range test.expectedHTML {
+			if !strings.Contains(w.Body.String(), html) {
+				t.Errorf("case - %s: expected to find %s but did not", test.name, html)
+			}
+		}
+	}
+}
+
+func TestRepository_AdminPostShowGuest(t *testing.T) {
+	var tableTest = []struct {
+		name               string
+		id                 string
+		firstName          string
+		expectedStatusCode int
+		expectedLocation   string
+	}{
+		{"valid", "1", "John", http.StatusSeeOther, "/admin/guests/1"},
+		{"missing name", "1", "", http.StatusOK, ""},
+		{"unknown guest", "100", "John", http.StatusNotFound, ""},
+	}
+
+	defer resetTestDB()
+
+	for _, test := range tableTest {
+		postedData := url.Values{}
+		postedData.Add("first_name", test.firstName)
+		postedData.Add("last_name", "Smith")
+		postedData.Add("phone", "555-555-5555")
+		postedData.Add("tags", "vip, late arrival")
+		postedData.Add("notes", "Prefers a late check-in")
+
+		w := httptest.NewRecorder()
+		r := userRequest("POST", "/admin/guests/"+test.id, test.id, postedData)
+
+		handler := http.HandlerFunc(Repo.AdminPostShowGuest)
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.expectedStatusCode {
+			t.Errorf("case - %s: expected code %d but got %d", test.name, test.expectedStatusCode, w.Code)
+		}
+
+		if test.expectedLocation != "" {
+			actualLoc, _ := w.Result().Location()
+			if actualLoc.String() != test.expectedLocation {
+				t.Errorf("case - %s: expected location %s, but got location %s", test.name, test.expectedLocation, actualLoc.String())
+			}
+		}
+	}
+}
+
+func TestRepository_AdminMergeGuest(t *testing.T) {
+	var tableTest = []struct {
+		name         string
+		id           string
+		duplicate    string
+		scoped       bool
+		expectedKey  string
+		expectedCode int
+	}{
+		{"merge", "1", "3", false, "flash", http.StatusSeeOther},
+		{"duplicate has an account", "3", "2", false, "error", http.StatusSeeOther},
+		{"unknown duplicate", "1", "100", false, "error", http.StatusSeeOther},
+		{"unknown guest", "100", "3", false, "", http.StatusNotFound},
+		{"guest of another property", "1", "3", true, "", http.StatusNotFound},
+	}
+
+	defer resetTestDB()
+
+	for _, test := range tableTest {
+		resetTestDB()
+		w := httptest.NewRecorder()
+		target := "/admin/guests/" + test.id + "/merge/" + test.duplicate + "/do"
+		var r *http.Request
+		if test.scoped {
+			r = scopedRequest("POST", target, test.id, nil)
+		} else {
+			r = userRequest("POST", target, test.id, nil)
+		}
+		chi.RouteContext(r.Context()).URLParams.Add("duplicate", test.duplicate)
+
+		handler := http.HandlerFunc(Repo.AdminMergeGuest)
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.expectedCode {
+			t.Errorf("case - %s: expected code %d but got %d", test.name, test.expectedCode, w.Code)
+		}
+
+		if test.expectedKey != "" && session.GetString(r.Context(), test.expectedKey) == "" {
+			t.Errorf("case - %s: expected a %s message", test.name, test.expectedKey)
+		}
+	}
+}
+
+func TestRepository_AdminShowReservation_Guest(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := userRequest("GET", "/admin/reservations/all/1/show", "1", nil)
+
+	handler := http.HandlerFunc(Repo.AdminShowReservation)
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected code %d but got %d", http.StatusOK, w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `href="/admin/guests/1"`) {
+		t.Error("expected a link to the profile of the guest")
+	}
+}
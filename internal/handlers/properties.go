@@ -0,0 +1,492 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adewidyatamadb/GoBookings/internal/forms"
+	"github.com/adewidyatamadb/GoBookings/internal/helpers"
+	"github.com/adewidyatamadb/GoBookings/internal/models"
+	"github.com/adewidyatamadb/GoBookings/internal/render"
+	"github.com/adewidyatamadb/GoBookings/internal/repository"
+	"github.com/go-chi/chi/v5"
+)
+
+// propertyOf returns the property of room roomID, or the first property for a roomID of 0
+func (m *Repository) propertyOf(ctx context.Context, roomID int) (models.Property, error) {
+	if roomID > 0 {
+		room, err := m.DB.GetRoomByID(ctx, roomID)
+		if err != nil {
+			return models.Property{}, err
+		}
+		if room.PropertyID > 0 {
+			return m.DB.GetPropertyByID(ctx, room.PropertyID)
+		}
+	}
+
+	properties, err := m.DB.AllProperties(ctx)
+	if err != nil {
+		return models.Property{}, err
+	}
+	if len(properties) == 0 {
+		return models.Property{}, repository.ErrNotFound
+	}
+	return properties[0], nil
+}
+
+// requestProperty returns the property the request is for, the first property when no middleware selected one
+func (m *Repository) requestProperty(r *http.Request) (models.Property, error) {
+	if p := helpers.Property(r); p.ID > 0 {
+		return p, nil
+	}
+	return m.propertyOf(r.Context(), 0)
+}
+
+// propertiesTTL is how long the cached property list is used, property changes made by other
+// instances of the application show after it at the latest
+const propertiesTTL = time.Minute
+
+// propertyCache keeps the property list between requests, the zero value is empty
+type propertyCache struct {
+	mu         sync.Mutex
+	properties []models.Property
+	loadedAt   time.Time
+}
+
+// Properties returns every property like AllProperties, from a cache that property changes clear
+func (m *Repository) Properties(ctx context.Context) ([]models.Property, error) {
+	c := &m.properties
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.properties != nil && time.Since(c.loadedAt) < propertiesTTL {
+		return c.properties, nil
+	}
+
+	properties, err := m.DB.AllProperties(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if properties == nil {
+		properties = []models.Property{}
+	}
+
+	c.properties = properties
+	c.loadedAt = time.Now()
+	return properties, nil
+}
+
+// cachedProperty returns property id from the cached property list, the first property when there is no such
+// property, like the rooms without one belong to it
+func (m *Repository) cachedProperty(ctx context.Context, id int) (models.Property, error) {
+	properties, err := m.Properties(ctx)
+	if err != nil {
+		return models.Property{}, err
+	}
+	for _, p := range properties {
+		if p.ID == id {
+			return p, nil
+		}
+	}
+	if len(properties) == 0 {
+		return models.Property{}, nil
+	}
+	return properties[0], nil
+}
+
+// forgetProperties clears the cached property list after a property changed
+func (m *Repository) forgetProperties() {
+	m.properties.mu.Lock()
+	m.properties.properties = nil
+	m.properties.mu.Unlock()
+}
+
+// propertyMail returns msg sent from the address and with the name of property p
+func propertyMail(p models.Property, msg models.MailData) models.MailData {
+	msg.From = p.MailFrom
+	msg.Brand = p.Name
+	return msg
+}
+
+// roomProperties returns the property ids of the rooms, by room id
+func (m *Repository) roomProperties(ctx context.Context) (map[int]int, error) {
+	rooms, err := m.DB.GetAllRooms(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	properties := make(map[int]int, len(rooms))
+	for _, room := range rooms {
+		properties[room.ID] = room.PropertyID
+	}
+	return properties, nil
+}
+
+// roomScope is which rooms a staff user works on, the rooms of the properties the user manages
+type roomScope struct {
+	all   bool
+	rooms map[int]bool
+}
+
+// Has reports whether room roomID is in the scope
+func (s roomScope) Has(roomID int) bool {
+	return s.all || s.rooms[roomID]
+}
+
+// roomIDs returns the ids of the rooms in the scope, nil for every room
+func (s roomScope) roomIDs() []int {
+	if s.all {
+		return nil
+	}
+
+	ids := make([]int, 0, len(s.rooms))
+	for id := range s.rooms {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// staffScope returns the rooms of the properties the logged in user manages
+func (m *Repository) staffScope(r *http.Request) (roomScope, error) {
+	u, err := m.DB.GetUserByID(r.Context(), m.App.Session.GetInt(r.Context(), "user_id"))
+	if err != nil {
+		return roomScope{}, err
+	}
+	if len(u.PropertyIDs) == 0 {
+		return roomScope{all: true}, nil
+	}
+
+	properties, err := m.roomProperties(r.Context())
+	if err != nil {
+		return roomScope{}, err
+	}
+
+	scope := roomScope{rooms: make(map[int]bool)}
+	for roomID, propertyID := range properties {
+		if u.Manages(propertyID) {
+			scope.rooms[roomID] = true
+		}
+	}
+	return scope, nil
+}
+
+// scopedReservations returns the reservations of reservations in the rooms of scope
+func scopedReservations(reservations []models.Reservation, scope roomScope) []models.Reservation {
+	if scope.all {
+		return reservations
+	}
+
+	var list []models.Reservation
+	for _, res := range reservations {
+		if scope.Has(res.RoomID) {
+			list = append(list, res)
+		}
+	}
+	return list
+}
+
+// scopedRooms returns the rooms of rooms in scope
+func scopedRooms(rooms []models.Room, scope roomScope) []models.Room {
+	if scope.all {
+		return rooms
+	}
+
+	var list []models.Room
+	for _, room := range rooms {
+		if scope.Has(room.ID) {
+			list = append(list, room)
+		}
+	}
+	return list
+}
+
+// inStaffScope reports whether reservation id is in a room of a property the logged in user manages, a
+// reservation that does not exist is left to the caller to report
+func (m *Repository) inStaffScope(r *http.Request, id int) (bool, error) {
+	scope, err := m.staffScope(r)
+	if err != nil || scope.all {
+		return err == nil, err
+	}
+
+	res, err := m.DB.GetReservationByID(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	return scope.Has(res.RoomID), nil
+}
+
+// managedProperties returns the properties the logged in user manages
+func (m *Repository) managedProperties(r *http.Request) ([]models.Property, error) {
+	u, err := m.DB.GetUserByID(r.Context(), m.App.Session.GetInt(r.Context(), "user_id"))
+	if err != nil {
+		return nil, err
+	}
+
+	properties, err := m.DB.AllProperties(r.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	var list []models.Property
+	for _, p := range properties {
+		if u.Manages(p.ID) {
+			list = append(list, p)
+		}
+	}
+	return list, nil
+}
+
+// propertySlug is what a slug looks like, it is the path prefix /p/{slug} of the public pages
+var propertySlug = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// propertyCurrency is what a currency code looks like, e.g. EUR
+var propertyCurrency = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// propertyForm validates the posted property form and copies it into p
+func propertyForm(r *http.Request, p *models.Property) *forms.Form {
+	form := forms.New(r.PostForm)
+	form.Required("name", "slug")
+
+	p.Name = strings.TrimSpace(r.Form.Get("name"))
+	p.Slug = strings.ToLower(strings.TrimSpace(r.Form.Get("slug")))
+	p.Host = strings.ToLower(strings.TrimSpace(r.Form.Get("host")))
+	p.TimeZone = strings.TrimSpace(r.Form.Get("time_zone"))
+	p.Currency = strings.ToUpper(strings.TrimSpace(r.Form.Get("currency")))
+	p.MailFrom = strings.TrimSpace(r.Form.Get("mail_from"))
+	p.OwnerEmail = strings.TrimSpace(r.Form.Get("owner_email"))
+	p.Description = strings.TrimSpace(r.Form.Get("description"))
+
+	if p.Slug != "" && !propertySlug.MatchString(p.Slug) {
+		form.Errors.Add("slug", "Use lowercase letters, digits and dashes only")
+	}
+	if strings.ContainsAny(p.Host, "/: ") {
+		form.Errors.Add("host", "Enter a host name only, like www.example.com")
+	}
+	if p.TimeZone != "" {
+		if _, err := time.LoadLocation(p.TimeZone); err != nil {
+			form.Errors.Add("time_zone", "Unknown time zone, use a name like Europe/Lisbon")
+		}
+	}
+	if p.Currency != "" && !propertyCurrency.MatchString(p.Currency) {
+		form.Errors.Add("currency", "Use a three letter currency code like EUR")
+	}
+	for _, field := range []string{"mail_from", "owner_email"} {
+		if form.Get(field) != "" {
+			form.IsEmail(field)
+		}
+	}
+
+	return form
+}
+
+// renderPropertyForm renders the page to create or edit a property, with the rooms of existing properties
+func (m *Repository) renderPropertyForm(w http.ResponseWriter, r *http.Request, p models.Property, form *forms.Form) {
+	data := make(map[string]interface{})
+	data["property"] = p
+
+	if p.ID > 0 {
+		rooms, err := m.DB.GetAllRooms(r.Context())
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		var own []models.Room
+		for _, room := range rooms {
+			if room.PropertyID == p.ID {
+				own = append(own, room)
+			}
+		}
+		data["rooms"] = own
+		data["all_rooms"] = rooms
+	}
+
+	render.Template(w, r, "admin-property.page.html", &models.TemplateData{
+		Data: data,
+		Form: form,
+	})
+}
+
+// managedProperty returns the property of the id URL parameter, ErrNotFound when it does not exist or the logged
+// in user does not manage it
+func (m *Repository) managedProperty(r *http.Request) (models.Property, error) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		return models.Property{}, repository.ErrNotFound
+	}
+
+	u, err := m.DB.GetUserByID(r.Context(), m.App.Session.GetInt(r.Context(), "user_id"))
+	if err != nil {
+		return models.Property{}, err
+	}
+	if !u.Manages(id) {
+		return models.Property{}, repository.ErrNotFound
+	}
+
+	return m.DB.GetPropertyByID(r.Context(), id)
+}
+
+// AdminProperties lists the properties the logged in user manages
+func (m *Repository) AdminProperties(w http.ResponseWriter, r *http.Request) {
+	properties, err := m.managedProperties(r)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["properties"] = properties
+
+	render.Template(w, r, "admin-properties.page.html", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminNewProperty shows the form to add a property
+func (m *Repository) AdminNewProperty(w http.ResponseWriter, r *http.Request) {
+	m.renderPropertyForm(w, r, models.Property{}, forms.New(nil))
+}
+
+// AdminPostNewProperty adds a property
+func (m *Repository) AdminPostNewProperty(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	var p models.Property
+	form := propertyForm(r, &p)
+	if !form.Valid() {
+		m.renderPropertyForm(w, r, p, form)
+		return
+	}
+
+	id, err := m.DB.InsertProperty(r.Context(), p)
+	if errors.Is(err, repository.ErrConstraint) {
+		form.Errors.Add("slug", "Another property already uses this slug or host name")
+		m.renderPropertyForm(w, r, p, form)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	m.forgetProperties()
+
+	m.App.Session.Put(r.Context(), "flash", "Property added, move rooms to it below")
+	http.Redirect(w, r, fmt.Sprintf("/admin/properties/%d", id), http.StatusSeeOther)
+}
+
+// AdminShowProperty shows the form to edit a property with its rooms
+func (m *Repository) AdminShowProperty(w http.ResponseWriter, r *http.Request) {
+	p, err := m.managedProperty(r)
+	if errors.Is(err, repository.ErrNotFound) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.renderPropertyForm(w, r, p, forms.New(nil))
+}
+
+// AdminPostShowProperty updates the settings of a property
+func (m *Repository) AdminPostShowProperty(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	p, err := m.managedProperty(r)
+	if errors.Is(err, repository.ErrNotFound) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := propertyForm(r, &p)
+	if !form.Valid() {
+		m.renderPropertyForm(w, r, p, form)
+		return
+	}
+
+	err = m.DB.UpdateProperty(r.Context(), p)
+	if errors.Is(err, repository.ErrNotFound) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	} else if errors.Is(err, repository.ErrConstraint) {
+		form.Errors.Add("slug", "Another property already uses this slug or host name")
+		m.renderPropertyForm(w, r, p, form)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	m.forgetProperties()
+
+	m.App.Session.Put(r.Context(), "flash", "Changes saved")
+	http.Redirect(w, r, fmt.Sprintf("/admin/properties/%d", p.ID), http.StatusSeeOther)
+}
+
+// AdminMoveRoom moves the posted room to a property
+func (m *Repository) AdminMoveRoom(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	roomID, _ := strconv.Atoi(r.Form.Get("room_id"))
+
+	err = m.DB.MoveRoom(r.Context(), roomID, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		m.App.Session.Put(r.Context(), "error", "Room not found")
+	} else if errors.Is(err, repository.ErrConstraint) {
+		m.App.Session.Put(r.Context(), "error", "Property not found")
+		http.Redirect(w, r, "/admin/properties", http.StatusSeeOther)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	} else {
+		m.App.Session.Put(r.Context(), "flash", "Room moved")
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/admin/properties/%d", id), http.StatusSeeOther)
+}
+
+// AdminDeleteProperty deletes a property that has no rooms anymore
+func (m *Repository) AdminDeleteProperty(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+
+	err := m.DB.DeleteProperty(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		m.App.Session.Put(r.Context(), "error", "Property not found")
+	} else if errors.Is(err, repository.ErrConstraint) {
+		m.App.Session.Put(r.Context(), "error", "Move the rooms of the property to another one first")
+		http.Redirect(w, r, fmt.Sprintf("/admin/properties/%d", id), http.StatusSeeOther)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	} else {
+		m.forgetProperties()
+		m.App.Session.Put(r.Context(), "flash", "Property deleted")
+	}
+
+	http.Redirect(w, r, "/admin/properties", http.StatusSeeOther)
+}
@@ -0,0 +1,315 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/adewidyatamadb/GoBookings/internal/models"
+)
+
+// scopedRequest returns a request of the test user 7, who is an admin of property 2 only
+func scopedRequest(method, target, id string, postedData url.Values) *http.Request {
+	r := userRequest(method, target, id, postedData)
+	session.Put(r.Context(), "user_id", 7)
+	return r
+}
+
+func TestRepository_AdminProperties(t *testing.T) {
+	var tableTest = []struct {
+		name            string
+		scoped          bool
+		expectedHTML    []string
+		notExpectedHTML []string
+	}{
+		{"every property", false, []string{"Fort Smythe Bed and Breakfast", "Harbour House", "/p/fort-smythe/", "harbour.example.com"}, nil},
+		{"scoped admin", true, []string{"Harbour House"}, []string{"Fort Smythe Bed and Breakfast"}},
+	}
+
+	for _, test := range tableTest {
+		w := httptest.NewRecorder()
+		r := userRequest("GET", "/admin/properties", "", nil)
+		if test.scoped {
+			r = scopedRequest("GET", "/admin/properties", "", nil)
+		}
+
+		handler := http.HandlerFunc(Repo.AdminProperties)
+		handler.ServeHTTP(w, r)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("case - %s: expected code %d but got %d", test.name, http.StatusOK, w.Code)
+		}
+		for _, expected := range test.expectedHTML {
+			if !strings.Contains(w.Body.String(), expected) {
+				t.Errorf("case - %s: expected to find %s but did not", test.name, expected)
+			}
+		}
+		for _, unexpected := range test.notExpectedHTML {
+			if strings.Contains(w.Body.String(), unexpected) {
+				t.Errorf("case - %s: did not expect to find %s", test.name, unexpected)
+			}
+		}
+	}
+}
+
+func TestRepository_AdminShowProperty(t *testing.T) {
+	var tableTest = []struct {
+		name               string
+		id                 string
+		scoped             bool
+		expectedStatusCode int
+		expectedHTML       []string
+	}{
+		{"property with rooms", "1", false, http.StatusOK, []string{"fort-smythe", "Move room"}},
+		{"property without rooms", "2", false, http.StatusOK, []string{"Europe/Lisbon", "This property has no rooms yet"}},
+		{"managed by the scoped admin", "2", true, http.StatusOK, []string{"Harbour House"}},
+		{"not managed by the scoped admin", "1", true, http.StatusNotFound, nil},
+		{"non-existent property", "100", false, http.StatusNotFound, nil},
+		{"invalid id", "x", false, http.StatusNotFound, nil},
+	}
+
+	for _, test := range tableTest {
+		w := httptest.NewRecorder()
+		r := userRequest("GET", "/admin/properties/"+test.id, test.id, nil)
+		if test.scoped {
+			r = scopedRequest("GET", "/admin/properties/"+test.id, test.id, nil)
+		}
+
+		handler := http.HandlerFunc(Repo.AdminShowProperty)
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.expectedStatusCode {
+			t.Errorf("case - %s: expected code %d but got %d", test.name, test.expectedStatusCode, w.Code)
+		}
+		for _, expected := range test.expectedHTML {
+			if !strings.Contains(w.Body.String(), expected) {
+				t.Errorf("case - %s: expected to find %s but did not", test.name, expected)
+			}
+		}
+	}
+}
+
+func TestRepository_AdminPostNewProperty(t *testing.T) {
+	var tableTest = []struct {
+		name               string
+		slug               string
+		host               string
+		timeZone           string
+		currency           string
+		mailFrom           string
+		expectedStatusCode int
+		expectedLocation   string
+		expectedHTML       string
+	}{
+		{"valid property", "sea-view", "", "Europe/Lisbon", "EUR", "stay@seaview.example.com", http.StatusSeeOther, "/admin/properties/3", ""},
+		{"minimal property", "sea-view", "", "", "", "", http.StatusSeeOther, "/admin/properties/3", ""},
+		{"missing slug", "", "", "", "", "", http.StatusOK, "", "This field cannot be blank"},
+		{"invalid slug", "sea view", "", "", "", "", http.StatusOK, "", "Use lowercase letters, digits and dashes only"},
+		{"host with a port", "sea-view", "seaview.example.com:8080", "", "", "", http.StatusOK, "", "Enter a host name only"},
+		{"unknown time zone", "sea-view", "", "Europe/Atlantis", "", "", http.StatusOK, "", "Unknown time zone"},
+		{"invalid currency", "sea-view", "", "", "EURO", "", http.StatusOK, "", "Use a three letter currency code"},
+		{"invalid sender", "sea-view", "", "", "", "seaview", http.StatusOK, "", "Invalid email address"},
+		{"slug taken", "fort-smythe", "", "", "", "", http.StatusOK, "", "Another property already uses this slug or host name"},
+		{"host taken", "sea-view", "harbour.example.com", "", "", "", http.StatusOK, "", "Another property already uses this slug or host name"},
+	}
+
+	defer resetTestDB()
+
+	for _, test := range tableTest {
+		resetTestDB()
+		postedData := url.Values{}
+		postedData.Add("name", "Sea View")
+		postedData.Add("slug", test.slug)
+		postedData.Add("host", test.host)
+		postedData.Add("time_zone", test.timeZone)
+		postedData.Add("currency", test.currency)
+		postedData.Add("mail_from", test.mailFrom)
+		postedData.Add("owner_email", "")
+
+		w := httptest.NewRecorder()
+		r := userRequest("POST", "/admin/properties/new", "", postedData)
+
+		handler := http.HandlerFunc(Repo.AdminPostNewProperty)
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.expectedStatusCode {
+			t.Errorf("case - %s: expected code %d but got %d", test.name, test.expectedStatusCode, w.Code)
+		}
+		if test.expectedLocation != "" {
+			location, _ := w.Result().Location()
+			if location.String() != test.expectedLocation {
+				t.Errorf("case - %s: expected location %s but got %s", test.name, test.expectedLocation, location.String())
+			}
+		}
+		if test.expectedHTML != "" && !strings.Contains(w.Body.String(), test.expectedHTML) {
+			t.Errorf("case - %s: expected to find %s but did not", test.name, test.expectedHTML)
+		}
+	}
+}
+
+func TestRepository_AdminPostShowProperty(t *testing.T) {
+	var tableTest = []struct {
+		name               string
+		id                 string
+		slug               string
+		scoped             bool
+		expectedStatusCode int
+		expectedHTML       string
+	}{
+		{"valid changes", "2", "harbour-house", false, http.StatusSeeOther, ""},
+		{"scoped admin of the property", "2", "harbour-house", true, http.StatusSeeOther, ""},
+		{"scoped admin of another property", "1", "fort-smythe", true, http.StatusNotFound, ""},
+		{"slug of another property", "2", "fort-smythe", false, http.StatusOK, "Another property already uses this slug or host name"},
+		{"non-existent property", "100", "sea-view", false, http.StatusNotFound, ""},
+	}
+
+	defer resetTestDB()
+
+	for _, test := range tableTest {
+		postedData := url.Values{}
+		postedData.Add("name", "Harbour House")
+		postedData.Add("slug", test.slug)
+		postedData.Add("currency", "EUR")
+
+		w := httptest.NewRecorder()
+		r := userRequest("POST", "/admin/properties/"+test.id, test.id, postedData)
+		if test.scoped {
+			r = scopedRequest("POST", "/admin/properties/"+test.id, test.id, postedData)
+		}
+
+		handler := http.HandlerFunc(Repo.AdminPostShowProperty)
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.expectedStatusCode {
+			t.Errorf("case - %s: expected code %d but got %d", test.name, test.expectedStatusCode, w.Code)
+		}
+		if test.expectedHTML != "" && !strings.Contains(w.Body.String(), test.expectedHTML) {
+			t.Errorf("case - %s: expected to find %s but did not", test.name, test.expectedHTML)
+		}
+	}
+}
+
+func TestRepository_AdminMoveRoom(t *testing.T) {
+	var tableTest = []struct {
+		name             string
+		id               string
+		roomID           string
+		expectedFlash    string
+		expectedLocation string
+	}{
+		{"existing room", "2", "1", "flash", "/admin/properties/2"},
+		{"non-existent room", "2", "100", "error", "/admin/properties/2"},
+		{"non-existent property", "100", "1", "error", "/admin/properties"},
+	}
+
+	defer resetTestDB()
+
+	for _, test := range tableTest {
+		postedData := url.Values{}
+		postedData.Add("room_id", test.roomID)
+
+		w := httptest.NewRecorder()
+		r := userRequest("POST", "/admin/properties/"+test.id+"/rooms", test.id, postedData)
+
+		handler := http.HandlerFunc(Repo.AdminMoveRoom)
+		handler.ServeHTTP(w, r)
+
+		if w.Code != http.StatusSeeOther {
+			t.Errorf("case - %s: expected code %d but got %d", test.name, http.StatusSeeOther, w.Code)
+		}
+		location, _ := w.Result().Location()
+		if location.String() != test.expectedLocation {
+			t.Errorf("case - %s: expected location %s but got %s", test.name, test.expectedLocation, location.String())
+		}
+		if !session.Exists(r.Context(), test.expectedFlash) {
+			t.Errorf("case - %s: expected a %s message", test.name, test.expectedFlash)
+		}
+	}
+}
+
+func TestRepository_AdminDeleteProperty(t *testing.T) {
+	var tableTest = []struct {
+		name             string
+		id               string
+		expectedFlash    string
+		expectedLocation string
+	}{
+		{"property without rooms", "2", "flash", "/admin/properties"},
+		{"property with rooms", "1", "error", "/admin/properties/1"},
+		{"non-existent property", "100", "error", "/admin/properties"},
+	}
+
+	defer resetTestDB()
+
+	for _, test := range tableTest {
+		w := httptest.NewRecorder()
+		r := userRequest("POST", "/admin/properties/"+test.id+"/delete/do", test.id, nil)
+
+		handler := http.HandlerFunc(Repo.AdminDeleteProperty)
+		handler.ServeHTTP(w, r)
+
+		if w.Code != http.StatusSeeOther {
+			t.Errorf("case - %s: expected code %d but got %d", test.name, http.StatusSeeOther, w.Code)
+		}
+		location, _ := w.Result().Location()
+		if location.String() != test.expectedLocation {
+			t.Errorf("case - %s: expected location %s but got %s", test.name, test.expectedLocation, location.String())
+		}
+		if !session.Exists(r.Context(), test.expectedFlash) {
+			t.Errorf("case - %s: expected a %s message", test.name, test.expectedFlash)
+		}
+	}
+}
+
+func TestRepository_Properties(t *testing.T) {
+	defer resetTestDB()
+
+	ctx := context.Background()
+	repo := NewDemoRepo(&app)
+
+	properties, err := repo.Properties(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := repo.DB.InsertProperty(ctx, models.Property{Name: "Hill Cabin", Slug: "hill-cabin"}); err != nil {
+		t.Fatal(err)
+	}
+	if cached, _ := repo.Properties(ctx); len(cached) != len(properties) {
+		t.Errorf("expected the cached %d properties but got %d", len(properties), len(cached))
+	}
+
+	repo.forgetProperties()
+	if loaded, _ := repo.Properties(ctx); len(loaded) != len(properties)+1 {
+		t.Errorf("expected %d properties after a change but got %d", len(properties)+1, len(loaded))
+	}
+}
+
+func TestRepository_AdminShowReservation_Scoped(t *testing.T) {
+	var tableTest = []struct {
+		name               string
+		scoped             bool
+		expectedStatusCode int
+	}{
+		{"admin of every property", false, http.StatusOK},
+		{"admin of another property", true, http.StatusNotFound},
+	}
+
+	for _, test := range tableTest {
+		w := httptest.NewRecorder()
+		r := userRequest("GET", "/admin/reservations/all/1/show", "1", nil)
+		if test.scoped {
+			r = scopedRequest("GET", "/admin/reservations/all/1/show", "1", nil)
+		}
+
+		handler := http.HandlerFunc(Repo.AdminShowReservation)
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.expectedStatusCode {
+			t.Errorf("case - %s: expected code %d but got %d", test.name, test.expectedStatusCode, w.Code)
+		}
+	}
+}
@@ -12,12 +12,18 @@ import (
 	"time"
 
 	"github.com/adewidyatamadb/GoBookings/internal/config"
+	"github.com/adewidyatamadb/GoBookings/internal/events"
+	"github.com/adewidyatamadb/GoBookings/internal/helpers"
 	"github.com/adewidyatamadb/GoBookings/internal/models"
 	"github.com/adewidyatamadb/GoBookings/internal/render"
+	"github.com/adewidyatamadb/GoBookings/internal/repository/dbrepo"
+	"github.com/adewidyatamadb/GoBookings/internal/throttle"
+	"github.com/adewidyatamadb/GoBookings/internal/webhooks"
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/justinas/nosurf"
+	"golang.org/x/crypto/bcrypt"
 )
 
 var app config.AppConfig
@@ -30,6 +36,7 @@ var functions = template.FuncMap{
 	"formatDate": render.FormatDate,
 	"iterate":    render.Iterate,
 	"add":        render.Add,
+	"percent":    render.Percent,
 }
 
 func TestMain(m *testing.M) {
@@ -41,6 +48,7 @@ func TestMain(m *testing.M) {
 	gob.Register(map[string]int{})
 	// change this to true when in production
 	app.InProduction = false
+	pathToEmailTemplates = "./../../email-templates"
 
 	infoLog := log.New(os.Stdout, "INFO:\t", log.Ldate|log.Ltime)
 	app.InfoLog = infoLog
@@ -55,6 +63,10 @@ func TestMain(m *testing.M) {
 	session.Cookie.Secure = app.InProduction
 
 	app.Session = session
+	app.BaseURL = "http://localhost:8080"
+	app.Secret = []byte("test secret")
+	app.LoginAccounts = throttle.New(AccountLoginPolicy)
+	app.LoginIPs = throttle.New(IPLoginPolicy)
 
 	mailChan := make(chan models.MailData)
 	app.MailChan = mailChan
@@ -70,9 +82,18 @@ func TestMain(m *testing.M) {
 	app.TemplateCache = tc
 	app.UseCache = true
 
-	repo := NewTestRepo(&app)
+	dbrepo.PasswordCost = bcrypt.MinCost
+	resetTestDB()
+	repo := newTestRepo(&app)
 	NewHandlers(repo)
+
+	app.Events = events.New(errorLog)
+	app.EventCounter = events.NewCounter(time.Now())
+	app.Events.Subscribe("metrics", app.EventCounter.Handle)
+	app.Events.Subscribe("mail", repo.MailEvent)
+	app.Events.Subscribe("webhooks", webhooks.Subscriber(testDB))
 	render.NewRenderer(&app)
+	helpers.NewHelpers(&app)
 
 	os.Exit(m.Run())
 }
@@ -100,22 +121,55 @@ func getRoutes() http.Handler {
 	mux.Get("/search-availability", Repo.Availability)
 	mux.Post("/search-availability", Repo.PostAvailability)
 	mux.Post("/search-availability-json", Repo.AvailabilityJSON)
+	mux.Get("/choose-room/{id}", Repo.ChooseRoom)
 
 	mux.Get("/contact", Repo.Contact)
 
 	mux.Get("/make-reservation", Repo.Reservation)
 	mux.Post("/make-reservation", Repo.PostReservation)
 	mux.Get("/reservation-summary", Repo.ReservationSummary)
+	mux.Get("/reservation/confirm", Repo.ConfirmReservation)
 
 	mux.Get("/user/login", Repo.ShowLogin)
 	mux.Post("/user/login", Repo.PostShowLogin)
+	mux.Get("/user/login/two-factor", Repo.LoginTwoFactor)
+	mux.Post("/user/login/two-factor", Repo.PostLoginTwoFactor)
 	mux.Get("/user/logout", Repo.Logout)
+	mux.Get("/user/change-password", Repo.ChangePassword)
+	mux.Post("/user/change-password", Repo.PostChangePassword)
+	mux.Get("/user/two-factor", Repo.TwoFactor)
+	mux.Post("/user/two-factor", Repo.PostTwoFactor)
+	mux.Post("/user/two-factor/disable", Repo.PostDisableTwoFactor)
+	mux.Get("/user/forgot-password", Repo.ForgotPassword)
+	mux.Post("/user/forgot-password", Repo.PostForgotPassword)
+	mux.Get("/user/reset-password", Repo.ResetPassword)
+	mux.Post("/user/reset-password", Repo.PostResetPassword)
+
+	mux.Get("/guest/register", Repo.GuestRegister)
+	mux.Post("/guest/register", Repo.PostGuestRegister)
+	mux.Get("/guest/login", Repo.GuestLogin)
+	mux.Post("/guest/login", Repo.PostGuestLogin)
+	mux.Get("/guest/logout", Repo.GuestLogout)
+	mux.Get("/guest/bookings", Repo.GuestBookings)
+	mux.Post("/guest/verify/resend", Repo.PostGuestResendVerification)
+	mux.Get("/guest/verify", Repo.GuestVerify)
+	mux.Get("/guest/forgot-password", Repo.GuestForgotPassword)
+	mux.Post("/guest/forgot-password", Repo.PostGuestForgotPassword)
+	mux.Get("/guest/reset-password", Repo.GuestResetPassword)
+	mux.Post("/guest/reset-password", Repo.PostGuestResetPassword)
+
+	mux.Get("/api/v1/availability", Repo.APIAvailability)
+	mux.Get("/api/v1/rooms/{id}/quote", Repo.APIQuote)
+	mux.Post("/api/v1/reservations", Repo.APICreateReservation)
 
 	fileServer := http.FileServer(http.Dir("./static/"))
 	mux.Handle("/static/*", http.StripPrefix("/static", fileServer))
 
 	mux.Route("/admin", func(mux chi.Router) {
 		mux.Get("/dashboard", Repo.AdminDashboard)
+		mux.Get("/dashboard.json", Repo.AdminDashboardJSON)
+		mux.Get("/day-sheet", Repo.AdminDaySheet)
+		mux.Get("/day-sheet/print", Repo.AdminDaySheetPrint)
 
 		mux.Get("/reservations-new", Repo.AdminNewReservations)
 		mux.Get("/reservations-all", Repo.AdminAllReservations)
@@ -126,6 +180,53 @@ func getRoutes() http.Handler {
 
 		mux.Get("/reservations/{src}/{id}/show", Repo.AdminShowReservation)
 		mux.Post("/reservations/{src}/{id}", Repo.AdminPostShowReservation)
+
+		mux.Get("/guests", Repo.AdminGuests)
+		mux.Get("/guests/{id}", Repo.AdminShowGuest)
+		mux.Post("/guests/{id}", Repo.AdminPostShowGuest)
+		mux.Post("/guests/{id}/merge/{duplicate}/do", Repo.AdminMergeGuest)
+
+		mux.Get("/jobs", Repo.AdminJobs)
+		mux.Get("/metrics.json", Repo.AdminMetricsJSON)
+
+		mux.Get("/api/reservations/{id}", Repo.AdminAPIReservation)
+		mux.Put("/api/reservations/{id}", Repo.AdminAPIModifyReservation)
+		mux.Delete("/api/reservations/{id}", Repo.AdminAPICancelReservation)
+		mux.Post("/api/reservations/{id}/process", Repo.AdminAPIProcessReservation)
+		mux.Post("/api/blocks", Repo.AdminAPISetBlocks)
+
+		mux.Get("/users", Repo.AdminUsers)
+		mux.Get("/users/new", Repo.AdminNewUser)
+		mux.Post("/users/new", Repo.AdminPostNewUser)
+		mux.Get("/users/{id}", Repo.AdminShowUser)
+		mux.Post("/users/{id}", Repo.AdminPostShowUser)
+		mux.Post("/users/{id}/reset-password/do", Repo.AdminResetUserPassword)
+		mux.Post("/users/{id}/unlock/do", Repo.AdminUnlockUser)
+		mux.Post("/users/{id}/two-factor/reset/do", Repo.AdminResetUserTwoFactor)
+		mux.Post("/users/{id}/sessions/revoke/do", Repo.AdminRevokeUserSessions)
+		mux.Post("/users/{id}/sessions/{session}/revoke/do", Repo.AdminRevokeSession)
+		mux.Post("/users/{id}/delete/do", Repo.AdminDeleteUser)
+
+		mux.Get("/booking-rules", Repo.AdminBookingRules)
+		mux.Get("/booking-rules/new", Repo.AdminNewBookingRule)
+		mux.Post("/booking-rules/new", Repo.AdminPostNewBookingRule)
+		mux.Get("/booking-rules/{id}", Repo.AdminShowBookingRule)
+		mux.Post("/booking-rules/{id}", Repo.AdminPostShowBookingRule)
+		mux.Post("/booking-rules/{id}/delete/do", Repo.AdminDeleteBookingRule)
+		mux.Get("/webhooks", Repo.AdminWebhooks)
+		mux.Get("/webhooks/new", Repo.AdminNewWebhook)
+		mux.Post("/webhooks/new", Repo.AdminPostNewWebhook)
+		mux.Get("/webhooks/{id}", Repo.AdminShowWebhook)
+		mux.Post("/webhooks/{id}", Repo.AdminPostShowWebhook)
+		mux.Post("/webhooks/{id}/ping/do", Repo.AdminPingWebhook)
+		mux.Post("/webhooks/{id}/delete/do", Repo.AdminDeleteWebhook)
+		mux.Get("/properties", Repo.AdminProperties)
+		mux.Get("/properties/new", Repo.AdminNewProperty)
+		mux.Post("/properties/new", Repo.AdminPostNewProperty)
+		mux.Get("/properties/{id}", Repo.AdminShowProperty)
+		mux.Post("/properties/{id}", Repo.AdminPostShowProperty)
+		mux.Post("/properties/{id}/rooms", Repo.AdminMoveRoom)
+		mux.Post("/properties/{id}/delete/do", Repo.AdminDeleteProperty)
 	})
 
 	return mux
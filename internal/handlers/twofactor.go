@@ -0,0 +1,341 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/adewidyatamadb/GoBookings/internal/config"
+	"github.com/adewidyatamadb/GoBookings/internal/forms"
+	"github.com/adewidyatamadb/GoBookings/internal/helpers"
+	"github.com/adewidyatamadb/GoBookings/internal/models"
+	"github.com/adewidyatamadb/GoBookings/internal/render"
+	"github.com/adewidyatamadb/GoBookings/internal/repository"
+	"github.com/adewidyatamadb/GoBookings/internal/totp"
+)
+
+const (
+	// twoFactorTTL is how long the second login step can take after the password was accepted
+	twoFactorTTL = 5 * time.Minute
+	// recoveryCodeCount is the number of recovery codes given when two-factor authentication is enabled
+	recoveryCodeCount = 10
+)
+
+// TwoFactorRequired reports whether u has to use two-factor authentication because of the user's access level
+func TwoFactorRequired(a *config.AppConfig, u models.User) bool {
+	return a.TwoFactorLevel > 0 && u.AccessLevel >= a.TwoFactorLevel
+}
+
+// recoveryCodes returns new single use codes to log in without the authenticator app
+func recoveryCodes() ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		code := base32.StdEncoding.EncodeToString(b)[:10]
+		codes[i] = code[:5] + "-" + code[5:]
+	}
+	return codes, nil
+}
+
+// completeLogin logs u in once every login step has succeeded
+func (m *Repository) completeLogin(w http.ResponseWriter, r *http.Request, u models.User) {
+	m.loginSucceeded(r, u)
+
+	m.App.Session.Put(r.Context(), "user_id", u.ID)
+	m.App.Session.Put(r.Context(), "access_level", u.AccessLevel)
+	m.App.Session.Put(r.Context(), "session_version", u.SessionVersion)
+	// kept with the session so admins can tell the sessions of a user apart
+	m.App.Session.Put(r.Context(), "ip", helpers.ClientIP(r))
+	m.App.Session.Put(r.Context(), "user_agent", r.UserAgent())
+
+	if u.MustChangePassword {
+		m.App.Session.Put(r.Context(), "warning", "Please choose a new password")
+		http.Redirect(w, r, "/user/change-password", http.StatusSeeOther)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Logged in successfully")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// pendingUser returns the user whose password was accepted and who still has to enter a code
+func (m *Repository) pendingUser(r *http.Request) (models.User, bool) {
+	id := m.App.Session.GetInt(r.Context(), "pending_user_id")
+	since := time.Unix(int64(m.App.Session.GetInt(r.Context(), "pending_since")), 0)
+	if id == 0 || time.Since(since) > twoFactorTTL {
+		return models.User{}, false
+	}
+
+	u, err := m.DB.GetUserByID(r.Context(), id)
+	if err != nil {
+		if !errors.Is(err, repository.ErrNotFound) {
+			log.Println(err)
+		}
+		return u, false
+	}
+
+	return u, u.Active
+}
+
+// useTOTPCode reports whether code is a current authentication code of u that has not been used yet, and
+// records it as used
+func (m *Repository) useTOTPCode(r *http.Request, u models.User, code string) (bool, error) {
+	counter, ok := totp.Match(u.TOTPSecret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	err := m.DB.UseTOTPCounter(r.Context(), u.ID, counter)
+	if errors.Is(err, repository.ErrInvalidCredentials) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// abortTwoFactorLogin sends the user back to the first login step
+func (m *Repository) abortTwoFactorLogin(w http.ResponseWriter, r *http.Request, msg string) {
+	m.App.Session.Remove(r.Context(), "pending_user_id")
+	m.App.Session.Remove(r.Context(), "pending_since")
+
+	m.App.Session.Put(r.Context(), "error", msg)
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+// LoginTwoFactor shows the second login step of users with two-factor authentication
+func (m *Repository) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if _, ok := m.pendingUser(r); !ok {
+		m.abortTwoFactorLogin(w, r, "Please log in again")
+		return
+	}
+
+	render.Template(w, r, "login-two-factor.page.html", &models.TemplateData{
+		Form: forms.New(nil),
+	})
+}
+
+// PostLoginTwoFactor checks the authentication or recovery code of the second login step
+func (m *Repository) PostLoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	u, ok := m.pendingUser(r)
+	if !ok {
+		m.abortTwoFactorLogin(w, r, "Please log in again")
+		return
+	}
+	if u.Locked() || m.loginThrottled(r, u.Email) {
+		m.abortTwoFactorLogin(w, r, tooManyLogins)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("code")
+
+	code := r.Form.Get("code")
+	valid := false
+	if form.Valid() {
+		valid, err = m.useTOTPCode(r, u, code)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+	if form.Valid() && !valid {
+		err = m.DB.UseRecoveryCode(r.Context(), u.ID, code)
+		if errors.Is(err, repository.ErrInvalidCredentials) {
+			m.loginFailed(r, u.Email)
+			form.Errors.Add("code", "Invalid authentication code")
+		} else if err != nil {
+			helpers.ServerError(w, err)
+			return
+		} else {
+			m.App.Session.Put(r.Context(), "warning", "You logged in with a recovery code, it cannot be used again")
+		}
+	}
+
+	if !form.Valid() {
+		render.Template(w, r, "login-two-factor.page.html", &models.TemplateData{
+			Form: form,
+		})
+		return
+	}
+
+	m.App.Session.Remove(r.Context(), "pending_user_id")
+	m.App.Session.Remove(r.Context(), "pending_since")
+	_ = m.App.Session.RenewToken(r.Context())
+
+	m.completeLogin(w, r, u)
+}
+
+// renderTwoFactor renders the two-factor settings of u, users that have not enabled it yet
+// get a secret kept in the session until they confirm it with a code
+func (m *Repository) renderTwoFactor(w http.ResponseWriter, r *http.Request, u models.User, form *forms.Form) {
+	stringMap := make(map[string]string)
+	intMap := make(map[string]int)
+
+	if u.TOTPEnabled {
+		intMap["enabled"] = 1
+	} else {
+		secret := m.App.Session.GetString(r.Context(), "totp_setup_secret")
+		if secret == "" {
+			var err error
+			secret, err = totp.GenerateSecret()
+			if err != nil {
+				helpers.ServerError(w, err)
+				return
+			}
+			m.App.Session.Put(r.Context(), "totp_setup_secret", secret)
+		}
+
+		// authenticator apps show the account under the property whose site it was set up on, like its emails
+		p, err := m.requestProperty(r)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		stringMap["secret"] = secret
+		stringMap["uri"] = totp.ProvisioningURI(secret, p.Name, u.Email)
+	}
+	if TwoFactorRequired(m.App, u) {
+		intMap["required"] = 1
+	}
+
+	render.Template(w, r, "two-factor.page.html", &models.TemplateData{
+		Form:      form,
+		StringMap: stringMap,
+		IntMap:    intMap,
+	})
+}
+
+// TwoFactor shows the two-factor authentication settings of the logged in user
+func (m *Repository) TwoFactor(w http.ResponseWriter, r *http.Request) {
+	u, err := m.DB.GetUserByID(r.Context(), m.App.Session.GetInt(r.Context(), "user_id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.renderTwoFactor(w, r, u, forms.New(nil))
+}
+
+// PostTwoFactor enables two-factor authentication once the user confirms the new secret with a code
+func (m *Repository) PostTwoFactor(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	u, err := m.DB.GetUserByID(r.Context(), m.App.Session.GetInt(r.Context(), "user_id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	if u.TOTPEnabled {
+		http.Redirect(w, r, "/user/two-factor", http.StatusSeeOther)
+		return
+	}
+
+	secret := m.App.Session.GetString(r.Context(), "totp_setup_secret")
+
+	form := forms.New(r.PostForm)
+	form.Required("code")
+	if form.Valid() && (secret == "" || !totp.Validate(secret, r.Form.Get("code"), time.Now())) {
+		form.Errors.Add("code", "Invalid authentication code, check the time of your device and try again")
+	}
+
+	if !form.Valid() {
+		m.renderTwoFactor(w, r, u, form)
+		return
+	}
+
+	codes, err := recoveryCodes()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.DB.EnableTOTP(r.Context(), u.ID, secret, codes)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	// the code that confirmed the secret cannot log in as well
+	counter, _ := totp.Match(secret, r.Form.Get("code"), time.Now())
+	err = m.DB.UseTOTPCounter(r.Context(), u.ID, counter)
+	if err != nil && !errors.Is(err, repository.ErrInvalidCredentials) {
+		helpers.ServerError(w, err)
+		return
+	}
+	m.App.Session.Remove(r.Context(), "totp_setup_secret")
+
+	data := make(map[string]interface{})
+	data["recovery_codes"] = codes
+
+	m.App.Session.Put(r.Context(), "flash", "Two-factor authentication enabled")
+	render.Template(w, r, "two-factor-recovery.page.html", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// PostDisableTwoFactor turns off two-factor authentication after checking a current code
+func (m *Repository) PostDisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	u, err := m.DB.GetUserByID(r.Context(), m.App.Session.GetInt(r.Context(), "user_id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if TwoFactorRequired(m.App, u) {
+		m.App.Session.Put(r.Context(), "error", "Two-factor authentication is required for your access level")
+		http.Redirect(w, r, "/user/two-factor", http.StatusSeeOther)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("code")
+	if form.Valid() {
+		valid, err := m.useTOTPCode(r, u, r.Form.Get("code"))
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		if !valid {
+			form.Errors.Add("code", "Invalid authentication code")
+		}
+	}
+
+	if !form.Valid() {
+		m.renderTwoFactor(w, r, u, form)
+		return
+	}
+
+	err = m.DB.DisableTOTP(r.Context(), u.ID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Two-factor authentication disabled")
+	http.Redirect(w, r, "/user/two-factor", http.StatusSeeOther)
+}
@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adewidyatamadb/GoBookings/internal/helpers"
+	"github.com/adewidyatamadb/GoBookings/internal/models"
+	"github.com/adewidyatamadb/GoBookings/internal/totp"
+)
+
+// currentCode returns the current code of the two-factor user of the test repository
+func currentCode(t *testing.T) string {
+	t.Helper()
+
+	code, err := totp.Code(fixtureTOTPSecret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+// usedCode returns the code of the previous period, which the test repository treats as used
+func usedCode(t *testing.T) string {
+	t.Helper()
+
+	code, err := totp.Code(fixtureTOTPSecret, time.Now().Add(-totp.Period))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestRepository_PostLoginTwoFactor(t *testing.T) {
+	var tableTest = []struct {
+		name               string
+		pendingUserID      int
+		pendingSince       time.Time
+		code               string
+		expectedStatusCode int
+		expectedLocation   string
+		expectedHTML       string
+	}{
+		{"valid code", 6, time.Now(), currentCode(t), http.StatusSeeOther, "/", ""},
+		{"recovery code", 6, time.Now(), fixtureRecoveryCode, http.StatusSeeOther, "/", ""},
+		{"invalid code", 6, time.Now(), "000000", http.StatusOK, "", "Invalid authentication code"},
+		{"used code", 6, time.Now(), usedCode(t), http.StatusOK, "", "Invalid authentication code"},
+		{"missing code", 6, time.Now(), "", http.StatusOK, "", "This field cannot be blank"},
+		{"no pending login", 0, time.Now(), currentCode(t), http.StatusSeeOther, "/user/login", ""},
+		{"expired pending login", 6, time.Now().Add(-time.Hour), currentCode(t), http.StatusSeeOther, "/user/login", ""},
+	}
+
+	defer resetTestDB()
+
+	for _, test := range tableTest {
+		postedData := url.Values{}
+		postedData.Add("code", test.code)
+
+		req := httptest.NewRequest("POST", "/user/login/two-factor", strings.NewReader(postedData.Encode()))
+		req = req.WithContext(getCTX(req))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		session.Put(req.Context(), "pending_user_id", test.pendingUserID)
+		session.Put(req.Context(), "pending_since", int(test.pendingSince.Unix()))
+
+		w := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.PostLoginTwoFactor)
+		handler.ServeHTTP(w, req)
+
+		if w.Code != test.expectedStatusCode {
+			t.Errorf("case - %s: expected code %d but got %d", test.name, test.expectedStatusCode, w.Code)
+		}
+
+		if test.expectedLocation != "" {
+			actualLoc, _ := w.Result().Location()
+			if actualLoc.String() != test.expectedLocation {
+				t.Errorf("case - %s: expected location %s, but got location %s", test.name, test.expectedLocation, actualLoc.String())
+			}
+		}
+
+		if test.expectedHTML != "" && !strings.Contains(w.Body.String(), test.expectedHTML) {
+			t.Errorf("case - %s: expected to find %s but did not", test.name, test.expectedHTML)
+		}
+
+		loggedIn := session.GetInt(req.Context(), "user_id") == 6
+		if loggedIn != (test.expectedLocation == "/") {
+			t.Errorf("case - %s: expected logged in to be %t", test.name, !loggedIn)
+		}
+	}
+}
+
+func TestRepository_LoginTwoFactor(t *testing.T) {
+	req := httptest.NewRequest("GET", "/user/login/two-factor", nil)
+	req = req.WithContext(getCTX(req))
+
+	w := httptest.NewRecorder()
+	Repo.LoginTwoFactor(w, req)
+
+	if w.Code != http.StatusSeeOther {
+		t.Errorf("expected the second login step without a pending login to redirect but got %d", w.Code)
+	}
+
+	session.Put(req.Context(), "pending_user_id", 6)
+	session.Put(req.Context(), "pending_since", int(time.Now().Unix()))
+
+	w = httptest.NewRecorder()
+	Repo.LoginTwoFactor(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected the second login step of a pending login to show but got %d", w.Code)
+	}
+}
+
+func TestRepository_PostTwoFactor(t *testing.T) {
+	var tableTest = []struct {
+		name               string
+		userID             int
+		code               string
+		expectedStatusCode int
+		expectedHTML       string
+	}{
+		{"enable", 2, currentCode(t), http.StatusOK, "Recovery Codes"},
+		{"invalid code", 2, "000000", http.StatusOK, "Invalid authentication code"},
+		{"already enabled", 6, currentCode(t), http.StatusSeeOther, ""},
+	}
+
+	defer resetTestDB()
+
+	for _, test := range tableTest {
+		resetTestDB()
+		postedData := url.Values{}
+		postedData.Add("code", test.code)
+
+		w := httptest.NewRecorder()
+		r := userRequest("POST", "/user/two-factor", "", postedData)
+		session.Put(r.Context(), "user_id", test.userID)
+		session.Put(r.Context(), "totp_setup_secret", fixtureTOTPSecret)
+
+		handler := http.HandlerFunc(Repo.PostTwoFactor)
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.expectedStatusCode {
+			t.Errorf("case - %s: expected code %d but got %d", test.name, test.expectedStatusCode, w.Code)
+		}
+
+		if test.expectedHTML != "" && !strings.Contains(w.Body.String(), test.expectedHTML) {
+			t.Errorf("case - %s: expected to find %s but did not", test.name, test.expectedHTML)
+		}
+	}
+}
+
+func TestRepository_PostDisableTwoFactor(t *testing.T) {
+	var tableTest = []struct {
+		name               string
+		code               string
+		twoFactorLevel     int
+		expectedStatusCode int
+		expectedFlash      string
+		expectedError      string
+	}{
+		{"disable", currentCode(t), 0, http.StatusSeeOther, "Two-factor authentication disabled", ""},
+		{"invalid code", "000000", 0, http.StatusOK, "", ""},
+		{"required for the access level", currentCode(t), 1, http.StatusSeeOther, "", "Two-factor authentication is required for your access level"},
+	}
+
+	defer func() { app.TwoFactorLevel = 0 }()
+
+	defer resetTestDB()
+
+	for _, test := range tableTest {
+		app.TwoFactorLevel = test.twoFactorLevel
+
+		postedData := url.Values{}
+		postedData.Add("code", test.code)
+
+		w := httptest.NewRecorder()
+		r := userRequest("POST", "/user/two-factor/disable", "", postedData)
+		session.Put(r.Context(), "user_id", 6)
+
+		handler := http.HandlerFunc(Repo.PostDisableTwoFactor)
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.expectedStatusCode {
+			t.Errorf("case - %s: expected code %d but got %d", test.name, test.expectedStatusCode, w.Code)
+		}
+
+		if flash := session.GetString(r.Context(), "flash"); flash != test.expectedFlash {
+			t.Errorf("case - %s: expected flash %q but got %q", test.name, test.expectedFlash, flash)
+		}
+		if msg := session.GetString(r.Context(), "error"); msg != test.expectedError {
+			t.Errorf("case - %s: expected error %q but got %q", test.name, test.expectedError, msg)
+		}
+	}
+}
+
+func TestRepository_TwoFactor_Issuer(t *testing.T) {
+	var tableTest = []struct {
+		name     string
+		property models.Property
+		expected string
+	}{
+		{"first property", models.Property{}, "Fort%20Smythe%20Bed%20and%20Breakfast"},
+		{"property of the site", models.Property{ID: 2, Name: "Harbour House"}, "Harbour%20House"},
+	}
+
+	for _, test := range tableTest {
+		r := userRequest("GET", "/user/two-factor", "", nil)
+		if test.property.ID > 0 {
+			r = helpers.WithProperty(r, test.property)
+		}
+
+		w := httptest.NewRecorder()
+		Repo.TwoFactor(w, r)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("case - %s: expected code %d but got %d", test.name, http.StatusOK, w.Code)
+		}
+		if !strings.Contains(w.Body.String(), test.expected) {
+			t.Errorf("case - %s: expected the authenticator app to show the account under %s", test.name, test.expected)
+		}
+	}
+}
@@ -0,0 +1,503 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/adewidyatamadb/GoBookings/internal/forms"
+	"github.com/adewidyatamadb/GoBookings/internal/helpers"
+	"github.com/adewidyatamadb/GoBookings/internal/models"
+	"github.com/adewidyatamadb/GoBookings/internal/render"
+	"github.com/adewidyatamadb/GoBookings/internal/repository"
+	"github.com/go-chi/chi/v5"
+)
+
+// randomPassword returns a temporary password for invited users and forced resets
+func randomPassword() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.EncodeToString(b), nil
+}
+
+// userForm validates the posted staff user form and copies it into u
+func userForm(r *http.Request, u *models.User) *forms.Form {
+	form := forms.New(r.PostForm)
+	form.Required("first_name", "last_name", "email", "access_level")
+	form.IsEmail("email")
+
+	u.FirstName = r.Form.Get("first_name")
+	u.LastName = r.Form.Get("last_name")
+	u.Email = r.Form.Get("email")
+
+	level, err := strconv.Atoi(r.Form.Get("access_level"))
+	if err != nil || level < models.AccessLevelStaff || level > models.AccessLevelAdmin {
+		form.Errors.Add("access_level", "Invalid access level")
+	}
+	u.AccessLevel = level
+
+	u.PropertyIDs = nil
+	for _, v := range r.Form["property_ids"] {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			form.Errors.Add("property_ids", "Invalid property")
+			continue
+		}
+		u.PropertyIDs = append(u.PropertyIDs, id)
+	}
+
+	return form
+}
+
+// checkUserProperties adds a form error when the user is given a property that does not exist
+func (m *Repository) checkUserProperties(ctx context.Context, u models.User, form *forms.Form) error {
+	properties, err := m.DB.AllProperties(ctx)
+	if err != nil {
+		return err
+	}
+
+	known := make(map[int]bool)
+	for _, p := range properties {
+		known[p.ID] = true
+	}
+	for _, id := range u.PropertyIDs {
+		if !known[id] {
+			form.Errors.Add("property_ids", "Invalid property")
+			break
+		}
+	}
+
+	return nil
+}
+
+// renderUserForm renders the page to create or edit a staff user, with the active sessions of existing users
+func (m *Repository) renderUserForm(w http.ResponseWriter, r *http.Request, u models.User, form *forms.Form) {
+	data := make(map[string]interface{})
+	data["user"] = u
+
+	intMap := make(map[string]int)
+	if m.App.PersistentSessions {
+		intMap["persistent_sessions"] = 1
+	}
+
+	if u.ID > 0 {
+		sessions, err := m.DB.UserSessions(r.Context(), u.ID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		data["sessions"] = sessions
+	}
+
+	properties, err := m.DB.AllProperties(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	data["properties"] = properties
+
+	render.Template(w, r, "admin-user.page.html", &models.TemplateData{
+		Data:   data,
+		Form:   form,
+		IntMap: intMap,
+	})
+}
+
+// AdminUsers lists the staff users
+func (m *Repository) AdminUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := m.DB.AllUsers(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["users"] = users
+
+	render.Template(w, r, "admin-users.page.html", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminNewUser shows the form to invite or create a staff user
+func (m *Repository) AdminNewUser(w http.ResponseWriter, r *http.Request) {
+	u := models.User{
+		AccessLevel: models.AccessLevelStaff,
+		Active:      true,
+	}
+
+	m.renderUserForm(w, r, u, forms.New(nil))
+}
+
+// AdminPostNewUser creates a staff user, without a password the user is invited with a temporary one
+func (m *Repository) AdminPostNewUser(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	u := models.User{Active: true}
+	form := userForm(r, &u)
+
+	password := r.Form.Get("password")
+	if password != "" {
+		form.IsPassword("password", u.Email)
+	}
+
+	err = m.checkUserProperties(r.Context(), u, form)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if !form.Valid() {
+		m.renderUserForm(w, r, u, form)
+		return
+	}
+
+	invite := password == ""
+	if invite {
+		password, err = randomPassword()
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		u.MustChangePassword = true
+	} else {
+		u.MustChangePassword = form.Has("must_change_password")
+	}
+
+	id, err := m.DB.InsertUser(r.Context(), u, password)
+	if errors.Is(err, repository.ErrConstraint) {
+		form.Errors.Add("email", "A user with this email already exists")
+		m.renderUserForm(w, r, u, form)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.DB.SetUserProperties(r.Context(), id, u.PropertyIDs)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	htmlMessage := fmt.Sprintf(`
+		<strong>Your staff account</strong>
+		<br>
+		Dear %s: <br>
+		A staff account has been created for you, you can log in with your email address %s.
+	`, u.FirstName, u.Email)
+	if invite {
+		htmlMessage += fmt.Sprintf(`
+		<br>
+		Your temporary password is <strong>%s</strong>, you will be asked to choose a new one when you log in.
+		`, password)
+	}
+
+	p, err := m.requestProperty(r)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.MailChan <- propertyMail(p, models.MailData{
+		To:       u.Email,
+		Subject:  "Your staff account",
+		Content:  htmlMessage,
+		Template: "basic.html",
+	})
+
+	if invite {
+		m.App.Session.Put(r.Context(), "flash", "Invitation sent")
+	} else {
+		m.App.Session.Put(r.Context(), "flash", "User created")
+	}
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
+
+// AdminShowUser shows a staff user in the admin panel
+func (m *Repository) AdminShowUser(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+
+	u, err := m.DB.GetUserByID(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.renderUserForm(w, r, u, forms.New(nil))
+}
+
+// AdminPostShowUser updates a staff user
+func (m *Repository) AdminPostShowUser(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+
+	u, err := m.DB.GetUserByID(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := userForm(r, &u)
+	u.Active = form.Has("active")
+
+	// an admin must not lock themselves out of the staff pages
+	if id == m.App.Session.GetInt(r.Context(), "user_id") && (!u.Active || u.AccessLevel != models.AccessLevelAdmin) {
+		form.Errors.Add("access_level", "You cannot disable or demote your own account")
+	}
+	if id == m.App.Session.GetInt(r.Context(), "user_id") && len(u.PropertyIDs) > 0 {
+		form.Errors.Add("property_ids", "You cannot limit your own account to some properties")
+	}
+
+	err = m.checkUserProperties(r.Context(), u, form)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if !form.Valid() {
+		m.renderUserForm(w, r, u, form)
+		return
+	}
+
+	err = m.DB.UpdateUser(r.Context(), u)
+	if errors.Is(err, repository.ErrConstraint) {
+		form.Errors.Add("email", "A user with this email already exists")
+		m.renderUserForm(w, r, u, form)
+		return
+	} else if errors.Is(err, repository.ErrNotFound) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.DB.SetUserProperties(r.Context(), id, u.PropertyIDs)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Changes saved")
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
+
+// AdminResetUserPassword gives a staff user a temporary password that has to be changed on the next login
+func (m *Repository) AdminResetUserPassword(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+
+	u, err := m.DB.GetUserByID(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		m.App.Session.Put(r.Context(), "error", "User not found")
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	password, err := randomPassword()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.DB.UpdatePassword(r.Context(), id, password)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	u.MustChangePassword = true
+	err = m.DB.UpdateUser(r.Context(), u)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	htmlMessage := fmt.Sprintf(`
+		<strong>Password reset</strong>
+		<br>
+		Dear %s: <br>
+		An administrator has reset your password. Your temporary password is <strong>%s</strong>,
+		you will be asked to choose a new one when you log in.
+	`, u.FirstName, password)
+
+	p, err := m.requestProperty(r)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.MailChan <- propertyMail(p, models.MailData{
+		To:       u.Email,
+		Subject:  "Your password has been reset",
+		Content:  htmlMessage,
+		Template: "basic.html",
+	})
+
+	m.App.Session.Put(r.Context(), "flash", "Password reset, the user has been emailed a temporary password")
+	http.Redirect(w, r, fmt.Sprintf("/admin/users/%d", id), http.StatusSeeOther)
+}
+
+// AdminUnlockUser lifts the lockout of a staff user after too many failed logins
+func (m *Repository) AdminUnlockUser(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+
+	u, err := m.DB.GetUserByID(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		m.App.Session.Put(r.Context(), "error", "User not found")
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.DB.UnlockUser(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	m.App.LoginAccounts.Reset(loginAccount(u.Email))
+
+	m.App.Session.Put(r.Context(), "flash", "User unlocked")
+	http.Redirect(w, r, fmt.Sprintf("/admin/users/%d", id), http.StatusSeeOther)
+}
+
+// AdminResetUserTwoFactor turns off two-factor authentication of a staff user who lost
+// the authenticator app and the recovery codes
+func (m *Repository) AdminResetUserTwoFactor(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+
+	err := m.DB.DisableTOTP(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		m.App.Session.Put(r.Context(), "error", "User not found")
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Two-factor authentication reset, the user has to set it up again")
+	http.Redirect(w, r, fmt.Sprintf("/admin/users/%d", id), http.StatusSeeOther)
+}
+
+// currentSessionID returns the id of the stored session the request was made with, 0 if there is none
+func (m *Repository) currentSessionID(r *http.Request) int {
+	cookie, err := r.Cookie(m.App.Session.Cookie.Name)
+	if err != nil {
+		return 0
+	}
+
+	s, err := m.DB.FindSession(r.Context(), cookie.Value)
+	if err != nil {
+		return 0
+	}
+	return s.ID
+}
+
+// endOwnSession logs out an admin who revoked the session of the current request, the session
+// would otherwise be stored again at the end of the request
+func (m *Repository) endOwnSession(w http.ResponseWriter, r *http.Request) {
+	_ = m.App.Session.Destroy(r.Context())
+	_ = m.App.Session.RenewToken(r.Context())
+
+	m.App.Session.Put(r.Context(), "flash", "Your session was revoked, please log in again")
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+// AdminRevokeSession logs a staff user out of one session
+func (m *Repository) AdminRevokeSession(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	sessionID, _ := strconv.Atoi(chi.URLParam(r, "session"))
+	own := sessionID > 0 && sessionID == m.currentSessionID(r)
+
+	err := m.DB.DeleteSession(r.Context(), sessionID)
+	if err == nil && own {
+		m.endOwnSession(w, r)
+		return
+	} else if errors.Is(err, repository.ErrNotFound) {
+		m.App.Session.Put(r.Context(), "error", "Session not found, it may have expired")
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	} else {
+		m.App.Session.Put(r.Context(), "flash", "Session revoked")
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/admin/users/%d", id), http.StatusSeeOther)
+}
+
+// AdminRevokeUserSessions logs a staff user out of every session
+func (m *Repository) AdminRevokeUserSessions(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+
+	err := m.DB.DeleteUserSessions(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if id == m.App.Session.GetInt(r.Context(), "user_id") {
+		m.endOwnSession(w, r)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "All sessions revoked")
+	http.Redirect(w, r, fmt.Sprintf("/admin/users/%d", id), http.StatusSeeOther)
+}
+
+// AdminDeleteUser deletes a staff user
+func (m *Repository) AdminDeleteUser(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+
+	if id == m.App.Session.GetInt(r.Context(), "user_id") {
+		m.App.Session.Put(r.Context(), "error", "You cannot delete your own account")
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+		return
+	}
+
+	err := m.DB.DeleteUser(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		m.App.Session.Put(r.Context(), "error", "User not found")
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	} else {
+		m.App.Session.Put(r.Context(), "flash", "User deleted")
+	}
+
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
@@ -0,0 +1,347 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// userRequest builds a request for the staff user pages, logged in as user 1
+func userRequest(method, target, id string, postedData url.Values) *http.Request {
+	var r *http.Request
+	if postedData != nil {
+		r = httptest.NewRequest(method, target, strings.NewReader(postedData.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		r = httptest.NewRequest(method, target, nil)
+	}
+
+	ctx := getCTX(r)
+	session.Put(ctx, "user_id", 1)
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", id)
+
+	return r.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+}
+
+func TestRepository_AdminPostNewUser(t *testing.T) {
+	var tableTest = []struct {
+		name               string
+		email              string
+		accessLevel        string
+		password           string
+		expectedStatusCode int
+		expectedLocation   string
+		expectedHTML       string
+	}{
+		{"invite", "jane@here.com", "1", "", http.StatusSeeOther, "/admin/users", ""},
+		{"with password", "jane@here.com", "2", "long enough 42", http.StatusSeeOther, "/admin/users", ""},
+		{"short password", "jane@here.com", "1", "short 42", http.StatusOK, "", "at least 10 characters"},
+		{"weak password", "jane@here.com", "1", "letters only please", http.StatusOK, "", "letters and digits"},
+		{"invalid access level", "jane@here.com", "9", "", http.StatusOK, "", "Invalid access level"},
+		{"invalid email", "jane", "1", "", http.StatusOK, "", "Invalid email address"},
+		{"duplicate email", "john@smith.com", "1", "", http.StatusOK, "", "already exists"},
+	}
+
+	defer resetTestDB()
+
+	for _, test := range tableTest {
+		resetTestDB()
+		postedData := url.Values{}
+		postedData.Add("first_name", "Jane")
+		postedData.Add("last_name", "Smith")
+		postedData.Add("email", test.email)
+		postedData.Add("access_level", test.accessLevel)
+		postedData.Add("password", test.password)
+
+		w := httptest.NewRecorder()
+		r := userRequest("POST", "/admin/users/new", "", postedData)
+
+		handler := http.HandlerFunc(Repo.AdminPostNewUser)
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.expectedStatusCode {
+			t.Errorf("case - %s: expected code %d but got %d", test.name, test.expectedStatusCode, w.Code)
+		}
+
+		if test.expectedLocation != "" {
+			actualLoc, _ := w.Result().Location()
+			if actualLoc.String() != test.expectedLocation {
+				t.Errorf("case - %s: expected location %s, but got location %s", test.name, test.expectedLocation, actualLoc.String())
+			}
+		}
+
+		if test.expectedHTML != "" && !strings.Contains(w.Body.String(), test.expectedHTML) {
+			t.Errorf("case - %s: expected to find %s but did not", test.name, test.expectedHTML)
+		}
+	}
+}
+
+func TestRepository_AdminPostShowUser(t *testing.T) {
+	var tableTest = []struct {
+		name               string
+		id                 string
+		email              string
+		accessLevel        string
+		active             string
+		expectedStatusCode int
+		expectedHTML       string
+	}{
+		{"update staff user", "2", "john@smith.com", "2", "1", http.StatusSeeOther, ""},
+		{"disable staff user", "2", "john@smith.com", "1", "", http.StatusSeeOther, ""},
+		{"disable own account", "1", "me@here.com", "3", "", http.StatusOK, "cannot disable or demote"},
+		{"demote own account", "1", "me@here.com", "1", "1", http.StatusOK, "cannot disable or demote"},
+		{"duplicate email", "2", "me@here.com", "1", "1", http.StatusOK, "already exists"},
+		{"non-existent user", "100", "john@smith.com", "1", "1", http.StatusNotFound, ""},
+	}
+
+	defer resetTestDB()
+
+	for _, test := range tableTest {
+		postedData := url.Values{}
+		postedData.Add("first_name", "John")
+		postedData.Add("last_name", "Smith")
+		postedData.Add("email", test.email)
+		postedData.Add("access_level", test.accessLevel)
+		postedData.Add("active", test.active)
+
+		w := httptest.NewRecorder()
+		r := userRequest("POST", "/admin/users/"+test.id, test.id, postedData)
+
+		handler := http.HandlerFunc(Repo.AdminPostShowUser)
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.expectedStatusCode {
+			t.Errorf("case - %s: expected code %d but got %d", test.name, test.expectedStatusCode, w.Code)
+		}
+
+		if test.expectedHTML != "" && !strings.Contains(w.Body.String(), test.expectedHTML) {
+			t.Errorf("case - %s: expected to find %s but did not", test.name, test.expectedHTML)
+		}
+	}
+}
+
+func TestRepository_AdminResetUserPassword(t *testing.T) {
+	var tableTest = []struct {
+		name             string
+		id               string
+		expectedLocation string
+	}{
+		{"reset staff user", "2", "/admin/users/2"},
+		{"non-existent user", "100", "/admin/users"},
+	}
+
+	defer resetTestDB()
+
+	for _, test := range tableTest {
+		w := httptest.NewRecorder()
+		r := userRequest("POST", "/admin/users/"+test.id+"/reset-password/do", test.id, nil)
+
+		handler := http.HandlerFunc(Repo.AdminResetUserPassword)
+		handler.ServeHTTP(w, r)
+
+		if w.Code != http.StatusSeeOther {
+			t.Errorf("case - %s: expected code %d but got %d", test.name, http.StatusSeeOther, w.Code)
+		}
+
+		actualLoc, _ := w.Result().Location()
+		if actualLoc.String() != test.expectedLocation {
+			t.Errorf("case - %s: expected location %s, but got location %s", test.name, test.expectedLocation, actualLoc.String())
+		}
+	}
+}
+
+func TestRepository_AdminDeleteUser(t *testing.T) {
+	var tableTest = []struct {
+		name          string
+		id            string
+		expectedFlash string
+		expectedError string
+	}{
+		{"delete staff user", "2", "User deleted", ""},
+		{"delete own account", "1", "", "You cannot delete your own account"},
+		{"non-existent user", "100", "", "User not found"},
+	}
+
+	defer resetTestDB()
+
+	for _, test := range tableTest {
+		w := httptest.NewRecorder()
+		r := userRequest("POST", "/admin/users/"+test.id+"/delete/do", test.id, nil)
+
+		handler := http.HandlerFunc(Repo.AdminDeleteUser)
+		handler.ServeHTTP(w, r)
+
+		if w.Code != http.StatusSeeOther {
+			t.Errorf("case - %s: expected code %d but got %d", test.name, http.StatusSeeOther, w.Code)
+		}
+
+		if flash := session.GetString(r.Context(), "flash"); flash != test.expectedFlash {
+			t.Errorf("case - %s: expected flash %q but got %q", test.name, test.expectedFlash, flash)
+		}
+		if msg := session.GetString(r.Context(), "error"); msg != test.expectedError {
+			t.Errorf("case - %s: expected error %q but got %q", test.name, test.expectedError, msg)
+		}
+	}
+}
+
+func TestRepository_AdminUnlockUser(t *testing.T) {
+	var tableTest = []struct {
+		name             string
+		id               string
+		expectedLocation string
+		expectedFlash    string
+	}{
+		{"unlock staff user", "2", "/admin/users/2", "User unlocked"},
+		{"non-existent user", "100", "/admin/users", ""},
+	}
+
+	defer resetTestDB()
+
+	for _, test := range tableTest {
+		w := httptest.NewRecorder()
+		r := userRequest("POST", "/admin/users/"+test.id+"/unlock/do", test.id, nil)
+
+		handler := http.HandlerFunc(Repo.AdminUnlockUser)
+		handler.ServeHTTP(w, r)
+
+		if w.Code != http.StatusSeeOther {
+			t.Errorf("case - %s: expected code %d but got %d", test.name, http.StatusSeeOther, w.Code)
+		}
+
+		actualLoc, _ := w.Result().Location()
+		if actualLoc.String() != test.expectedLocation {
+			t.Errorf("case - %s: expected location %s, but got location %s", test.name, test.expectedLocation, actualLoc.String())
+		}
+
+		if flash := session.GetString(r.Context(), "flash"); flash != test.expectedFlash {
+			t.Errorf("case - %s: expected flash %q but got %q", test.name, test.expectedFlash, flash)
+		}
+	}
+}
+
+func TestRepository_AdminResetUserTwoFactor(t *testing.T) {
+	var tableTest = []struct {
+		name             string
+		id               string
+		expectedLocation string
+	}{
+		{"reset staff user", "6", "/admin/users/6"},
+		{"non-existent user", "100", "/admin/users"},
+	}
+
+	defer resetTestDB()
+
+	for _, test := range tableTest {
+		w := httptest.NewRecorder()
+		r := userRequest("POST", "/admin/users/"+test.id+"/two-factor/reset/do", test.id, nil)
+
+		handler := http.HandlerFunc(Repo.AdminResetUserTwoFactor)
+		handler.ServeHTTP(w, r)
+
+		if w.Code != http.StatusSeeOther {
+			t.Errorf("case - %s: expected code %d but got %d", test.name, http.StatusSeeOther, w.Code)
+		}
+
+		actualLoc, _ := w.Result().Location()
+		if actualLoc.String() != test.expectedLocation {
+			t.Errorf("case - %s: expected location %s, but got location %s", test.name, test.expectedLocation, actualLoc.String())
+		}
+	}
+}
+
+func TestRepository_AdminRevokeSession(t *testing.T) {
+	var tableTest = []struct {
+		name          string
+		session       string
+		expectedFlash string
+		expectedError string
+	}{
+		{"revoke session", "1", "Session revoked", ""},
+		{"non-existent session", "100", "", "Session not found, it may have expired"},
+	}
+
+	defer resetTestDB()
+
+	for _, test := range tableTest {
+		w := httptest.NewRecorder()
+		r := userRequest("POST", "/admin/users/1/sessions/"+test.session+"/revoke/do", "1", nil)
+		chi.RouteContext(r.Context()).URLParams.Add("session", test.session)
+
+		handler := http.HandlerFunc(Repo.AdminRevokeSession)
+		handler.ServeHTTP(w, r)
+
+		if w.Code != http.StatusSeeOther {
+			t.Errorf("case - %s: expected code %d but got %d", test.name, http.StatusSeeOther, w.Code)
+		}
+
+		actualLoc, _ := w.Result().Location()
+		if actualLoc.String() != "/admin/users/1" {
+			t.Errorf("case - %s: expected location /admin/users/1, but got location %s", test.name, actualLoc.String())
+		}
+
+		if flash := session.GetString(r.Context(), "flash"); flash != test.expectedFlash {
+			t.Errorf("case - %s: expected flash %q but got %q", test.name, test.expectedFlash, flash)
+		}
+		if msg := session.GetString(r.Context(), "error"); msg != test.expectedError {
+			t.Errorf("case - %s: expected error %q but got %q", test.name, test.expectedError, msg)
+		}
+	}
+}
+
+func TestRepository_AdminRevokeUserSessions(t *testing.T) {
+	var tableTest = []struct {
+		name             string
+		id               string
+		expectedLocation string
+	}{
+		{"revoke sessions of another user", "2", "/admin/users/2"},
+		{"revoke own sessions", "1", "/user/login"},
+	}
+
+	defer resetTestDB()
+
+	for _, test := range tableTest {
+		w := httptest.NewRecorder()
+		r := userRequest("POST", "/admin/users/"+test.id+"/sessions/revoke/do", test.id, nil)
+
+		handler := http.HandlerFunc(Repo.AdminRevokeUserSessions)
+		handler.ServeHTTP(w, r)
+
+		if w.Code != http.StatusSeeOther {
+			t.Errorf("case - %s: expected code %d but got %d", test.name, http.StatusSeeOther, w.Code)
+		}
+
+		actualLoc, _ := w.Result().Location()
+		if actualLoc.String() != test.expectedLocation {
+			t.Errorf("case - %s: expected location %s, but got location %s", test.name, test.expectedLocation, actualLoc.String())
+		}
+	}
+}
+
+func TestRepository_AdminShowUser_Sessions(t *testing.T) {
+	app.PersistentSessions = true
+	defer func() { app.PersistentSessions = false }()
+
+	w := httptest.NewRecorder()
+	r := userRequest("GET", "/admin/users/1", "1", nil)
+
+	handler := http.HandlerFunc(Repo.AdminShowUser)
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected code %d but got %d", http.StatusOK, w.Code)
+	}
+
+	for _, expected := range []string{"Active Sessions", "192.0.2.1", "Safari", "/admin/users/1/sessions/2/revoke/do"} {
+		if !strings.Contains(w.Body.String(), expected) {
+			t.Errorf("expected to find %s on the user page but did not", expected)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/adewidyatamadb/GoBookings/internal/forms"
+	"github.com/adewidyatamadb/GoBookings/internal/helpers"
+	"github.com/adewidyatamadb/GoBookings/internal/models"
+	"github.com/adewidyatamadb/GoBookings/internal/render"
+	"github.com/adewidyatamadb/GoBookings/internal/repository"
+	"github.com/adewidyatamadb/GoBookings/internal/webhooks"
+	"github.com/go-chi/chi/v5"
+)
+
+// webhookDeliveriesShown is how many deliveries the page of a webhook lists
+const webhookDeliveriesShown = 50
+
+// webhookForm validates the posted webhook form and copies it into h
+func webhookForm(r *http.Request, h *models.Webhook) *forms.Form {
+	form := forms.New(r.PostForm)
+	form.Required("url")
+
+	h.URL = r.Form.Get("url")
+	if h.URL != "" {
+		u, err := url.Parse(h.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			form.Errors.Add("url", "Enter an http or https URL")
+		}
+	}
+
+	h.Events = nil
+	for _, e := range models.WebhookEvents {
+		for _, posted := range r.Form["events"] {
+			if posted == e {
+				h.Events = append(h.Events, e)
+				break
+			}
+		}
+	}
+	if len(h.Events) == 0 {
+		form.Errors.Add("events", "Choose at least one event")
+	}
+
+	h.Active = form.Has("active")
+
+	return form
+}
+
+// renderWebhookForm renders the page to create or edit a webhook, with the latest deliveries of existing webhooks
+func (m *Repository) renderWebhookForm(w http.ResponseWriter, r *http.Request, h models.Webhook, form *forms.Form) {
+	data := make(map[string]interface{})
+	data["webhook"] = h
+	data["events"] = models.WebhookEvents
+
+	if h.ID > 0 {
+		deliveries, err := m.DB.WebhookDeliveries(r.Context(), h.ID, webhookDeliveriesShown)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		data["deliveries"] = deliveries
+	}
+
+	render.Template(w, r, "admin-webhook.page.html", &models.TemplateData{
+		Data: data,
+		Form: form,
+	})
+}
+
+// AdminWebhooks lists the webhooks
+func (m *Repository) AdminWebhooks(w http.ResponseWriter, r *http.Request) {
+	hooks, err := m.DB.AllWebhooks(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["webhooks"] = hooks
+
+	render.Template(w, r, "admin-webhooks.page.html", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminNewWebhook shows the form to add a webhook
+func (m *Repository) AdminNewWebhook(w http.ResponseWriter, r *http.Request) {
+	h := models.Webhook{
+		Events: models.WebhookEvents,
+		Active: true,
+	}
+
+	m.renderWebhookForm(w, r, h, forms.New(nil))
+}
+
+// AdminPostNewWebhook adds a webhook with a new signing secret
+func (m *Repository) AdminPostNewWebhook(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	var h models.Webhook
+	form := webhookForm(r, &h)
+	if !form.Valid() {
+		m.renderWebhookForm(w, r, h, form)
+		return
+	}
+
+	h.Secret, err = webhooks.NewSecret()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	id, err := m.DB.InsertWebhook(r.Context(), h)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Webhook added, use the secret to verify its signatures")
+	http.Redirect(w, r, fmt.Sprintf("/admin/webhooks/%d", id), http.StatusSeeOther)
+}
+
+// AdminShowWebhook shows a webhook with its signing secret and delivery log
+func (m *Repository) AdminShowWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+
+	h, err := m.DB.GetWebhookByID(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.renderWebhookForm(w, r, h, forms.New(nil))
+}
+
+// AdminPostShowWebhook updates the URL, events and status of a webhook
+func (m *Repository) AdminPostShowWebhook(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+
+	h, err := m.DB.GetWebhookByID(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := webhookForm(r, &h)
+	if !form.Valid() {
+		m.renderWebhookForm(w, r, h, form)
+		return
+	}
+
+	err = m.DB.UpdateWebhook(r.Context(), h)
+	if errors.Is(err, repository.ErrNotFound) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Changes saved")
+	http.Redirect(w, r, fmt.Sprintf("/admin/webhooks/%d", id), http.StatusSeeOther)
+}
+
+// AdminPingWebhook queues a ping for a webhook, also when it is not active, to test the receiver
+func (m *Repository) AdminPingWebhook(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+
+	data := map[string]int{"webhook_id": id}
+	n, err := webhooks.Enqueue(r.Context(), m.DB, models.EventPing, data, id, time.Now())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if n == 0 {
+		m.App.Session.Put(r.Context(), "error", "Webhook not found")
+		http.Redirect(w, r, "/admin/webhooks", http.StatusSeeOther)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Ping queued, it is sent within 15 seconds")
+	http.Redirect(w, r, fmt.Sprintf("/admin/webhooks/%d", id), http.StatusSeeOther)
+}
+
+// AdminDeleteWebhook deletes a webhook with its delivery log
+func (m *Repository) AdminDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+
+	err := m.DB.DeleteWebhook(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		m.App.Session.Put(r.Context(), "error", "Webhook not found")
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	} else {
+		m.App.Session.Put(r.Context(), "flash", "Webhook deleted")
+	}
+
+	http.Redirect(w, r, "/admin/webhooks", http.StatusSeeOther)
+}
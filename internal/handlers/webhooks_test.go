@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/adewidyatamadb/GoBookings/internal/models"
+)
+
+func TestRepository_AdminWebhooks(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := userRequest("GET", "/admin/webhooks", "", nil)
+
+	handler := http.HandlerFunc(Repo.AdminWebhooks)
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected code %d but got %d", http.StatusOK, w.Code)
+	}
+	for _, expected := range []string{"https://accounting.example.com/hooks", "https://housekeeping.example.com/hooks", "Disabled"} {
+		if !strings.Contains(w.Body.String(), expected) {
+			t.Errorf("expected to find %s but did not", expected)
+		}
+	}
+}
+
+func TestRepository_AdminShowWebhook(t *testing.T) {
+	var tableTest = []struct {
+		name               string
+		id                 string
+		expectedStatusCode int
+		expectedHTML       []string
+	}{
+		{"delivery log", "1", http.StatusOK, []string{"accounting-secret", "reservation.created", "connection refused", "Delivered", "Pending"}},
+		{"no deliveries", "2", http.StatusOK, []string{"Nothing has been sent"}},
+		{"non-existent webhook", "100", http.StatusNotFound, nil},
+		{"invalid id", "x", http.StatusNotFound, nil},
+	}
+
+	for _, test := range tableTest {
+		w := httptest.NewRecorder()
+		r := userRequest("GET", "/admin/webhooks/"+test.id, test.id, nil)
+
+		handler := http.HandlerFunc(Repo.AdminShowWebhook)
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.expectedStatusCode {
+			t.Errorf("case - %s: expected code %d but got %d", test.name, test.expectedStatusCode, w.Code)
+		}
+
+		for _, expected := range test.expectedHTML {
+			if !strings.Contains(w.Body.String(), expected) {
+				t.Errorf("case - %s: expected to find %s but did not", test.name, expected)
+			}
+		}
+	}
+}
+
+func TestRepository_AdminPostNewWebhook(t *testing.T) {
+	var tableTest = []struct {
+		name               string
+		url                string
+		events             []string
+		expectedStatusCode int
+		expectedLocation   string
+		expectedHTML       string
+	}{
+		{"valid webhook", "http://localhost:9090/hooks", []string{models.EventReservationCreated}, http.StatusSeeOther, "/admin/webhooks/3", ""},
+		{"missing url", "", []string{models.EventReservationCreated}, http.StatusOK, "", "This field cannot be blank"},
+		{"not a web url", "ftp://example.com/hooks", []string{models.EventReservationCreated}, http.StatusOK, "", "Enter an http or https URL"},
+		{"relative url", "/hooks", []string{models.EventReservationCreated}, http.StatusOK, "", "Enter an http or https URL"},
+		{"no events", "https://example.com/hooks", nil, http.StatusOK, "", "Choose at least one event"},
+		{"unknown event", "https://example.com/hooks", []string{"reservation.exploded"}, http.StatusOK, "", "Choose at least one event"},
+	}
+
+	defer resetTestDB()
+
+	for _, test := range tableTest {
+		postedData := url.Values{}
+		postedData.Add("url", test.url)
+		postedData.Add("active", "1")
+		for _, e := range test.events {
+			postedData.Add("events", e)
+		}
+
+		w := httptest.NewRecorder()
+		r := userRequest("POST", "/admin/webhooks/new", "", postedData)
+
+		handler := http.HandlerFunc(Repo.AdminPostNewWebhook)
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.expectedStatusCode {
+			t.Errorf("case - %s: expected code %d but got %d", test.name, test.expectedStatusCode, w.Code)
+		}
+
+		if test.expectedLocation != "" {
+			actualLoc, _ := w.Result().Location()
+			if actualLoc.String() != test.expectedLocation {
+				t.Errorf("case - %s: expected location %s, but got location %s", test.name, test.expectedLocation, actualLoc.String())
+			}
+		}
+
+		if test.expectedHTML != "" && !strings.Contains(w.Body.String(), test.expectedHTML) {
+			t.Errorf("case - %s: expected to find %s but did not", test.name, test.expectedHTML)
+		}
+	}
+}
+
+func TestRepository_AdminPostShowWebhook(t *testing.T) {
+	var tableTest = []struct {
+		name               string
+		id                 string
+		url                string
+		expectedStatusCode int
+		expectedHTML       string
+	}{
+		{"update webhook", "1", "https://accounting.example.com/v2/hooks", http.StatusSeeOther, ""},
+		{"invalid url", "1", "accounting", http.StatusOK, "Enter an http or https URL"},
+		{"non-existent webhook", "100", "https://example.com/hooks", http.StatusNotFound, ""},
+	}
+
+	defer resetTestDB()
+
+	for _, test := range tableTest {
+		postedData := url.Values{}
+		postedData.Add("url", test.url)
+		postedData.Add("events", models.EventReservationCancelled)
+
+		w := httptest.NewRecorder()
+		r := userRequest("POST", "/admin/webhooks/"+test.id, test.id, postedData)
+
+		handler := http.HandlerFunc(Repo.AdminPostShowWebhook)
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.expectedStatusCode {
+			t.Errorf("case - %s: expected code %d but got %d", test.name, test.expectedStatusCode, w.Code)
+		}
+
+		if test.expectedHTML != "" && !strings.Contains(w.Body.String(), test.expectedHTML) {
+			t.Errorf("case - %s: expected to find %s but did not", test.name, test.expectedHTML)
+		}
+	}
+}
+
+func TestRepository_AdminPingWebhook(t *testing.T) {
+	var tableTest = []struct {
+		name             string
+		id               string
+		expectedLocation string
+	}{
+		{"active webhook", "1", "/admin/webhooks/1"},
+		{"inactive webhook", "2", "/admin/webhooks/2"},
+		{"non-existent webhook", "100", "/admin/webhooks"},
+	}
+
+	defer resetTestDB()
+
+	for _, test := range tableTest {
+		w := httptest.NewRecorder()
+		r := userRequest("POST", "/admin/webhooks/"+test.id+"/ping/do", test.id, nil)
+
+		handler := http.HandlerFunc(Repo.AdminPingWebhook)
+		handler.ServeHTTP(w, r)
+
+		if w.Code != http.StatusSeeOther {
+			t.Errorf("case - %s: expected code %d but got %d", test.name, http.StatusSeeOther, w.Code)
+		}
+
+		actualLoc, _ := w.Result().Location()
+		if actualLoc.String() != test.expectedLocation {
+			t.Errorf("case - %s: expected location %s, but got location %s", test.name, test.expectedLocation, actualLoc.String())
+		}
+	}
+}
+
+func TestRepository_AdminDeleteWebhook(t *testing.T) {
+	var tableTest = []struct {
+		name          string
+		id            string
+		expectedFlash string
+	}{
+		{"existing webhook", "2", "flash"},
+		{"non-existent webhook", "100", "error"},
+	}
+
+	defer resetTestDB()
+
+	for _, test := range tableTest {
+		w := httptest.NewRecorder()
+		r := userRequest("POST", "/admin/webhooks/"+test.id+"/delete/do", test.id, nil)
+
+		handler := http.HandlerFunc(Repo.AdminDeleteWebhook)
+		handler.ServeHTTP(w, r)
+
+		if w.Code != http.StatusSeeOther {
+			t.Errorf("case - %s: expected code %d but got %d", test.name, http.StatusSeeOther, w.Code)
+		}
+
+		if !session.Exists(r.Context(), test.expectedFlash) {
+			t.Errorf("case - %s: expected a %s message", test.name, test.expectedFlash)
+		}
+	}
+}
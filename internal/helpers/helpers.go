@@ -1,11 +1,17 @@
 package helpers
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
 	"fmt"
+	"net"
 	"net/http"
 	"runtime/debug"
+	"strings"
 
 	"github.com/adewidyatamadb/GoBookings/internal/config"
+	"github.com/adewidyatamadb/GoBookings/internal/models"
 )
 
 var app *config.AppConfig
@@ -30,3 +36,131 @@ func IsAuthenticated(r *http.Request) bool {
 	exists := app.Session.Exists(r.Context(), "user_id")
 	return exists
 }
+
+// ClientIP returns the IP address the request comes from, requests relayed by a trusted proxy
+// are attributed to the last address in X-Forwarded-For that is not a trusted proxy itself
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !trustedProxy(host) {
+		return host
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		ip := strings.TrimSpace(forwarded[i])
+		if net.ParseIP(ip) == nil {
+			break
+		}
+		host = ip
+		if !trustedProxy(ip) {
+			break
+		}
+	}
+	return host
+}
+
+// trustedProxy reports whether ip belongs to one of the trusted proxies of the app
+func trustedProxy(ip string) bool {
+	if app == nil || len(app.TrustedProxies) == 0 {
+		return false
+	}
+
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range app.TrustedProxies {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTrustedProxies parses a comma separated list of IP addresses and CIDR ranges
+func ParseTrustedProxies(list string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", item)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", item)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// contextKey is the type of the request context keys set by helpers
+type contextKey string
+
+// cspNonceKey is the request context key of the Content-Security-Policy nonce
+const cspNonceKey contextKey = "csp_nonce"
+
+// WithCSPNonce returns r carrying a new random nonce for inline scripts, or r itself when it already has one
+func WithCSPNonce(r *http.Request) (*http.Request, error) {
+	if CSPNonce(r) != "" {
+		return r, nil
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return r, err
+	}
+	return r.WithContext(context.WithValue(r.Context(), cspNonceKey, base64.StdEncoding.EncodeToString(b))), nil
+}
+
+// CSPNonce returns the Content-Security-Policy nonce of the request, inline scripts need it in their nonce attribute
+func CSPNonce(r *http.Request) string {
+	nonce, _ := r.Context().Value(cspNonceKey).(string)
+	return nonce
+}
+
+// propertyKey is the request context key of the property the request is for
+const propertyKey contextKey = "property"
+
+// propertySlugKey is the request context key of the property slug taken from the path prefix
+const propertySlugKey contextKey = "property_slug"
+
+// WithProperty returns r carrying the property p the request is for
+func WithProperty(r *http.Request, p models.Property) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), propertyKey, p))
+}
+
+// Property returns the property the request is for, the zero property when none was selected
+func Property(r *http.Request) models.Property {
+	p, _ := r.Context().Value(propertyKey).(models.Property)
+	return p
+}
+
+// WithPropertySlug returns r carrying the property slug of its path prefix
+func WithPropertySlug(r *http.Request, slug string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), propertySlugKey, slug))
+}
+
+// PropertySlug returns the property slug of the path prefix of the request, empty without a prefix
+func PropertySlug(r *http.Request) string {
+	slug, _ := r.Context().Value(propertySlugKey).(string)
+	return slug
+}
@@ -2,26 +2,136 @@ package models
 
 import (
 	"time"
+
+	"github.com/adewidyatamadb/GoBookings/internal/dates"
+)
+
+// Access levels of staff users
+const (
+	AccessLevelStaff   = 1
+	AccessLevelManager = 2
+	AccessLevelAdmin   = 3
 )
 
 // User is the user model
 type User struct {
-	ID          int
-	FirstName   string
-	LastName    string
-	Email       string
-	Password    string
-	AccessLevel int
+	ID                 int
+	FirstName          string
+	LastName           string
+	Email              string
+	Password           string
+	AccessLevel        int
+	Active             bool
+	MustChangePassword bool
+	SessionVersion     int
+	FailedLogins       int
+	LockedUntil        time.Time
+	TOTPSecret         string
+	TOTPEnabled        bool
+	// PropertyIDs are the properties the user works for, none stands for every property
+	PropertyIDs []int
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// Locked reports whether the user is locked out after too many failed logins
+func (u User) Locked() bool {
+	return u.LockedUntil.After(time.Now())
+}
+
+// Manages reports whether the user works for property propertyID
+func (u User) Manages(propertyID int) bool {
+	if len(u.PropertyIDs) == 0 {
+		return true
+	}
+	for _, id := range u.PropertyIDs {
+		if id == propertyID {
+			return true
+		}
+	}
+	return false
+}
+
+// Tags staff give guests
+const (
+	TagVIP       = "vip"
+	TagDoNotRent = "do-not-rent"
+)
+
+// Guest is a person who made reservations, one profile per email address. Guests who registered
+// have a password and log in separately from staff users
+type Guest struct {
+	ID        int
+	FirstName string
+	LastName  string
+	Email     string
+	Phone     string
+	Password  string
+	// PendingPassword is the password of a registration that becomes the guest's
+	// once the email address is verified
+	PendingPassword string
+	EmailVerified   bool
+	Notes           string
+	Tags            []string
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	// Stays is the number of reservations, only set when guests are listed
+	Stays int
+	// LastStay is the latest arrival date, only set when guests are listed
+	LastStay dates.Date
+}
+
+// HasAccount reports whether the guest registered and can log in
+func (g Guest) HasAccount() bool {
+	return g.Password != ""
+}
+
+// HasTag reports whether staff gave the guest tag
+func (g Guest) HasTag(tag string) bool {
+	for _, t := range g.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Property is a bed and breakfast with its rooms and settings. The public pages of a property are found by its
+// Host name or under /p/ and its Slug
+type Property struct {
+	ID   int
+	Name string
+	Slug string
+	// Host is the host name the public pages of the property are served on, empty when there is none
+	Host string
+	// TimeZone is the IANA name of the time zone of the property, empty for the time zone of the application
+	TimeZone string
+	Currency string
+	// MailFrom sends the emails to guests, OwnerEmail is sent the notifications for the owner
+	MailFrom   string
+	OwnerEmail string
+	// Description is the welcome text of the home page
+	Description string
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
 }
 
+// Location returns the time zone of the property, nil when it has none of its own
+func (p Property) Location() (*time.Location, error) {
+	if p.TimeZone == "" {
+		return nil, nil
+	}
+	return time.LoadLocation(p.TimeZone)
+}
+
 // Room is the room model
 type Room struct {
 	ID        int
 	RoomName  string
 	CreatedAt time.Time
 	UpdatedAt time.Time
+	// PropertyID is the property the room belongs to
+	PropertyID int
 }
 
 // Restriction is the restriction model
@@ -39,20 +149,31 @@ type Reservation struct {
 	LastName  string
 	Email     string
 	Phone     string
-	StartDate time.Time
-	EndDate   time.Time
+	StartDate dates.Date
+	EndDate   dates.Date
 	RoomID    int
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	Room      Room
 	Processed int
+	// GuestID is the profile of the guest who made the reservation, 0 for reservations made before guests were kept
+	GuestID int
+	// HoldUntil is when the room is released unless the guest confirms the email address, zero for confirmed reservations
+	HoldUntil time.Time
+	// Guest holds the notes and tags of the guest profile, it is only loaded for the day sheet
+	Guest Guest
+}
+
+// Pending reports whether the reservation only holds the room until the guest confirms the email address
+func (r Reservation) Pending() bool {
+	return !r.HoldUntil.IsZero()
 }
 
 // RoomRestriction is the room restriction model
 type RoomRestriction struct {
 	ID            int
-	StartDate     time.Time
-	EndDate       time.Time
+	StartDate     dates.Date
+	EndDate       dates.Date
 	RoomID        int
 	ReservationID int
 	RestrictionID int
@@ -63,6 +184,19 @@ type RoomRestriction struct {
 	Restriction   Restriction
 }
 
+// Session is a login session kept in the session store, Data holds the encoded session values
+type Session struct {
+	ID        int
+	Token     string
+	Data      []byte
+	Expiry    time.Time
+	UserID    int
+	IP        string
+	UserAgent string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
 // MailData holds an email message
 type MailData struct {
 	To       string
@@ -70,4 +204,244 @@ type MailData struct {
 	Subject  string
 	Content  string
 	Template string
+	// Brand is the name of the property shown at the top of the template
+	Brand string
+}
+
+// Occupancy is how many of the nights of a date range a room, or all rooms together, were booked
+type Occupancy struct {
+	Room   Room
+	Booked int
+	Nights int
+}
+
+// Rate returns the booked share of the nights
+func (o Occupancy) Rate() float64 {
+	if o.Nights == 0 {
+		return 0
+	}
+	return float64(o.Booked) / float64(o.Nights)
+}
+
+// LeadTime counts the reservations booked from Min to Max days before arrival, Max is -1 for no upper bound
+type LeadTime struct {
+	Label string
+	Min   int
+	Max   int
+	Count int
+}
+
+// DashboardStats are the occupancy and booking figures of the admin dashboard for the nights from Start to End,
+// ADR and RevPAR need room prices, which are not kept yet
+type DashboardStats struct {
+	Start dates.Date
+	End   dates.Date
+	// Total is the occupancy of all rooms together
+	Total Occupancy
+	Rooms []Occupancy
+	// Arrivals and Departures are the reservations starting and ending today
+	Arrivals   int
+	Departures int
+	// PickUp7 and PickUp30 are the reservations booked in the last 7 and 30 days
+	PickUp7  int
+	PickUp30 int
+	// LeadTimes are how far ahead the reservations arriving from Start to End were booked
+	LeadTimes []LeadTime
+}
+
+// JobRun is one run of a scheduled job, Error is empty for runs that succeeded
+type JobRun struct {
+	ID           int
+	Name         string
+	Owner        string
+	ScheduledFor time.Time
+	StartedAt    time.Time
+	FinishedAt   time.Time
+	Error        string
+}
+
+// Failed reports whether the run returned an error
+func (r JobRun) Failed() bool {
+	return r.Error != ""
+}
+
+// Duration returns how long the run took
+func (r JobRun) Duration() time.Duration {
+	return r.FinishedAt.Sub(r.StartedAt)
+}
+
+// Kinds of the scheduled emails sent to guests around their stay
+const (
+	GuestMailPreArrival = "pre-arrival"
+	GuestMailCheckOut   = "check-out"
+	GuestMailPostStay   = "post-stay"
+)
+
+// GuestMail is a scheduled email sent to the guest of a reservation
+type GuestMail struct {
+	ID            int
+	ReservationID int
+	Kind          string
+	Email         string
+	Subject       string
+	SentAt        time.Time
+}
+
+// Events sent to webhooks
+const (
+	EventReservationCreated   = "reservation.created"
+	EventReservationUpdated   = "reservation.updated"
+	EventReservationProcessed = "reservation.processed"
+	EventReservationCancelled = "reservation.cancelled"
+	EventBlockCreated         = "block.created"
+	// EventPing is only sent by the test button of a webhook, whatever it subscribes to
+	EventPing = "ping"
+)
+
+// WebhookEvents are the events a webhook can subscribe to
+var WebhookEvents = []string{
+	EventReservationCreated,
+	EventReservationUpdated,
+	EventReservationProcessed,
+	EventReservationCancelled,
+	EventBlockCreated,
+}
+
+// Webhook is an endpoint of another system that is sent the events it subscribes to
+type Webhook struct {
+	ID  int
+	URL string
+	// Secret is the key of the HMAC signature of the payloads
+	Secret    string
+	Events    []string
+	Active    bool
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Subscribed reports whether the webhook is sent event
+func (h Webhook) Subscribed(event string) bool {
+	if event == EventPing {
+		return true
+	}
+	for _, e := range h.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Statuses of webhook deliveries
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookDelivery is an event sent, or still to be sent, to a webhook
+type WebhookDelivery struct {
+	ID        int
+	WebhookID int
+	Event     string
+	// Payload is the JSON body, kept as it was when the event happened
+	Payload string
+	Status  string
+	// Attempts, ResponseCode and Error are about the latest attempt, ResponseCode is 0 when there was no response
+	Attempts      int
+	ResponseCode  int
+	Error         string
+	CreatedAt     time.Time
+	NextAttemptAt time.Time
+	// DeliveredAt is zero until the webhook accepted the delivery
+	DeliveredAt time.Time
+	// Webhook holds the URL and secret, it is only loaded with the deliveries that are due
+	Webhook Webhook
+}
+
+// Weekdays is a set of days of the week, the empty set stands for every day
+type Weekdays uint8
+
+// AllWeekdays are the days of the week from Monday, the order they are listed in
+var AllWeekdays = []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday, time.Sunday}
+
+// WeekdaysOf returns the set of days
+func WeekdaysOf(days ...time.Weekday) Weekdays {
+	var w Weekdays
+	for _, d := range days {
+		w |= 1 << uint(d)
+	}
+	return w
+}
+
+// Has reports whether d is in the set, every day is in the empty set
+func (w Weekdays) Has(d time.Weekday) bool {
+	return w == 0 || w&(1<<uint(d)) != 0
+}
+
+// Contains reports whether d was added to the set, unlike Has it is false for every day of the empty set
+func (w Weekdays) Contains(d time.Weekday) bool {
+	return w&(1<<uint(d)) != 0
+}
+
+// String lists the days of the set like "Fri, Sat", the empty set is "any day"
+func (w Weekdays) String() string {
+	if w == 0 {
+		return "any day"
+	}
+	var s string
+	for _, d := range AllWeekdays {
+		if w.Contains(d) {
+			if s != "" {
+				s += ", "
+			}
+			s += d.String()[:3]
+		}
+	}
+	return s
+}
+
+// BookingRule limits the stays guests can book. It applies to the room RoomID, or to every room when RoomID is 0,
+// and to arrivals from Start to End, a season, where a zero Start or End leaves that side open. Limits of 0 and
+// empty sets of days are not enforced
+type BookingRule struct {
+	ID   int
+	Name string
+	// PropertyID is the property of the rule, a rule of a room has the property of the room
+	PropertyID int
+	// RoomID is the room of the rule, 0 for every room of the property
+	RoomID int
+	Start  dates.Date
+	End    dates.Date
+	// MinNights and MaxNights limit the length of the stay
+	MinNights int
+	MaxNights int
+	// MinNotice is the notice in days a stay must at least be booked with, MaxAdvance the booking horizon, how many
+	// days ahead of arrival it can be booked at most
+	MinNotice  int
+	MaxAdvance int
+	// ArrivalDays and DepartureDays are the days of the week guests can arrive and leave on
+	ArrivalDays   Weekdays
+	DepartureDays Weekdays
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	// Room holds the name of the room of the rule
+	Room Room
+}
+
+// Applies reports whether the rule is about a stay in room arriving on arrival
+func (r BookingRule) Applies(room Room, arrival dates.Date) bool {
+	if r.RoomID != 0 && r.RoomID != room.ID {
+		return false
+	}
+	if r.RoomID == 0 && r.PropertyID != room.PropertyID {
+		return false
+	}
+	if !r.Start.IsZero() && arrival.Before(r.Start) {
+		return false
+	}
+	if !r.End.IsZero() && arrival.After(r.End) {
+		return false
+	}
+	return true
 }
@@ -9,9 +9,18 @@ type TemplateData struct {
 	FloatMap        map[string]float32
 	Data            map[string]interface{}
 	CSRFToken       string
+	CSPNonce        string
 	Flash           string
 	Warning         string
 	Error           string
 	Form            *forms.Form
 	IsAuthenticated int
+	IsGuest         int
+	AccessLevel     int
+	// Scoped is set for staff users who manage some of the properties only
+	Scoped bool
+	// DatePickerFormat is the format of the date picker, matching the date input format of the property
+	DatePickerFormat string
+	// Property is the property whose site the page belongs to
+	Property Property
 }
@@ -0,0 +1,107 @@
+// Package ratelimit limits how often a key, e.g. a client IP address, may make requests with token buckets
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepThreshold is the number of tracked keys above which full buckets are dropped
+const sweepThreshold = 10000
+
+// Policy describes the bucket of every key
+type Policy struct {
+	// Rate is the number of requests allowed per Per on average
+	Rate int
+	// Per is the period Rate is counted over
+	Per time.Duration
+	// Burst is the number of requests a key may make at once, it is the size of the bucket
+	Burst int
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter keeps a token bucket per key in memory, it is safe for concurrent use
+type Limiter struct {
+	policy Policy
+	now    func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+// New creates a limiter applying p
+func New(p Policy) *Limiter {
+	if p.Rate < 1 {
+		p.Rate = 1
+	}
+	if p.Burst < 1 {
+		p.Burst = 1
+	}
+
+	return &Limiter{
+		policy:  p,
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Allow takes a token from the bucket of key, when the bucket is empty it returns false
+// and how long key has to wait for the next token
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= sweepThreshold {
+			l.sweep(now)
+		}
+		b = &bucket{tokens: float64(l.policy.Burst), last: now}
+		l.buckets[key] = b
+	}
+	l.refill(b, now)
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	return false, time.Duration(math.Ceil((1 - b.tokens) * float64(l.perToken())))
+}
+
+// perToken returns how long it takes to add one token to a bucket
+func (l *Limiter) perToken() time.Duration {
+	return l.policy.Per / time.Duration(l.policy.Rate)
+}
+
+// refill adds the tokens earned since the last request of b, the caller holds the lock
+func (l *Limiter) refill(b *bucket, now time.Time) {
+	elapsed := now.Sub(b.last)
+	if elapsed <= 0 {
+		return
+	}
+	b.last = now
+
+	perToken := l.perToken()
+	if perToken <= 0 {
+		b.tokens = float64(l.policy.Burst)
+		return
+	}
+	b.tokens = math.Min(float64(l.policy.Burst), b.tokens+float64(elapsed)/float64(perToken))
+}
+
+// sweep drops the buckets that have filled up again, the caller holds the lock
+func (l *Limiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		l.refill(b, now)
+		if b.tokens >= float64(l.policy.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	l := New(Policy{
+		Rate:  6,
+		Per:   time.Minute,
+		Burst: 3,
+	})
+	l.now = func() time.Time { return now }
+
+	var tableTest = []struct {
+		name          string
+		advance       time.Duration
+		expectedOK    bool
+		expectedRetry time.Duration
+	}{
+		{"first request", 0, true, 0},
+		{"second request", 0, true, 0},
+		{"last of the burst", 0, true, 0},
+		{"empty bucket", 0, false, 10 * time.Second},
+		{"partly refilled", 4 * time.Second, false, 6 * time.Second},
+		{"refilled token", 6 * time.Second, true, 0},
+		{"empty again", 0, false, 10 * time.Second},
+		{"full bucket", time.Hour, true, 0},
+		{"burst after a pause", 0, true, 0},
+		{"last of the new burst", 0, true, 0},
+		{"burst is capped", 0, false, 10 * time.Second},
+	}
+
+	for _, test := range tableTest {
+		now = now.Add(test.advance)
+
+		ok, retry := l.Allow("192.0.2.1")
+		if ok != test.expectedOK {
+			t.Errorf("case - %s: expected allowed %t but got %t", test.name, test.expectedOK, ok)
+		}
+		if retry != test.expectedRetry {
+			t.Errorf("case - %s: expected retry after %s but got %s", test.name, test.expectedRetry, retry)
+		}
+	}
+
+	if ok, _ := l.Allow("192.0.2.2"); !ok {
+		t.Error("expected other keys to have their own bucket")
+	}
+}
+
+func TestLimiter_Sweep(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	l := New(Policy{Rate: 1, Per: time.Second, Burst: 1})
+	l.now = func() time.Time { return now }
+
+	l.Allow("idle")
+	now = now.Add(time.Minute)
+	l.Allow("busy")
+	l.sweep(now)
+
+	if _, ok := l.buckets["idle"]; ok {
+		t.Error("expected the full bucket of an idle key to be dropped")
+	}
+	if _, ok := l.buckets["busy"]; !ok {
+		t.Error("expected the bucket of a busy key to be kept")
+	}
+}
@@ -7,9 +7,9 @@ import (
 	"html/template"
 	"net/http"
 	"path/filepath"
-	"time"
 
 	"github.com/adewidyatamadb/GoBookings/internal/config"
+	"github.com/adewidyatamadb/GoBookings/internal/helpers"
 	"github.com/adewidyatamadb/GoBookings/internal/models"
 	"github.com/justinas/nosurf"
 )
@@ -20,6 +20,7 @@ var functions = template.FuncMap{
 	"formatDate": FormatDate,
 	"iterate":    Iterate,
 	"add":        Add,
+	"percent":    Percent,
 }
 
 var app *config.AppConfig
@@ -44,26 +45,54 @@ func NewRenderer(a *config.AppConfig) {
 	app = a
 }
 
-// HumanDate returns readable date
-func HumanDate(t time.Time) string {
-	return t.Format("02-Jan-2006")
+// dateFormatter is a time.Time or a dates.Date
+type dateFormatter interface {
+	Format(layout string) string
 }
 
-func ValueDate(t time.Time) string {
-	return t.Format("02-01-2006")
+// HumanDate returns a date the way the property writes dates
+func HumanDate(t dateFormatter) string {
+	if app == nil || app.DateFormat == "" {
+		return t.Format(config.DefaultDateFormat)
+	}
+	return t.Format(app.DateFormat)
+}
+
+// ValueDate returns a date the way it is typed into forms
+func ValueDate(t dateFormatter) string {
+	if app == nil || app.DateInputFormat == "" {
+		return t.Format(config.DefaultDateInputFormat)
+	}
+	return t.Format(app.DateInputFormat)
 }
 
-func FormatDate(t time.Time, f string) string {
+func FormatDate(t dateFormatter, f string) string {
 	return t.Format(f)
 }
 
+// Percent returns a rate between 0 and 1 as a percentage with one decimal
+func Percent(rate float64) string {
+	return fmt.Sprintf("%.1f%%", rate*100)
+}
+
 func AddDefaultData(td *models.TemplateData, r *http.Request) *models.TemplateData {
 	td.Flash = app.Session.PopString(r.Context(), "flash")
 	td.Error = app.Session.PopString(r.Context(), "error")
 	td.Warning = app.Session.PopString(r.Context(), "warning")
 	td.CSRFToken = nosurf.Token(r)
+	td.CSPNonce = helpers.CSPNonce(r)
+	td.Property = helpers.Property(r)
+	td.DatePickerFormat = app.DatePickerFormat
+	if td.DatePickerFormat == "" {
+		td.DatePickerFormat = config.DefaultDatePickerFormat
+	}
 	if app.Session.Exists(r.Context(), "user_id") {
 		td.IsAuthenticated = 1
+		td.AccessLevel = app.Session.GetInt(r.Context(), "access_level")
+		td.Scoped = app.Session.GetBool(r.Context(), "scoped")
+	}
+	if app.Session.Exists(r.Context(), "guest_id") {
+		td.IsGuest = 1
 	}
 	return td
 }
@@ -4,6 +4,8 @@ import (
 	"net/http"
 	"testing"
 
+	"github.com/adewidyatamadb/GoBookings/internal/dates"
+	"github.com/adewidyatamadb/GoBookings/internal/helpers"
 	"github.com/adewidyatamadb/GoBookings/internal/models"
 )
 
@@ -16,10 +18,18 @@ func TestAddDefaultData(t *testing.T) {
 
 	session.Put(r.Context(), "flash", "123")
 
+	r, err = helpers.WithCSPNonce(r)
+	if err != nil {
+		t.Error(err)
+	}
+
 	result := AddDefaultData(&td, r)
 	if result.Flash != "123" {
 		t.Error("flash value of 123 not found in session")
 	}
+	if result.CSPNonce == "" || result.CSPNonce != helpers.CSPNonce(r) {
+		t.Error("nonce of the request not found in template data")
+	}
 
 }
 
@@ -74,3 +84,26 @@ func TestCreateTemplateCache(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestHumanDate(t *testing.T) {
+	d := dates.New(2021, 10, 19)
+	defer func(format, input string) {
+		testApp.DateFormat, testApp.DateInputFormat = format, input
+	}(testApp.DateFormat, testApp.DateInputFormat)
+
+	testApp.DateFormat, testApp.DateInputFormat = "", ""
+	if got := HumanDate(d); got != "19-Oct-2021" {
+		t.Errorf("expected the default format but got %s", got)
+	}
+	if got := ValueDate(d); got != "19-10-2021" {
+		t.Errorf("expected the default input format but got %s", got)
+	}
+
+	testApp.DateFormat, testApp.DateInputFormat = "January 2, 2006", "01/02/2006"
+	if got := HumanDate(d); got != "October 19, 2021" {
+		t.Errorf("expected the configured format but got %s", got)
+	}
+	if got := ValueDate(d); got != "10/19/2021" {
+		t.Errorf("expected the configured input format but got %s", got)
+	}
+}
@@ -1,31 +1,456 @@
 package dbrepo
 
 import (
+	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/adewidyatamadb/GoBookings/internal/config"
+	"github.com/adewidyatamadb/GoBookings/internal/dates"
+	"github.com/adewidyatamadb/GoBookings/internal/models"
 	"github.com/adewidyatamadb/GoBookings/internal/repository"
+	"golang.org/x/crypto/bcrypt"
 )
 
-type postgresDBRepo struct {
+// memoryDBRepo keeps all data in maps guarded by a mutex
+type memoryDBRepo struct {
 	App *config.AppConfig
-	DB  *sql.DB
+
+	mu                    sync.RWMutex
+	rooms                 map[int]models.Room
+	restrictions          map[int]models.Restriction
+	users                 map[int]models.User
+	reservations          map[int]models.Reservation
+	roomRestrictions      map[int]models.RoomRestriction
+	recoveryCodes         map[int]map[string]bool
+	totpCounters          map[int]int64
+	sessions              map[string]models.Session
+	guests                map[int]models.Guest
+	jobLocks              map[string]memoryJobLock
+	jobRuns               map[int]models.JobRun
+	guestMails            map[int]models.GuestMail
+	webhooks              map[int]models.Webhook
+	webhookDeliveries     map[int]models.WebhookDelivery
+	bookingRules          map[int]models.BookingRule
+	properties            map[int]models.Property
+	userProperties        map[int][]int
+	lastRoomID            int
+	lastRestrictionID     int
+	lastUserID            int
+	lastReservationID     int
+	lastRoomRestrictionID int
+	lastSessionID         int
+	lastGuestID           int
+	lastJobRunID          int
+	lastGuestMailID       int
+	lastWebhookID         int
+	lastDeliveryID        int
+	lastBookingRuleID     int
+	lastPropertyID        int
 }
 
-type testDBRepo struct {
-	App *config.AppConfig
-	DB  *sql.DB
+// memoryJobLock is the lock of a scheduled job kept by the in-memory repository
+type memoryJobLock struct {
+	owner        string
+	scheduledFor time.Time
+	lockedUntil  time.Time
 }
 
-func NewPostgresRepo(conn *sql.DB, a *config.AppConfig) repository.DatabaseRepo {
-	return &postgresDBRepo{
+// Credentials of the administrator seeded into the in-memory repository
+const (
+	MemoryAdminEmail    = "admin@admin.com"
+	MemoryAdminPassword = "password"
+)
+
+// NewMemoryRepo creates an in-memory repository seeded with the default rooms, restrictions and administrator
+func NewMemoryRepo(a *config.AppConfig) repository.DatabaseRepo {
+	m := &memoryDBRepo{
 		App: a,
-		DB:  conn,
 	}
+	m.seed()
+
+	return m
 }
 
-func NewTestingRepo(a *config.AppConfig) repository.DatabaseRepo {
-	return &testDBRepo{
-		App: a,
+// defaultQueryTimeout is used when the app config does not set a query timeout
+const defaultQueryTimeout = 3 * time.Second
+
+// scanUser scans a users row selected with all columns, mapping errors with mapErr
+func scanUser(row *sql.Row, mapErr func(error) error) (models.User, error) {
+	var u models.User
+	var lockedUntil sql.NullTime
+	err := row.Scan(
+		&u.ID,
+		&u.FirstName,
+		&u.LastName,
+		&u.Email,
+		&u.Password,
+		&u.AccessLevel,
+		&u.Active,
+		&u.MustChangePassword,
+		&u.SessionVersion,
+		&u.FailedLogins,
+		&lockedUntil,
+		&u.TOTPSecret,
+		&u.TOTPEnabled,
+		&u.CreatedAt,
+		&u.UpdatedAt,
+	)
+	if err != nil {
+		return u, mapErr(err)
+	}
+	u.LockedUntil = lockedUntil.Time
+
+	return u, nil
+}
+
+// rowScanner is a *sql.Row or *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// guestColumns are the columns scanGuest expects, in order
+const guestColumns = "id, first_name, last_name, email, phone, password, pending_password, email_verified, notes, tags, created_at, updated_at"
+
+// scanGuest scans a guests row selected with guestColumns, followed by extra, mapping errors with mapErr
+func scanGuest(row rowScanner, mapErr func(error) error, extra ...interface{}) (models.Guest, error) {
+	var g models.Guest
+	var tags string
+	dest := []interface{}{
+		&g.ID,
+		&g.FirstName,
+		&g.LastName,
+		&g.Email,
+		&g.Phone,
+		&g.Password,
+		&g.PendingPassword,
+		&g.EmailVerified,
+		&g.Notes,
+		&tags,
+		&g.CreatedAt,
+		&g.UpdatedAt,
+	}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return g, mapErr(err)
+	}
+	g.Tags = splitTags(tags)
+
+	return g, nil
+}
+
+// phoneKey returns the digits of a phone number, guests are matched on it regardless of formatting
+func phoneKey(phone string) string {
+	var b strings.Builder
+	for _, r := range phone {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// joinTags returns the stored form of guest tags
+func joinTags(tags []string) string {
+	return strings.Join(tags, ",")
+}
+
+// splitTags parses stored guest tags
+func splitTags(tags string) []string {
+	if tags == "" {
+		return nil
+	}
+	return strings.Split(tags, ",")
+}
+
+// mergeGuest returns keep with the notes, tags and phone number of duplicate added, the email
+// address of duplicate is kept in the notes since a guest has a single address
+func mergeGuest(keep, duplicate models.Guest) models.Guest {
+	notes := []string{}
+	if keep.Notes != "" {
+		notes = append(notes, keep.Notes)
+	}
+	if duplicate.Notes != "" {
+		notes = append(notes, duplicate.Notes)
+	}
+	notes = append(notes, "Merged with the profile of "+duplicate.Email)
+	keep.Notes = strings.Join(notes, "\n\n")
+
+	tags := append([]string{}, keep.Tags...)
+	for _, t := range duplicate.Tags {
+		if !keep.HasTag(t) {
+			tags = append(tags, t)
+		}
+	}
+	keep.Tags = tags
+
+	if keep.Phone == "" {
+		keep.Phone = duplicate.Phone
+	}
+
+	return keep
+}
+
+// guestSearch returns the patterns AllGuests matches names and email addresses, and phone numbers with
+func guestSearch(search string) (text, phone string) {
+	search = strings.ToLower(strings.TrimSpace(search))
+	if search == "" {
+		return "", ""
+	}
+	text = "%" + search + "%"
+	if digits := phoneKey(search); digits != "" {
+		phone = "%" + digits + "%"
+	}
+	return text, phone
+}
+
+// nullID stores a zero id as NULL, for optional foreign keys
+func nullID(id int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(id), Valid: id != 0}
+}
+
+// nullTime stores a zero time as NULL, for optional timestamps
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// userPropertyIDs returns the ids of the properties of user userID, selected with query
+func userPropertyIDs(ctx context.Context, db *sql.DB, query string, userID int) ([]int, error) {
+	rows, err := db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// propertyColumns are the columns scanProperty expects, in order
+const propertyColumns = `id, name, slug, host, time_zone, currency, mail_from, owner_email, description, created_at, updated_at`
+
+// scanProperty scans a properties row selected with propertyColumns, mapping errors with mapErr
+func scanProperty(row rowScanner, mapErr func(error) error) (models.Property, error) {
+	var p models.Property
+	err := row.Scan(
+		&p.ID,
+		&p.Name,
+		&p.Slug,
+		&p.Host,
+		&p.TimeZone,
+		&p.Currency,
+		&p.MailFrom,
+		&p.OwnerEmail,
+		&p.Description,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+	)
+	if err != nil {
+		return p, mapErr(err)
+	}
+
+	return p, nil
+}
+
+// nullDate stores a zero date as NULL, for optional dates
+func nullDate(d dates.Date) interface{} {
+	if d.IsZero() {
+		return nil
+	}
+	return d
+}
+
+// bookingRuleColumns are the columns scanBookingRule expects, in order, of booking_rules r left joined with rooms rm
+const bookingRuleColumns = `r.id, r.name, r.property_id, coalesce(r.room_id, 0), coalesce(rm.room_name, ''), r.start_date, r.end_date,
+	r.min_nights, r.max_nights, r.min_notice, r.max_advance, r.arrival_days, r.departure_days, r.created_at, r.updated_at`
+
+// scanBookingRule scans a booking_rules row selected with bookingRuleColumns, mapping errors with mapErr
+func scanBookingRule(row rowScanner, mapErr func(error) error) (models.BookingRule, error) {
+	var rule models.BookingRule
+	err := row.Scan(
+		&rule.ID,
+		&rule.Name,
+		&rule.PropertyID,
+		&rule.RoomID,
+		&rule.Room.RoomName,
+		&rule.Start,
+		&rule.End,
+		&rule.MinNights,
+		&rule.MaxNights,
+		&rule.MinNotice,
+		&rule.MaxAdvance,
+		&rule.ArrivalDays,
+		&rule.DepartureDays,
+		&rule.CreatedAt,
+		&rule.UpdatedAt,
+	)
+	if err != nil {
+		return rule, mapErr(err)
 	}
+	rule.Room.ID = rule.RoomID
+
+	return rule, nil
+}
+
+// guestMailColumn returns the reservation date a kind of guest email is scheduled from
+func guestMailColumn(kind string) (string, error) {
+	switch kind {
+	case models.GuestMailPreArrival:
+		return "start_date", nil
+	case models.GuestMailCheckOut, models.GuestMailPostStay:
+		return "end_date", nil
+	}
+	return "", fmt.Errorf("unknown guest mail %q", kind)
+}
+
+// leadTimeBuckets returns the empty buckets of the lead time distribution
+func leadTimeBuckets() []models.LeadTime {
+	return []models.LeadTime{
+		{Label: "Same day", Min: 0, Max: 0},
+		{Label: "1-7 days", Min: 1, Max: 7},
+		{Label: "8-30 days", Min: 8, Max: 30},
+		{Label: "31-90 days", Min: 31, Max: 90},
+		{Label: "Over 90 days", Min: 91, Max: -1},
+	}
+}
+
+// dashboardStats computes the dashboard figures for the nights from start to end, reservations can
+// hold more than the ones that count, those outside the range or booked earlier are left out here. Today is
+// the day of now in its location, the time zone of the property. Only the rooms roomIDs count, all of them
+// when it is nil
+func dashboardStats(rooms []models.Room, reservations []models.Reservation, start, end dates.Date, now time.Time, roomIDs []int) models.DashboardStats {
+	if roomIDs != nil {
+		counted := make(map[int]bool, len(roomIDs))
+		for _, id := range roomIDs {
+			counted[id] = true
+		}
+
+		var scopedRooms []models.Room
+		for _, room := range rooms {
+			if counted[room.ID] {
+				scopedRooms = append(scopedRooms, room)
+			}
+		}
+		var scopedReservations []models.Reservation
+		for _, res := range reservations {
+			if counted[res.RoomID] {
+				scopedReservations = append(scopedReservations, res)
+			}
+		}
+		rooms, reservations = scopedRooms, scopedReservations
+	}
+
+	today := dates.Of(now)
+	nights := start.DaysUntil(end) + 1
+
+	stats := models.DashboardStats{
+		Start:     start,
+		End:       end,
+		LeadTimes: leadTimeBuckets(),
+	}
+
+	booked := make(map[int]int)
+	for _, res := range reservations {
+		arrival, departure := res.StartDate, res.EndDate
+
+		first, last := arrival, departure
+		if first.Before(start) {
+			first = start
+		}
+		if last.After(end.AddDays(1)) {
+			last = end.AddDays(1)
+		}
+		if n := first.DaysUntil(last); n > 0 {
+			booked[res.RoomID] += n
+		}
+
+		if arrival.Equal(today) {
+			stats.Arrivals++
+		}
+		if departure.Equal(today) {
+			stats.Departures++
+		}
+
+		if age := now.Sub(res.CreatedAt); age >= 0 && age < 30*24*time.Hour {
+			stats.PickUp30++
+			if age < 7*24*time.Hour {
+				stats.PickUp7++
+			}
+		}
+
+		if arrival.Before(start) || arrival.After(end) {
+			continue
+		}
+		lead := dates.Of(res.CreatedAt.In(now.Location())).DaysUntil(arrival)
+		if lead < 0 {
+			lead = 0
+		}
+		for i := range stats.LeadTimes {
+			if lt := &stats.LeadTimes[i]; lead >= lt.Min && (lt.Max < 0 || lead <= lt.Max) {
+				lt.Count++
+				break
+			}
+		}
+	}
+
+	for _, room := range rooms {
+		o := models.Occupancy{Room: room, Booked: booked[room.ID], Nights: nights}
+		stats.Rooms = append(stats.Rooms, o)
+		stats.Total.Booked += o.Booked
+		stats.Total.Nights += o.Nights
+	}
+
+	return stats
+}
+
+// PasswordCost is the bcrypt cost of stored passwords, it matches the seeded admin user. Tests lower it
+var PasswordCost = 12
+
+// dummyPasswordHash is compared against when Authenticate does not know the email,
+// so unknown emails take as long as wrong passwords
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("dummy password"), PasswordCost)
+	return hash
+})
+
+// queryTimeout returns the per-query timeout layered on top of the request context
+func queryTimeout(a *config.AppConfig) time.Duration {
+	if a == nil || a.QueryTimeout <= 0 {
+		return defaultQueryTimeout
+	}
+	return a.QueryTimeout
+}
+
+// rowAffected returns repository.ErrNotFound when a write did not match any row
+func rowAffected(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return repository.ErrNotFound
+	}
+
+	return nil
+}
+
+// hashRecoveryCode returns the stored form of a two-factor recovery code, the codes
+// are random enough for a fast hash and are compared without spaces, dashes or case
+func hashRecoveryCode(code string) string {
+	code = strings.ToUpper(strings.NewReplacer(" ", "", "-", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
 }
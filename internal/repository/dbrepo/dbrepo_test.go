@@ -0,0 +1,61 @@
+package dbrepo
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/adewidyatamadb/GoBookings/internal/config"
+	"github.com/adewidyatamadb/GoBookings/internal/driver"
+	"github.com/adewidyatamadb/GoBookings/internal/repository"
+	"github.com/adewidyatamadb/GoBookings/internal/repository/repotest"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// defaultPostgresDSN is the local development database, override it with BOOKINGS_TEST_DSN
+const defaultPostgresDSN = "host=localhost port=5432 dbname=bookings user=postgres password=root"
+
+func init() {
+	// hashing at the stored password cost makes the conformance runs crawl under the race detector
+	PasswordCost = bcrypt.MinCost
+}
+
+// testConfig gives queries more time than the default, the sqlite repository waits for its single connection
+func testConfig() *config.AppConfig {
+	return &config.AppConfig{QueryTimeout: time.Minute}
+}
+
+func TestSQLiteRepo(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repository.DatabaseRepo {
+		db, err := driver.ConnectSQLite(t.TempDir() + "/bookings.db")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.SQL.Close() })
+
+		return NewSQLiteRepo(db.SQL, testConfig())
+	})
+}
+
+func TestMemoryRepo(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repository.DatabaseRepo {
+		return NewMemoryRepo(testConfig())
+	})
+}
+
+func TestPostgresRepo(t *testing.T) {
+	dsn := os.Getenv("BOOKINGS_TEST_DSN")
+	if dsn == "" {
+		dsn = defaultPostgresDSN
+	}
+
+	conn, err := driver.NewDatabase(dsn)
+	if err != nil {
+		t.Skipf("no postgres instance available: %v", err)
+	}
+	defer conn.Close()
+
+	repotest.Run(t, func(t *testing.T) repository.DatabaseRepo {
+		return NewPostgresRepo(conn, testConfig())
+	})
+}
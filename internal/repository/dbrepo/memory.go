@@ -0,0 +1,2138 @@
+package dbrepo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adewidyatamadb/GoBookings/internal/dates"
+	"github.com/adewidyatamadb/GoBookings/internal/models"
+	"github.com/adewidyatamadb/GoBookings/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// seed loads the same fixtures the migrations put into a new database
+func (m *memoryDBRepo) seed() {
+	m.rooms = map[int]models.Room{}
+	m.restrictions = map[int]models.Restriction{}
+	m.users = map[int]models.User{}
+	m.reservations = map[int]models.Reservation{}
+	m.roomRestrictions = map[int]models.RoomRestriction{}
+	m.recoveryCodes = map[int]map[string]bool{}
+	m.totpCounters = map[int]int64{}
+	m.sessions = map[string]models.Session{}
+	m.guests = map[int]models.Guest{}
+	m.jobLocks = map[string]memoryJobLock{}
+	m.jobRuns = map[int]models.JobRun{}
+	m.guestMails = map[int]models.GuestMail{}
+	m.webhooks = map[int]models.Webhook{}
+	m.webhookDeliveries = map[int]models.WebhookDelivery{}
+	m.bookingRules = map[int]models.BookingRule{}
+	m.properties = map[int]models.Property{}
+	m.userProperties = map[int][]int{}
+
+	m.lastPropertyID++
+	m.properties[m.lastPropertyID] = models.Property{
+		ID:          m.lastPropertyID,
+		Name:        "Fort Smythe Bed and Breakfast",
+		Slug:        "fort-smythe",
+		Currency:    "USD",
+		MailFrom:    "fort@smythe.com",
+		OwnerEmail:  "me@here.com",
+		Description: "Your home away from home, set on the majestic waters of the Atlantic Ocean, this will be a vacation to remember.",
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+
+	for _, name := range []string{"General's Quarters", "Major's Suite"} {
+		m.lastRoomID++
+		m.rooms[m.lastRoomID] = models.Room{ID: m.lastRoomID, RoomName: name, CreatedAt: time.Now(), UpdatedAt: time.Now(), PropertyID: m.lastPropertyID}
+	}
+
+	for _, name := range []string{"Reservation", "Owner Block"} {
+		m.lastRestrictionID++
+		m.restrictions[m.lastRestrictionID] = models.Restriction{ID: m.lastRestrictionID, RestrictionName: name, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	}
+
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte(MemoryAdminPassword), PasswordCost)
+	m.lastUserID++
+	m.users[m.lastUserID] = models.User{
+		ID:          m.lastUserID,
+		FirstName:   "Admin",
+		LastName:    "Fortnight",
+		Email:       MemoryAdminEmail,
+		Password:    string(hashedPassword),
+		AccessLevel: models.AccessLevelAdmin,
+		Active:      true,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+}
+
+// InsertReservation insert a reservation into memory
+func (m *memoryDBRepo) InsertReservation(ctx context.Context, res models.Reservation) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.rooms[res.RoomID]; !ok {
+		return 0, fmt.Errorf("%w: room %d does not exist", repository.ErrConstraint, res.RoomID)
+	}
+
+	if _, ok := m.guests[res.GuestID]; res.GuestID != 0 && !ok {
+		return 0, fmt.Errorf("%w: guest %d does not exist", repository.ErrConstraint, res.GuestID)
+	}
+
+	m.lastReservationID++
+	res.ID = m.lastReservationID
+	res.Room = models.Room{}
+	res.Processed = 0
+	res.CreatedAt = time.Now()
+	res.UpdatedAt = time.Now()
+	m.reservations[res.ID] = res
+
+	return res.ID, nil
+}
+
+// InsertRoomRestriction inserts a room restriction into memory, it returns
+// repository.ErrUnavailable when the room is already restricted for some of the dates
+func (m *memoryDBRepo) InsertRoomRestriction(ctx context.Context, res models.RoomRestriction) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.rooms[res.RoomID]; !ok {
+		return fmt.Errorf("%w: room %d does not exist", repository.ErrConstraint, res.RoomID)
+	}
+	if _, ok := m.restrictions[res.RestrictionID]; !ok {
+		return fmt.Errorf("%w: restriction %d does not exist", repository.ErrConstraint, res.RestrictionID)
+	}
+	if _, ok := m.reservations[res.ReservationID]; res.ReservationID != 0 && !ok {
+		return fmt.Errorf("%w: reservation %d does not exist", repository.ErrConstraint, res.ReservationID)
+	}
+	if !m.roomAvailable(res.RoomID, res.StartDate, res.EndDate) {
+		return repository.ErrUnavailable
+	}
+
+	m.lastRoomRestrictionID++
+	m.roomRestrictions[m.lastRoomRestrictionID] = models.RoomRestriction{
+		ID:            m.lastRoomRestrictionID,
+		StartDate:     res.StartDate,
+		EndDate:       res.EndDate,
+		RoomID:        res.RoomID,
+		ReservationID: res.ReservationID,
+		RestrictionID: res.RestrictionID,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+	}
+
+	return nil
+}
+
+// roomAvailable reports whether no restriction of a room overlaps the stay, the caller holds the lock
+func (m *memoryDBRepo) roomAvailable(roomID int, start, end dates.Date) bool {
+	for _, rr := range m.roomRestrictions {
+		if rr.RoomID == roomID && start.Before(rr.EndDate) && end.After(rr.StartDate) {
+			return false
+		}
+	}
+	return true
+}
+
+// SearchAvailabilityByDatesByRoomID returns true if room available and return false if room is not available
+func (m *memoryDBRepo) SearchAvailabilityByDatesByRoomID(ctx context.Context, start, end dates.Date, roomID int) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.roomAvailable(roomID, start, end), nil
+}
+
+// SearchAvailabilityForAllRooms returns a slice of available rooms if any for given date range
+func (m *memoryDBRepo) SearchAvailabilityForAllRooms(ctx context.Context, start, end dates.Date) ([]models.Room, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var rooms []models.Room
+	for _, room := range m.rooms {
+		if m.roomAvailable(room.ID, start, end) {
+			rooms = append(rooms, models.Room{ID: room.ID, RoomName: room.RoomName, PropertyID: room.PropertyID})
+		}
+	}
+
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].ID < rooms[j].ID })
+
+	return rooms, nil
+}
+
+// GetRoomByID get a room by id
+func (m *memoryDBRepo) GetRoomByID(ctx context.Context, id int) (models.Room, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Room{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	room, ok := m.rooms[id]
+	if !ok {
+		return room, repository.ErrNotFound
+	}
+
+	return room, nil
+}
+
+// GetUserByID retrieve user data using id
+func (m *memoryDBRepo) GetUserByID(ctx context.Context, id int) (models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return models.User{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	u, ok := m.users[id]
+	if !ok {
+		return u, repository.ErrNotFound
+	}
+	u.PropertyIDs = append([]int(nil), m.userProperties[id]...)
+
+	return u, nil
+}
+
+// GetUserByEmail retrieve user data using the email address
+func (m *memoryDBRepo) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return models.User{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, u := range m.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+
+	return models.User{}, repository.ErrNotFound
+}
+
+// UpdateUser update user data
+func (m *memoryDBRepo) UpdateUser(ctx context.Context, u models.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current, ok := m.users[u.ID]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	if m.emailTaken(u.Email, u.ID) {
+		return fmt.Errorf("%w: email %s is already used", repository.ErrConstraint, u.Email)
+	}
+
+	current.FirstName = u.FirstName
+	current.LastName = u.LastName
+	current.Email = u.Email
+	current.AccessLevel = u.AccessLevel
+	current.Active = u.Active
+	current.MustChangePassword = u.MustChangePassword
+	current.UpdatedAt = time.Now()
+	m.users[u.ID] = current
+
+	return nil
+}
+
+// Authentice authenticates a user
+func (m *memoryDBRepo) Authenticate(ctx context.Context, email, testPassword string) (int, string, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, "", err
+	}
+
+	m.mu.RLock()
+	var found *models.User
+	for _, u := range m.users {
+		if u.Email == email {
+			u := u
+			found = &u
+			break
+		}
+	}
+	m.mu.RUnlock()
+
+	if found == nil {
+		_ = bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(testPassword))
+		return 0, "", repository.ErrInvalidCredentials
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(found.Password), []byte(testPassword))
+	if found.Locked() {
+		return 0, "", repository.ErrLocked
+	}
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return 0, "", repository.ErrInvalidCredentials
+	} else if err != nil {
+		return 0, "", err
+	}
+
+	if !found.Active {
+		return 0, "", repository.ErrDisabled
+	}
+
+	return found.ID, found.Password, nil
+}
+
+// RecordFailedLogin counts a failed login for the user with the given email and returns the updated user
+func (m *memoryDBRepo) RecordFailedLogin(ctx context.Context, email string) (models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return models.User{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, u := range m.users {
+		if u.Email == email {
+			u.FailedLogins++
+			m.users[id] = u
+			return u, nil
+		}
+	}
+
+	return models.User{}, repository.ErrNotFound
+}
+
+// LockUser locks a user out until the given time and starts counting failed logins over
+func (m *memoryDBRepo) LockUser(ctx context.Context, id int, until time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[id]
+	if !ok {
+		return repository.ErrNotFound
+	}
+
+	u.FailedLogins = 0
+	u.LockedUntil = until
+	m.users[id] = u
+
+	return nil
+}
+
+// UnlockUser lifts a lockout and clears the failed logins of a user
+func (m *memoryDBRepo) UnlockUser(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[id]
+	if !ok {
+		return repository.ErrNotFound
+	}
+
+	u.FailedLogins = 0
+	u.LockedUntil = time.Time{}
+	m.users[id] = u
+
+	return nil
+}
+
+// EnableTOTP turns on two-factor authentication for a user and replaces the user's recovery codes
+func (m *memoryDBRepo) EnableTOTP(ctx context.Context, id int, secret string, recoveryCodes []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[id]
+	if !ok {
+		return repository.ErrNotFound
+	}
+
+	u.TOTPSecret = secret
+	u.TOTPEnabled = true
+	u.UpdatedAt = time.Now()
+	m.users[id] = u
+	delete(m.totpCounters, id)
+
+	// the value tells whether the code has been used
+	codes := make(map[string]bool)
+	for _, code := range recoveryCodes {
+		codes[hashRecoveryCode(code)] = false
+	}
+	m.recoveryCodes[id] = codes
+
+	return nil
+}
+
+// DisableTOTP turns off two-factor authentication for a user and deletes the user's recovery codes
+func (m *memoryDBRepo) DisableTOTP(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[id]
+	if !ok {
+		return repository.ErrNotFound
+	}
+
+	u.TOTPSecret = ""
+	u.TOTPEnabled = false
+	u.UpdatedAt = time.Now()
+	m.users[id] = u
+	delete(m.recoveryCodes, id)
+	delete(m.totpCounters, id)
+
+	return nil
+}
+
+// UseRecoveryCode marks an unused recovery code of a user as used, it returns
+// repository.ErrInvalidCredentials when the user has no such code
+func (m *memoryDBRepo) UseRecoveryCode(ctx context.Context, id int, code string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	hash := hashRecoveryCode(code)
+	used, ok := m.recoveryCodes[id][hash]
+	if !ok || used {
+		return repository.ErrInvalidCredentials
+	}
+	m.recoveryCodes[id][hash] = true
+
+	return nil
+}
+
+// UseTOTPCounter records counter as the period of the last authentication code a user logged in with, it
+// returns repository.ErrInvalidCredentials when a code of that period or a later one was used before
+func (m *memoryDBRepo) UseTOTPCounter(ctx context.Context, id int, counter int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[id]; !ok || counter <= m.totpCounters[id] {
+		return repository.ErrInvalidCredentials
+	}
+	m.totpCounters[id] = counter
+
+	return nil
+}
+
+// emailTaken reports whether another user than id uses email, the caller holds the lock
+func (m *memoryDBRepo) emailTaken(email string, id int) bool {
+	for _, u := range m.users {
+		if u.Email == email && u.ID != id {
+			return true
+		}
+	}
+	return false
+}
+
+// AllUsers returns a slice of all users ordered by last name
+func (m *memoryDBRepo) AllUsers(ctx context.Context) ([]models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var users []models.User
+	for _, u := range m.users {
+		u.Password = ""
+		users = append(users, u)
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].LastName != users[j].LastName {
+			return users[i].LastName < users[j].LastName
+		}
+		return users[i].FirstName < users[j].FirstName
+	})
+
+	return users, nil
+}
+
+// InsertUser inserts a user with the given plain text password into memory
+func (m *memoryDBRepo) InsertUser(ctx context.Context, u models.User, password string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), PasswordCost)
+	if err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.emailTaken(u.Email, 0) {
+		return 0, fmt.Errorf("%w: email %s is already used", repository.ErrConstraint, u.Email)
+	}
+
+	m.lastUserID++
+	u.ID = m.lastUserID
+	u.Password = string(hashedPassword)
+	u.CreatedAt = time.Now()
+	u.UpdatedAt = time.Now()
+	m.users[u.ID] = u
+
+	return u.ID, nil
+}
+
+// UpdatePassword stores a new password for a user, clears a forced password change
+// and bumps the session version to log the user out everywhere
+func (m *memoryDBRepo) UpdatePassword(ctx context.Context, id int, password string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), PasswordCost)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[id]
+	if !ok {
+		return repository.ErrNotFound
+	}
+
+	u.Password = string(hashedPassword)
+	u.MustChangePassword = false
+	u.SessionVersion++
+	u.UpdatedAt = time.Now()
+	m.users[id] = u
+
+	return nil
+}
+
+// DeleteUser deletes a user by id
+func (m *memoryDBRepo) DeleteUser(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[id]; !ok {
+		return repository.ErrNotFound
+	}
+
+	delete(m.users, id)
+	delete(m.recoveryCodes, id)
+	delete(m.userProperties, id)
+
+	return nil
+}
+
+// withRoom returns the reservation joined with its room, the caller holds the lock
+func (m *memoryDBRepo) withRoom(res models.Reservation) models.Reservation {
+	room := m.rooms[res.RoomID]
+	res.Room = models.Room{ID: room.ID, RoomName: room.RoomName}
+	return res
+}
+
+// listReservations returns the reservations matching keep ordered by arrival date
+func (m *memoryDBRepo) listReservations(ctx context.Context, keep func(models.Reservation) bool) ([]models.Reservation, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var reservations []models.Reservation
+	for _, res := range m.reservations {
+		if keep(res) {
+			reservations = append(reservations, m.withRoom(res))
+		}
+	}
+
+	sort.Slice(reservations, func(i, j int) bool {
+		if reservations[i].StartDate.Equal(reservations[j].StartDate) {
+			return reservations[i].ID < reservations[j].ID
+		}
+		return reservations[i].StartDate.Before(reservations[j].StartDate)
+	})
+
+	return reservations, nil
+}
+
+// GetAllReservations returns a slice of all reservations
+func (m *memoryDBRepo) GetAllReservations(ctx context.Context) ([]models.Reservation, error) {
+	return m.listReservations(ctx, func(models.Reservation) bool { return true })
+}
+
+// GetAllNewReservations returns a slice of all reservations
+func (m *memoryDBRepo) GetAllNewReservations(ctx context.Context) ([]models.Reservation, error) {
+	return m.listReservations(ctx, func(res models.Reservation) bool { return res.Processed == 0 && !res.Pending() })
+}
+
+// GetReservationByID returns reservation by id
+func (m *memoryDBRepo) GetReservationByID(ctx context.Context, id int) (models.Reservation, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Reservation{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	res, ok := m.reservations[id]
+	if !ok {
+		return res, repository.ErrNotFound
+	}
+
+	return m.withRoom(res), nil
+}
+
+// UpdateReservation update reservation data
+func (m *memoryDBRepo) UpdateReservation(ctx context.Context, r models.Reservation) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current, ok := m.reservations[r.ID]
+	if !ok {
+		return repository.ErrNotFound
+	}
+
+	current.FirstName = r.FirstName
+	current.LastName = r.LastName
+	current.Email = r.Email
+	current.Phone = r.Phone
+	current.UpdatedAt = time.Now()
+	m.reservations[r.ID] = current
+
+	return nil
+}
+
+// DeleteReservation deletes one reservation by id together with its room restrictions
+func (m *memoryDBRepo) DeleteReservation(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.reservations[id]; !ok {
+		return repository.ErrNotFound
+	}
+
+	delete(m.reservations, id)
+	for rrID, rr := range m.roomRestrictions {
+		if rr.ReservationID == id {
+			delete(m.roomRestrictions, rrID)
+		}
+	}
+	for mailID, mail := range m.guestMails {
+		if mail.ReservationID == id {
+			delete(m.guestMails, mailID)
+		}
+	}
+
+	return nil
+}
+
+// UpdateProcessedForReservation update processed for a reservation by id
+func (m *memoryDBRepo) UpdateProcessedForReservation(ctx context.Context, id, processed int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	res, ok := m.reservations[id]
+	if !ok {
+		return repository.ErrNotFound
+	}
+
+	res.Processed = processed
+	m.reservations[id] = res
+
+	return nil
+}
+
+// ConfirmReservation confirms a reservation held until the guest confirms the email address, it returns
+// repository.ErrNotFound when the reservation is not held or the hold expired
+func (m *memoryDBRepo) ConfirmReservation(ctx context.Context, id int, now time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	res, ok := m.reservations[id]
+	if !ok || !res.HoldUntil.After(now) {
+		return repository.ErrNotFound
+	}
+
+	res.HoldUntil = time.Time{}
+	res.UpdatedAt = now
+	m.reservations[id] = res
+
+	return nil
+}
+
+// ReleaseExpiredHolds deletes the reservations whose hold expired before the guest confirmed the email
+// address, their room restrictions are deleted with them
+func (m *memoryDBRepo) ReleaseExpiredHolds(ctx context.Context, now time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := 0
+	for id, res := range m.reservations {
+		if !res.Pending() || res.HoldUntil.After(now) {
+			continue
+		}
+		delete(m.reservations, id)
+		for rrID, rr := range m.roomRestrictions {
+			if rr.ReservationID == id {
+				delete(m.roomRestrictions, rrID)
+			}
+		}
+		n++
+	}
+
+	return n, nil
+}
+
+func (m *memoryDBRepo) GetAllRooms(ctx context.Context) ([]models.Room, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var rooms []models.Room
+	for _, room := range m.rooms {
+		rooms = append(rooms, room)
+	}
+
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].RoomName < rooms[j].RoomName })
+
+	return rooms, nil
+}
+
+// GetRestrictionForRoomByDate returns restrictions for a room by date range
+func (m *memoryDBRepo) GetRestrictionForRoomByDate(ctx context.Context, roomID int, start, end dates.Date) ([]models.RoomRestriction, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var restrictions []models.RoomRestriction
+	for _, rr := range m.roomRestrictions {
+		if rr.RoomID == roomID && start.Before(rr.EndDate) && !end.Before(rr.StartDate) {
+			restrictions = append(restrictions, models.RoomRestriction{
+				ID:            rr.ID,
+				ReservationID: rr.ReservationID,
+				RestrictionID: rr.RestrictionID,
+				RoomID:        rr.RoomID,
+				StartDate:     rr.StartDate,
+				EndDate:       rr.EndDate,
+			})
+		}
+	}
+
+	sort.Slice(restrictions, func(i, j int) bool { return restrictions[i].ID < restrictions[j].ID })
+
+	return restrictions, nil
+}
+
+// InsertBlockForRoom inserts an owner block for a single night, it returns
+// repository.ErrUnavailable when the night is already restricted
+func (m *memoryDBRepo) InsertBlockForRoom(ctx context.Context, id int, startDate dates.Date) error {
+	return m.InsertRoomRestriction(ctx, models.RoomRestriction{
+		StartDate:     startDate,
+		EndDate:       startDate.AddDate(0, 0, 1),
+		RoomID:        id,
+		RestrictionID: 2,
+	})
+}
+
+// DeleteBlockByID deletes a room restriction
+func (m *memoryDBRepo) DeleteBlockByID(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.roomRestrictions[id]; !ok {
+		return repository.ErrNotFound
+	}
+
+	delete(m.roomRestrictions, id)
+
+	return nil
+}
+
+// FindSession returns the unexpired session with the given token
+func (m *memoryDBRepo) FindSession(ctx context.Context, token string) (models.Session, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Session{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	s, ok := m.sessions[token]
+	if !ok || !s.Expiry.After(time.Now()) {
+		return models.Session{}, repository.ErrNotFound
+	}
+
+	return s, nil
+}
+
+// CommitSession stores a session, replacing the data of an existing session with the same token
+func (m *memoryDBRepo) CommitSession(ctx context.Context, s models.Session) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if current, ok := m.sessions[s.Token]; ok {
+		s.ID = current.ID
+		s.CreatedAt = current.CreatedAt
+	} else {
+		m.lastSessionID++
+		s.ID = m.lastSessionID
+		s.CreatedAt = time.Now()
+	}
+	s.UpdatedAt = time.Now()
+	m.sessions[s.Token] = s
+
+	return nil
+}
+
+// DeleteSessionToken deletes the session with the given token, deleting a missing session is not an error
+func (m *memoryDBRepo) DeleteSessionToken(ctx context.Context, token string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sessions, token)
+
+	return nil
+}
+
+// DeleteExpiredSessions deletes the expired sessions and returns how many there were
+func (m *memoryDBRepo) DeleteExpiredSessions(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := 0
+	for token, s := range m.sessions {
+		if !s.Expiry.After(time.Now()) {
+			delete(m.sessions, token)
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// UserSessions returns the unexpired sessions of a user, most recently used first, without their data
+func (m *memoryDBRepo) UserSessions(ctx context.Context, userID int) ([]models.Session, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var sessions []models.Session
+	for _, s := range m.sessions {
+		if s.UserID == userID && s.Expiry.After(time.Now()) {
+			s.Token = ""
+			s.Data = nil
+			sessions = append(sessions, s)
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].UpdatedAt.After(sessions[j].UpdatedAt)
+	})
+
+	return sessions, nil
+}
+
+// DeleteSession deletes a session by id, logging its user out
+func (m *memoryDBRepo) DeleteSession(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for token, s := range m.sessions {
+		if s.ID == id {
+			delete(m.sessions, token)
+			return nil
+		}
+	}
+
+	return repository.ErrNotFound
+}
+
+// DeleteUserSessions deletes every session of a user, logging the user out everywhere
+func (m *memoryDBRepo) DeleteUserSessions(ctx context.Context, userID int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for token, s := range m.sessions {
+		if s.UserID == userID {
+			delete(m.sessions, token)
+		}
+	}
+
+	return nil
+}
+
+// InsertGuest registers a guest, the password is pending until VerifyGuestEmail and an existing profile
+// keeps its names and phone number. It returns repository.ErrConstraint when the email is already registered
+func (m *memoryDBRepo) InsertGuest(ctx context.Context, g models.Guest, password string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), PasswordCost)
+	if err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.guests {
+		if existing.Email != g.Email {
+			continue
+		}
+		if existing.HasAccount() {
+			return 0, fmt.Errorf("%w: email %s is already registered", repository.ErrConstraint, g.Email)
+		}
+
+		if existing.Phone == "" {
+			existing.Phone = g.Phone
+		}
+		existing.PendingPassword = string(hashedPassword)
+		existing.UpdatedAt = time.Now()
+		m.guests[existing.ID] = existing
+
+		return existing.ID, nil
+	}
+
+	m.lastGuestID++
+	g.ID = m.lastGuestID
+	g.Password = ""
+	g.PendingPassword = string(hashedPassword)
+	g.CreatedAt = time.Now()
+	g.UpdatedAt = time.Now()
+	m.guests[g.ID] = g
+
+	return g.ID, nil
+}
+
+// GetGuestByID returns a guest by id
+func (m *memoryDBRepo) GetGuestByID(ctx context.Context, id int) (models.Guest, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Guest{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	g, ok := m.guests[id]
+	if !ok {
+		return g, repository.ErrNotFound
+	}
+
+	return g, nil
+}
+
+// GetGuestByEmail returns a guest by email
+func (m *memoryDBRepo) GetGuestByEmail(ctx context.Context, email string) (models.Guest, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Guest{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, g := range m.guests {
+		if g.Email == email {
+			return g, nil
+		}
+	}
+
+	return models.Guest{}, repository.ErrNotFound
+}
+
+// AuthenticateGuest checks the password of a guest and returns the guest's id
+func (m *memoryDBRepo) AuthenticateGuest(ctx context.Context, email, testPassword string) (int, error) {
+	g, err := m.GetGuestByEmail(ctx, email)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && !g.HasAccount()) {
+		// guests without an account cannot log in
+		_ = bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(testPassword))
+		return 0, repository.ErrInvalidCredentials
+	} else if err != nil {
+		return 0, err
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(g.Password), []byte(testPassword))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return 0, repository.ErrInvalidCredentials
+	} else if err != nil {
+		return 0, err
+	}
+
+	return g.ID, nil
+}
+
+// VerifyGuestEmail marks the email address of a guest as verified, the pending password of the guest's
+// registration becomes the password
+func (m *memoryDBRepo) VerifyGuestEmail(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	g, ok := m.guests[id]
+	if !ok {
+		return repository.ErrNotFound
+	}
+
+	g.EmailVerified = true
+	if g.PendingPassword != "" {
+		g.Password = g.PendingPassword
+		g.PendingPassword = ""
+	}
+	g.UpdatedAt = time.Now()
+	m.guests[id] = g
+
+	return nil
+}
+
+// UpdateGuestPassword sets the password of a guest and drops a pending registration
+func (m *memoryDBRepo) UpdateGuestPassword(ctx context.Context, id int, password string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), PasswordCost)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	g, ok := m.guests[id]
+	if !ok {
+		return repository.ErrNotFound
+	}
+
+	g.Password = string(hashedPassword)
+	g.PendingPassword = ""
+	g.UpdatedAt = time.Now()
+	m.guests[id] = g
+
+	return nil
+}
+
+// DeleteGuest deletes a guest, the guest's reservations are kept as anonymous bookings
+func (m *memoryDBRepo) DeleteGuest(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.guests[id]; !ok {
+		return repository.ErrNotFound
+	}
+
+	delete(m.guests, id)
+	for resID, res := range m.reservations {
+		if res.GuestID == id {
+			res.GuestID = 0
+			m.reservations[resID] = res
+		}
+	}
+
+	return nil
+}
+
+// GuestReservations returns the reservations of a guest, the latest arrival first
+func (m *memoryDBRepo) GuestReservations(ctx context.Context, guestID int) ([]models.Reservation, error) {
+	reservations, err := m.listReservations(ctx, func(res models.Reservation) bool { return res.GuestID == guestID })
+	if err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(reservations)-1; i < j; i, j = i+1, j-1 {
+		reservations[i], reservations[j] = reservations[j], reservations[i]
+	}
+
+	return reservations, nil
+}
+
+// ClaimReservations adds the anonymous reservations made with email to the account of a guest
+// and returns how many were added, the guest has to have verified the email address
+func (m *memoryDBRepo) ClaimReservations(ctx context.Context, guestID int, email string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := 0
+	for id, res := range m.reservations {
+		if res.GuestID == 0 && strings.EqualFold(res.Email, email) {
+			res.GuestID = guestID
+			res.UpdatedAt = time.Now()
+			m.reservations[id] = res
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// FindOrCreateGuest returns the profile of the email address of g, creating it from g when there is
+// none yet. A missing phone number of the profile is filled in from g, like the SQL repositories it
+// never matches a profile on the phone number
+func (m *memoryDBRepo) FindOrCreateGuest(ctx context.Context, g models.Guest) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.guests {
+		if existing.Email != g.Email {
+			continue
+		}
+		if existing.Phone == "" && g.Phone != "" {
+			existing.Phone = g.Phone
+			m.guests[existing.ID] = existing
+		}
+		return existing.ID, nil
+	}
+
+	m.lastGuestID++
+	m.guests[m.lastGuestID] = models.Guest{
+		ID:        m.lastGuestID,
+		FirstName: g.FirstName,
+		LastName:  g.LastName,
+		Email:     g.Email,
+		Phone:     g.Phone,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	return m.lastGuestID, nil
+}
+
+// AllGuests returns the guests whose name, email address or phone number contains search, all guests
+// when it is empty, with the number of reservations and latest arrival of each guest
+func (m *memoryDBRepo) AllGuests(ctx context.Context, search string) ([]models.Guest, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	text, phone := guestSearch(search)
+	text = strings.Trim(text, "%")
+	phone = strings.Trim(phone, "%")
+
+	var guests []models.Guest
+	for _, g := range m.guests {
+		if text != "" &&
+			!strings.Contains(strings.ToLower(g.FirstName+" "+g.LastName), text) &&
+			!strings.Contains(g.Email, text) &&
+			(phone == "" || !strings.Contains(phoneKey(g.Phone), phone)) {
+			continue
+		}
+
+		for _, res := range m.reservations {
+			if res.GuestID != g.ID {
+				continue
+			}
+			g.Stays++
+			if res.StartDate.After(g.LastStay) {
+				g.LastStay = res.StartDate
+			}
+		}
+		guests = append(guests, g)
+	}
+
+	sort.Slice(guests, func(i, j int) bool {
+		if guests[i].LastName != guests[j].LastName {
+			return guests[i].LastName < guests[j].LastName
+		}
+		if guests[i].FirstName != guests[j].FirstName {
+			return guests[i].FirstName < guests[j].FirstName
+		}
+		return guests[i].ID < guests[j].ID
+	})
+
+	return guests, nil
+}
+
+// UpdateGuestProfile updates the name, phone number, notes and tags of a guest
+func (m *memoryDBRepo) UpdateGuestProfile(ctx context.Context, g models.Guest) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, ok := m.guests[g.ID]
+	if !ok {
+		return repository.ErrNotFound
+	}
+
+	existing.FirstName = g.FirstName
+	existing.LastName = g.LastName
+	existing.Phone = g.Phone
+	existing.Notes = g.Notes
+	existing.Tags = append([]string(nil), g.Tags...)
+	existing.UpdatedAt = time.Now()
+	m.guests[g.ID] = existing
+
+	return nil
+}
+
+// GuestDuplicates returns the other guests with the phone number or the name of g, who may be the same person
+func (m *memoryDBRepo) GuestDuplicates(ctx context.Context, g models.Guest) ([]models.Guest, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	key := phoneKey(g.Phone)
+
+	var guests []models.Guest
+	for _, d := range m.guests {
+		if d.ID == g.ID {
+			continue
+		}
+		samePhone := key != "" && phoneKey(d.Phone) == key
+		sameName := strings.EqualFold(d.FirstName, g.FirstName) && strings.EqualFold(d.LastName, g.LastName)
+		if samePhone || sameName {
+			guests = append(guests, d)
+		}
+	}
+
+	sort.Slice(guests, func(i, j int) bool {
+		return guests[i].ID < guests[j].ID
+	})
+
+	return guests, nil
+}
+
+// MergeGuests moves the reservations, notes and tags of the guest duplicateID to the guest keepID and
+// deletes the duplicate. It returns repository.ErrConstraint when the duplicate has an account
+func (m *memoryDBRepo) MergeGuests(ctx context.Context, keepID, duplicateID int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if keepID == duplicateID {
+		return repository.ErrConstraint
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keep, ok := m.guests[keepID]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	duplicate, ok := m.guests[duplicateID]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	if duplicate.HasAccount() {
+		return repository.ErrConstraint
+	}
+
+	for id, res := range m.reservations {
+		if res.GuestID == duplicateID {
+			res.GuestID = keepID
+			res.UpdatedAt = time.Now()
+			m.reservations[id] = res
+		}
+	}
+
+	keep = mergeGuest(keep, duplicate)
+	keep.UpdatedAt = time.Now()
+	m.guests[keepID] = keep
+	delete(m.guests, duplicateID)
+
+	return nil
+}
+
+// ReservationsOnDay returns the confirmed reservations arriving, staying or departing on day with the notes
+// and tags of their guests, ordered by room
+func (m *memoryDBRepo) ReservationsOnDay(ctx context.Context, day dates.Date) ([]models.Reservation, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var reservations []models.Reservation
+	for _, res := range m.reservations {
+		if res.Pending() || res.StartDate.After(day) || res.EndDate.Before(day) {
+			continue
+		}
+		res = m.withRoom(res)
+		if g, ok := m.guests[res.GuestID]; ok {
+			res.Guest = models.Guest{ID: g.ID, Notes: g.Notes, Tags: g.Tags}
+		}
+		reservations = append(reservations, res)
+	}
+
+	sort.Slice(reservations, func(i, j int) bool {
+		a, b := reservations[i], reservations[j]
+		if a.Room.RoomName != b.Room.RoomName {
+			return a.Room.RoomName < b.Room.RoomName
+		}
+		if a.LastName != b.LastName {
+			return a.LastName < b.LastName
+		}
+		return a.ID < b.ID
+	})
+
+	return reservations, nil
+}
+
+// DashboardStats returns the occupancy and booking figures of the rooms roomIDs, every room when it is nil, for
+// the nights from start to end. Reservations held for guests who did not confirm their email address yet are left out
+func (m *memoryDBRepo) DashboardStats(ctx context.Context, start, end dates.Date, now time.Time, roomIDs []int) (models.DashboardStats, error) {
+	rooms, err := m.GetAllRooms(ctx)
+	if err != nil {
+		return models.DashboardStats{}, err
+	}
+
+	reservations, err := m.listReservations(ctx, func(res models.Reservation) bool { return !res.Pending() })
+	if err != nil {
+		return models.DashboardStats{}, err
+	}
+
+	return dashboardStats(rooms, reservations, start, end, now, roomIDs), nil
+}
+
+// ClaimJob takes the lock of a job for its run scheduled for scheduledFor until lockedUntil, it returns false when
+// another instance claimed that run already or still holds the lock from an earlier run
+func (m *memoryDBRepo) ClaimJob(ctx context.Context, name, owner string, scheduledFor, lockedUntil, now time.Time) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if lock, ok := m.jobLocks[name]; ok && (!lock.scheduledFor.Before(scheduledFor) || lock.lockedUntil.After(now)) {
+		return false, nil
+	}
+
+	m.jobLocks[name] = memoryJobLock{owner: owner, scheduledFor: scheduledFor, lockedUntil: lockedUntil}
+
+	return true, nil
+}
+
+// ReleaseJob releases the lock an owner holds on a job, the next scheduled run can then be claimed
+func (m *memoryDBRepo) ReleaseJob(ctx context.Context, name, owner string, now time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	lock, ok := m.jobLocks[name]
+	if !ok || lock.owner != owner {
+		return repository.ErrNotFound
+	}
+
+	lock.lockedUntil = now
+	m.jobLocks[name] = lock
+
+	return nil
+}
+
+// InsertJobRun adds a run to the job history
+func (m *memoryDBRepo) InsertJobRun(ctx context.Context, run models.JobRun) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastJobRunID++
+	run.ID = m.lastJobRunID
+	m.jobRuns[run.ID] = run
+
+	return nil
+}
+
+// JobRuns returns the latest runs of a job, most recent first
+func (m *memoryDBRepo) JobRuns(ctx context.Context, name string, limit int) ([]models.JobRun, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var runs []models.JobRun
+	for _, run := range m.jobRuns {
+		if run.Name == name {
+			runs = append(runs, run)
+		}
+	}
+
+	sort.Slice(runs, func(i, j int) bool {
+		if runs[i].StartedAt.Equal(runs[j].StartedAt) {
+			return runs[i].ID > runs[j].ID
+		}
+		return runs[i].StartedAt.After(runs[j].StartedAt)
+	})
+	if len(runs) > limit {
+		runs = runs[:limit]
+	}
+
+	return runs, nil
+}
+
+// DeleteJobRunsBefore deletes the history of the runs started before before
+func (m *memoryDBRepo) DeleteJobRunsBefore(ctx context.Context, before time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := 0
+	for id, run := range m.jobRuns {
+		if run.StartedAt.Before(before) {
+			delete(m.jobRuns, id)
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// ReservationsWithoutGuestMail returns the confirmed reservations whose date the kind of guest email is scheduled
+// from is between from and to and that have not been sent that email yet
+func (m *memoryDBRepo) ReservationsWithoutGuestMail(ctx context.Context, kind string, from, to dates.Date) ([]models.Reservation, error) {
+	column, err := guestMailColumn(kind)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	sent := make(map[int]bool)
+	for _, mail := range m.guestMails {
+		if mail.Kind == kind {
+			sent[mail.ReservationID] = true
+		}
+	}
+
+	date := func(res models.Reservation) dates.Date {
+		if column == "start_date" {
+			return res.StartDate
+		}
+		return res.EndDate
+	}
+
+	var reservations []models.Reservation
+	for _, res := range m.reservations {
+		if res.Pending() || sent[res.ID] || date(res).Before(from) || date(res).After(to) {
+			continue
+		}
+		reservations = append(reservations, m.withRoom(res))
+	}
+
+	sort.Slice(reservations, func(i, j int) bool {
+		a, b := date(reservations[i]), date(reservations[j])
+		if a.Equal(b) {
+			return reservations[i].ID < reservations[j].ID
+		}
+		return a.Before(b)
+	})
+
+	return reservations, nil
+}
+
+// LogGuestMail records that a guest email was sent for a reservation, it returns false when that kind of email
+// was sent for the reservation already
+func (m *memoryDBRepo) LogGuestMail(ctx context.Context, mail models.GuestMail) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.reservations[mail.ReservationID]; !ok {
+		return false, fmt.Errorf("%w: reservation %d does not exist", repository.ErrConstraint, mail.ReservationID)
+	}
+	for _, logged := range m.guestMails {
+		if logged.ReservationID == mail.ReservationID && logged.Kind == mail.Kind {
+			return false, nil
+		}
+	}
+
+	m.lastGuestMailID++
+	mail.ID = m.lastGuestMailID
+	m.guestMails[mail.ID] = mail
+
+	return true, nil
+}
+
+// GuestMails returns the guest emails sent for a reservation, oldest first
+func (m *memoryDBRepo) GuestMails(ctx context.Context, reservationID int) ([]models.GuestMail, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var mails []models.GuestMail
+	for _, mail := range m.guestMails {
+		if mail.ReservationID == reservationID {
+			mails = append(mails, mail)
+		}
+	}
+
+	sort.Slice(mails, func(i, j int) bool {
+		if mails[i].SentAt.Equal(mails[j].SentAt) {
+			return mails[i].ID < mails[j].ID
+		}
+		return mails[i].SentAt.Before(mails[j].SentAt)
+	})
+
+	return mails, nil
+}
+
+// AllWebhooks returns the webhooks, oldest first
+func (m *memoryDBRepo) AllWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var hooks []models.Webhook
+	for _, h := range m.webhooks {
+		h.Events = append([]string(nil), h.Events...)
+		hooks = append(hooks, h)
+	}
+
+	sort.Slice(hooks, func(i, j int) bool { return hooks[i].ID < hooks[j].ID })
+
+	return hooks, nil
+}
+
+// GetWebhookByID returns a webhook by id
+func (m *memoryDBRepo) GetWebhookByID(ctx context.Context, id int) (models.Webhook, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Webhook{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	h, ok := m.webhooks[id]
+	if !ok {
+		return models.Webhook{}, repository.ErrNotFound
+	}
+	h.Events = append([]string(nil), h.Events...)
+
+	return h, nil
+}
+
+// InsertWebhook adds a webhook and returns its id
+func (m *memoryDBRepo) InsertWebhook(ctx context.Context, h models.Webhook) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastWebhookID++
+	h.ID = m.lastWebhookID
+	h.Events = append([]string(nil), h.Events...)
+	h.CreatedAt = time.Now()
+	h.UpdatedAt = time.Now()
+	m.webhooks[h.ID] = h
+
+	return h.ID, nil
+}
+
+// UpdateWebhook updates the URL, events and status of a webhook, the secret is kept
+func (m *memoryDBRepo) UpdateWebhook(ctx context.Context, h models.Webhook) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, ok := m.webhooks[h.ID]
+	if !ok {
+		return repository.ErrNotFound
+	}
+
+	existing.URL = h.URL
+	existing.Events = append([]string(nil), h.Events...)
+	existing.Active = h.Active
+	existing.UpdatedAt = time.Now()
+	m.webhooks[h.ID] = existing
+
+	return nil
+}
+
+// DeleteWebhook deletes a webhook with its deliveries
+func (m *memoryDBRepo) DeleteWebhook(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.webhooks[id]; !ok {
+		return repository.ErrNotFound
+	}
+
+	delete(m.webhooks, id)
+	for deliveryID, d := range m.webhookDeliveries {
+		if d.WebhookID == id {
+			delete(m.webhookDeliveries, deliveryID)
+		}
+	}
+
+	return nil
+}
+
+// InsertWebhookDelivery queues a delivery and returns its id
+func (m *memoryDBRepo) InsertWebhookDelivery(ctx context.Context, d models.WebhookDelivery) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.webhooks[d.WebhookID]; !ok {
+		return 0, fmt.Errorf("%w: webhook %d does not exist", repository.ErrConstraint, d.WebhookID)
+	}
+
+	m.lastDeliveryID++
+	d.ID = m.lastDeliveryID
+	d.Webhook = models.Webhook{}
+	m.webhookDeliveries[d.ID] = d
+
+	return d.ID, nil
+}
+
+// DueWebhookDeliveries returns up to limit pending deliveries to active webhooks whose next attempt is due at now,
+// with the URL and secret of their webhook
+func (m *memoryDBRepo) DueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]models.WebhookDelivery, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var deliveries []models.WebhookDelivery
+	for _, d := range m.webhookDeliveries {
+		h, ok := m.webhooks[d.WebhookID]
+		if !ok || !h.Active || d.Status != models.DeliveryPending || d.NextAttemptAt.After(now) {
+			continue
+		}
+		d.Webhook = models.Webhook{ID: h.ID, URL: h.URL, Secret: h.Secret}
+		deliveries = append(deliveries, d)
+	}
+
+	sort.Slice(deliveries, func(i, j int) bool {
+		if deliveries[i].NextAttemptAt.Equal(deliveries[j].NextAttemptAt) {
+			return deliveries[i].ID < deliveries[j].ID
+		}
+		return deliveries[i].NextAttemptAt.Before(deliveries[j].NextAttemptAt)
+	})
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+
+	return deliveries, nil
+}
+
+// UpdateWebhookDelivery records the outcome of an attempt to deliver
+func (m *memoryDBRepo) UpdateWebhookDelivery(ctx context.Context, d models.WebhookDelivery) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, ok := m.webhookDeliveries[d.ID]
+	if !ok {
+		return repository.ErrNotFound
+	}
+
+	existing.Status = d.Status
+	existing.Attempts = d.Attempts
+	existing.ResponseCode = d.ResponseCode
+	existing.Error = d.Error
+	existing.NextAttemptAt = d.NextAttemptAt
+	existing.DeliveredAt = d.DeliveredAt
+	m.webhookDeliveries[d.ID] = existing
+
+	return nil
+}
+
+// WebhookDeliveries returns the latest deliveries to a webhook, most recent first
+func (m *memoryDBRepo) WebhookDeliveries(ctx context.Context, webhookID, limit int) ([]models.WebhookDelivery, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var deliveries []models.WebhookDelivery
+	for _, d := range m.webhookDeliveries {
+		if d.WebhookID == webhookID {
+			deliveries = append(deliveries, d)
+		}
+	}
+
+	sort.Slice(deliveries, func(i, j int) bool {
+		if deliveries[i].CreatedAt.Equal(deliveries[j].CreatedAt) {
+			return deliveries[i].ID > deliveries[j].ID
+		}
+		return deliveries[i].CreatedAt.After(deliveries[j].CreatedAt)
+	})
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+
+	return deliveries, nil
+}
+
+// ruleWithRoom fills in the room of a booking rule, the caller holds the lock
+func (m *memoryDBRepo) ruleWithRoom(rule models.BookingRule) models.BookingRule {
+	rule.Room = models.Room{ID: rule.RoomID}
+	if room, ok := m.rooms[rule.RoomID]; ok {
+		rule.Room.RoomName = room.RoomName
+	}
+	return rule
+}
+
+// ruleProperty gives a booking rule of a room the property of the room, it checks the room or the property of
+// the rule exists. The caller holds the lock
+func (m *memoryDBRepo) ruleProperty(rule models.BookingRule) (models.BookingRule, error) {
+	if rule.RoomID != 0 {
+		room, ok := m.rooms[rule.RoomID]
+		if !ok {
+			return rule, fmt.Errorf("%w: room %d does not exist", repository.ErrConstraint, rule.RoomID)
+		}
+		rule.PropertyID = room.PropertyID
+	} else if _, ok := m.properties[rule.PropertyID]; !ok {
+		return rule, fmt.Errorf("%w: property %d does not exist", repository.ErrConstraint, rule.PropertyID)
+	}
+	return rule, nil
+}
+
+// AllBookingRules returns the booking rules, oldest first
+func (m *memoryDBRepo) AllBookingRules(ctx context.Context) ([]models.BookingRule, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var rules []models.BookingRule
+	for _, rule := range m.bookingRules {
+		rules = append(rules, m.ruleWithRoom(rule))
+	}
+
+	sort.Slice(rules, func(i, j int) bool { return rules[i].ID < rules[j].ID })
+
+	return rules, nil
+}
+
+// GetBookingRuleByID returns a booking rule by id
+func (m *memoryDBRepo) GetBookingRuleByID(ctx context.Context, id int) (models.BookingRule, error) {
+	if err := ctx.Err(); err != nil {
+		return models.BookingRule{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	rule, ok := m.bookingRules[id]
+	if !ok {
+		return models.BookingRule{}, repository.ErrNotFound
+	}
+
+	return m.ruleWithRoom(rule), nil
+}
+
+// InsertBookingRule adds a booking rule and returns its id
+func (m *memoryDBRepo) InsertBookingRule(ctx context.Context, rule models.BookingRule) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rule, err := m.ruleProperty(rule)
+	if err != nil {
+		return 0, err
+	}
+
+	m.lastBookingRuleID++
+	rule.ID = m.lastBookingRuleID
+	rule.Room = models.Room{}
+	rule.CreatedAt = time.Now()
+	rule.UpdatedAt = time.Now()
+	m.bookingRules[rule.ID] = rule
+
+	return rule.ID, nil
+}
+
+// UpdateBookingRule updates a booking rule
+func (m *memoryDBRepo) UpdateBookingRule(ctx context.Context, rule models.BookingRule) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, ok := m.bookingRules[rule.ID]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	rule, err := m.ruleProperty(rule)
+	if err != nil {
+		return err
+	}
+
+	rule.Room = models.Room{}
+	rule.CreatedAt = existing.CreatedAt
+	rule.UpdatedAt = time.Now()
+	m.bookingRules[rule.ID] = rule
+
+	return nil
+}
+
+// DeleteBookingRule deletes a booking rule
+func (m *memoryDBRepo) DeleteBookingRule(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.bookingRules[id]; !ok {
+		return repository.ErrNotFound
+	}
+	delete(m.bookingRules, id)
+
+	return nil
+}
+
+// MoveRoom moves a room to property propertyID
+func (m *memoryDBRepo) MoveRoom(ctx context.Context, roomID, propertyID int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	room, ok := m.rooms[roomID]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	if _, ok := m.properties[propertyID]; !ok {
+		return fmt.Errorf("%w: property %d does not exist", repository.ErrConstraint, propertyID)
+	}
+
+	room.PropertyID = propertyID
+	room.UpdatedAt = time.Now()
+	m.rooms[roomID] = room
+
+	for id, rule := range m.bookingRules {
+		if rule.RoomID == roomID {
+			rule.PropertyID = propertyID
+			rule.UpdatedAt = time.Now()
+			m.bookingRules[id] = rule
+		}
+	}
+
+	return nil
+}
+
+// AllProperties returns the properties, oldest first
+func (m *memoryDBRepo) AllProperties(ctx context.Context) ([]models.Property, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var properties []models.Property
+	for _, p := range m.properties {
+		properties = append(properties, p)
+	}
+
+	sort.Slice(properties, func(i, j int) bool { return properties[i].ID < properties[j].ID })
+
+	return properties, nil
+}
+
+// GetPropertyByID returns a property by id
+func (m *memoryDBRepo) GetPropertyByID(ctx context.Context, id int) (models.Property, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Property{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	p, ok := m.properties[id]
+	if !ok {
+		return p, repository.ErrNotFound
+	}
+
+	return p, nil
+}
+
+// propertyTaken reports whether another property than id uses the slug or host name of p, the caller holds the lock
+func (m *memoryDBRepo) propertyTaken(p models.Property) bool {
+	for _, other := range m.properties {
+		if other.ID == p.ID {
+			continue
+		}
+		if other.Slug == p.Slug || (p.Host != "" && other.Host == p.Host) {
+			return true
+		}
+	}
+	return false
+}
+
+// InsertProperty adds a property and returns its id, the slug and host name have to be unused
+func (m *memoryDBRepo) InsertProperty(ctx context.Context, p models.Property) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p.ID = 0
+	if m.propertyTaken(p) {
+		return 0, fmt.Errorf("%w: slug %s or host %s is already used", repository.ErrConstraint, p.Slug, p.Host)
+	}
+
+	m.lastPropertyID++
+	p.ID = m.lastPropertyID
+	p.CreatedAt = time.Now()
+	p.UpdatedAt = time.Now()
+	m.properties[p.ID] = p
+
+	return p.ID, nil
+}
+
+// UpdateProperty updates the name and settings of a property
+func (m *memoryDBRepo) UpdateProperty(ctx context.Context, p models.Property) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, ok := m.properties[p.ID]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	if m.propertyTaken(p) {
+		return fmt.Errorf("%w: slug %s or host %s is already used", repository.ErrConstraint, p.Slug, p.Host)
+	}
+
+	p.CreatedAt = existing.CreatedAt
+	p.UpdatedAt = time.Now()
+	m.properties[p.ID] = p
+
+	return nil
+}
+
+// DeleteProperty deletes a property, which must not have rooms anymore
+func (m *memoryDBRepo) DeleteProperty(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.properties[id]; !ok {
+		return repository.ErrNotFound
+	}
+	for _, room := range m.rooms {
+		if room.PropertyID == id {
+			return fmt.Errorf("%w: property %d still has rooms", repository.ErrConstraint, id)
+		}
+	}
+
+	delete(m.properties, id)
+	for ruleID, rule := range m.bookingRules {
+		if rule.PropertyID == id {
+			delete(m.bookingRules, ruleID)
+		}
+	}
+	for userID, ids := range m.userProperties {
+		var kept []int
+		for _, propertyID := range ids {
+			if propertyID != id {
+				kept = append(kept, propertyID)
+			}
+		}
+		m.userProperties[userID] = kept
+	}
+
+	return nil
+}
+
+// SetUserProperties replaces the properties of a user, none gives the user every property
+func (m *memoryDBRepo) SetUserProperties(ctx context.Context, userID int, propertyIDs []int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[userID]; !ok {
+		return repository.ErrNotFound
+	}
+	for _, id := range propertyIDs {
+		if _, ok := m.properties[id]; !ok {
+			return fmt.Errorf("%w: property %d does not exist", repository.ErrConstraint, id)
+		}
+	}
+
+	ids := append([]int(nil), propertyIDs...)
+	sort.Ints(ids)
+	m.userProperties[userID] = ids
+
+	return nil
+}
@@ -2,551 +2,49 @@ package dbrepo
 
 import (
 	"context"
+	"database/sql"
 	"errors"
-	"log"
+	"fmt"
+	"strings"
 	"time"
 
-	"github.com/adewidyatamadb/GoBookings/internal/models"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/adewidyatamadb/GoBookings/internal/config"
+	"github.com/adewidyatamadb/GoBookings/internal/repository"
+	"github.com/jackc/pgconn"
 )
 
-func (m *postgresDBRepo) AllUsers() bool {
-	return true
+type postgresDBRepo struct {
+	sqlDBRepo
 }
 
-// InsertReservation insert a reservation into the database
-func (m *postgresDBRepo) InsertReservation(res models.Reservation) (int, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	var newID int
-
-	stmt := `insert into reservations 
-	(first_name, last_name, email, phone, start_date, end_date, room_id, created_at, updated_at) 
-	values($1, $2, $3, $4, $5, $6, $7, $8, $9) returning id`
-
-	err := m.DB.QueryRowContext(ctx, stmt,
-		res.FirstName,
-		res.LastName,
-		res.Email,
-		res.Phone,
-		res.StartDate,
-		res.EndDate,
-		res.RoomID,
-		time.Now(),
-		time.Now(),
-	).Scan(&newID)
-	if err != nil {
-		return 0, err
-	}
-
-	return newID, nil
-}
-
-// InsertRoomRestriction inserts a room restriction into the database
-func (m *postgresDBRepo) InsertRoomRestriction(res models.RoomRestriction) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	stmt := `insert into room_restrictions 
-	(start_date, end_date, room_id, reservation_id, restriction_id, created_at, updated_at)
-	values($1, $2, $3, $4, $5, $6, $7)`
-
-	_, err := m.DB.ExecContext(ctx, stmt,
-		res.StartDate,
-		res.EndDate,
-		res.RoomID,
-		res.ReservationID,
-		res.RestrictionID,
-		time.Now(),
-		time.Now(),
-	)
-
-	if err != nil {
-		return err
-	}
-
-	return nil
+func NewPostgresRepo(conn *sql.DB, a *config.AppConfig) repository.DatabaseRepo {
+	return &postgresDBRepo{sqlDBRepo{
+		App:    a,
+		DB:     conn,
+		mapErr: postgresError,
+		// timestamp columns keep the wall clock of a time and drop its zone
+		stamp:    func(t time.Time) time.Time { return t },
+		lockRoom: postgresLockRoom,
+		lockRows: " for update",
+	}}
 }
 
-// SearchAvailabilityByDatesByRoomID returns true if room available and return false if room is not available
-func (m *postgresDBRepo) SearchAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	var numRows int
-
-	query := `select 
-				count(id) 
-			from 
-				room_restrictions rr 
-			where 
-				room_id = $1 and
-				$2 < end_date and $3 > start_date`
-
-	row := m.DB.QueryRowContext(ctx, query, roomID, start, end)
-	err := row.Scan(&numRows)
-	if err != nil {
-		return false, err
-	}
-
-	if numRows == 0 {
-		return true, nil
-	}
-
-	return false, nil
-}
-
-// SearchAvailabilityForAllRooms returns a slice of available rooms if any for given date range
-func (m *postgresDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	var rooms []models.Room
-
-	query := `select 
-				r.id, r.room_name
-			from
-				rooms r 
-			where
-				r.id not in 
-				(select rr.room_id from room_restrictions rr where $1 < rr.end_date and $2 > rr.start_date)
-			`
-
-	rows, err := m.DB.QueryContext(ctx, query, start, end)
-	if err != nil {
-		return rooms, err
-	}
-
-	for rows.Next() {
-		var room models.Room
-		err := rows.Scan(
-			&room.ID,
-			&room.RoomName,
-		)
-		if err != nil {
-			return rooms, err
-		}
-
-		rooms = append(rooms, room)
-	}
-
-	if err = rows.Err(); err != nil {
-		return rooms, err
-	}
-
-	return rooms, nil
-}
-
-// GetRoomByID get a room by id
-func (m *postgresDBRepo) GetRoomByID(id int) (models.Room, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	var room models.Room
-
-	query := `select id, room_name, created_at, updated_at from rooms where id=$1`
-
-	row := m.DB.QueryRowContext(ctx, query, id)
-	err := row.Scan(
-		&room.ID,
-		&room.RoomName,
-		&room.CreatedAt,
-		&room.UpdatedAt,
-	)
-
-	if err != nil {
-		return room, err
-	}
-
-	return room, nil
-}
-
-// GetUserByID retrieve user data from the database using id
-func (m *postgresDBRepo) GetUserByID(id int) (models.User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	query := `select id, first_name, last_name, email, password, access_level, created_at, updated_at
-	from users where id = $1`
-
-	row := m.DB.QueryRowContext(ctx, query, id)
-
-	var u models.User
-	err := row.Scan(
-		&u.ID,
-		&u.FirstName,
-		&u.LastName,
-		&u.Email,
-		&u.Password,
-		&u.AccessLevel,
-		&u.CreatedAt,
-		&u.UpdatedAt,
-	)
-	if err != nil {
-		return u, err
-	}
-
-	return u, nil
-}
-
-// UpdateUser update user data in the database
-func (m *postgresDBRepo) UpdateUser(u models.User) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	query := `
-		update users set first_name = $1, last_name = $2, email = $3, access_level = $4, updated_At = $5
-	`
-
-	_, err := m.DB.ExecContext(ctx, query,
-		u.FirstName,
-		u.LastName,
-		u.Email,
-		u.AccessLevel,
-		time.Now(),
-	)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-// Authentice authenticates a user
-func (m *postgresDBRepo) Authenticate(email, testPassword string) (int, string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	var id int
-	var hashedPassword string
-
-	row := m.DB.QueryRowContext(ctx, "select id, password from users where email = $1", email)
-
-	err := row.Scan(&id, &hashedPassword)
-	if err != nil {
-		return id, "", err
-	}
-
-	err = bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(testPassword))
-	if err == bcrypt.ErrMismatchedHashAndPassword {
-		return 0, "", errors.New("incorrect password")
-	} else if err != nil {
-		return 0, "", err
-	}
-
-	return id, hashedPassword, nil
-}
-
-// GetAllReservations returns a slice of all reservations
-func (m *postgresDBRepo) GetAllReservations() ([]models.Reservation, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	var reservations []models.Reservation
-
-	query := `select 
-				r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date, r.room_id, r.created_at, r.updated_at, r.processed, rm.id, rm.room_name
-			from 
-				reservations r
-			left join 
-				rooms rm on (r.room_id = rm.id)
-			order by
-				r.start_date asc
-	`
-
-	rows, err := m.DB.QueryContext(ctx, query)
-	if err != nil {
-		return reservations, err
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var i models.Reservation
-		err := rows.Scan(
-			&i.ID,
-			&i.FirstName,
-			&i.LastName,
-			&i.Email,
-			&i.Phone,
-			&i.StartDate,
-			&i.EndDate,
-			&i.RoomID,
-			&i.CreatedAt,
-			&i.UpdatedAt,
-			&i.Processed,
-			&i.Room.ID,
-			&i.Room.RoomName,
-		)
-		if err != nil {
-			return reservations, err
-		}
-		reservations = append(reservations, i)
-	}
-	if err = rows.Err(); err != nil {
-		return reservations, err
+// postgresError maps postgres errors to the repository errors
+func postgresError(err error) error {
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return repository.ErrNotFound
+	case errors.As(err, &pgErr) && strings.HasPrefix(pgErr.Code, "23"):
+		// class 23 holds the integrity constraint violations
+		return fmt.Errorf("%w: %s", repository.ErrConstraint, pgErr.Message)
 	}
 
-	return reservations, nil
+	return err
 }
 
-// GetAllNewReservations returns a slice of all reservations
-func (m *postgresDBRepo) GetAllNewReservations() ([]models.Reservation, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	var reservations []models.Reservation
-
-	query := `
-		select 
-			r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date, r.room_id, r.created_at, r.updated_at, r.processed, rm.id, rm.room_name
-		from 
-			reservations r
-		left join 
-			rooms rm on (r.room_id = rm.id)
-		where
-			r.processed = 0
-		order by
-			r.start_date asc
-	`
-
-	rows, err := m.DB.QueryContext(ctx, query)
-	if err != nil {
-		return reservations, err
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var i models.Reservation
-		err := rows.Scan(
-			&i.ID,
-			&i.FirstName,
-			&i.LastName,
-			&i.Email,
-			&i.Phone,
-			&i.StartDate,
-			&i.EndDate,
-			&i.RoomID,
-			&i.CreatedAt,
-			&i.UpdatedAt,
-			&i.Processed,
-			&i.Room.ID,
-			&i.Room.RoomName,
-		)
-		if err != nil {
-			return reservations, err
-		}
-		reservations = append(reservations, i)
-	}
-	if err = rows.Err(); err != nil {
-		return reservations, err
-	}
-
-	return reservations, nil
-}
-
-// GetReservationByID returns reservation by id
-func (m *postgresDBRepo) GetReservationByID(id int) (models.Reservation, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	var res models.Reservation
-
-	query := `
-		select 
-			r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date, r.room_id, r.created_at, r.updated_at, r.processed, rm.id, rm.room_name
-		from 
-			reservations r
-		left join 
-			rooms rm on (r.room_id = rm.id)
-		where
-			r.id = $1
-	`
-
-	row := m.DB.QueryRowContext(ctx, query, id)
-	err := row.Scan(
-		&res.ID,
-		&res.FirstName,
-		&res.LastName,
-		&res.Email,
-		&res.Phone,
-		&res.StartDate,
-		&res.EndDate,
-		&res.RoomID,
-		&res.CreatedAt,
-		&res.UpdatedAt,
-		&res.Processed,
-		&res.Room.ID,
-		&res.Room.RoomName,
-	)
-	if err != nil {
-		return res, err
-	}
-
-	return res, nil
-}
-
-// UpdateReservation update reservation data in the database
-func (m *postgresDBRepo) UpdateReservation(r models.Reservation) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	query := `
-		update reservations set first_name = $1, last_name = $2, email = $3, phone = $4, updated_At = $5 where id = $6
-	`
-
-	_, err := m.DB.ExecContext(ctx, query,
-		r.FirstName,
-		r.LastName,
-		r.Email,
-		r.Phone,
-		time.Now(),
-		r.ID,
-	)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-// DeleteReservation deletes one reservation by id
-func (m *postgresDBRepo) DeleteReservation(id int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	query := `delete from reservations where id = $1`
-
-	_, err := m.DB.ExecContext(ctx, query, id)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-// UpdateProcessedForReservation update processed for a reservation by id
-func (m *postgresDBRepo) UpdateProcessedForReservation(id, processed int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	query := `update reservations set processed = $1 where id = $2`
-
-	_, err := m.DB.ExecContext(ctx, query, processed, id)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func (m *postgresDBRepo) GetAllRooms() ([]models.Room, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	var rooms []models.Room
-
-	query := `select id, room_name, created_at, updated_at from rooms order by room_name`
-
-	rows, err := m.DB.QueryContext(ctx, query)
-	if err != nil {
-		return rooms, err
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var rm models.Room
-		err := rows.Scan(
-			&rm.ID,
-			&rm.RoomName,
-			&rm.CreatedAt,
-			&rm.UpdatedAt,
-		)
-		if err != nil {
-			return rooms, err
-		}
-		rooms = append(rooms, rm)
-	}
-
-	if err = rows.Err(); err != nil {
-		return rooms, err
-	}
-
-	return rooms, nil
-}
-
-// GetRestrictionForRoomByDate returns restrictions for a room by date range
-func (m *postgresDBRepo) GetRestrictionForRoomByDate(roomID int, start, end time.Time) ([]models.RoomRestriction, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	var restrictions []models.RoomRestriction
-
-	query := `
-		select id, coalesce(reservation_id, 0), restriction_id, room_id, start_date, end_date
-		from room_restrictions where $1 < end_date and $2 >= start_date
-		and room_id = $3
-	`
-
-	rows, err := m.DB.QueryContext(ctx, query, start, end, roomID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var r models.RoomRestriction
-		err = rows.Scan(
-			&r.ID,
-			&r.ReservationID,
-			&r.RestrictionID,
-			&r.RoomID,
-			&r.StartDate,
-			&r.EndDate,
-		)
-		if err != nil {
-			return nil, err
-		}
-		restrictions = append(restrictions, r)
-	}
-
-	if err = rows.Err(); err != nil {
-		return nil, err
-	}
-
-	return restrictions, nil
-
-}
-
-// InsertBlockForRoom insert a room restriction data
-func (m *postgresDBRepo) InsertBlockForRoom(id int, startDate time.Time) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	query := `insert into room_restrictions (start_Date, end_date, room_id, restriction_id, created_at, updated_at)
-				values($1, $2, $3, $4, $5, $6)`
-
-	_, err := m.DB.ExecContext(ctx, query, startDate, startDate.AddDate(0, 0, 1), id, 2, time.Now(), time.Now())
-	if err != nil {
-		log.Println(err)
-		return err
-	}
-
-	return nil
-}
-
-// DeleteBlockByID deletes a room restriction
-func (m *postgresDBRepo) DeleteBlockByID(id int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	query := `delete from room_restrictions where id = $1`
-
-	_, err := m.DB.ExecContext(ctx, query, id)
-	if err != nil {
-		log.Println(err)
-		return err
-	}
-
-	return nil
+// postgresLockRoom takes a transaction level advisory lock on the room
+func postgresLockRoom(ctx context.Context, tx *sql.Tx, roomID int) error {
+	_, err := tx.ExecContext(ctx, `select pg_advisory_xact_lock($1)`, roomID)
+	return err
 }
@@ -0,0 +1,2422 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/adewidyatamadb/GoBookings/internal/config"
+	"github.com/adewidyatamadb/GoBookings/internal/dates"
+	"github.com/adewidyatamadb/GoBookings/internal/models"
+	"github.com/adewidyatamadb/GoBookings/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// sqlDBRepo holds the queries the postgres and sqlite repositories share. They are written for postgres,
+// the sqlite driver binds $1 placeholders by position too, and the hooks cover where the databases differ
+type sqlDBRepo struct {
+	App *config.AppConfig
+	DB  *sql.DB
+
+	// mapErr maps the errors of the database to the repository errors
+	mapErr func(error) error
+	// stamp returns the time stored for t where timestamps are compared
+	stamp func(t time.Time) time.Time
+	// lockRoom serializes the restriction inserts of a room within tx
+	lockRoom func(ctx context.Context, tx *sql.Tx, roomID int) error
+	// lockRows is appended to the selects of rows a transaction goes on to change
+	lockRows string
+}
+
+// InsertReservation insert a reservation into the database
+func (m *sqlDBRepo) InsertReservation(ctx context.Context, res models.Reservation) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var newID int
+
+	stmt := `insert into reservations 
+	(first_name, last_name, email, phone, start_date, end_date, room_id, guest_id, hold_expires_at, created_at, updated_at) 
+	values($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt,
+		res.FirstName,
+		res.LastName,
+		res.Email,
+		res.Phone,
+		res.StartDate,
+		res.EndDate,
+		res.RoomID,
+		nullID(res.GuestID),
+		nullTime(m.stamp(res.HoldUntil)),
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, m.mapErr(err)
+	}
+
+	return newID, nil
+}
+
+// InsertRoomRestriction inserts a room restriction into the database, it returns
+// repository.ErrUnavailable when the room is already restricted for some of the dates
+func (m *sqlDBRepo) InsertRoomRestriction(ctx context.Context, res models.RoomRestriction) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// serialize restriction inserts per room so two overlapping stays cannot both pass the check
+	err = m.lockRoom(ctx, tx, res.RoomID)
+	if err != nil {
+		return err
+	}
+
+	var overlapping int
+	query := `select count(id) from room_restrictions where room_id = $1 and $2 < end_date and $3 > start_date`
+	err = tx.QueryRowContext(ctx, query, res.RoomID, res.StartDate, res.EndDate).Scan(&overlapping)
+	if err != nil {
+		return m.mapErr(err)
+	}
+	if overlapping > 0 {
+		return repository.ErrUnavailable
+	}
+
+	stmt := `insert into room_restrictions 
+	(start_date, end_date, room_id, reservation_id, restriction_id, created_at, updated_at)
+	values ($1, $2, $3, $4, $5, $6, $7)`
+
+	_, err = tx.ExecContext(ctx, stmt,
+		res.StartDate,
+		res.EndDate,
+		res.RoomID,
+		sql.NullInt64{Int64: int64(res.ReservationID), Valid: res.ReservationID > 0},
+		res.RestrictionID,
+		time.Now(),
+		time.Now(),
+	)
+	if err != nil {
+		return m.mapErr(err)
+	}
+
+	return tx.Commit()
+}
+
+// SearchAvailabilityByDatesByRoomID returns true if room available and return false if room is not available
+func (m *sqlDBRepo) SearchAvailabilityByDatesByRoomID(ctx context.Context, start, end dates.Date, roomID int) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var numRows int
+
+	query := `select 
+				count(id) 
+			from 
+				room_restrictions rr 
+			where 
+				room_id = $1 and
+				$2 < end_date and $3 > start_date`
+
+	row := m.DB.QueryRowContext(ctx, query, roomID, start, end)
+	err := row.Scan(&numRows)
+	if err != nil {
+		return false, m.mapErr(err)
+	}
+
+	if numRows == 0 {
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// SearchAvailabilityForAllRooms returns a slice of available rooms if any for given date range
+func (m *sqlDBRepo) SearchAvailabilityForAllRooms(ctx context.Context, start, end dates.Date) ([]models.Room, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var rooms []models.Room
+
+	query := `select 
+				r.id, r.room_name, r.property_id
+			from
+				rooms r 
+			where
+				r.id not in 
+				(select rr.room_id from room_restrictions rr where $1 < rr.end_date and $2 > rr.start_date)
+			`
+
+	rows, err := m.DB.QueryContext(ctx, query, start, end)
+	if err != nil {
+		return rooms, m.mapErr(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var room models.Room
+		err := rows.Scan(
+			&room.ID,
+			&room.RoomName,
+			&room.PropertyID,
+		)
+		if err != nil {
+			return rooms, m.mapErr(err)
+		}
+
+		rooms = append(rooms, room)
+	}
+
+	if err = rows.Err(); err != nil {
+		return rooms, m.mapErr(err)
+	}
+
+	return rooms, nil
+}
+
+// GetRoomByID get a room by id
+func (m *sqlDBRepo) GetRoomByID(ctx context.Context, id int) (models.Room, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var room models.Room
+
+	query := `select id, room_name, created_at, updated_at, property_id from rooms where id=$1`
+
+	row := m.DB.QueryRowContext(ctx, query, id)
+	err := row.Scan(
+		&room.ID,
+		&room.RoomName,
+		&room.CreatedAt,
+		&room.UpdatedAt,
+		&room.PropertyID,
+	)
+
+	if err != nil {
+		return room, m.mapErr(err)
+	}
+
+	return room, nil
+}
+
+// GetUserByID retrieve user data from the database using id
+func (m *sqlDBRepo) GetUserByID(ctx context.Context, id int) (models.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	query := `select id, first_name, last_name, email, password, access_level, active, must_change_password, session_version, failed_logins, locked_until, totp_secret, totp_enabled, created_at, updated_at
+	from users where id = $1`
+
+	u, err := scanUser(m.DB.QueryRowContext(ctx, query, id), m.mapErr)
+	if err != nil {
+		return u, err
+	}
+
+	u.PropertyIDs, err = userPropertyIDs(ctx, m.DB, `select property_id from user_properties where user_id = $1 order by property_id`, id)
+
+	return u, err
+}
+
+// GetUserByEmail retrieve user data from the database using the email address
+func (m *sqlDBRepo) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	query := `select id, first_name, last_name, email, password, access_level, active, must_change_password, session_version, failed_logins, locked_until, totp_secret, totp_enabled, created_at, updated_at
+	from users where email = $1`
+
+	return scanUser(m.DB.QueryRowContext(ctx, query, email), m.mapErr)
+}
+
+// UpdateUser update user data in the database
+func (m *sqlDBRepo) UpdateUser(ctx context.Context, u models.User) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	query := `
+		update users set first_name = $1, last_name = $2, email = $3, access_level = $4, active = $5,
+		must_change_password = $6, updated_At = $7 where id = $8
+	`
+
+	result, err := m.DB.ExecContext(ctx, query,
+		u.FirstName,
+		u.LastName,
+		u.Email,
+		u.AccessLevel,
+		u.Active,
+		u.MustChangePassword,
+		time.Now(),
+		u.ID,
+	)
+	if err != nil {
+		return m.mapErr(err)
+	}
+
+	return rowAffected(result)
+}
+
+// Authentice authenticates a user
+func (m *sqlDBRepo) Authenticate(ctx context.Context, email, testPassword string) (int, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var id int
+	var hashedPassword string
+	var active bool
+	var lockedUntil sql.NullTime
+
+	row := m.DB.QueryRowContext(ctx, "select id, password, active, locked_until from users where email = $1", email)
+
+	err := row.Scan(&id, &hashedPassword, &active, &lockedUntil)
+	if errors.Is(err, sql.ErrNoRows) {
+		_ = bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(testPassword))
+		return 0, "", repository.ErrInvalidCredentials
+	} else if err != nil {
+		return 0, "", err
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(testPassword))
+	if lockedUntil.Valid && lockedUntil.Time.After(time.Now()) {
+		return 0, "", repository.ErrLocked
+	}
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return 0, "", repository.ErrInvalidCredentials
+	} else if err != nil {
+		return 0, "", err
+	}
+
+	if !active {
+		return 0, "", repository.ErrDisabled
+	}
+
+	return id, hashedPassword, nil
+}
+
+// RecordFailedLogin counts a failed login for the user with the given email and returns the updated user
+func (m *sqlDBRepo) RecordFailedLogin(ctx context.Context, email string) (models.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	query := `update users set failed_logins = failed_logins + 1 where email = $1
+	returning id, first_name, last_name, email, password, access_level, active, must_change_password, session_version, failed_logins, locked_until, totp_secret, totp_enabled, created_at, updated_at`
+
+	return scanUser(m.DB.QueryRowContext(ctx, query, email), m.mapErr)
+}
+
+// LockUser locks a user out until the given time and starts counting failed logins over
+func (m *sqlDBRepo) LockUser(ctx context.Context, id int, until time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, "update users set failed_logins = 0, locked_until = $1 where id = $2", until, id)
+	if err != nil {
+		return m.mapErr(err)
+	}
+
+	return rowAffected(result)
+}
+
+// UnlockUser lifts a lockout and clears the failed logins of a user
+func (m *sqlDBRepo) UnlockUser(ctx context.Context, id int) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, "update users set failed_logins = 0, locked_until = null where id = $1", id)
+	if err != nil {
+		return m.mapErr(err)
+	}
+
+	return rowAffected(result)
+}
+
+// EnableTOTP turns on two-factor authentication for a user and replaces the user's recovery codes
+func (m *sqlDBRepo) EnableTOTP(ctx context.Context, id int, secret string, recoveryCodes []string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "update users set totp_secret = $1, totp_enabled = true, totp_counter = 0, updated_at = $2 where id = $3",
+		secret, time.Now(), id)
+	if err != nil {
+		return m.mapErr(err)
+	}
+	if err = rowAffected(result); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "delete from recovery_codes where user_id = $1", id)
+	if err != nil {
+		return m.mapErr(err)
+	}
+
+	for _, code := range recoveryCodes {
+		_, err = tx.ExecContext(ctx, `insert into recovery_codes (user_id, code_hash, created_at, updated_at)
+		values ($1, $2, $3, $4)`, id, hashRecoveryCode(code), time.Now(), time.Now())
+		if err != nil {
+			return m.mapErr(err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DisableTOTP turns off two-factor authentication for a user and deletes the user's recovery codes
+func (m *sqlDBRepo) DisableTOTP(ctx context.Context, id int) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "update users set totp_secret = '', totp_enabled = false, totp_counter = 0, updated_at = $1 where id = $2",
+		time.Now(), id)
+	if err != nil {
+		return m.mapErr(err)
+	}
+	if err = rowAffected(result); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "delete from recovery_codes where user_id = $1", id)
+	if err != nil {
+		return m.mapErr(err)
+	}
+
+	return tx.Commit()
+}
+
+// UseRecoveryCode marks an unused recovery code of a user as used, it returns
+// repository.ErrInvalidCredentials when the user has no such code
+func (m *sqlDBRepo) UseRecoveryCode(ctx context.Context, id int, code string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	query := `update recovery_codes set used_at = $1, updated_at = $1
+	where user_id = $2 and code_hash = $3 and used_at is null`
+
+	result, err := m.DB.ExecContext(ctx, query, time.Now(), id, hashRecoveryCode(code))
+	if err != nil {
+		return m.mapErr(err)
+	}
+
+	if errors.Is(rowAffected(result), repository.ErrNotFound) {
+		return repository.ErrInvalidCredentials
+	}
+	return nil
+}
+
+// UseTOTPCounter records counter as the period of the last authentication code a user logged in with, it
+// returns repository.ErrInvalidCredentials when a code of that period or a later one was used before
+func (m *sqlDBRepo) UseTOTPCounter(ctx context.Context, id int, counter int64) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	query := `update users set totp_counter = $1, updated_at = $2 where id = $3 and totp_counter < $1`
+	result, err := m.DB.ExecContext(ctx, query, counter, time.Now(), id)
+	if err != nil {
+		return m.mapErr(err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return repository.ErrInvalidCredentials
+	}
+
+	return nil
+}
+
+// AllUsers returns a slice of all users ordered by last name
+func (m *sqlDBRepo) AllUsers(ctx context.Context) ([]models.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var users []models.User
+
+	query := `select id, first_name, last_name, email, access_level, active, must_change_password, session_version, failed_logins, locked_until, totp_secret, totp_enabled, created_at, updated_at
+	from users order by last_name, first_name`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return users, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var u models.User
+		var lockedUntil sql.NullTime
+		err := rows.Scan(
+			&u.ID,
+			&u.FirstName,
+			&u.LastName,
+			&u.Email,
+			&u.AccessLevel,
+			&u.Active,
+			&u.MustChangePassword,
+			&u.SessionVersion,
+			&u.FailedLogins,
+			&lockedUntil,
+			&u.TOTPSecret,
+			&u.TOTPEnabled,
+			&u.CreatedAt,
+			&u.UpdatedAt,
+		)
+		if err != nil {
+			return users, err
+		}
+		u.LockedUntil = lockedUntil.Time
+		users = append(users, u)
+	}
+	if err = rows.Err(); err != nil {
+		return users, err
+	}
+
+	return users, nil
+}
+
+// InsertUser inserts a user with the given plain text password into the database
+func (m *sqlDBRepo) InsertUser(ctx context.Context, u models.User, password string) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), PasswordCost)
+	if err != nil {
+		return 0, err
+	}
+
+	var newID int
+	stmt := `insert into users (first_name, last_name, email, password, access_level, active, must_change_password, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $7, $8, $9) returning id`
+
+	err = m.DB.QueryRowContext(ctx, stmt,
+		u.FirstName,
+		u.LastName,
+		u.Email,
+		string(hashedPassword),
+		u.AccessLevel,
+		u.Active,
+		u.MustChangePassword,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, m.mapErr(err)
+	}
+
+	return newID, nil
+}
+
+// UpdatePassword stores a new password for a user, clears a forced password change
+// and bumps the session version to log the user out everywhere
+func (m *sqlDBRepo) UpdatePassword(ctx context.Context, id int, password string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), PasswordCost)
+	if err != nil {
+		return err
+	}
+
+	query := `update users set password = $1, must_change_password = false, session_version = session_version + 1,
+	updated_at = $2 where id = $3`
+
+	result, err := m.DB.ExecContext(ctx, query, string(hashedPassword), time.Now(), id)
+	if err != nil {
+		return m.mapErr(err)
+	}
+
+	return rowAffected(result)
+}
+
+// DeleteUser deletes a user by id
+func (m *sqlDBRepo) DeleteUser(ctx context.Context, id int) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, "delete from users where id = $1", id)
+	if err != nil {
+		return m.mapErr(err)
+	}
+
+	return rowAffected(result)
+}
+
+// GetAllReservations returns a slice of all reservations
+func (m *sqlDBRepo) GetAllReservations(ctx context.Context) ([]models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var reservations []models.Reservation
+
+	query := `select 
+				r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date, r.room_id, coalesce(r.guest_id, 0), r.created_at, r.updated_at, r.processed, r.hold_expires_at, rm.id, rm.room_name
+			from 
+				reservations r
+			left join 
+				rooms rm on (r.room_id = rm.id)
+			order by
+				r.start_date asc
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return reservations, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var i models.Reservation
+		var holdUntil sql.NullTime
+		err := rows.Scan(
+			&i.ID,
+			&i.FirstName,
+			&i.LastName,
+			&i.Email,
+			&i.Phone,
+			&i.StartDate,
+			&i.EndDate,
+			&i.RoomID,
+			&i.GuestID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Processed,
+			&holdUntil,
+			&i.Room.ID,
+			&i.Room.RoomName,
+		)
+		if err != nil {
+			return reservations, err
+		}
+		i.HoldUntil = holdUntil.Time
+		reservations = append(reservations, i)
+	}
+	if err = rows.Err(); err != nil {
+		return reservations, err
+	}
+
+	return reservations, nil
+}
+
+// GetAllNewReservations returns a slice of all reservations
+func (m *sqlDBRepo) GetAllNewReservations(ctx context.Context) ([]models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var reservations []models.Reservation
+
+	query := `
+		select 
+			r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date, r.room_id, r.created_at, r.updated_at, r.processed, r.hold_expires_at, rm.id, rm.room_name
+		from 
+			reservations r
+		left join 
+			rooms rm on (r.room_id = rm.id)
+		where
+			r.processed = 0 and r.hold_expires_at is null
+		order by
+			r.start_date asc
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return reservations, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var i models.Reservation
+		var holdUntil sql.NullTime
+		err := rows.Scan(
+			&i.ID,
+			&i.FirstName,
+			&i.LastName,
+			&i.Email,
+			&i.Phone,
+			&i.StartDate,
+			&i.EndDate,
+			&i.RoomID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Processed,
+			&holdUntil,
+			&i.Room.ID,
+			&i.Room.RoomName,
+		)
+		if err != nil {
+			return reservations, err
+		}
+		i.HoldUntil = holdUntil.Time
+		reservations = append(reservations, i)
+	}
+	if err = rows.Err(); err != nil {
+		return reservations, err
+	}
+
+	return reservations, nil
+}
+
+// GetReservationByID returns reservation by id
+func (m *sqlDBRepo) GetReservationByID(ctx context.Context, id int) (models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var res models.Reservation
+	var holdUntil sql.NullTime
+
+	query := `
+		select 
+			r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date, r.room_id, coalesce(r.guest_id, 0), r.created_at, r.updated_at, r.processed, r.hold_expires_at, rm.id, rm.room_name
+		from 
+			reservations r
+		left join 
+			rooms rm on (r.room_id = rm.id)
+		where
+			r.id = $1
+	`
+
+	row := m.DB.QueryRowContext(ctx, query, id)
+	err := row.Scan(
+		&res.ID,
+		&res.FirstName,
+		&res.LastName,
+		&res.Email,
+		&res.Phone,
+		&res.StartDate,
+		&res.EndDate,
+		&res.RoomID,
+		&res.GuestID,
+		&res.CreatedAt,
+		&res.UpdatedAt,
+		&res.Processed,
+		&holdUntil,
+		&res.Room.ID,
+		&res.Room.RoomName,
+	)
+	if err != nil {
+		return res, m.mapErr(err)
+	}
+	res.HoldUntil = holdUntil.Time
+
+	return res, nil
+}
+
+// UpdateReservation update reservation data in the database
+func (m *sqlDBRepo) UpdateReservation(ctx context.Context, r models.Reservation) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	query := `
+		update reservations set first_name = $1, last_name = $2, email = $3, phone = $4, updated_At = $5 where id = $6
+	`
+
+	result, err := m.DB.ExecContext(ctx, query,
+		r.FirstName,
+		r.LastName,
+		r.Email,
+		r.Phone,
+		time.Now(),
+		r.ID,
+	)
+	if err != nil {
+		return m.mapErr(err)
+	}
+
+	return rowAffected(result)
+}
+
+// DeleteReservation deletes one reservation by id
+func (m *sqlDBRepo) DeleteReservation(ctx context.Context, id int) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	query := `delete from reservations where id = $1`
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return m.mapErr(err)
+	}
+
+	return rowAffected(result)
+}
+
+// UpdateProcessedForReservation update processed for a reservation by id
+func (m *sqlDBRepo) UpdateProcessedForReservation(ctx context.Context, id, processed int) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	query := `update reservations set processed = $1 where id = $2`
+
+	result, err := m.DB.ExecContext(ctx, query, processed, id)
+	if err != nil {
+		return m.mapErr(err)
+	}
+
+	return rowAffected(result)
+}
+
+// ConfirmReservation confirms a reservation held until the guest confirms the email address, it returns
+// repository.ErrNotFound when the reservation is not held or the hold expired
+func (m *sqlDBRepo) ConfirmReservation(ctx context.Context, id int, now time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	query := `update reservations set hold_expires_at = null, updated_at = $1 where id = $2 and hold_expires_at > $1`
+
+	result, err := m.DB.ExecContext(ctx, query, m.stamp(now), id)
+	if err != nil {
+		return m.mapErr(err)
+	}
+
+	return rowAffected(result)
+}
+
+// ReleaseExpiredHolds deletes the reservations whose hold expired before the guest confirmed the email
+// address, their room restrictions are deleted with them
+func (m *sqlDBRepo) ReleaseExpiredHolds(ctx context.Context, now time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	query := `delete from reservations where hold_expires_at <= $1`
+
+	result, err := m.DB.ExecContext(ctx, query, m.stamp(now))
+	if err != nil {
+		return 0, m.mapErr(err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(n), nil
+}
+
+func (m *sqlDBRepo) GetAllRooms(ctx context.Context) ([]models.Room, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var rooms []models.Room
+
+	query := `select id, room_name, created_at, updated_at, property_id from rooms order by room_name`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return rooms, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rm models.Room
+		err := rows.Scan(
+			&rm.ID,
+			&rm.RoomName,
+			&rm.CreatedAt,
+			&rm.UpdatedAt,
+			&rm.PropertyID,
+		)
+		if err != nil {
+			return rooms, err
+		}
+		rooms = append(rooms, rm)
+	}
+
+	if err = rows.Err(); err != nil {
+		return rooms, err
+	}
+
+	return rooms, nil
+}
+
+// GetRestrictionForRoomByDate returns restrictions for a room by date range
+func (m *sqlDBRepo) GetRestrictionForRoomByDate(ctx context.Context, roomID int, start, end dates.Date) ([]models.RoomRestriction, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var restrictions []models.RoomRestriction
+
+	query := `
+		select id, coalesce(reservation_id, 0), restriction_id, room_id, start_date, end_date
+		from room_restrictions where $1 < end_date and $2 >= start_date
+		and room_id = $3
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, start, end, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r models.RoomRestriction
+		err = rows.Scan(
+			&r.ID,
+			&r.ReservationID,
+			&r.RestrictionID,
+			&r.RoomID,
+			&r.StartDate,
+			&r.EndDate,
+		)
+		if err != nil {
+			return nil, err
+		}
+		restrictions = append(restrictions, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return restrictions, nil
+
+}
+
+// InsertBlockForRoom inserts an owner block for a single night, it returns
+// repository.ErrUnavailable when the night is already restricted
+func (m *sqlDBRepo) InsertBlockForRoom(ctx context.Context, id int, startDate dates.Date) error {
+	err := m.InsertRoomRestriction(ctx, models.RoomRestriction{
+		StartDate:     startDate,
+		EndDate:       startDate.AddDate(0, 0, 1),
+		RoomID:        id,
+		RestrictionID: 2,
+	})
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// DeleteBlockByID deletes a room restriction
+func (m *sqlDBRepo) DeleteBlockByID(ctx context.Context, id int) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	query := `delete from room_restrictions where id = $1`
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		log.Println(err)
+		return m.mapErr(err)
+	}
+
+	return rowAffected(result)
+}
+
+// FindSession returns the unexpired session with the given token
+func (m *sqlDBRepo) FindSession(ctx context.Context, token string) (models.Session, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var s models.Session
+	var userID sql.NullInt64
+
+	query := `select id, token, data, expiry, user_id, ip, user_agent, created_at, updated_at
+	from sessions where token = $1 and expiry > $2`
+
+	row := m.DB.QueryRowContext(ctx, query, token, m.stamp(time.Now()))
+	err := row.Scan(
+		&s.ID,
+		&s.Token,
+		&s.Data,
+		&s.Expiry,
+		&userID,
+		&s.IP,
+		&s.UserAgent,
+		&s.CreatedAt,
+		&s.UpdatedAt,
+	)
+	if err != nil {
+		return s, m.mapErr(err)
+	}
+	s.UserID = int(userID.Int64)
+
+	return s, nil
+}
+
+// CommitSession stores a session, replacing the data of an existing session with the same token
+func (m *sqlDBRepo) CommitSession(ctx context.Context, s models.Session) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	stmt := `insert into sessions (token, data, expiry, user_id, ip, user_agent, created_at, updated_at)
+	values ($1, $2, $3, $4, $5, $6, $7, $8)
+	on conflict (token) do update set data = excluded.data, expiry = excluded.expiry, user_id = excluded.user_id,
+	ip = excluded.ip, user_agent = excluded.user_agent, updated_at = excluded.updated_at`
+
+	_, err := m.DB.ExecContext(ctx, stmt,
+		s.Token,
+		s.Data,
+		m.stamp(s.Expiry),
+		sql.NullInt64{Int64: int64(s.UserID), Valid: s.UserID > 0},
+		s.IP,
+		s.UserAgent,
+		time.Now(),
+		time.Now(),
+	)
+	if err != nil {
+		return m.mapErr(err)
+	}
+
+	return nil
+}
+
+// DeleteSessionToken deletes the session with the given token, deleting a missing session is not an error
+func (m *sqlDBRepo) DeleteSessionToken(ctx context.Context, token string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, "delete from sessions where token = $1", token)
+	if err != nil {
+		return m.mapErr(err)
+	}
+
+	return nil
+}
+
+// DeleteExpiredSessions deletes the expired sessions and returns how many there were
+func (m *sqlDBRepo) DeleteExpiredSessions(ctx context.Context) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, "delete from sessions where expiry <= $1", m.stamp(time.Now()))
+	if err != nil {
+		return 0, m.mapErr(err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(n), nil
+}
+
+// UserSessions returns the unexpired sessions of a user, most recently used first, without their data
+func (m *sqlDBRepo) UserSessions(ctx context.Context, userID int) ([]models.Session, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var sessions []models.Session
+
+	query := `select id, expiry, user_id, ip, user_agent, created_at, updated_at
+	from sessions where user_id = $1 and expiry > $2 order by updated_at desc`
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, m.stamp(time.Now()))
+	if err != nil {
+		return sessions, m.mapErr(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s models.Session
+		err := rows.Scan(
+			&s.ID,
+			&s.Expiry,
+			&s.UserID,
+			&s.IP,
+			&s.UserAgent,
+			&s.CreatedAt,
+			&s.UpdatedAt,
+		)
+		if err != nil {
+			return sessions, err
+		}
+		sessions = append(sessions, s)
+	}
+	if err = rows.Err(); err != nil {
+		return sessions, err
+	}
+
+	return sessions, nil
+}
+
+// DeleteSession deletes a session by id, logging its user out
+func (m *sqlDBRepo) DeleteSession(ctx context.Context, id int) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, "delete from sessions where id = $1", id)
+	if err != nil {
+		return m.mapErr(err)
+	}
+
+	return rowAffected(result)
+}
+
+// DeleteUserSessions deletes every session of a user, logging the user out everywhere
+func (m *sqlDBRepo) DeleteUserSessions(ctx context.Context, userID int) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, "delete from sessions where user_id = $1", userID)
+	if err != nil {
+		return m.mapErr(err)
+	}
+
+	return nil
+}
+
+// InsertGuest registers a guest, the password is pending until VerifyGuestEmail and then turns the profile
+// staff keep of the email address into the guest's account. The profile keeps the names and phone number
+// staff curated, only a missing phone number is filled in. A new registration replaces one that was not
+// verified yet, it returns repository.ErrConstraint when the email is already registered
+func (m *sqlDBRepo) InsertGuest(ctx context.Context, g models.Guest, password string) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), PasswordCost)
+	if err != nil {
+		return 0, err
+	}
+
+	var newID int
+	stmt := `insert into guests (first_name, last_name, email, phone, phone_key, password, pending_password, email_verified, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, '', $6, $7, $8, $9)
+			on conflict (email) do update set
+				phone = coalesce(nullif(guests.phone, ''), excluded.phone),
+				phone_key = coalesce(nullif(guests.phone_key, ''), excluded.phone_key),
+				pending_password = excluded.pending_password,
+				updated_at = excluded.updated_at
+			where guests.password = ''
+			returning id`
+
+	err = m.DB.QueryRowContext(ctx, stmt,
+		g.FirstName,
+		g.LastName,
+		g.Email,
+		g.Phone,
+		phoneKey(g.Phone),
+		string(hashedPassword),
+		g.EmailVerified,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if errors.Is(err, sql.ErrNoRows) {
+		// the update was skipped, the email address belongs to an account
+		return 0, repository.ErrConstraint
+	} else if err != nil {
+		return 0, m.mapErr(err)
+	}
+
+	return newID, nil
+}
+
+// GetGuestByID returns a guest by id
+func (m *sqlDBRepo) GetGuestByID(ctx context.Context, id int) (models.Guest, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	query := `select ` + guestColumns + ` from guests where id = $1`
+
+	return scanGuest(m.DB.QueryRowContext(ctx, query, id), m.mapErr)
+}
+
+// GetGuestByEmail returns a guest by email
+func (m *sqlDBRepo) GetGuestByEmail(ctx context.Context, email string) (models.Guest, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	query := `select ` + guestColumns + ` from guests where email = $1`
+
+	return scanGuest(m.DB.QueryRowContext(ctx, query, email), m.mapErr)
+}
+
+// AuthenticateGuest checks the password of a guest and returns the guest's id
+func (m *sqlDBRepo) AuthenticateGuest(ctx context.Context, email, testPassword string) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var id int
+	var hashedPassword string
+
+	row := m.DB.QueryRowContext(ctx, "select id, password from guests where email = $1", email)
+
+	err := row.Scan(&id, &hashedPassword)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && hashedPassword == "") {
+		// guests without an account cannot log in
+		_ = bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(testPassword))
+		return 0, repository.ErrInvalidCredentials
+	} else if err != nil {
+		return 0, err
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(testPassword))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return 0, repository.ErrInvalidCredentials
+	} else if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// VerifyGuestEmail marks the email address of a guest as verified, the pending password of the guest's
+// registration becomes the password
+func (m *sqlDBRepo) VerifyGuestEmail(ctx context.Context, id int) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	stmt := `update guests set
+			email_verified = true,
+			password = case when pending_password <> '' then pending_password else password end,
+			pending_password = '',
+			updated_at = $1
+		where id = $2`
+
+	result, err := m.DB.ExecContext(ctx, stmt, time.Now(), id)
+	if err != nil {
+		return m.mapErr(err)
+	}
+
+	return rowAffected(result)
+}
+
+// UpdateGuestPassword sets the password of a guest and drops a pending registration
+func (m *sqlDBRepo) UpdateGuestPassword(ctx context.Context, id int, password string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), PasswordCost)
+	if err != nil {
+		return err
+	}
+
+	stmt := `update guests set password = $1, pending_password = '', updated_at = $2 where id = $3`
+
+	result, err := m.DB.ExecContext(ctx, stmt, string(hashedPassword), time.Now(), id)
+	if err != nil {
+		return m.mapErr(err)
+	}
+
+	return rowAffected(result)
+}
+
+// DeleteGuest deletes a guest, the guest's reservations are kept as anonymous bookings
+func (m *sqlDBRepo) DeleteGuest(ctx context.Context, id int) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, "delete from guests where id = $1", id)
+	if err != nil {
+		return m.mapErr(err)
+	}
+
+	return rowAffected(result)
+}
+
+// GuestReservations returns the reservations of a guest, the latest arrival first
+func (m *sqlDBRepo) GuestReservations(ctx context.Context, guestID int) ([]models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var reservations []models.Reservation
+
+	query := `select 
+				r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date, r.room_id, r.guest_id, r.created_at, r.updated_at, r.processed, r.hold_expires_at, rm.id, rm.room_name
+			from 
+				reservations r
+			left join 
+				rooms rm on (r.room_id = rm.id)
+			where
+				r.guest_id = $1
+			order by
+				r.start_date desc, r.id desc
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, guestID)
+	if err != nil {
+		return reservations, m.mapErr(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var i models.Reservation
+		var holdUntil sql.NullTime
+		err := rows.Scan(
+			&i.ID,
+			&i.FirstName,
+			&i.LastName,
+			&i.Email,
+			&i.Phone,
+			&i.StartDate,
+			&i.EndDate,
+			&i.RoomID,
+			&i.GuestID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Processed,
+			&holdUntil,
+			&i.Room.ID,
+			&i.Room.RoomName,
+		)
+		if err != nil {
+			return reservations, err
+		}
+		i.HoldUntil = holdUntil.Time
+		reservations = append(reservations, i)
+	}
+	if err = rows.Err(); err != nil {
+		return reservations, err
+	}
+
+	return reservations, nil
+}
+
+// ClaimReservations adds the anonymous reservations made with email to the account of a guest
+// and returns how many were added, the guest has to have verified the email address
+func (m *sqlDBRepo) ClaimReservations(ctx context.Context, guestID int, email string) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	stmt := `update reservations set guest_id = $1, updated_at = $2
+	where guest_id is null and lower(email) = lower($3)`
+
+	result, err := m.DB.ExecContext(ctx, stmt, guestID, time.Now(), email)
+	if err != nil {
+		return 0, m.mapErr(err)
+	}
+
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+// FindOrCreateGuest returns the profile of the email address of g, creating it from g when there is
+// none yet. A missing phone number of the profile is filled in from g.
+// Profiles are matched on the email address only, never on the phone number: the reservations of a
+// profile show in the bookings of whoever verifies its email address, so a booking made with a known
+// phone number and a new address must not join that profile. Staff see such profiles among the
+// duplicates of a guest and merge them
+func (m *sqlDBRepo) FindOrCreateGuest(ctx context.Context, g models.Guest) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var id int
+	stmt := `insert into guests (first_name, last_name, email, phone, phone_key, password, email_verified, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, '', false, $6, $7)
+			on conflict (email) do update set
+				phone = coalesce(nullif(guests.phone, ''), excluded.phone),
+				phone_key = coalesce(nullif(guests.phone_key, ''), excluded.phone_key)
+			returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt,
+		g.FirstName,
+		g.LastName,
+		g.Email,
+		g.Phone,
+		phoneKey(g.Phone),
+		time.Now(),
+		time.Now(),
+	).Scan(&id)
+	if err != nil {
+		return 0, m.mapErr(err)
+	}
+
+	return id, nil
+}
+
+// AllGuests returns the guests whose name, email address or phone number contains search, all guests
+// when it is empty, with the number of reservations and latest arrival of each guest
+func (m *sqlDBRepo) AllGuests(ctx context.Context, search string) ([]models.Guest, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var guests []models.Guest
+
+	text, phone := guestSearch(search)
+	// the latest arrival is joined as a column, sqlite returns aggregates of dates as text
+	query := `select
+				g.id, g.first_name, g.last_name, g.email, g.phone, g.password, g.pending_password, g.email_verified, g.notes, g.tags, g.created_at, g.updated_at,
+				(select count(*) from reservations r where r.guest_id = g.id), latest.start_date
+			from
+				guests g
+			left join
+				reservations latest on (latest.id = (
+					select r.id from reservations r where r.guest_id = g.id order by r.start_date desc, r.id desc limit 1
+				))
+			where
+				$1 = ''
+				or lower(g.first_name || ' ' || g.last_name) like $1
+				or g.email like $1
+				or ($2 <> '' and g.phone_key like $2)
+			order by
+				g.last_name, g.first_name, g.id
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, text, phone)
+	if err != nil {
+		return guests, m.mapErr(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var stays int
+		var lastStay sql.NullTime
+		g, err := scanGuest(rows, m.mapErr, &stays, &lastStay)
+		if err != nil {
+			return guests, err
+		}
+		g.Stays = stays
+		g.LastStay = dates.Of(lastStay.Time)
+		guests = append(guests, g)
+	}
+	if err = rows.Err(); err != nil {
+		return guests, err
+	}
+
+	return guests, nil
+}
+
+// UpdateGuestProfile updates the name, phone number, notes and tags of a guest
+func (m *sqlDBRepo) UpdateGuestProfile(ctx context.Context, g models.Guest) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	stmt := `update guests set first_name = $1, last_name = $2, phone = $3, phone_key = $4, notes = $5, tags = $6, updated_at = $7
+	where id = $8`
+
+	result, err := m.DB.ExecContext(ctx, stmt,
+		g.FirstName,
+		g.LastName,
+		g.Phone,
+		phoneKey(g.Phone),
+		g.Notes,
+		joinTags(g.Tags),
+		time.Now(),
+		g.ID,
+	)
+	if err != nil {
+		return m.mapErr(err)
+	}
+
+	return rowAffected(result)
+}
+
+// GuestDuplicates returns the other guests with the phone number or the name of g, who may be the same person
+func (m *sqlDBRepo) GuestDuplicates(ctx context.Context, g models.Guest) ([]models.Guest, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var guests []models.Guest
+
+	query := `select ` + guestColumns + ` from guests
+	where id <> $1 and (
+		(phone_key <> '' and phone_key = $2)
+		or (lower(first_name) = lower($3) and lower(last_name) = lower($4))
+	)
+	order by id`
+
+	rows, err := m.DB.QueryContext(ctx, query, g.ID, phoneKey(g.Phone), g.FirstName, g.LastName)
+	if err != nil {
+		return guests, m.mapErr(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		d, err := scanGuest(rows, m.mapErr)
+		if err != nil {
+			return guests, err
+		}
+		guests = append(guests, d)
+	}
+	if err = rows.Err(); err != nil {
+		return guests, err
+	}
+
+	return guests, nil
+}
+
+// MergeGuests moves the reservations, notes and tags of the guest duplicateID to the guest keepID and
+// deletes the duplicate. It returns repository.ErrConstraint when the duplicate has an account
+func (m *sqlDBRepo) MergeGuests(ctx context.Context, keepID, duplicateID int) error {
+	if keepID == duplicateID {
+		return repository.ErrConstraint
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `select ` + guestColumns + ` from guests where id = $1` + m.lockRows
+	keep, err := scanGuest(tx.QueryRowContext(ctx, query, keepID), m.mapErr)
+	if err != nil {
+		return err
+	}
+	duplicate, err := scanGuest(tx.QueryRowContext(ctx, query, duplicateID), m.mapErr)
+	if err != nil {
+		return err
+	}
+	if duplicate.HasAccount() {
+		return repository.ErrConstraint
+	}
+
+	_, err = tx.ExecContext(ctx, "update reservations set guest_id = $1, updated_at = $2 where guest_id = $3",
+		keepID, time.Now(), duplicateID)
+	if err != nil {
+		return m.mapErr(err)
+	}
+
+	keep = mergeGuest(keep, duplicate)
+	_, err = tx.ExecContext(ctx, `update guests set phone = $1, phone_key = $2, notes = $3, tags = $4, updated_at = $5
+	where id = $6`, keep.Phone, phoneKey(keep.Phone), keep.Notes, joinTags(keep.Tags), time.Now(), keepID)
+	if err != nil {
+		return m.mapErr(err)
+	}
+
+	_, err = tx.ExecContext(ctx, "delete from guests where id = $1", duplicateID)
+	if err != nil {
+		return m.mapErr(err)
+	}
+
+	return tx.Commit()
+}
+
+// ReservationsOnDay returns the confirmed reservations arriving, staying or departing on day with the notes
+// and tags of their guests, ordered by room
+func (m *sqlDBRepo) ReservationsOnDay(ctx context.Context, day dates.Date) ([]models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var reservations []models.Reservation
+
+	query := `
+		select
+			r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date, r.room_id, coalesce(r.guest_id, 0),
+			r.created_at, r.updated_at, r.processed, rm.id, rm.room_name, coalesce(g.notes, ''), coalesce(g.tags, '')
+		from
+			reservations r
+		left join
+			rooms rm on (r.room_id = rm.id)
+		left join
+			guests g on (r.guest_id = g.id)
+		where
+			r.hold_expires_at is null and r.start_date <= $1 and r.end_date >= $1
+		order by
+			rm.room_name, r.last_name, r.id
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, day)
+	if err != nil {
+		return reservations, m.mapErr(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var i models.Reservation
+		var tags string
+		err := rows.Scan(
+			&i.ID,
+			&i.FirstName,
+			&i.LastName,
+			&i.Email,
+			&i.Phone,
+			&i.StartDate,
+			&i.EndDate,
+			&i.RoomID,
+			&i.GuestID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Processed,
+			&i.Room.ID,
+			&i.Room.RoomName,
+			&i.Guest.Notes,
+			&tags,
+		)
+		if err != nil {
+			return reservations, err
+		}
+		i.Guest.ID = i.GuestID
+		i.Guest.Tags = splitTags(tags)
+		reservations = append(reservations, i)
+	}
+	if err = rows.Err(); err != nil {
+		return reservations, err
+	}
+
+	return reservations, nil
+}
+
+// DashboardStats returns the occupancy and booking figures of the rooms roomIDs, every room when it is nil, for
+// the nights from start to end. Reservations held for guests who did not confirm their email address yet are left out
+func (m *sqlDBRepo) DashboardStats(ctx context.Context, start, end dates.Date, now time.Time, roomIDs []int) (models.DashboardStats, error) {
+	rooms, err := m.GetAllRooms(ctx)
+	if err != nil {
+		return models.DashboardStats{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	// the reservations in the range, the ones arriving or leaving today and the ones booked in the last 30 days
+	query := `
+		select
+			id, start_date, end_date, room_id, created_at
+		from
+			reservations
+		where
+			hold_expires_at is null
+			and ((start_date <= $2 and end_date >= $1) or (start_date <= $3 and end_date >= $3) or created_at >= $4)
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, start, end, dates.Of(now), now.AddDate(0, 0, -30))
+	if err != nil {
+		return models.DashboardStats{}, m.mapErr(err)
+	}
+	defer rows.Close()
+
+	var reservations []models.Reservation
+	for rows.Next() {
+		var res models.Reservation
+		err := rows.Scan(&res.ID, &res.StartDate, &res.EndDate, &res.RoomID, &res.CreatedAt)
+		if err != nil {
+			return models.DashboardStats{}, err
+		}
+		reservations = append(reservations, res)
+	}
+	if err = rows.Err(); err != nil {
+		return models.DashboardStats{}, err
+	}
+
+	return dashboardStats(rooms, reservations, start, end, now, roomIDs), nil
+}
+
+// ClaimJob takes the lock of a job for its run scheduled for scheduledFor until lockedUntil, it returns false when
+// another instance claimed that run already or still holds the lock from an earlier run
+func (m *sqlDBRepo) ClaimJob(ctx context.Context, name, owner string, scheduledFor, lockedUntil, now time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	stmt := `
+		insert into job_locks (name, owner, scheduled_for, locked_until)
+		values ($1, $2, $3, $4)
+		on conflict (name) do update
+		set owner = excluded.owner, scheduled_for = excluded.scheduled_for, locked_until = excluded.locked_until
+		where job_locks.scheduled_for < excluded.scheduled_for and job_locks.locked_until <= $5
+	`
+
+	result, err := m.DB.ExecContext(ctx, stmt, name, owner, m.stamp(scheduledFor), m.stamp(lockedUntil), m.stamp(now))
+	if err != nil {
+		return false, m.mapErr(err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+// ReleaseJob releases the lock an owner holds on a job, the next scheduled run can then be claimed
+func (m *sqlDBRepo) ReleaseJob(ctx context.Context, name, owner string, now time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	stmt := `update job_locks set locked_until = $1 where name = $2 and owner = $3`
+
+	result, err := m.DB.ExecContext(ctx, stmt, m.stamp(now), name, owner)
+	if err != nil {
+		return m.mapErr(err)
+	}
+
+	return rowAffected(result)
+}
+
+// InsertJobRun adds a run to the job history
+func (m *sqlDBRepo) InsertJobRun(ctx context.Context, run models.JobRun) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	stmt := `
+		insert into job_runs (name, owner, scheduled_for, started_at, finished_at, error)
+		values ($1, $2, $3, $4, $5, $6)
+	`
+
+	_, err := m.DB.ExecContext(ctx, stmt,
+		run.Name,
+		run.Owner,
+		m.stamp(run.ScheduledFor),
+		m.stamp(run.StartedAt),
+		m.stamp(run.FinishedAt),
+		run.Error,
+	)
+	if err != nil {
+		return m.mapErr(err)
+	}
+
+	return nil
+}
+
+// JobRuns returns the latest runs of a job, most recent first
+func (m *sqlDBRepo) JobRuns(ctx context.Context, name string, limit int) ([]models.JobRun, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var runs []models.JobRun
+
+	query := `
+		select
+			id, name, owner, scheduled_for, started_at, finished_at, error
+		from
+			job_runs
+		where
+			name = $1
+		order by
+			started_at desc, id desc
+		limit $2
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, name, limit)
+	if err != nil {
+		return runs, m.mapErr(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var run models.JobRun
+		err := rows.Scan(
+			&run.ID,
+			&run.Name,
+			&run.Owner,
+			&run.ScheduledFor,
+			&run.StartedAt,
+			&run.FinishedAt,
+			&run.Error,
+		)
+		if err != nil {
+			return runs, err
+		}
+		runs = append(runs, run)
+	}
+	if err = rows.Err(); err != nil {
+		return runs, err
+	}
+
+	return runs, nil
+}
+
+// DeleteJobRunsBefore deletes the history of the runs started before before
+func (m *sqlDBRepo) DeleteJobRunsBefore(ctx context.Context, before time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `delete from job_runs where started_at < $1`, m.stamp(before))
+	if err != nil {
+		return 0, m.mapErr(err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(n), nil
+}
+
+// ReservationsWithoutGuestMail returns the confirmed reservations whose date the kind of guest email is scheduled
+// from is between from and to and that have not been sent that email yet
+func (m *sqlDBRepo) ReservationsWithoutGuestMail(ctx context.Context, kind string, from, to dates.Date) ([]models.Reservation, error) {
+	column, err := guestMailColumn(kind)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var reservations []models.Reservation
+
+	query := `
+		select
+			r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date, r.room_id, coalesce(r.guest_id, 0),
+			r.created_at, r.updated_at, r.processed, rm.id, rm.room_name
+		from
+			reservations r
+		left join
+			rooms rm on (r.room_id = rm.id)
+		where
+			r.hold_expires_at is null and r.` + column + ` >= $1 and r.` + column + ` <= $2
+			and not exists (select 1 from guest_mails gm where gm.reservation_id = r.id and gm.kind = $3)
+		order by
+			r.` + column + `, r.id
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, from, to, kind)
+	if err != nil {
+		return reservations, m.mapErr(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var i models.Reservation
+		err := rows.Scan(
+			&i.ID,
+			&i.FirstName,
+			&i.LastName,
+			&i.Email,
+			&i.Phone,
+			&i.StartDate,
+			&i.EndDate,
+			&i.RoomID,
+			&i.GuestID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Processed,
+			&i.Room.ID,
+			&i.Room.RoomName,
+		)
+		if err != nil {
+			return reservations, err
+		}
+		reservations = append(reservations, i)
+	}
+	if err = rows.Err(); err != nil {
+		return reservations, err
+	}
+
+	return reservations, nil
+}
+
+// LogGuestMail records that a guest email was sent for a reservation, it returns false when that kind of email
+// was sent for the reservation already
+func (m *sqlDBRepo) LogGuestMail(ctx context.Context, mail models.GuestMail) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	stmt := `
+		insert into guest_mails (reservation_id, kind, email, subject, sent_at)
+		values ($1, $2, $3, $4, $5)
+		on conflict (reservation_id, kind) do nothing
+	`
+
+	result, err := m.DB.ExecContext(ctx, stmt, mail.ReservationID, mail.Kind, mail.Email, mail.Subject, m.stamp(mail.SentAt))
+	if err != nil {
+		return false, m.mapErr(err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+// GuestMails returns the guest emails sent for a reservation, oldest first
+func (m *sqlDBRepo) GuestMails(ctx context.Context, reservationID int) ([]models.GuestMail, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var mails []models.GuestMail
+
+	query := `
+		select
+			id, reservation_id, kind, email, subject, sent_at
+		from
+			guest_mails
+		where
+			reservation_id = $1
+		order by
+			sent_at, id
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, reservationID)
+	if err != nil {
+		return mails, m.mapErr(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var mail models.GuestMail
+		err := rows.Scan(
+			&mail.ID,
+			&mail.ReservationID,
+			&mail.Kind,
+			&mail.Email,
+			&mail.Subject,
+			&mail.SentAt,
+		)
+		if err != nil {
+			return mails, err
+		}
+		mails = append(mails, mail)
+	}
+	if err = rows.Err(); err != nil {
+		return mails, err
+	}
+
+	return mails, nil
+}
+
+// AllWebhooks returns the webhooks, oldest first
+func (m *sqlDBRepo) AllWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var hooks []models.Webhook
+
+	query := `select id, url, secret, events, active, created_at, updated_at from webhooks order by id`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return hooks, m.mapErr(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var h models.Webhook
+		var events string
+		err := rows.Scan(&h.ID, &h.URL, &h.Secret, &events, &h.Active, &h.CreatedAt, &h.UpdatedAt)
+		if err != nil {
+			return hooks, err
+		}
+		h.Events = splitTags(events)
+		hooks = append(hooks, h)
+	}
+	if err = rows.Err(); err != nil {
+		return hooks, err
+	}
+
+	return hooks, nil
+}
+
+// GetWebhookByID returns a webhook by id
+func (m *sqlDBRepo) GetWebhookByID(ctx context.Context, id int) (models.Webhook, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var h models.Webhook
+	var events string
+
+	query := `select id, url, secret, events, active, created_at, updated_at from webhooks where id = $1`
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&h.ID, &h.URL, &h.Secret, &events, &h.Active, &h.CreatedAt, &h.UpdatedAt)
+	if err != nil {
+		return h, m.mapErr(err)
+	}
+	h.Events = splitTags(events)
+
+	return h, nil
+}
+
+// InsertWebhook adds a webhook and returns its id
+func (m *sqlDBRepo) InsertWebhook(ctx context.Context, h models.Webhook) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var newID int
+	stmt := `insert into webhooks (url, secret, events, active, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt,
+		h.URL,
+		h.Secret,
+		joinTags(h.Events),
+		h.Active,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, m.mapErr(err)
+	}
+
+	return newID, nil
+}
+
+// UpdateWebhook updates the URL, events and status of a webhook, the secret is kept
+func (m *sqlDBRepo) UpdateWebhook(ctx context.Context, h models.Webhook) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	stmt := `update webhooks set url = $1, events = $2, active = $3, updated_at = $4 where id = $5`
+
+	result, err := m.DB.ExecContext(ctx, stmt, h.URL, joinTags(h.Events), h.Active, time.Now(), h.ID)
+	if err != nil {
+		return m.mapErr(err)
+	}
+
+	return rowAffected(result)
+}
+
+// DeleteWebhook deletes a webhook with its deliveries
+func (m *sqlDBRepo) DeleteWebhook(ctx context.Context, id int) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `delete from webhooks where id = $1`, id)
+	if err != nil {
+		return m.mapErr(err)
+	}
+
+	return rowAffected(result)
+}
+
+// InsertWebhookDelivery queues a delivery and returns its id
+func (m *sqlDBRepo) InsertWebhookDelivery(ctx context.Context, d models.WebhookDelivery) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var newID int
+	stmt := `insert into webhook_deliveries (webhook_id, event, payload, status, next_attempt_at, created_at)
+			values ($1, $2, $3, $4, $5, $6) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt,
+		d.WebhookID,
+		d.Event,
+		d.Payload,
+		d.Status,
+		m.stamp(d.NextAttemptAt),
+		m.stamp(d.CreatedAt),
+	).Scan(&newID)
+	if err != nil {
+		return 0, m.mapErr(err)
+	}
+
+	return newID, nil
+}
+
+// DueWebhookDeliveries returns up to limit pending deliveries to active webhooks whose next attempt is due at now,
+// with the URL and secret of their webhook
+func (m *sqlDBRepo) DueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]models.WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var deliveries []models.WebhookDelivery
+
+	query := `
+		select
+			d.id, d.webhook_id, d.event, d.payload, d.status, d.attempts, d.response_code, d.error,
+			d.next_attempt_at, d.created_at, h.id, h.url, h.secret
+		from
+			webhook_deliveries d
+		left join
+			webhooks h on (d.webhook_id = h.id)
+		where
+			d.status = $1 and d.next_attempt_at <= $2 and h.active = $3
+		order by
+			d.next_attempt_at, d.id
+		limit $4
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, models.DeliveryPending, m.stamp(now), true, limit)
+	if err != nil {
+		return deliveries, m.mapErr(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d models.WebhookDelivery
+		err := rows.Scan(
+			&d.ID,
+			&d.WebhookID,
+			&d.Event,
+			&d.Payload,
+			&d.Status,
+			&d.Attempts,
+			&d.ResponseCode,
+			&d.Error,
+			&d.NextAttemptAt,
+			&d.CreatedAt,
+			&d.Webhook.ID,
+			&d.Webhook.URL,
+			&d.Webhook.Secret,
+		)
+		if err != nil {
+			return deliveries, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err = rows.Err(); err != nil {
+		return deliveries, err
+	}
+
+	return deliveries, nil
+}
+
+// UpdateWebhookDelivery records the outcome of an attempt to deliver
+func (m *sqlDBRepo) UpdateWebhookDelivery(ctx context.Context, d models.WebhookDelivery) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	stmt := `
+		update webhook_deliveries
+		set status = $1, attempts = $2, response_code = $3, error = $4, next_attempt_at = $5, delivered_at = $6
+		where id = $7
+	`
+
+	result, err := m.DB.ExecContext(ctx, stmt,
+		d.Status,
+		d.Attempts,
+		d.ResponseCode,
+		d.Error,
+		m.stamp(d.NextAttemptAt),
+		nullTime(m.stamp(d.DeliveredAt)),
+		d.ID,
+	)
+	if err != nil {
+		return m.mapErr(err)
+	}
+
+	return rowAffected(result)
+}
+
+// WebhookDeliveries returns the latest deliveries to a webhook, most recent first
+func (m *sqlDBRepo) WebhookDeliveries(ctx context.Context, webhookID, limit int) ([]models.WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var deliveries []models.WebhookDelivery
+
+	query := `
+		select
+			id, webhook_id, event, payload, status, attempts, response_code, error, next_attempt_at, delivered_at, created_at
+		from
+			webhook_deliveries
+		where
+			webhook_id = $1
+		order by
+			created_at desc, id desc
+		limit $2
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, webhookID, limit)
+	if err != nil {
+		return deliveries, m.mapErr(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d models.WebhookDelivery
+		var deliveredAt sql.NullTime
+		err := rows.Scan(
+			&d.ID,
+			&d.WebhookID,
+			&d.Event,
+			&d.Payload,
+			&d.Status,
+			&d.Attempts,
+			&d.ResponseCode,
+			&d.Error,
+			&d.NextAttemptAt,
+			&deliveredAt,
+			&d.CreatedAt,
+		)
+		if err != nil {
+			return deliveries, err
+		}
+		d.DeliveredAt = deliveredAt.Time
+		deliveries = append(deliveries, d)
+	}
+	if err = rows.Err(); err != nil {
+		return deliveries, err
+	}
+
+	return deliveries, nil
+}
+
+// AllBookingRules returns the booking rules, oldest first
+func (m *sqlDBRepo) AllBookingRules(ctx context.Context) ([]models.BookingRule, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var rules []models.BookingRule
+
+	query := `select ` + bookingRuleColumns + ` from booking_rules r left join rooms rm on rm.id = r.room_id order by r.id`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return rules, m.mapErr(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		rule, err := scanBookingRule(rows, m.mapErr)
+		if err != nil {
+			return rules, err
+		}
+		rules = append(rules, rule)
+	}
+	if err = rows.Err(); err != nil {
+		return rules, err
+	}
+
+	return rules, nil
+}
+
+// GetBookingRuleByID returns a booking rule by id
+func (m *sqlDBRepo) GetBookingRuleByID(ctx context.Context, id int) (models.BookingRule, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	query := `select ` + bookingRuleColumns + ` from booking_rules r left join rooms rm on rm.id = r.room_id where r.id = $1`
+
+	return scanBookingRule(m.DB.QueryRowContext(ctx, query, id), m.mapErr)
+}
+
+// InsertBookingRule adds a booking rule and returns its id, a rule of a room gets the property of the room
+func (m *sqlDBRepo) InsertBookingRule(ctx context.Context, rule models.BookingRule) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	stmt := `insert into booking_rules (name, room_id, property_id, start_date, end_date, min_nights, max_nights,
+			min_notice, max_advance, arrival_days, departure_days, created_at, updated_at)
+			values ($1, $2, coalesce((select property_id from rooms where id = $2), $3), $4, $5, $6, $7, $8, $9,
+			$10, $11, $12, $13) returning id`
+
+	var newID int
+	err := m.DB.QueryRowContext(ctx, stmt,
+		rule.Name,
+		nullID(rule.RoomID),
+		rule.PropertyID,
+		nullDate(rule.Start),
+		nullDate(rule.End),
+		rule.MinNights,
+		rule.MaxNights,
+		rule.MinNotice,
+		rule.MaxAdvance,
+		int(rule.ArrivalDays),
+		int(rule.DepartureDays),
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, m.mapErr(err)
+	}
+
+	return newID, nil
+}
+
+// UpdateBookingRule updates a booking rule, a rule of a room gets the property of the room
+func (m *sqlDBRepo) UpdateBookingRule(ctx context.Context, rule models.BookingRule) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	stmt := `update booking_rules set name = $1, room_id = $2,
+		property_id = coalesce((select property_id from rooms where id = $2), $3), start_date = $4, end_date = $5,
+		min_nights = $6, max_nights = $7, min_notice = $8, max_advance = $9, arrival_days = $10, departure_days = $11,
+		updated_at = $12
+		where id = $13`
+
+	result, err := m.DB.ExecContext(ctx, stmt,
+		rule.Name,
+		nullID(rule.RoomID),
+		rule.PropertyID,
+		nullDate(rule.Start),
+		nullDate(rule.End),
+		rule.MinNights,
+		rule.MaxNights,
+		rule.MinNotice,
+		rule.MaxAdvance,
+		int(rule.ArrivalDays),
+		int(rule.DepartureDays),
+		time.Now(),
+		rule.ID,
+	)
+	if err != nil {
+		return m.mapErr(err)
+	}
+
+	return rowAffected(result)
+}
+
+// DeleteBookingRule deletes a booking rule
+func (m *sqlDBRepo) DeleteBookingRule(ctx context.Context, id int) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `delete from booking_rules where id = $1`, id)
+	if err != nil {
+		return m.mapErr(err)
+	}
+
+	return rowAffected(result)
+}
+
+// MoveRoom moves a room to property propertyID, with the booking rules of the room
+func (m *sqlDBRepo) MoveRoom(ctx context.Context, roomID, propertyID int) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `update rooms set property_id = $1, updated_at = $2 where id = $3`, propertyID, time.Now(), roomID)
+	if err != nil {
+		return m.mapErr(err)
+	}
+	if err = rowAffected(result); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `update booking_rules set property_id = $1, updated_at = $2 where room_id = $3`, propertyID, time.Now(), roomID)
+	if err != nil {
+		return m.mapErr(err)
+	}
+
+	return tx.Commit()
+}
+
+// AllProperties returns the properties, oldest first
+func (m *sqlDBRepo) AllProperties(ctx context.Context) ([]models.Property, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var properties []models.Property
+
+	rows, err := m.DB.QueryContext(ctx, `select `+propertyColumns+` from properties order by id`)
+	if err != nil {
+		return properties, m.mapErr(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p, err := scanProperty(rows, m.mapErr)
+		if err != nil {
+			return properties, err
+		}
+		properties = append(properties, p)
+	}
+	if err = rows.Err(); err != nil {
+		return properties, err
+	}
+
+	return properties, nil
+}
+
+// GetPropertyByID returns a property by id
+func (m *sqlDBRepo) GetPropertyByID(ctx context.Context, id int) (models.Property, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	query := `select ` + propertyColumns + ` from properties where id = $1`
+
+	return scanProperty(m.DB.QueryRowContext(ctx, query, id), m.mapErr)
+}
+
+// InsertProperty adds a property and returns its id, the slug and host name have to be unused
+func (m *sqlDBRepo) InsertProperty(ctx context.Context, p models.Property) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	stmt := `insert into properties (name, slug, host, time_zone, currency, mail_from, owner_email, description,
+			created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) returning id`
+
+	var newID int
+	err := m.DB.QueryRowContext(ctx, stmt,
+		p.Name,
+		p.Slug,
+		p.Host,
+		p.TimeZone,
+		p.Currency,
+		p.MailFrom,
+		p.OwnerEmail,
+		p.Description,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, m.mapErr(err)
+	}
+
+	return newID, nil
+}
+
+// UpdateProperty updates the name and settings of a property
+func (m *sqlDBRepo) UpdateProperty(ctx context.Context, p models.Property) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	stmt := `update properties set name = $1, slug = $2, host = $3, time_zone = $4, currency = $5, mail_from = $6,
+		owner_email = $7, description = $8, updated_at = $9 where id = $10`
+
+	result, err := m.DB.ExecContext(ctx, stmt,
+		p.Name,
+		p.Slug,
+		p.Host,
+		p.TimeZone,
+		p.Currency,
+		p.MailFrom,
+		p.OwnerEmail,
+		p.Description,
+		time.Now(),
+		p.ID,
+	)
+	if err != nil {
+		return m.mapErr(err)
+	}
+
+	return rowAffected(result)
+}
+
+// DeleteProperty deletes a property, which must not have rooms anymore
+func (m *sqlDBRepo) DeleteProperty(ctx context.Context, id int) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `delete from properties where id = $1`, id)
+	if err != nil {
+		return m.mapErr(err)
+	}
+
+	return rowAffected(result)
+}
+
+// SetUserProperties replaces the properties of a user, none gives the user every property
+func (m *sqlDBRepo) SetUserProperties(ctx context.Context, userID int, propertyIDs []int) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "update users set updated_at = $1 where id = $2", time.Now(), userID)
+	if err != nil {
+		return m.mapErr(err)
+	}
+	if err = rowAffected(result); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "delete from user_properties where user_id = $1", userID)
+	if err != nil {
+		return m.mapErr(err)
+	}
+
+	for _, id := range propertyIDs {
+		_, err = tx.ExecContext(ctx, `insert into user_properties (user_id, property_id, created_at, updated_at)
+		values ($1, $2, $3, $4)`, userID, id, time.Now(), time.Now())
+		if err != nil {
+			return m.mapErr(err)
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,121 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/adewidyatamadb/GoBookings/internal/config"
+	"github.com/adewidyatamadb/GoBookings/internal/models"
+	"github.com/adewidyatamadb/GoBookings/internal/repository"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+type sqliteDBRepo struct {
+	sqlDBRepo
+}
+
+func NewSQLiteRepo(conn *sql.DB, a *config.AppConfig) repository.DatabaseRepo {
+	return &sqliteDBRepo{sqlDBRepo{
+		App:    a,
+		DB:     conn,
+		mapErr: sqliteError,
+		// timestamps are stored as text, they only compare in the same zone
+		stamp: func(t time.Time) time.Time { return t.UTC() },
+		// the single connection already serializes the transactions
+		lockRoom: func(ctx context.Context, tx *sql.Tx, roomID int) error { return nil },
+	}}
+}
+
+// sqliteError maps sqlite errors to the repository errors
+func sqliteError(err error) error {
+	var liteErr *sqlite.Error
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return repository.ErrNotFound
+	case errors.As(err, &liteErr) && liteErr.Code()&0xff == sqlite3.SQLITE_CONSTRAINT:
+		// the low byte holds the primary result code of an extended result code
+		return fmt.Errorf("%w: %s", repository.ErrConstraint, liteErr.Error())
+	}
+
+	return err
+}
+
+// MoveRoom moves a room to property propertyID
+func (m *sqliteDBRepo) MoveRoom(ctx context.Context, roomID, propertyID int) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	if err := m.checkProperty(ctx, propertyID); err != nil {
+		return err
+	}
+
+	return m.sqlDBRepo.MoveRoom(ctx, roomID, propertyID)
+}
+
+// checkProperty returns ErrConstraint when property id does not exist, for the tables that got their property
+// after they were created, which SQLite cannot add a foreign key for
+func (m *sqliteDBRepo) checkProperty(ctx context.Context, id int) error {
+	var found int
+	err := m.DB.QueryRowContext(ctx, `select count(id) from properties where id = $1`, id).Scan(&found)
+	if err != nil {
+		return err
+	}
+	if found == 0 {
+		return fmt.Errorf("%w: property %d does not exist", repository.ErrConstraint, id)
+	}
+	return nil
+}
+
+// InsertBookingRule adds a booking rule and returns its id, a rule of a room gets the property of the room
+func (m *sqliteDBRepo) InsertBookingRule(ctx context.Context, rule models.BookingRule) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	if rule.RoomID == 0 {
+		if err := m.checkProperty(ctx, rule.PropertyID); err != nil {
+			return 0, err
+		}
+	}
+
+	return m.sqlDBRepo.InsertBookingRule(ctx, rule)
+}
+
+// UpdateBookingRule updates a booking rule, a rule of a room gets the property of the room
+func (m *sqliteDBRepo) UpdateBookingRule(ctx context.Context, rule models.BookingRule) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	if rule.RoomID == 0 {
+		if err := m.checkProperty(ctx, rule.PropertyID); err != nil {
+			return err
+		}
+	}
+
+	return m.sqlDBRepo.UpdateBookingRule(ctx, rule)
+}
+
+// DeleteProperty deletes a property, which must not have rooms anymore, with its booking rules
+func (m *sqliteDBRepo) DeleteProperty(ctx context.Context, id int) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var rooms int
+	err := m.DB.QueryRowContext(ctx, `select count(id) from rooms where property_id = $1`, id).Scan(&rooms)
+	if err != nil {
+		return err
+	}
+	if rooms > 0 {
+		return fmt.Errorf("%w: property %d still has %d rooms", repository.ErrConstraint, id, rooms)
+	}
+
+	_, err = m.DB.ExecContext(ctx, `delete from booking_rules where property_id = $1`, id)
+	if err != nil {
+		return m.mapErr(err)
+	}
+
+	return m.sqlDBRepo.DeleteProperty(ctx, id)
+}
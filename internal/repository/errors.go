@@ -0,0 +1,19 @@
+package repository
+
+import "errors"
+
+// Errors returned by every DatabaseRepo implementation, check them with errors.Is
+var (
+	// ErrNotFound is returned when the requested record does not exist
+	ErrNotFound = errors.New("record not found")
+	// ErrUnavailable is returned when a room is already restricted for some of the requested dates
+	ErrUnavailable = errors.New("room is not available for the requested dates")
+	// ErrInvalidCredentials is returned when the email or the password does not match a user
+	ErrInvalidCredentials = errors.New("invalid login credentials")
+	// ErrDisabled is returned by Authenticate when the credentials match a user that has been disabled
+	ErrDisabled = errors.New("user is disabled")
+	// ErrLocked is returned by Authenticate while a user is locked out after too many failed logins
+	ErrLocked = errors.New("user is locked")
+	// ErrConstraint is returned when a write violates a database constraint, e.g. a duplicate email or an unknown room
+	ErrConstraint = errors.New("constraint violation")
+)
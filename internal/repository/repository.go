@@ -1,32 +1,106 @@
 package repository
 
 import (
+	"context"
 	"time"
 
+	"github.com/adewidyatamadb/GoBookings/internal/dates"
 	"github.com/adewidyatamadb/GoBookings/internal/models"
 )
 
 type DatabaseRepo interface {
-	AllUsers() bool
-
-	InsertReservation(res models.Reservation) (int, error)
-	InsertRoomRestriction(res models.RoomRestriction) error
-	SearchAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error)
-	SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error)
-	GetRoomByID(id int) (models.Room, error)
-	GetAllRooms() ([]models.Room, error)
-	GetRestrictionForRoomByDate(roomID int, start, end time.Time) ([]models.RoomRestriction, error)
-	InsertBlockForRoom(id int, startDate time.Time) error
-	DeleteBlockByID(id int) error
-
-	GetUserByID(id int) (models.User, error)
-	UpdateUser(u models.User) error
-	Authenticate(email, testPassword string) (int, string, error)
-
-	GetAllReservations() ([]models.Reservation, error)
-	GetAllNewReservations() ([]models.Reservation, error)
-	GetReservationByID(id int) (models.Reservation, error)
-	UpdateReservation(u models.Reservation) error
-	DeleteReservation(id int) error
-	UpdateProcessedForReservation(id, processed int) error
+	InsertReservation(ctx context.Context, res models.Reservation) (int, error)
+	InsertRoomRestriction(ctx context.Context, res models.RoomRestriction) error
+	SearchAvailabilityByDatesByRoomID(ctx context.Context, start, end dates.Date, roomID int) (bool, error)
+	SearchAvailabilityForAllRooms(ctx context.Context, start, end dates.Date) ([]models.Room, error)
+	GetRoomByID(ctx context.Context, id int) (models.Room, error)
+	GetAllRooms(ctx context.Context) ([]models.Room, error)
+	GetRestrictionForRoomByDate(ctx context.Context, roomID int, start, end dates.Date) ([]models.RoomRestriction, error)
+	InsertBlockForRoom(ctx context.Context, id int, startDate dates.Date) error
+	DeleteBlockByID(ctx context.Context, id int) error
+	MoveRoom(ctx context.Context, roomID, propertyID int) error
+
+	AllProperties(ctx context.Context) ([]models.Property, error)
+	GetPropertyByID(ctx context.Context, id int) (models.Property, error)
+	InsertProperty(ctx context.Context, p models.Property) (int, error)
+	UpdateProperty(ctx context.Context, p models.Property) error
+	DeleteProperty(ctx context.Context, id int) error
+
+	AllUsers(ctx context.Context) ([]models.User, error)
+	GetUserByID(ctx context.Context, id int) (models.User, error)
+	GetUserByEmail(ctx context.Context, email string) (models.User, error)
+	InsertUser(ctx context.Context, u models.User, password string) (int, error)
+	UpdateUser(ctx context.Context, u models.User) error
+	SetUserProperties(ctx context.Context, userID int, propertyIDs []int) error
+	UpdatePassword(ctx context.Context, id int, password string) error
+	DeleteUser(ctx context.Context, id int) error
+	Authenticate(ctx context.Context, email, testPassword string) (int, string, error)
+	RecordFailedLogin(ctx context.Context, email string) (models.User, error)
+	LockUser(ctx context.Context, id int, until time.Time) error
+	UnlockUser(ctx context.Context, id int) error
+	EnableTOTP(ctx context.Context, id int, secret string, recoveryCodes []string) error
+	DisableTOTP(ctx context.Context, id int) error
+	UseRecoveryCode(ctx context.Context, id int, code string) error
+	UseTOTPCounter(ctx context.Context, id int, counter int64) error
+
+	FindSession(ctx context.Context, token string) (models.Session, error)
+	CommitSession(ctx context.Context, s models.Session) error
+	DeleteSessionToken(ctx context.Context, token string) error
+	DeleteExpiredSessions(ctx context.Context) (int, error)
+	UserSessions(ctx context.Context, userID int) ([]models.Session, error)
+	DeleteSession(ctx context.Context, id int) error
+	DeleteUserSessions(ctx context.Context, userID int) error
+
+	InsertGuest(ctx context.Context, g models.Guest, password string) (int, error)
+	GetGuestByID(ctx context.Context, id int) (models.Guest, error)
+	GetGuestByEmail(ctx context.Context, email string) (models.Guest, error)
+	AuthenticateGuest(ctx context.Context, email, testPassword string) (int, error)
+	VerifyGuestEmail(ctx context.Context, id int) error
+	UpdateGuestPassword(ctx context.Context, id int, password string) error
+	DeleteGuest(ctx context.Context, id int) error
+	GuestReservations(ctx context.Context, guestID int) ([]models.Reservation, error)
+	ClaimReservations(ctx context.Context, guestID int, email string) (int, error)
+	FindOrCreateGuest(ctx context.Context, g models.Guest) (int, error)
+	AllGuests(ctx context.Context, search string) ([]models.Guest, error)
+	UpdateGuestProfile(ctx context.Context, g models.Guest) error
+	GuestDuplicates(ctx context.Context, g models.Guest) ([]models.Guest, error)
+	MergeGuests(ctx context.Context, keepID, duplicateID int) error
+
+	GetAllReservations(ctx context.Context) ([]models.Reservation, error)
+	GetAllNewReservations(ctx context.Context) ([]models.Reservation, error)
+	GetReservationByID(ctx context.Context, id int) (models.Reservation, error)
+	UpdateReservation(ctx context.Context, u models.Reservation) error
+	DeleteReservation(ctx context.Context, id int) error
+	UpdateProcessedForReservation(ctx context.Context, id, processed int) error
+	ConfirmReservation(ctx context.Context, id int, now time.Time) error
+	ReleaseExpiredHolds(ctx context.Context, now time.Time) (int, error)
+	ReservationsOnDay(ctx context.Context, day dates.Date) ([]models.Reservation, error)
+
+	DashboardStats(ctx context.Context, start, end dates.Date, now time.Time, roomIDs []int) (models.DashboardStats, error)
+
+	ClaimJob(ctx context.Context, name, owner string, scheduledFor, lockedUntil, now time.Time) (bool, error)
+	ReleaseJob(ctx context.Context, name, owner string, now time.Time) error
+	InsertJobRun(ctx context.Context, run models.JobRun) error
+	JobRuns(ctx context.Context, name string, limit int) ([]models.JobRun, error)
+	DeleteJobRunsBefore(ctx context.Context, before time.Time) (int, error)
+
+	ReservationsWithoutGuestMail(ctx context.Context, kind string, from, to dates.Date) ([]models.Reservation, error)
+	LogGuestMail(ctx context.Context, mail models.GuestMail) (bool, error)
+	GuestMails(ctx context.Context, reservationID int) ([]models.GuestMail, error)
+
+	AllWebhooks(ctx context.Context) ([]models.Webhook, error)
+	GetWebhookByID(ctx context.Context, id int) (models.Webhook, error)
+	InsertWebhook(ctx context.Context, h models.Webhook) (int, error)
+	UpdateWebhook(ctx context.Context, h models.Webhook) error
+	DeleteWebhook(ctx context.Context, id int) error
+	InsertWebhookDelivery(ctx context.Context, d models.WebhookDelivery) (int, error)
+	DueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]models.WebhookDelivery, error)
+	UpdateWebhookDelivery(ctx context.Context, d models.WebhookDelivery) error
+	WebhookDeliveries(ctx context.Context, webhookID, limit int) ([]models.WebhookDelivery, error)
+
+	AllBookingRules(ctx context.Context) ([]models.BookingRule, error)
+	GetBookingRuleByID(ctx context.Context, id int) (models.BookingRule, error)
+	InsertBookingRule(ctx context.Context, rule models.BookingRule) (int, error)
+	UpdateBookingRule(ctx context.Context, rule models.BookingRule) error
+	DeleteBookingRule(ctx context.Context, id int) error
 }
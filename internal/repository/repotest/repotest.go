@@ -0,0 +1,2067 @@
+// Package repotest holds a conformance suite that every repository.DatabaseRepo
+// backend has to pass.
+//
+// Backends are expected to be seeded the same way as the migrations seed a new
+// database: the rooms "General's Quarters" and "Major's Suite" with ids 1 and 2,
+// the restrictions "Reservation" and "Owner Block" with ids 1 and 2, and the
+// property "fort-smythe" with id 1 that owns every room. The
+// suite works far in the future and removes what it creates, so it can run
+// against a development database.
+package repotest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adewidyatamadb/GoBookings/internal/dates"
+	"github.com/adewidyatamadb/GoBookings/internal/models"
+	"github.com/adewidyatamadb/GoBookings/internal/repository"
+)
+
+const (
+	generalsQuarters = 1
+	majorsSuite      = 2
+	reservationType  = 1
+	ownerBlockType   = 2
+	fortSmythe       = 1
+)
+
+// Run runs the conformance suite against the repository returned by newRepo,
+// which is called once for every sub test
+func Run(t *testing.T, newRepo func(t *testing.T) repository.DatabaseRepo) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, repo repository.DatabaseRepo)
+	}{
+		{"rooms", testRooms},
+		{"reservation lifecycle", testReservationLifecycle},
+		{"reservation holds", testReservationHolds},
+		{"dashboard stats", testDashboardStats},
+		{"reservations on a day", testReservationsOnDay},
+		{"scheduled jobs", testJobs},
+		{"guest mails", testGuestMails},
+		{"webhooks", testWebhooks},
+		{"booking rules", testBookingRules},
+		{"properties", testProperties},
+		{"availability boundaries", testAvailabilityBoundaries},
+		{"blocks", testBlocks},
+		{"users", testUsers},
+		{"user management", testUserManagement},
+		{"login lockout", testLoginLockout},
+		{"two-factor authentication", testTwoFactor},
+		{"sessions", testSessions},
+		{"guests", testGuests},
+		{"guest profiles", testGuestProfiles},
+		{"domain errors", testDomainErrors},
+		{"concurrent access", testConcurrentAccess},
+		{"double booking", testDoubleBooking},
+		{"cancelled context", testCancelledContext},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			test.fn(t, newRepo(t))
+		})
+	}
+}
+
+// baseDate returns a random date far enough in the future to not collide with
+// real data or with other runs of the suite against the same database
+func baseDate() dates.Date {
+	return dates.New(2090, 1, 1).AddDays(rand.Intn(3650))
+}
+
+// book inserts a reservation with its room restriction and deletes it again when the test ends
+func book(t *testing.T, repo repository.DatabaseRepo, roomID int, start, end dates.Date) int {
+	t.Helper()
+	ctx := context.Background()
+
+	id, err := repo.InsertReservation(ctx, models.Reservation{
+		FirstName: "John",
+		LastName:  "Conformance",
+		Email:     "john@conformance.test",
+		Phone:     "555-555-5555",
+		StartDate: start,
+		EndDate:   end,
+		RoomID:    roomID,
+	})
+	if err != nil {
+		t.Fatalf("InsertReservation: %v", err)
+	}
+	t.Cleanup(func() { _ = repo.DeleteReservation(context.Background(), id) })
+
+	err = repo.InsertRoomRestriction(ctx, models.RoomRestriction{
+		StartDate:     start,
+		EndDate:       end,
+		RoomID:        roomID,
+		ReservationID: id,
+		RestrictionID: reservationType,
+	})
+	if err != nil {
+		t.Fatalf("InsertRoomRestriction: %v", err)
+	}
+
+	return id
+}
+
+// findBlock returns the id of the owner block starting on day for a room, or 0
+func findBlock(t *testing.T, repo repository.DatabaseRepo, roomID int, day dates.Date) int {
+	t.Helper()
+
+	restrictions, err := repo.GetRestrictionForRoomByDate(context.Background(), roomID, day.AddDate(0, 0, -1), day.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("GetRestrictionForRoomByDate: %v", err)
+	}
+
+	for _, r := range restrictions {
+		if r.ReservationID == 0 && r.StartDate.Equal(day) {
+			if r.RestrictionID != ownerBlockType {
+				t.Errorf("expected block to have restriction id %d but got %d", ownerBlockType, r.RestrictionID)
+			}
+			return r.ID
+		}
+	}
+
+	return 0
+}
+
+func testRooms(t *testing.T, repo repository.DatabaseRepo) {
+	ctx := context.Background()
+
+	rooms, err := repo.GetAllRooms(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rooms) < 2 {
+		t.Fatalf("expected at least 2 rooms but got %d", len(rooms))
+	}
+	for i := 1; i < len(rooms); i++ {
+		if rooms[i-1].RoomName > rooms[i].RoomName {
+			t.Errorf("expected rooms to be ordered by name but got %q before %q", rooms[i-1].RoomName, rooms[i].RoomName)
+		}
+	}
+
+	room, err := repo.GetRoomByID(ctx, generalsQuarters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if room.ID != generalsQuarters || room.RoomName != "General's Quarters" {
+		t.Errorf("unexpected room %+v", room)
+	}
+
+	_, err = repo.GetRoomByID(ctx, 999999)
+	if !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a room that does not exist but got %v", err)
+	}
+}
+
+func testReservationLifecycle(t *testing.T, repo repository.DatabaseRepo) {
+	ctx := context.Background()
+	start := baseDate()
+	end := start.AddDate(0, 0, 2)
+
+	id := book(t, repo, majorsSuite, start, end)
+
+	res, err := repo.GetReservationByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.ID != id || res.LastName != "Conformance" || res.RoomID != majorsSuite {
+		t.Errorf("unexpected reservation %+v", res)
+	}
+	if res.Room.ID != majorsSuite || res.Room.RoomName != "Major's Suite" {
+		t.Errorf("expected reservation to be joined with its room but got %+v", res.Room)
+	}
+	if !res.StartDate.Equal(start) || !res.EndDate.Equal(end) {
+		t.Errorf("expected dates %s - %s but got %s - %s", start, end, res.StartDate, res.EndDate)
+	}
+	if res.Processed != 0 {
+		t.Errorf("expected a new reservation to be unprocessed")
+	}
+
+	if !containsReservation(t, repo.GetAllReservations, id) {
+		t.Error("expected reservation in all reservations")
+	}
+	if !containsReservation(t, repo.GetAllNewReservations, id) {
+		t.Error("expected reservation in new reservations")
+	}
+
+	res.FirstName = "Jane"
+	res.Email = "jane@conformance.test"
+	err = repo.UpdateReservation(ctx, res)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err = repo.GetReservationByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.FirstName != "Jane" || res.Email != "jane@conformance.test" || res.LastName != "Conformance" {
+		t.Errorf("update was not stored: %+v", res)
+	}
+
+	err = repo.UpdateProcessedForReservation(ctx, id, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if containsReservation(t, repo.GetAllNewReservations, id) {
+		t.Error("expected a processed reservation to not be in new reservations")
+	}
+	if !containsReservation(t, repo.GetAllReservations, id) {
+		t.Error("expected a processed reservation to stay in all reservations")
+	}
+
+	err = repo.DeleteReservation(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.GetReservationByID(ctx, id)
+	if !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a deleted reservation but got %v", err)
+	}
+
+	available, err := repo.SearchAvailabilityByDatesByRoomID(ctx, start, end, majorsSuite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !available {
+		t.Error("expected deleting a reservation to release its room restriction")
+	}
+}
+
+// hold inserts a reservation with its room restriction that holds the room until holdUntil
+// and deletes it again when the test ends
+func hold(t *testing.T, repo repository.DatabaseRepo, roomID int, start, end dates.Date, holdUntil time.Time) int {
+	t.Helper()
+	ctx := context.Background()
+
+	id, err := repo.InsertReservation(ctx, models.Reservation{
+		FirstName: "John",
+		LastName:  "Conformance",
+		Email:     "john@conformance.test",
+		Phone:     "555-555-5555",
+		StartDate: start,
+		EndDate:   end,
+		RoomID:    roomID,
+		HoldUntil: holdUntil,
+	})
+	if err != nil {
+		t.Fatalf("InsertReservation: %v", err)
+	}
+	t.Cleanup(func() { _ = repo.DeleteReservation(context.Background(), id) })
+
+	err = repo.InsertRoomRestriction(ctx, models.RoomRestriction{
+		StartDate:     start,
+		EndDate:       end,
+		RoomID:        roomID,
+		ReservationID: id,
+		RestrictionID: reservationType,
+	})
+	if err != nil {
+		t.Fatalf("InsertRoomRestriction: %v", err)
+	}
+
+	return id
+}
+
+func testReservationHolds(t *testing.T, repo repository.DatabaseRepo) {
+	ctx := context.Background()
+	start := baseDate()
+	end := start.AddDate(0, 0, 2)
+	now := time.Now()
+
+	confirmed := hold(t, repo, majorsSuite, start, end, now.Add(time.Hour))
+	released := hold(t, repo, generalsQuarters, start, end, now.Add(time.Hour))
+
+	res, err := repo.GetReservationByID(ctx, confirmed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Pending() || res.HoldUntil.Sub(now.Add(time.Hour)).Abs() > time.Second {
+		t.Errorf("expected the reservation to be held until %s but got %s", now.Add(time.Hour), res.HoldUntil)
+	}
+	if !containsReservation(t, repo.GetAllReservations, confirmed) {
+		t.Error("expected a held reservation in all reservations")
+	}
+	if containsReservation(t, repo.GetAllNewReservations, confirmed) {
+		t.Error("expected a held reservation to not be in new reservations")
+	}
+
+	err = repo.ConfirmReservation(ctx, confirmed, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err = repo.GetReservationByID(ctx, confirmed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Pending() {
+		t.Error("expected a confirmed reservation to not be held")
+	}
+	if !containsReservation(t, repo.GetAllNewReservations, confirmed) {
+		t.Error("expected a confirmed reservation in new reservations")
+	}
+	err = repo.ConfirmReservation(ctx, confirmed, now)
+	if !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound confirming a reservation twice but got %v", err)
+	}
+
+	later := now.Add(2 * time.Hour)
+	err = repo.ConfirmReservation(ctx, released, later)
+	if !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound confirming an expired hold but got %v", err)
+	}
+
+	n, err := repo.ReleaseExpiredHolds(ctx, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n < 1 {
+		t.Errorf("expected the expired hold to be released but %d were", n)
+	}
+	_, err = repo.GetReservationByID(ctx, released)
+	if !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a released hold but got %v", err)
+	}
+	if _, err = repo.GetReservationByID(ctx, confirmed); err != nil {
+		t.Errorf("expected a confirmed reservation to stay but got %v", err)
+	}
+
+	available, err := repo.SearchAvailabilityByDatesByRoomID(ctx, start, end, generalsQuarters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !available {
+		t.Error("expected releasing a hold to release its room restriction")
+	}
+}
+
+func testDashboardStats(t *testing.T, repo repository.DatabaseRepo) {
+	ctx := context.Background()
+	start := baseDate()
+	end := start.AddDate(0, 0, 9)
+
+	// three nights of the range in the suite, two in the quarters and a hold that does not count
+	book(t, repo, majorsSuite, start.AddDate(0, 0, -2), start.AddDate(0, 0, 3))
+	book(t, repo, generalsQuarters, start.AddDate(0, 0, 8), start.AddDate(0, 0, 12))
+	hold(t, repo, majorsSuite, start.AddDate(0, 0, 5), start.AddDate(0, 0, 7), time.Now().Add(time.Hour))
+
+	stats, err := repo.DashboardStats(ctx, start, end, start.AddDays(3).Time(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stats.Start.Equal(start) || !stats.End.Equal(end) {
+		t.Errorf("expected the range %s - %s but got %s - %s", start, end, stats.Start, stats.End)
+	}
+
+	booked := map[int]int{}
+	for _, o := range stats.Rooms {
+		if o.Nights != 10 {
+			t.Errorf("expected 10 nights for room %d but got %d", o.Room.ID, o.Nights)
+		}
+		booked[o.Room.ID] = o.Booked
+	}
+	if booked[majorsSuite] != 3 || booked[generalsQuarters] != 2 {
+		t.Errorf("expected 3 booked nights in the suite and 2 in the quarters but got %v", booked)
+	}
+	if stats.Total.Booked != 5 || stats.Total.Nights != 10*len(stats.Rooms) {
+		t.Errorf("expected 5 of %d nights booked in total but got %+v", 10*len(stats.Rooms), stats.Total)
+	}
+
+	if stats.Arrivals != 0 || stats.Departures != 1 {
+		t.Errorf("expected no arrivals and 1 departure on the third day but got %d and %d", stats.Arrivals, stats.Departures)
+	}
+
+	leadTimes := map[string]int{}
+	for _, lt := range stats.LeadTimes {
+		leadTimes[lt.Label] = lt.Count
+	}
+	if leadTimes["Over 90 days"] != 1 || leadTimes["Same day"] != 0 {
+		t.Errorf("expected the one arrival in the range booked over 90 days ahead but got %v", leadTimes)
+	}
+
+	stats, err = repo.DashboardStats(ctx, start, end, time.Now(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.PickUp7 < 2 || stats.PickUp30 < stats.PickUp7 {
+		t.Errorf("expected the reservations booked just now to be picked up but got %d and %d", stats.PickUp7, stats.PickUp30)
+	}
+
+	stats, err = repo.DashboardStats(ctx, start, end, start.AddDays(3).Time(), []int{generalsQuarters})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats.Rooms) != 1 || stats.Total.Booked != 2 || stats.Total.Nights != 10 || stats.Departures != 0 {
+		t.Errorf("expected the figures of the quarters only but got %+v", stats)
+	}
+}
+
+func testReservationsOnDay(t *testing.T, repo repository.DatabaseRepo) {
+	ctx := context.Background()
+	day := baseDate()
+
+	departing := book(t, repo, generalsQuarters, day.AddDate(0, 0, -2), day)
+	arriving := book(t, repo, generalsQuarters, day, day.AddDate(0, 0, 3))
+	staying := book(t, repo, majorsSuite, day.AddDate(0, 0, -1), day.AddDate(0, 0, 1))
+	book(t, repo, majorsSuite, day.AddDate(0, 0, 1), day.AddDate(0, 0, 2))
+	hold(t, repo, majorsSuite, day.AddDate(0, 0, -5), day.AddDate(0, 0, -1), time.Now().Add(time.Hour))
+
+	guestID, err := repo.FindOrCreateGuest(ctx, models.Guest{FirstName: "John", LastName: "Conformance", Email: "day.sheet@conformance.test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = repo.DeleteGuest(context.Background(), guestID) })
+	err = repo.UpdateGuestProfile(ctx, models.Guest{ID: guestID, FirstName: "John", LastName: "Conformance", Notes: "Arrives late", Tags: []string{"vip"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	withGuest, err := repo.InsertReservation(ctx, models.Reservation{
+		FirstName: "John",
+		LastName:  "Conformance",
+		Email:     "day.sheet@conformance.test",
+		StartDate: day,
+		EndDate:   day.AddDate(0, 0, 1),
+		RoomID:    majorsSuite,
+		GuestID:   guestID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = repo.DeleteReservation(context.Background(), withGuest) })
+
+	reservations, err := repo.ReservationsOnDay(ctx, day)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []int
+	for _, res := range reservations {
+		ids = append(ids, res.ID)
+		if res.ID == withGuest && (res.Guest.Notes != "Arrives late" || !res.Guest.HasTag("vip")) {
+			t.Errorf("expected the notes and tags of the guest but got %+v", res.Guest)
+		}
+		if res.Room.RoomName == "" {
+			t.Errorf("expected reservation %d to be joined with its room", res.ID)
+		}
+	}
+
+	// the quarters sort before the suite
+	expected := []int{departing, arriving, staying, withGuest}
+	if departing > arriving {
+		expected[0], expected[1] = arriving, departing
+	}
+	if staying > withGuest {
+		expected[2], expected[3] = withGuest, staying
+	}
+	if fmt.Sprint(ids) != fmt.Sprint(expected) {
+		t.Errorf("expected reservations %v on the day but got %v", expected, ids)
+	}
+}
+
+func testJobs(t *testing.T, repo repository.DatabaseRepo) {
+	ctx := context.Background()
+	name := fmt.Sprintf("conformance-%d", rand.Int())
+	now := time.Now()
+	tick := now.Truncate(time.Minute)
+
+	claimed, err := repo.ClaimJob(ctx, name, "a", tick, now.Add(time.Minute), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !claimed {
+		t.Error("expected the first run of a job to be claimed")
+	}
+
+	var tableTest = []struct {
+		name         string
+		owner        string
+		scheduledFor time.Time
+	}{
+		{"same run", "b", tick},
+		{"next run while locked", "b", tick.Add(time.Minute)},
+	}
+	for _, test := range tableTest {
+		claimed, err = repo.ClaimJob(ctx, name, test.owner, test.scheduledFor, now.Add(2*time.Minute), now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if claimed {
+			t.Errorf("case - %s: expected the run to not be claimed", test.name)
+		}
+	}
+
+	err = repo.ReleaseJob(ctx, name, "b", now)
+	if !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound releasing a job locked by another owner but got %v", err)
+	}
+	err = repo.ReleaseJob(ctx, name, "a", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claimed, err = repo.ClaimJob(ctx, name, "b", tick.Add(time.Minute), now.Add(2*time.Minute), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !claimed {
+		t.Error("expected the next run to be claimed once the lock is released")
+	}
+	err = repo.ReleaseJob(ctx, name, "b", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claimed, err = repo.ClaimJob(ctx, name, "a", tick, now.Add(time.Minute), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claimed {
+		t.Error("expected an earlier run to not be claimed again")
+	}
+
+	for _, run := range []models.JobRun{
+		{Name: name, Owner: "a", StartedAt: now.AddDate(0, 0, -40)},
+		{Name: name, Owner: "a", StartedAt: now.Add(-time.Minute), Error: "boom"},
+		{Name: name, Owner: "b", StartedAt: now},
+	} {
+		run.ScheduledFor = run.StartedAt.Truncate(time.Minute)
+		run.FinishedAt = run.StartedAt.Add(time.Second)
+		err = repo.InsertJobRun(ctx, run)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runs, err := repo.JobRuns(ctx, name, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 || runs[0].Owner != "b" || runs[1].Error != "boom" {
+		t.Fatalf("expected the two latest runs, most recent first, but got %+v", runs)
+	}
+	if runs[0].Duration() != time.Second || runs[0].Failed() || !runs[1].Failed() {
+		t.Errorf("unexpected run %+v", runs[0])
+	}
+
+	n, err := repo.DeleteJobRunsBefore(ctx, now.AddDate(0, 0, -30))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n < 1 {
+		t.Errorf("expected the old run to be deleted but %d were", n)
+	}
+	runs, err = repo.JobRuns(ctx, name, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 {
+		t.Errorf("expected 2 runs to be kept but got %d", len(runs))
+	}
+}
+
+func testGuestMails(t *testing.T, repo repository.DatabaseRepo) {
+	ctx := context.Background()
+	start := baseDate()
+	end := start.AddDate(0, 0, 3)
+
+	id := book(t, repo, generalsQuarters, start, end)
+	held := hold(t, repo, majorsSuite, start, end, time.Now().Add(time.Hour))
+
+	due := func(kind string, from, to dates.Date) func(ctx context.Context) ([]models.Reservation, error) {
+		return func(ctx context.Context) ([]models.Reservation, error) {
+			return repo.ReservationsWithoutGuestMail(ctx, kind, from, to)
+		}
+	}
+
+	var tableTest = []struct {
+		name     string
+		kind     string
+		from     dates.Date
+		to       dates.Date
+		expected bool
+	}{
+		{"arriving within the range", models.GuestMailPreArrival, start.AddDate(0, 0, -3), start, true},
+		{"arriving after the range", models.GuestMailPreArrival, start.AddDate(0, 0, -3), start.AddDate(0, 0, -1), false},
+		{"departing on the day", models.GuestMailCheckOut, end, end, true},
+		{"arriving on the day", models.GuestMailCheckOut, start, start, false},
+		{"departed within the range", models.GuestMailPostStay, end.AddDate(0, 0, -7), end, true},
+	}
+	for _, test := range tableTest {
+		if containsReservation(t, due(test.kind, test.from, test.to), id) != test.expected {
+			t.Errorf("case - %s: expected the reservation due %t", test.name, test.expected)
+		}
+	}
+
+	if containsReservation(t, due(models.GuestMailPreArrival, start, start), held) {
+		t.Error("expected a held reservation to not be sent guest emails")
+	}
+
+	sentAt := time.Now().Truncate(time.Second)
+	logged, err := repo.LogGuestMail(ctx, models.GuestMail{ReservationID: id, Kind: models.GuestMailPreArrival, Email: "john@conformance.test", Subject: "Your stay", SentAt: sentAt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !logged {
+		t.Error("expected the first pre-arrival email to be logged")
+	}
+	logged, err = repo.LogGuestMail(ctx, models.GuestMail{ReservationID: id, Kind: models.GuestMailPreArrival, Email: "john@conformance.test", Subject: "Your stay", SentAt: sentAt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if logged {
+		t.Error("expected a second pre-arrival email to not be logged")
+	}
+
+	if containsReservation(t, due(models.GuestMailPreArrival, start, start), id) {
+		t.Error("expected a reservation sent the pre-arrival email to not be due again")
+	}
+	if !containsReservation(t, due(models.GuestMailCheckOut, end, end), id) {
+		t.Error("expected the check-out reminder to still be due")
+	}
+
+	mails, err := repo.GuestMails(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mails) != 1 || mails[0].Kind != models.GuestMailPreArrival || mails[0].Subject != "Your stay" || !mails[0].SentAt.Equal(sentAt) {
+		t.Errorf("expected the pre-arrival email in the log but got %+v", mails)
+	}
+
+	_, err = repo.ReservationsWithoutGuestMail(ctx, "birthday", start, end)
+	if err == nil {
+		t.Error("expected an error for an unknown kind of guest email")
+	}
+}
+
+func testWebhooks(t *testing.T, repo repository.DatabaseRepo) {
+	ctx := context.Background()
+
+	id, err := repo.InsertWebhook(ctx, models.Webhook{
+		URL:    "https://conformance.test/hooks",
+		Secret: "secret",
+		Events: []string{models.EventReservationCreated, models.EventBlockCreated},
+		Active: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = repo.DeleteWebhook(context.Background(), id) })
+
+	h, err := repo.GetWebhookByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.URL != "https://conformance.test/hooks" || h.Secret != "secret" || !h.Active || !h.Subscribed(models.EventBlockCreated) || h.Subscribed(models.EventReservationCancelled) {
+		t.Errorf("unexpected webhook %+v", h)
+	}
+
+	h.URL = "https://conformance.test/v2/hooks"
+	h.Events = []string{models.EventReservationCancelled}
+	h.Secret = "changed"
+	err = repo.UpdateWebhook(ctx, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err = repo.GetWebhookByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.URL != "https://conformance.test/v2/hooks" || h.Secret != "secret" || len(h.Events) != 1 || !h.Subscribed(models.EventReservationCancelled) {
+		t.Errorf("expected the URL and events to change and the secret to be kept but got %+v", h)
+	}
+
+	hooks, err := repo.AllWebhooks(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, hook := range hooks {
+		found = found || hook.ID == id
+	}
+	if !found {
+		t.Error("expected the webhook to be listed")
+	}
+
+	now := time.Now().Truncate(time.Second)
+	var ids []int
+	for i, next := range []time.Time{now.Add(-time.Minute), now, now.Add(time.Minute)} {
+		deliveryID, err := repo.InsertWebhookDelivery(ctx, models.WebhookDelivery{
+			WebhookID:     id,
+			Event:         models.EventReservationCancelled,
+			Payload:       fmt.Sprintf(`{"n":%d}`, i),
+			Status:        models.DeliveryPending,
+			NextAttemptAt: next,
+			CreatedAt:     now.Add(time.Duration(i) * time.Second),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, deliveryID)
+	}
+
+	_, err = repo.InsertWebhookDelivery(ctx, models.WebhookDelivery{WebhookID: 999999, Event: models.EventPing, Payload: "{}", Status: models.DeliveryPending, NextAttemptAt: now, CreatedAt: now})
+	if !errors.Is(err, repository.ErrConstraint) {
+		t.Errorf("expected ErrConstraint queueing a delivery to a missing webhook but got %v", err)
+	}
+
+	due := func() []models.WebhookDelivery {
+		t.Helper()
+		deliveries, err := repo.DueWebhookDeliveries(ctx, now, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var mine []models.WebhookDelivery
+		for _, d := range deliveries {
+			if d.WebhookID == id {
+				mine = append(mine, d)
+			}
+		}
+		return mine
+	}
+
+	deliveries := due()
+	if len(deliveries) != 2 || deliveries[0].ID != ids[0] || deliveries[1].ID != ids[1] {
+		t.Fatalf("expected the two deliveries that are due, oldest first, but got %+v", deliveries)
+	}
+	if deliveries[0].Webhook.URL != h.URL || deliveries[0].Webhook.Secret != "secret" || deliveries[0].Payload != `{"n":0}` {
+		t.Errorf("expected the delivery with its webhook but got %+v", deliveries[0])
+	}
+
+	delivered := deliveries[0]
+	delivered.Status = models.DeliveryDelivered
+	delivered.Attempts = 1
+	delivered.ResponseCode = 204
+	delivered.DeliveredAt = now
+	err = repo.UpdateWebhookDelivery(ctx, delivered)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	retried := deliveries[1]
+	retried.Attempts = 1
+	retried.ResponseCode = 500
+	retried.Error = "server error"
+	retried.NextAttemptAt = now.Add(time.Hour)
+	err = repo.UpdateWebhookDelivery(ctx, retried)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if deliveries := due(); len(deliveries) != 0 {
+		t.Errorf("expected no deliveries due after the attempts but got %+v", deliveries)
+	}
+
+	log, err := repo.WebhookDeliveries(ctx, id, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(log) != 3 || log[0].ID != ids[2] || log[2].ID != ids[0] {
+		t.Fatalf("expected the 3 deliveries, most recent first, but got %+v", log)
+	}
+	if log[2].Status != models.DeliveryDelivered || log[2].ResponseCode != 204 || !log[2].DeliveredAt.Equal(now) {
+		t.Errorf("expected the delivered attempt to be recorded but got %+v", log[2])
+	}
+	if log[1].Status != models.DeliveryPending || log[1].Error != "server error" || !log[1].DeliveredAt.IsZero() {
+		t.Errorf("expected the failed attempt to be recorded but got %+v", log[1])
+	}
+
+	h.Active = false
+	err = repo.UpdateWebhook(ctx, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.InsertWebhookDelivery(ctx, models.WebhookDelivery{WebhookID: id, Event: models.EventPing, Payload: "{}", Status: models.DeliveryPending, NextAttemptAt: now, CreatedAt: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deliveries := due(); len(deliveries) != 0 {
+		t.Errorf("expected no deliveries to an inactive webhook but got %+v", deliveries)
+	}
+
+	err = repo.DeleteWebhook(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log, err = repo.WebhookDeliveries(ctx, id, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(log) != 0 {
+		t.Errorf("expected the deliveries to be deleted with the webhook but got %d", len(log))
+	}
+	if _, err = repo.GetWebhookByID(ctx, id); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a deleted webhook but got %v", err)
+	}
+	if err = repo.UpdateWebhookDelivery(ctx, delivered); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound updating a deleted delivery but got %v", err)
+	}
+}
+
+func testBookingRules(t *testing.T, repo repository.DatabaseRepo) {
+	ctx := context.Background()
+	start := baseDate()
+
+	id, err := repo.InsertBookingRule(ctx, models.BookingRule{
+		Name:          "Conformance season",
+		RoomID:        majorsSuite,
+		Start:         start,
+		End:           start.AddDays(60),
+		MinNights:     3,
+		MaxNights:     14,
+		MinNotice:     2,
+		MaxAdvance:    365,
+		ArrivalDays:   models.WeekdaysOf(time.Friday, time.Saturday),
+		DepartureDays: models.WeekdaysOf(time.Sunday),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = repo.DeleteBookingRule(context.Background(), id) })
+
+	rule, err := repo.GetBookingRuleByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rule.Name != "Conformance season" || rule.RoomID != majorsSuite || rule.Room.RoomName != "Major's Suite" {
+		t.Errorf("unexpected booking rule %+v", rule)
+	}
+	room, err := repo.GetRoomByID(ctx, majorsSuite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rule.PropertyID != room.PropertyID {
+		t.Errorf("expected the rule of a room to have property %d of the room but got %d", room.PropertyID, rule.PropertyID)
+	}
+	if !rule.Start.Equal(start) || !rule.End.Equal(start.AddDays(60)) {
+		t.Errorf("expected the season %s to %s but got %s to %s", start, start.AddDays(60), rule.Start, rule.End)
+	}
+	if rule.MinNights != 3 || rule.MaxNights != 14 || rule.MinNotice != 2 || rule.MaxAdvance != 365 {
+		t.Errorf("unexpected limits %+v", rule)
+	}
+	if rule.ArrivalDays != models.WeekdaysOf(time.Friday, time.Saturday) || rule.DepartureDays != models.WeekdaysOf(time.Sunday) {
+		t.Errorf("expected arrivals on %s and departures on %s but got %s and %s", "Fri, Sat", "Sun", rule.ArrivalDays, rule.DepartureDays)
+	}
+
+	rule.Name = "Conformance all year"
+	rule.RoomID = 0
+	rule.PropertyID = fortSmythe
+	rule.Start = dates.Date{}
+	rule.End = dates.Date{}
+	rule.ArrivalDays = 0
+	err = repo.UpdateBookingRule(ctx, rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule, err = repo.GetBookingRuleByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rule.Name != "Conformance all year" || rule.RoomID != 0 || rule.PropertyID != fortSmythe || !rule.Start.IsZero() ||
+		!rule.End.IsZero() || rule.ArrivalDays != 0 {
+		t.Errorf("expected a rule for every room of the property all year but got %+v", rule)
+	}
+
+	rules, err := repo.AllBookingRules(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, r := range rules {
+		found = found || r.ID == id
+	}
+	if !found {
+		t.Error("expected the booking rule to be listed")
+	}
+
+	_, err = repo.InsertBookingRule(ctx, models.BookingRule{Name: "Missing room", RoomID: 999999})
+	if !errors.Is(err, repository.ErrConstraint) {
+		t.Errorf("expected ErrConstraint for a rule of a missing room but got %v", err)
+	}
+	_, err = repo.InsertBookingRule(ctx, models.BookingRule{Name: "Missing property", PropertyID: 999999})
+	if !errors.Is(err, repository.ErrConstraint) {
+		t.Errorf("expected ErrConstraint for a rule of a missing property but got %v", err)
+	}
+
+	err = repo.DeleteBookingRule(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = repo.GetBookingRuleByID(ctx, id); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a deleted booking rule but got %v", err)
+	}
+	if err = repo.UpdateBookingRule(ctx, rule); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound updating a deleted booking rule but got %v", err)
+	}
+	if err = repo.DeleteBookingRule(ctx, id); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound deleting a deleted booking rule but got %v", err)
+	}
+}
+
+func testProperties(t *testing.T, repo repository.DatabaseRepo) {
+	ctx := context.Background()
+	suffix := rand.Int()
+
+	room, err := repo.GetRoomByID(ctx, majorsSuite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if room.PropertyID != fortSmythe {
+		t.Errorf("expected the seeded rooms to belong to property %d but got %d", fortSmythe, room.PropertyID)
+	}
+
+	id, err := repo.InsertProperty(ctx, models.Property{
+		Name:       "Conformance Lodge",
+		Slug:       fmt.Sprintf("conformance-%d", suffix),
+		Host:       fmt.Sprintf("lodge-%d.conformance.test", suffix),
+		TimeZone:   "Europe/Lisbon",
+		Currency:   "EUR",
+		MailFrom:   "stay@conformance.test",
+		OwnerEmail: "owner@conformance.test",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = repo.MoveRoom(context.Background(), majorsSuite, fortSmythe)
+		_ = repo.DeleteProperty(context.Background(), id)
+	})
+
+	p, err := repo.GetPropertyByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "Conformance Lodge" || p.TimeZone != "Europe/Lisbon" || p.Currency != "EUR" || p.OwnerEmail != "owner@conformance.test" {
+		t.Errorf("unexpected property %+v", p)
+	}
+
+	_, err = repo.InsertProperty(ctx, models.Property{Name: "Duplicate", Slug: p.Slug})
+	if !errors.Is(err, repository.ErrConstraint) {
+		t.Errorf("expected ErrConstraint for a duplicate slug but got %v", err)
+	}
+	_, err = repo.InsertProperty(ctx, models.Property{Name: "Duplicate", Slug: p.Slug + "-other", Host: p.Host})
+	if !errors.Is(err, repository.ErrConstraint) {
+		t.Errorf("expected ErrConstraint for a duplicate host name but got %v", err)
+	}
+
+	p.Description = "Updated by the conformance suite"
+	p.Host = ""
+	if err = repo.UpdateProperty(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+	p, err = repo.GetPropertyByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Description != "Updated by the conformance suite" || p.Host != "" {
+		t.Errorf("expected the property to be updated but got %+v", p)
+	}
+
+	properties, err := repo.AllProperties(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, other := range properties {
+		found = found || other.ID == id
+	}
+	if !found {
+		t.Error("expected the property to be listed")
+	}
+
+	roomRuleID, err := repo.InsertBookingRule(ctx, models.BookingRule{Name: "Conformance room", RoomID: majorsSuite})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = repo.DeleteBookingRule(context.Background(), roomRuleID) })
+	propertyRuleID, err := repo.InsertBookingRule(ctx, models.BookingRule{Name: "Conformance lodge", PropertyID: id})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = repo.MoveRoom(ctx, majorsSuite, id); err != nil {
+		t.Fatal(err)
+	}
+	room, err = repo.GetRoomByID(ctx, majorsSuite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if room.PropertyID != id {
+		t.Errorf("expected the room to move to property %d but got %d", id, room.PropertyID)
+	}
+	rule, err := repo.GetBookingRuleByID(ctx, roomRuleID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rule.PropertyID != id {
+		t.Errorf("expected the rule of the room to move to property %d but got %d", id, rule.PropertyID)
+	}
+	if err = repo.MoveRoom(ctx, majorsSuite, 999999); !errors.Is(err, repository.ErrConstraint) {
+		t.Errorf("expected ErrConstraint moving a room to a missing property but got %v", err)
+	}
+	if err = repo.MoveRoom(ctx, 999999, id); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound moving a missing room but got %v", err)
+	}
+	if err = repo.DeleteProperty(ctx, id); !errors.Is(err, repository.ErrConstraint) {
+		t.Errorf("expected ErrConstraint deleting a property with rooms but got %v", err)
+	}
+
+	userID, err := repo.InsertUser(ctx, models.User{
+		LastName:    "Scoped",
+		Email:       fmt.Sprintf("scoped-%d@conformance.test", suffix),
+		AccessLevel: models.AccessLevelStaff,
+		Active:      true,
+	}, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = repo.DeleteUser(context.Background(), userID) })
+
+	if err = repo.SetUserProperties(ctx, userID, []int{id, fortSmythe}); err != nil {
+		t.Fatal(err)
+	}
+	u, err := repo.GetUserByID(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(u.PropertyIDs) != 2 || !u.Manages(id) || !u.Manages(fortSmythe) || u.Manages(999999) {
+		t.Errorf("expected the user to manage properties %d and %d but got %v", fortSmythe, id, u.PropertyIDs)
+	}
+	if err = repo.SetUserProperties(ctx, userID, []int{999999}); !errors.Is(err, repository.ErrConstraint) {
+		t.Errorf("expected ErrConstraint for a missing property but got %v", err)
+	}
+	if err = repo.SetUserProperties(ctx, 999999, nil); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a missing user but got %v", err)
+	}
+	if err = repo.SetUserProperties(ctx, userID, nil); err != nil {
+		t.Fatal(err)
+	}
+	u, err = repo.GetUserByID(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(u.PropertyIDs) != 0 || !u.Manages(id) {
+		t.Errorf("expected a user without properties to manage every property but got %v", u.PropertyIDs)
+	}
+
+	if err = repo.MoveRoom(ctx, majorsSuite, fortSmythe); err != nil {
+		t.Fatal(err)
+	}
+	if err = repo.DeleteProperty(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = repo.GetPropertyByID(ctx, id); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a deleted property but got %v", err)
+	}
+	if _, err = repo.GetBookingRuleByID(ctx, propertyRuleID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected the rules of a deleted property to be deleted but got %v", err)
+	}
+	rule, err = repo.GetBookingRuleByID(ctx, roomRuleID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rule.PropertyID != fortSmythe {
+		t.Errorf("expected the rule of the room to stay with the room in property %d but got %d", fortSmythe, rule.PropertyID)
+	}
+	if err = repo.UpdateProperty(ctx, p); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound updating a deleted property but got %v", err)
+	}
+	if err = repo.DeleteProperty(ctx, id); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound deleting a deleted property but got %v", err)
+	}
+}
+
+func containsReservation(t *testing.T, list func(ctx context.Context) ([]models.Reservation, error), id int) bool {
+	t.Helper()
+
+	reservations, err := list(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range reservations {
+		if r.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func testAvailabilityBoundaries(t *testing.T, repo repository.DatabaseRepo) {
+	ctx := context.Background()
+	start := baseDate()
+	end := start.AddDate(0, 0, 3)
+
+	book(t, repo, generalsQuarters, start, end)
+
+	var tableTest = []struct {
+		name      string
+		start     dates.Date
+		end       dates.Date
+		available bool
+	}{
+		{"same dates", start, end, false},
+		{"inside the stay", start.AddDate(0, 0, 1), start.AddDate(0, 0, 2), false},
+		{"around the stay", start.AddDate(0, 0, -1), end.AddDate(0, 0, 1), false},
+		{"overlapping arrival", start.AddDate(0, 0, -2), start.AddDate(0, 0, 1), false},
+		{"overlapping departure", end.AddDate(0, 0, -1), end.AddDate(0, 0, 2), false},
+		{"arrival on departure day", end, end.AddDate(0, 0, 2), true},
+		{"departure on arrival day", start.AddDate(0, 0, -2), start, true},
+		{"a week later", end.AddDate(0, 0, 7), end.AddDate(0, 0, 9), true},
+	}
+
+	for _, test := range tableTest {
+		available, err := repo.SearchAvailabilityByDatesByRoomID(ctx, test.start, test.end, generalsQuarters)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if available != test.available {
+			t.Errorf("case - %s: expected room availability %v but got %v", test.name, test.available, available)
+		}
+
+		rooms, err := repo.SearchAvailabilityForAllRooms(ctx, test.start, test.end)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if containsRoom(rooms, generalsQuarters) != test.available {
+			t.Errorf("case - %s: expected room in all rooms availability to be %v", test.name, test.available)
+		}
+		if !containsRoom(rooms, majorsSuite) {
+			t.Errorf("case - %s: expected the other room to stay available", test.name)
+		}
+	}
+}
+
+func containsRoom(rooms []models.Room, id int) bool {
+	for _, r := range rooms {
+		if r.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func testBlocks(t *testing.T, repo repository.DatabaseRepo) {
+	ctx := context.Background()
+	day := baseDate()
+
+	err := repo.InsertBlockForRoom(ctx, majorsSuite, day)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blockID := findBlock(t, repo, majorsSuite, day)
+	if blockID == 0 {
+		t.Fatal("expected to find the inserted block")
+	}
+	t.Cleanup(func() { _ = repo.DeleteBlockByID(context.Background(), blockID) })
+
+	available, err := repo.SearchAvailabilityByDatesByRoomID(ctx, day, day.AddDate(0, 0, 1), majorsSuite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if available {
+		t.Error("expected a blocked night to be unavailable")
+	}
+
+	available, err = repo.SearchAvailabilityByDatesByRoomID(ctx, day.AddDate(0, 0, 1), day.AddDate(0, 0, 2), majorsSuite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !available {
+		t.Error("expected a block to only cover a single night")
+	}
+
+	if findBlock(t, repo, generalsQuarters, day) != 0 {
+		t.Error("expected a block to only apply to its own room")
+	}
+
+	err = repo.DeleteBlockByID(ctx, blockID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if findBlock(t, repo, majorsSuite, day) != 0 {
+		t.Error("expected block to be removed")
+	}
+
+	available, err = repo.SearchAvailabilityByDatesByRoomID(ctx, day, day.AddDate(0, 0, 1), majorsSuite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !available {
+		t.Error("expected removing the block to make the night available")
+	}
+}
+
+func testUsers(t *testing.T, repo repository.DatabaseRepo) {
+	ctx := context.Background()
+
+	_, err := repo.GetUserByID(ctx, 999999)
+	if !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a user that does not exist but got %v", err)
+	}
+
+	id, _, err := repo.Authenticate(ctx, "nobody@conformance.test", "password")
+	if !errors.Is(err, repository.ErrInvalidCredentials) || id != 0 {
+		t.Errorf("expected ErrInvalidCredentials for an unknown email but got %v", err)
+	}
+
+	id, _, err = repo.Authenticate(ctx, "admin@admin.com", "not the password")
+	if !errors.Is(err, repository.ErrInvalidCredentials) || id != 0 {
+		t.Errorf("expected ErrInvalidCredentials for a wrong password but got %v", err)
+	}
+
+	err = repo.UpdateUser(ctx, models.User{ID: 999999, FirstName: "Nobody", Email: "nobody@conformance.test"})
+	if !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound when updating a user that does not exist but got %v", err)
+	}
+	if err := repo.UpdatePassword(ctx, 999999, "new password"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound when changing the password of a user that does not exist but got %v", err)
+	}
+	if err := repo.DeleteUser(ctx, 999999); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound when deleting a user that does not exist but got %v", err)
+	}
+}
+
+func testUserManagement(t *testing.T, repo repository.DatabaseRepo) {
+	ctx := context.Background()
+	email := fmt.Sprintf("staff-%d@conformance.test", rand.Int())
+
+	id, err := repo.InsertUser(ctx, models.User{
+		FirstName:          "Jane",
+		LastName:           "Conformance",
+		Email:              email,
+		AccessLevel:        models.AccessLevelStaff,
+		Active:             true,
+		MustChangePassword: true,
+	}, "first password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = repo.DeleteUser(context.Background(), id) })
+
+	_, err = repo.InsertUser(ctx, models.User{LastName: "Duplicate", Email: email, Active: true}, "password")
+	if !errors.Is(err, repository.ErrConstraint) {
+		t.Errorf("expected ErrConstraint for a duplicate email but got %v", err)
+	}
+
+	u, err := repo.GetUserByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Email != email || u.AccessLevel != models.AccessLevelStaff || !u.Active || !u.MustChangePassword {
+		t.Errorf("unexpected user %+v", u)
+	}
+	if u.Password == "first password" {
+		t.Error("expected the password to be stored hashed")
+	}
+
+	users, err := repo.AllUsers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, u := range users {
+		if u.ID == id {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("expected the new user in all users")
+	}
+
+	byEmail, err := repo.GetUserByEmail(ctx, email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if byEmail.ID != id || byEmail.Password != u.Password {
+		t.Errorf("expected to find the new user by email but got %+v", byEmail)
+	}
+	if _, err := repo.GetUserByEmail(ctx, "nobody@conformance.test"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for an unknown email but got %v", err)
+	}
+
+	loggedIn, _, err := repo.Authenticate(ctx, email, "first password")
+	if err != nil || loggedIn != id {
+		t.Errorf("expected the new user to log in but got %d, %v", loggedIn, err)
+	}
+
+	err = repo.UpdatePassword(ctx, id, "second password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := repo.Authenticate(ctx, email, "first password"); !errors.Is(err, repository.ErrInvalidCredentials) {
+		t.Errorf("expected the old password to stop working but got %v", err)
+	}
+	u, err = repo.GetUserByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.MustChangePassword {
+		t.Error("expected changing the password to clear the forced change")
+	}
+	if u.SessionVersion != byEmail.SessionVersion+1 {
+		t.Errorf("expected changing the password to bump the session version from %d but got %d", byEmail.SessionVersion, u.SessionVersion)
+	}
+
+	u.AccessLevel = models.AccessLevelManager
+	u.Active = false
+	err = repo.UpdateUser(ctx, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err = repo.GetUserByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.AccessLevel != models.AccessLevelManager || u.Active {
+		t.Errorf("update was not stored: %+v", u)
+	}
+	if _, _, err := repo.Authenticate(ctx, email, "second password"); !errors.Is(err, repository.ErrDisabled) {
+		t.Errorf("expected ErrDisabled for a disabled user but got %v", err)
+	}
+
+	u.Email = "admin@admin.com"
+	if err := repo.UpdateUser(ctx, u); !errors.Is(err, repository.ErrConstraint) {
+		t.Errorf("expected ErrConstraint when taking another user's email but got %v", err)
+	}
+
+	err = repo.DeleteUser(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GetUserByID(ctx, id); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a deleted user but got %v", err)
+	}
+}
+
+func testLoginLockout(t *testing.T, repo repository.DatabaseRepo) {
+	ctx := context.Background()
+	email := fmt.Sprintf("lockout-%d@conformance.test", rand.Int())
+
+	id, err := repo.InsertUser(ctx, models.User{
+		FirstName:   "Jane",
+		LastName:    "Lockout",
+		Email:       email,
+		AccessLevel: models.AccessLevelStaff,
+		Active:      true,
+	}, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = repo.DeleteUser(context.Background(), id) })
+
+	for i := 1; i <= 2; i++ {
+		u, err := repo.RecordFailedLogin(ctx, email)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u.ID != id || u.FailedLogins != i {
+			t.Errorf("expected failed login %d of user %d but got %d of user %d", i, id, u.FailedLogins, u.ID)
+		}
+	}
+	if _, err := repo.RecordFailedLogin(ctx, "nobody@conformance.test"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound when recording a failed login of an unknown email but got %v", err)
+	}
+
+	err = repo.LockUser(ctx, id, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := repo.GetUserByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !u.Locked() || u.FailedLogins != 0 {
+		t.Errorf("expected a locked user with no failed logins but got %+v", u)
+	}
+	if _, _, err := repo.Authenticate(ctx, email, "password"); !errors.Is(err, repository.ErrLocked) {
+		t.Errorf("expected ErrLocked for a locked user but got %v", err)
+	}
+
+	err = repo.UnlockUser(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loggedIn, _, err := repo.Authenticate(ctx, email, "password"); err != nil || loggedIn != id {
+		t.Errorf("expected the unlocked user to log in but got %d, %v", loggedIn, err)
+	}
+
+	err = repo.LockUser(ctx, id, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := repo.Authenticate(ctx, email, "password"); err != nil {
+		t.Errorf("expected an expired lockout to let the user log in but got %v", err)
+	}
+
+	if err := repo.LockUser(ctx, 999999, time.Now()); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound when locking a user that does not exist but got %v", err)
+	}
+	if err := repo.UnlockUser(ctx, 999999); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound when unlocking a user that does not exist but got %v", err)
+	}
+}
+
+func testTwoFactor(t *testing.T, repo repository.DatabaseRepo) {
+	ctx := context.Background()
+	email := fmt.Sprintf("totp-%d@conformance.test", rand.Int())
+
+	id, err := repo.InsertUser(ctx, models.User{
+		FirstName:   "Jane",
+		LastName:    "Two-Factor",
+		Email:       email,
+		AccessLevel: models.AccessLevelStaff,
+		Active:      true,
+	}, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = repo.DeleteUser(context.Background(), id) })
+
+	err = repo.EnableTOTP(ctx, id, "JBSWY3DPEHPK3PXP", []string{"AAAAA-BBBBB", "CCCCC-DDDDD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := repo.GetUserByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !u.TOTPEnabled || u.TOTPSecret != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("expected two-factor authentication to be enabled but got %+v", u)
+	}
+
+	if err := repo.UseRecoveryCode(ctx, id, "aaaaabbbbb"); err != nil {
+		t.Errorf("expected a recovery code to be accepted regardless of case and dashes but got %v", err)
+	}
+	if err := repo.UseRecoveryCode(ctx, id, "AAAAA-BBBBB"); !errors.Is(err, repository.ErrInvalidCredentials) {
+		t.Errorf("expected ErrInvalidCredentials for a used recovery code but got %v", err)
+	}
+	if err := repo.UseRecoveryCode(ctx, id, "EEEEE-FFFFF"); !errors.Is(err, repository.ErrInvalidCredentials) {
+		t.Errorf("expected ErrInvalidCredentials for an unknown recovery code but got %v", err)
+	}
+
+	if err := repo.UseTOTPCounter(ctx, id, 1000); err != nil {
+		t.Errorf("expected the first authentication code to be accepted but got %v", err)
+	}
+	if err := repo.UseTOTPCounter(ctx, id, 1000); !errors.Is(err, repository.ErrInvalidCredentials) {
+		t.Errorf("expected ErrInvalidCredentials for a used authentication code but got %v", err)
+	}
+	if err := repo.UseTOTPCounter(ctx, id, 999); !errors.Is(err, repository.ErrInvalidCredentials) {
+		t.Errorf("expected ErrInvalidCredentials for the code of an earlier period but got %v", err)
+	}
+	if err := repo.UseTOTPCounter(ctx, id, 1001); err != nil {
+		t.Errorf("expected the code of a later period to be accepted but got %v", err)
+	}
+
+	err = repo.EnableTOTP(ctx, id, "KRSXG5CTMVRXEZLU", []string{"GGGGG-HHHHH"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.UseTOTPCounter(ctx, id, 10); err != nil {
+		t.Errorf("expected a new secret to start over with the used codes but got %v", err)
+	}
+	if err := repo.UseRecoveryCode(ctx, id, "CCCCC-DDDDD"); !errors.Is(err, repository.ErrInvalidCredentials) {
+		t.Errorf("expected enabling again to replace the recovery codes but got %v", err)
+	}
+
+	err = repo.DisableTOTP(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err = repo.GetUserByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.TOTPEnabled || u.TOTPSecret != "" {
+		t.Errorf("expected two-factor authentication to be disabled but got %+v", u)
+	}
+	if err := repo.UseRecoveryCode(ctx, id, "GGGGG-HHHHH"); !errors.Is(err, repository.ErrInvalidCredentials) {
+		t.Errorf("expected disabling to delete the recovery codes but got %v", err)
+	}
+
+	if err := repo.EnableTOTP(ctx, 999999, "JBSWY3DPEHPK3PXP", nil); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound when enabling two-factor authentication of a user that does not exist but got %v", err)
+	}
+	if err := repo.DisableTOTP(ctx, 999999); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound when disabling two-factor authentication of a user that does not exist but got %v", err)
+	}
+}
+
+func testSessions(t *testing.T, repo repository.DatabaseRepo) {
+	ctx := context.Background()
+	userID := 900000 + rand.Intn(99999)
+	token := fmt.Sprintf("token-%d", rand.Int())
+
+	t.Cleanup(func() {
+		_ = repo.DeleteSessionToken(context.Background(), token)
+		_ = repo.DeleteUserSessions(context.Background(), userID)
+	})
+
+	if _, err := repo.FindSession(ctx, token); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a session that does not exist but got %v", err)
+	}
+
+	err := repo.CommitSession(ctx, models.Session{
+		Token:  token,
+		Data:   []byte("anonymous"),
+		Expiry: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repo.CommitSession(ctx, models.Session{
+		Token:     token,
+		Data:      []byte("logged in"),
+		Expiry:    time.Now().Add(2 * time.Hour),
+		UserID:    userID,
+		IP:        "192.0.2.1",
+		UserAgent: "conformance",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := repo.FindSession(ctx, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(s.Data) != "logged in" || s.UserID != userID || s.IP != "192.0.2.1" || s.UserAgent != "conformance" {
+		t.Errorf("expected the second commit to replace the session but got %+v", s)
+	}
+	if s.Expiry.Before(time.Now().Add(time.Hour)) {
+		t.Errorf("expected the second commit to replace the expiry but got %s", s.Expiry)
+	}
+
+	expired := fmt.Sprintf("expired-%d", rand.Int())
+	err = repo.CommitSession(ctx, models.Session{Token: expired, Data: []byte("old"), Expiry: time.Now().Add(-time.Minute), UserID: userID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.FindSession(ctx, expired); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for an expired session but got %v", err)
+	}
+
+	sessions, err := repo.UserSessions(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || sessions[0].ID != s.ID {
+		t.Errorf("expected the unexpired session of the user but got %+v", sessions)
+	}
+
+	n, err := repo.DeleteExpiredSessions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n < 1 {
+		t.Errorf("expected the expired session to be deleted but %d sessions were", n)
+	}
+	if _, err := repo.FindSession(ctx, token); err != nil {
+		t.Errorf("expected deleting expired sessions to keep the current one but got %v", err)
+	}
+
+	if err := repo.DeleteSession(ctx, s.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.FindSession(ctx, token); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a revoked session but got %v", err)
+	}
+	if err := repo.DeleteSession(ctx, s.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound when revoking a session twice but got %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		err = repo.CommitSession(ctx, models.Session{Token: fmt.Sprintf("%s-%d", token, i), Data: []byte("x"), Expiry: time.Now().Add(time.Hour), UserID: userID})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.DeleteUserSessions(ctx, userID); err != nil {
+		t.Fatal(err)
+	}
+	sessions, err = repo.UserSessions(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 0 {
+		t.Errorf("expected no sessions after revoking all of them but got %d", len(sessions))
+	}
+
+	if err := repo.DeleteSessionToken(ctx, "no such token"); err != nil {
+		t.Errorf("expected deleting a missing token to be a no-op but got %v", err)
+	}
+}
+
+func testGuests(t *testing.T, repo repository.DatabaseRepo) {
+	ctx := context.Background()
+	email := fmt.Sprintf("guest-%d@conformance.test", rand.Int())
+
+	id, err := repo.InsertGuest(ctx, models.Guest{
+		FirstName: "Gina",
+		LastName:  "Guest",
+		Email:     email,
+		Phone:     "555-555-0000",
+	}, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = repo.DeleteGuest(context.Background(), id) })
+
+	if _, err := repo.AuthenticateGuest(ctx, email, "password"); !errors.Is(err, repository.ErrInvalidCredentials) {
+		t.Errorf("expected ErrInvalidCredentials before the email is verified but got %v", err)
+	}
+	again, err := repo.InsertGuest(ctx, models.Guest{FirstName: "Gina", LastName: "Guest", Email: email}, "new password")
+	if err != nil || again != id {
+		t.Errorf("expected registering again to replace the unverified registration of %d but got %d, %v", id, again, err)
+	}
+
+	g, err := repo.GetGuestByEmail(ctx, email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.ID != id || g.FirstName != "Gina" || g.Phone != "555-555-0000" || g.EmailVerified || g.HasAccount() || g.PendingPassword == "" {
+		t.Errorf("expected the unverified guest %d but got %+v", id, g)
+	}
+	if _, err := repo.GetGuestByID(ctx, 999999); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a guest that does not exist but got %v", err)
+	}
+
+	if err := repo.VerifyGuestEmail(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if g, err = repo.GetGuestByID(ctx, id); err != nil || !g.EmailVerified || !g.HasAccount() || g.PendingPassword != "" {
+		t.Errorf("expected a verified guest with an account but got %+v, %v", g, err)
+	}
+	if err := repo.VerifyGuestEmail(ctx, 999999); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound when verifying a guest that does not exist but got %v", err)
+	}
+
+	if loggedIn, err := repo.AuthenticateGuest(ctx, email, "new password"); err != nil || loggedIn != id {
+		t.Errorf("expected the guest to log in with the latest registration but got %d, %v", loggedIn, err)
+	}
+	if _, err := repo.AuthenticateGuest(ctx, email, "password"); !errors.Is(err, repository.ErrInvalidCredentials) {
+		t.Errorf("expected ErrInvalidCredentials for the replaced registration but got %v", err)
+	}
+	if _, err := repo.AuthenticateGuest(ctx, "nobody@conformance.test", "password"); !errors.Is(err, repository.ErrInvalidCredentials) {
+		t.Errorf("expected ErrInvalidCredentials for an unknown guest but got %v", err)
+	}
+	if _, err := repo.InsertGuest(ctx, models.Guest{Email: email}, "password"); !errors.Is(err, repository.ErrConstraint) {
+		t.Errorf("expected ErrConstraint when registering a verified email again but got %v", err)
+	}
+
+	if err := repo.UpdateGuestPassword(ctx, id, "reset password"); err != nil {
+		t.Fatal(err)
+	}
+	if loggedIn, err := repo.AuthenticateGuest(ctx, email, "reset password"); err != nil || loggedIn != id {
+		t.Errorf("expected the guest to log in with the reset password but got %d, %v", loggedIn, err)
+	}
+	if err := repo.UpdateGuestPassword(ctx, 999999, "reset password"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound when resetting the password of a guest that does not exist but got %v", err)
+	}
+
+	base := baseDate()
+	anonymous := func(start dates.Date, email string) int {
+		resID, err := repo.InsertReservation(ctx, models.Reservation{
+			FirstName: "Gina",
+			LastName:  "Guest",
+			Email:     email,
+			StartDate: start,
+			EndDate:   start.AddDate(0, 0, 1),
+			RoomID:    generalsQuarters,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = repo.DeleteReservation(context.Background(), resID) })
+		return resID
+	}
+
+	booked, err := repo.InsertReservation(ctx, models.Reservation{
+		FirstName: "Gina",
+		Email:     email,
+		StartDate: base.AddDate(0, 0, 10),
+		EndDate:   base.AddDate(0, 0, 11),
+		RoomID:    majorsSuite,
+		GuestID:   id,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = repo.DeleteReservation(context.Background(), booked) })
+
+	past := anonymous(base, strings.ToUpper(email))
+	anonymous(base.AddDate(0, 0, 2), "someone-else@conformance.test")
+
+	n, err := repo.ClaimReservations(ctx, id, email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("expected to claim the anonymous reservation made with the email of the guest but claimed %d", n)
+	}
+	if n, _ := repo.ClaimReservations(ctx, id, email); n != 0 {
+		t.Errorf("expected claimed reservations not to be claimed again but claimed %d", n)
+	}
+
+	reservations, err := repo.GuestReservations(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reservations) != 2 || reservations[0].ID != booked || reservations[1].ID != past {
+		t.Fatalf("expected the booked and the claimed reservation, the latest first, but got %+v", reservations)
+	}
+	if reservations[0].Room.RoomName != "Major's Suite" || reservations[0].GuestID != id {
+		t.Errorf("expected the reservation with its room and guest but got %+v", reservations[0])
+	}
+
+	if err := repo.DeleteGuest(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	res, err := repo.GetReservationByID(ctx, booked)
+	if err != nil {
+		t.Errorf("expected the reservations of a deleted guest to be kept but got %v", err)
+	}
+	if res.ID != booked {
+		t.Errorf("expected reservation %d but got %+v", booked, res)
+	}
+	if reservations, _ := repo.GuestReservations(ctx, id); len(reservations) != 0 {
+		t.Errorf("expected no reservations of a deleted guest but got %d", len(reservations))
+	}
+	if err := repo.DeleteGuest(ctx, id); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound when deleting a guest twice but got %v", err)
+	}
+}
+
+func testGuestProfiles(t *testing.T, repo repository.DatabaseRepo) {
+	ctx := context.Background()
+	suffix := rand.Int()
+	email := fmt.Sprintf("profile-%d@conformance.test", suffix)
+	other := fmt.Sprintf("profile-other-%d@conformance.test", suffix)
+	lastName := fmt.Sprintf("Profile%d", suffix)
+
+	id, err := repo.FindOrCreateGuest(ctx, models.Guest{FirstName: "Paula", LastName: lastName, Email: email})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = repo.DeleteGuest(context.Background(), id) })
+
+	again, err := repo.FindOrCreateGuest(ctx, models.Guest{FirstName: "P.", LastName: lastName, Email: email, Phone: "+1 (555) 010-2030"})
+	if err != nil || again != id {
+		t.Fatalf("expected the profile %d of the email address but got %d, %v", id, again, err)
+	}
+	g, err := repo.GetGuestByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.FirstName != "Paula" || g.Phone != "+1 (555) 010-2030" || g.HasAccount() {
+		t.Errorf("expected the profile without an account with its phone number filled in but got %+v", g)
+	}
+	if _, err := repo.AuthenticateGuest(ctx, email, ""); !errors.Is(err, repository.ErrInvalidCredentials) {
+		t.Errorf("expected ErrInvalidCredentials for a guest without an account but got %v", err)
+	}
+
+	g.Notes = "Allergic to feathers"
+	g.Tags = []string{models.TagVIP}
+	if err := repo.UpdateGuestProfile(ctx, g); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.UpdateGuestProfile(ctx, models.Guest{ID: 999999}); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound when updating a guest that does not exist but got %v", err)
+	}
+
+	duplicate, err := repo.FindOrCreateGuest(ctx, models.Guest{FirstName: "Paul", LastName: "Other", Email: other, Phone: "15550102030"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = repo.DeleteGuest(context.Background(), duplicate) })
+	if duplicate == id {
+		t.Errorf("expected another email address with the same phone number to get its own profile")
+	}
+	if err := repo.UpdateGuestProfile(ctx, models.Guest{ID: duplicate, FirstName: "Paul", LastName: "Other", Phone: "15550102030",
+		Notes: "Asked for a quiet room", Tags: []string{models.TagVIP, models.TagDoNotRent}}); err != nil {
+		t.Fatal(err)
+	}
+
+	duplicates, err := repo.GuestDuplicates(ctx, g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(duplicates) != 1 || duplicates[0].ID != duplicate {
+		t.Errorf("expected the guest with the same phone number as a duplicate but got %+v", duplicates)
+	}
+
+	base := baseDate()
+	for i, e := range []string{email, other} {
+		start := base.AddDate(0, 0, i*3)
+		resID, err := repo.InsertReservation(ctx, models.Reservation{
+			FirstName: "Paula",
+			LastName:  lastName,
+			Email:     e,
+			StartDate: start,
+			EndDate:   start.AddDate(0, 0, 2),
+			RoomID:    generalsQuarters,
+			GuestID:   []int{id, duplicate}[i],
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = repo.DeleteReservation(context.Background(), resID) })
+	}
+
+	all, err := repo.GetAllReservations(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	guestStays := 0
+	for _, res := range all {
+		if res.GuestID == id {
+			guestStays++
+		}
+	}
+	if guestStays != 1 {
+		t.Errorf("expected all reservations to name the guest of one of them but got %d", guestStays)
+	}
+
+	found, err := repo.AllGuests(ctx, lastName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].ID != id || found[0].Stays != 1 || !found[0].LastStay.Equal(base) {
+		t.Errorf("expected to find the guest by name with one stay but got %+v", found)
+	}
+	if found, _ := repo.AllGuests(ctx, "0102030"); len(found) != 2 {
+		t.Errorf("expected to find both guests by phone number but got %d", len(found))
+	}
+
+	if err := repo.MergeGuests(ctx, id, id); !errors.Is(err, repository.ErrConstraint) {
+		t.Errorf("expected ErrConstraint when merging a guest into itself but got %v", err)
+	}
+	if err := repo.MergeGuests(ctx, id, duplicate); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GetGuestByID(ctx, duplicate); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected the merged guest to be deleted but got %v", err)
+	}
+	g, err = repo.GetGuestByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !g.HasTag(models.TagVIP) || !g.HasTag(models.TagDoNotRent) || len(g.Tags) != 2 ||
+		!strings.Contains(g.Notes, "feathers") || !strings.Contains(g.Notes, "quiet room") || !strings.Contains(g.Notes, other) {
+		t.Errorf("expected the tags and notes of both guests but got %+v", g)
+	}
+	reservations, err := repo.GuestReservations(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reservations) != 2 {
+		t.Errorf("expected the reservations of both guests but got %d", len(reservations))
+	}
+
+	registered, err := repo.InsertGuest(ctx, models.Guest{FirstName: "Pauline", LastName: "Registered", Email: email, Phone: "555-555-0000"}, "password")
+	if err != nil || registered != id {
+		t.Fatalf("expected registering to give the profile %d a pending registration but got %d, %v", id, registered, err)
+	}
+	if _, err := repo.AuthenticateGuest(ctx, email, "password"); !errors.Is(err, repository.ErrInvalidCredentials) {
+		t.Errorf("expected the profile to have no account before the email is verified but got %v", err)
+	}
+	if g, _ := repo.GetGuestByID(ctx, id); g.EmailVerified || g.HasAccount() ||
+		g.FirstName != "Paula" || g.LastName != lastName || g.Phone != "+1 (555) 010-2030" {
+		t.Errorf("expected the registered profile to be unverified and keep its names and phone number but got %+v", g)
+	}
+	if err := repo.VerifyGuestEmail(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if loggedIn, err := repo.AuthenticateGuest(ctx, email, "password"); err != nil || loggedIn != id {
+		t.Errorf("expected the guest to log in once the email is verified but got %d, %v", loggedIn, err)
+	}
+
+	other2, err := repo.FindOrCreateGuest(ctx, models.Guest{FirstName: "Paul", LastName: "Other", Email: other})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = repo.DeleteGuest(context.Background(), other2) })
+	if err := repo.MergeGuests(ctx, other2, id); !errors.Is(err, repository.ErrConstraint) {
+		t.Errorf("expected ErrConstraint when merging a guest with an account into another but got %v", err)
+	}
+	if err := repo.MergeGuests(ctx, id, 999999); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound when merging a guest that does not exist but got %v", err)
+	}
+}
+
+func testDomainErrors(t *testing.T, repo repository.DatabaseRepo) {
+	ctx := context.Background()
+	start := baseDate()
+	end := start.AddDate(0, 0, 2)
+
+	book(t, repo, generalsQuarters, start, end)
+
+	err := repo.InsertRoomRestriction(ctx, models.RoomRestriction{
+		StartDate:     start.AddDate(0, 0, 1),
+		EndDate:       end.AddDate(0, 0, 1),
+		RoomID:        generalsQuarters,
+		RestrictionID: ownerBlockType,
+	})
+	if !errors.Is(err, repository.ErrUnavailable) {
+		t.Errorf("expected ErrUnavailable for an overlapping restriction but got %v", err)
+	}
+
+	err = repo.InsertBlockForRoom(ctx, generalsQuarters, start)
+	if !errors.Is(err, repository.ErrUnavailable) {
+		t.Errorf("expected ErrUnavailable when blocking a reserved night but got %v", err)
+	}
+
+	_, err = repo.InsertReservation(ctx, models.Reservation{
+		LastName:  "Conformance",
+		Email:     "john@conformance.test",
+		StartDate: start,
+		EndDate:   end,
+		RoomID:    999999,
+	})
+	if !errors.Is(err, repository.ErrConstraint) {
+		t.Errorf("expected ErrConstraint for a reservation of an unknown room but got %v", err)
+	}
+
+	var tableTest = []struct {
+		name string
+		fn   func() error
+	}{
+		{"update reservation", func() error {
+			return repo.UpdateReservation(ctx, models.Reservation{ID: 999999, LastName: "Nobody"})
+		}},
+		{"delete reservation", func() error { return repo.DeleteReservation(ctx, 999999) }},
+		{"process reservation", func() error { return repo.UpdateProcessedForReservation(ctx, 999999, 1) }},
+		{"delete block", func() error { return repo.DeleteBlockByID(ctx, 999999) }},
+	}
+
+	for _, test := range tableTest {
+		if err := test.fn(); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("case - %s: expected ErrNotFound for a missing id but got %v", test.name, err)
+		}
+	}
+}
+
+func testConcurrentAccess(t *testing.T, repo repository.DatabaseRepo) {
+	start := baseDate()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx := context.Background()
+			day := start.AddDate(0, 0, i*2)
+
+			id, err := repo.InsertReservation(ctx, models.Reservation{
+				LastName:  "Concurrent",
+				Email:     "concurrent@conformance.test",
+				StartDate: day,
+				EndDate:   day.AddDate(0, 0, 1),
+				RoomID:    generalsQuarters,
+			})
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer repo.DeleteReservation(context.Background(), id)
+
+			err = repo.InsertRoomRestriction(ctx, models.RoomRestriction{
+				StartDate:     day,
+				EndDate:       day.AddDate(0, 0, 1),
+				RoomID:        generalsQuarters,
+				ReservationID: id,
+				RestrictionID: reservationType,
+			})
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			if _, err := repo.SearchAvailabilityForAllRooms(ctx, day, day.AddDate(0, 0, 1)); err != nil {
+				errs <- err
+			}
+			if _, err := repo.GetAllReservations(ctx); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+// testDoubleBooking races several bookings of the same night and expects
+// exactly one of them to get the room
+func testDoubleBooking(t *testing.T, repo repository.DatabaseRepo) {
+	day := baseDate()
+
+	var wg sync.WaitGroup
+	results := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx := context.Background()
+
+			id, err := repo.InsertReservation(ctx, models.Reservation{
+				LastName:  "Double",
+				Email:     "double@conformance.test",
+				StartDate: day,
+				EndDate:   day.AddDate(0, 0, 1),
+				RoomID:    majorsSuite,
+			})
+			if err != nil {
+				results <- err
+				return
+			}
+			t.Cleanup(func() { _ = repo.DeleteReservation(context.Background(), id) })
+
+			results <- repo.InsertRoomRestriction(ctx, models.RoomRestriction{
+				StartDate:     day,
+				EndDate:       day.AddDate(0, 0, 1),
+				RoomID:        majorsSuite,
+				ReservationID: id,
+				RestrictionID: reservationType,
+			})
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	booked := 0
+	for err := range results {
+		switch {
+		case err == nil:
+			booked++
+		case !errors.Is(err, repository.ErrUnavailable):
+			t.Errorf("expected ErrUnavailable for a losing booking but got %v", err)
+		}
+	}
+	if booked != 1 {
+		t.Errorf("expected exactly one booking to succeed but got %d", booked)
+	}
+}
+
+func testCancelledContext(t *testing.T, repo repository.DatabaseRepo) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := repo.GetAllRooms(ctx); err == nil {
+		t.Error("expected GetAllRooms to fail with a cancelled context")
+	}
+	if _, err := repo.SearchAvailabilityForAllRooms(ctx, baseDate(), baseDate().AddDate(0, 0, 1)); err == nil {
+		t.Error("expected SearchAvailabilityForAllRooms to fail with a cancelled context")
+	}
+}
@@ -0,0 +1,195 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron expression
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	// domAny and dowAny are set for a * day of month or day of week, cron matches either day field
+	// when both are restricted
+	domAny, dowAny bool
+	// every is set for @every schedules, which run at multiples of it since the zero time
+	every time.Duration
+}
+
+// field are the bounds of a cron field
+type field struct {
+	name     string
+	min, max int
+}
+
+var (
+	minuteField = field{"minute", 0, 59}
+	hourField   = field{"hour", 0, 23}
+	domField    = field{"day of month", 1, 31}
+	monthField  = field{"month", 1, 12}
+	dowField    = field{"day of week", 0, 7}
+)
+
+// descriptors are the shorthands for common schedules
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse parses a cron expression of five fields (minute, hour, day of month, month, day of week) made of
+// numbers, ranges, lists and steps such as "*/15 8-18 * * 1-5", a descriptor such as "@daily" or an
+// interval such as "@every 5m"
+func Parse(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+
+	if strings.HasPrefix(spec, "@every ") {
+		every, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every ")))
+		if err != nil {
+			return Schedule{}, fmt.Errorf("invalid interval in %q: %w", spec, err)
+		}
+		if every < time.Second {
+			return Schedule{}, fmt.Errorf("interval in %q is shorter than a second", spec)
+		}
+		return Schedule{every: every}, nil
+	}
+
+	if d, ok := descriptors[spec]; ok {
+		spec = d
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return Schedule{}, fmt.Errorf("expected 5 fields in %q but got %d", spec, len(fields))
+	}
+
+	var s Schedule
+	var err error
+	for i, f := range []struct {
+		bits *uint64
+		def  field
+	}{
+		{&s.minute, minuteField},
+		{&s.hour, hourField},
+		{&s.dom, domField},
+		{&s.month, monthField},
+		{&s.dow, dowField},
+	} {
+		*f.bits, err = parseField(fields[i], f.def)
+		if err != nil {
+			return Schedule{}, fmt.Errorf("invalid %s in %q: %w", f.def.name, spec, err)
+		}
+	}
+
+	// 7 is Sunday as well
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domAny = fields[2] == "*"
+	s.dowAny = fields[4] == "*"
+
+	return s, nil
+}
+
+// parseField returns the set of values of a comma separated cron field as bits
+func parseField(s string, f field) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(s, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			rng = part[:i]
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+		}
+
+		lo, hi := f.min, f.max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			i := strings.Index(rng, "-")
+			var err1, err2 error
+			lo, err1 = strconv.Atoi(rng[:i])
+			hi, err2 = strconv.Atoi(rng[i+1:])
+			if err1 != nil || err2 != nil {
+				return 0, fmt.Errorf("invalid range %q", rng)
+			}
+		default:
+			var err error
+			lo, err = strconv.Atoi(rng)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value %q", rng)
+			}
+			// a single value with a step runs from the value to the end of the field
+			if rng != part {
+				hi = f.max
+			} else {
+				hi = lo
+			}
+		}
+
+		if lo < f.min || hi > f.max || lo > hi {
+			return 0, fmt.Errorf("%q is outside %d-%d", part, f.min, f.max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+
+	if bits == 0 {
+		return 0, errors.New("no values")
+	}
+	return bits, nil
+}
+
+// has reports whether the bit of v is set
+func has(bits uint64, v int) bool {
+	return bits&(1<<v) != 0
+}
+
+// dayMatches reports whether the day of t matches the day of month and day of week fields
+func (s Schedule) dayMatches(t time.Time) bool {
+	dom := has(s.dom, t.Day())
+	dow := has(s.dow, int(t.Weekday()))
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next returns the first time after t the schedule runs at, in the location of t, or the zero time
+// for a schedule that never runs, such as on the 31st of February
+func (s Schedule) Next(t time.Time) time.Time {
+	if s.every > 0 {
+		return t.Truncate(s.every).Add(s.every)
+	}
+
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		switch {
+		case !has(s.month, int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case !has(s.hour, t.Hour()):
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case !has(s.minute, t.Minute()):
+			t = t.Truncate(time.Minute).Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
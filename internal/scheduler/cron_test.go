@@ -0,0 +1,77 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	var tableTest = []struct {
+		name          string
+		spec          string
+		expectedError bool
+	}{
+		{"every minute", "* * * * *", false},
+		{"steps and ranges", "*/15 8-18 * * 1-5", false},
+		{"lists", "0,30 6,18 1,15 * *", false},
+		{"range with step", "0 9-17/2 * * *", false},
+		{"value with step", "5/20 * * * *", false},
+		{"sunday as 7", "0 0 * * 7", false},
+		{"descriptor", "@daily", false},
+		{"interval", "@every 90s", false},
+		{"too few fields", "* * * *", true},
+		{"out of range", "60 * * * *", true},
+		{"reversed range", "0 18-8 * * *", true},
+		{"zero step", "*/0 * * * *", true},
+		{"not a number", "a * * * *", true},
+		{"unknown descriptor", "@fortnightly", true},
+		{"invalid interval", "@every soon", true},
+		{"short interval", "@every 10ms", true},
+	}
+
+	for _, test := range tableTest {
+		_, err := Parse(test.spec)
+		if (err != nil) != test.expectedError {
+			t.Errorf("case - %s: expected error %t but got %v", test.name, test.expectedError, err)
+		}
+	}
+}
+
+func TestSchedule_Next(t *testing.T) {
+	// a Tuesday
+	from := time.Date(2021, 10, 19, 14, 7, 30, 0, time.UTC)
+
+	var tableTest = []struct {
+		name     string
+		spec     string
+		expected time.Time
+	}{
+		{"every minute", "* * * * *", time.Date(2021, 10, 19, 14, 8, 0, 0, time.UTC)},
+		{"quarter hours", "*/15 * * * *", time.Date(2021, 10, 19, 14, 15, 0, 0, time.UTC)},
+		{"hourly", "@hourly", time.Date(2021, 10, 19, 15, 0, 0, 0, time.UTC)},
+		{"daily at six", "0 6 * * *", time.Date(2021, 10, 20, 6, 0, 0, 0, time.UTC)},
+		{"later today", "30 18 * * *", time.Date(2021, 10, 19, 18, 30, 0, 0, time.UTC)},
+		{"weekly", "@weekly", time.Date(2021, 10, 24, 0, 0, 0, 0, time.UTC)},
+		{"sunday as 7", "0 0 * * 7", time.Date(2021, 10, 24, 0, 0, 0, 0, time.UTC)},
+		{"weekdays", "0 9 * * 1-5", time.Date(2021, 10, 20, 9, 0, 0, 0, time.UTC)},
+		{"monthly", "@monthly", time.Date(2021, 11, 1, 0, 0, 0, 0, time.UTC)},
+		{"yearly", "@yearly", time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"day of month or week", "0 0 1 * 5", time.Date(2021, 10, 22, 0, 0, 0, 0, time.UTC)},
+		{"leap day", "0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"never", "0 0 31 2 *", time.Time{}},
+		{"interval", "@every 5m", time.Date(2021, 10, 19, 14, 10, 0, 0, time.UTC)},
+	}
+
+	for _, test := range tableTest {
+		s, err := Parse(test.spec)
+		if err != nil {
+			t.Errorf("case - %s: %v", test.name, err)
+			continue
+		}
+
+		next := s.Next(from)
+		if !next.Equal(test.expected) {
+			t.Errorf("case - %s: expected %s but got %s", test.name, test.expected, next)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+// Package scheduler runs background jobs on cron schedules. Every run is claimed in the database first,
+// so when several instances of the application share a database each scheduled run happens only once,
+// and the outcome of every run is kept as job history.
+package scheduler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/adewidyatamadb/GoBookings/internal/models"
+	"github.com/adewidyatamadb/GoBookings/internal/repository"
+)
+
+// bookkeepingTimeout bounds the database calls that claim, record and release a run
+const bookkeepingTimeout = 10 * time.Second
+
+// Func is the work of a job, ctx is cancelled when the job timeout passes
+type Func func(ctx context.Context) error
+
+// Status is the state of a job in this instance
+type Status struct {
+	Name    string
+	Spec    string
+	Timeout time.Duration
+	Next    time.Time
+	Running bool
+}
+
+// job is a job added to the scheduler
+type job struct {
+	name     string
+	spec     string
+	schedule Schedule
+	timeout  time.Duration
+	run      Func
+
+	mu      sync.Mutex
+	next    time.Time
+	running bool
+}
+
+// Scheduler runs jobs on their schedules
+type Scheduler struct {
+	db    repository.DatabaseRepo
+	owner string
+	now   func() time.Time
+
+	mu      sync.Mutex
+	jobs    []*job
+	started bool
+}
+
+// New returns a scheduler that claims and records runs in db under the name of owner, an empty owner is
+// replaced by the host name, process id and a random suffix
+func New(db repository.DatabaseRepo, owner string) *Scheduler {
+	if owner == "" {
+		owner = defaultOwner()
+	}
+
+	return &Scheduler{
+		db:    db,
+		owner: owner,
+		now:   time.Now,
+	}
+}
+
+// defaultOwner names this process in job locks and history
+func defaultOwner() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(b))
+}
+
+// Owner returns the name this scheduler claims runs under
+func (s *Scheduler) Owner() string {
+	return s.owner
+}
+
+// SetLocation makes the schedules follow the clock of loc rather than the local time of the server, so that a
+// daily job runs at the same hour for the property wherever the server is
+func (s *Scheduler) SetLocation(loc *time.Location) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started {
+		return errors.New("cannot change the location of a started scheduler")
+	}
+	s.now = func() time.Time {
+		return time.Now().In(loc)
+	}
+
+	return nil
+}
+
+// Add adds a job that calls run on the cron schedule spec, the database lock of a run is kept for timeout
+// and the context passed to run is cancelled after it
+func (s *Scheduler) Add(name, spec string, timeout time.Duration, run Func) error {
+	schedule, err := Parse(spec)
+	if err != nil {
+		return err
+	}
+	if timeout <= 0 {
+		return fmt.Errorf("job %s needs a positive timeout", name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started {
+		return errors.New("cannot add jobs to a started scheduler")
+	}
+	for _, j := range s.jobs {
+		if j.name == name {
+			return fmt.Errorf("job %s already exists", name)
+		}
+	}
+
+	s.jobs = append(s.jobs, &job{
+		name:     name,
+		spec:     spec,
+		schedule: schedule,
+		timeout:  timeout,
+		run:      run,
+	})
+
+	return nil
+}
+
+// Start runs every job on its schedule until the returned function is called, which waits for running jobs
+func (s *Scheduler) Start() (stop func()) {
+	s.mu.Lock()
+	s.started = true
+	jobs := s.jobs
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+
+	for _, j := range jobs {
+		wg.Add(1)
+		go func(j *job) {
+			defer wg.Done()
+			s.loop(j, done)
+		}(j)
+	}
+
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+// loop waits for every scheduled time of j and runs it until done is closed
+func (s *Scheduler) loop(j *job, done chan struct{}) {
+	for {
+		next := j.schedule.Next(s.now())
+		if next.IsZero() {
+			log.Printf("job %s is never scheduled", j.name)
+			return
+		}
+
+		j.mu.Lock()
+		j.next = next
+		j.mu.Unlock()
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+			if _, err := s.runOnce(j, next); err != nil {
+				log.Printf("job %s: %v", j.name, err)
+			}
+		case <-done:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// runOnce runs j for the time it was scheduled for unless another instance has claimed that run, it
+// reports whether the job ran and returns the error of the job or of the bookkeeping
+func (s *Scheduler) runOnce(j *job, scheduledFor time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), bookkeepingTimeout)
+	now := s.now()
+	claimed, err := s.db.ClaimJob(ctx, j.name, s.owner, scheduledFor, now.Add(j.timeout), now)
+	cancel()
+	if err != nil {
+		return false, fmt.Errorf("cannot claim run: %w", err)
+	}
+	if !claimed {
+		return false, nil
+	}
+
+	j.mu.Lock()
+	j.running = true
+	j.mu.Unlock()
+
+	run := models.JobRun{
+		Name:         j.name,
+		Owner:        s.owner,
+		ScheduledFor: scheduledFor,
+		StartedAt:    s.now(),
+	}
+	runErr := s.call(j)
+	run.FinishedAt = s.now()
+	if runErr != nil {
+		run.Error = runErr.Error()
+	}
+
+	j.mu.Lock()
+	j.running = false
+	j.mu.Unlock()
+
+	ctx, cancel = context.WithTimeout(context.Background(), bookkeepingTimeout)
+	defer cancel()
+
+	if err := s.db.InsertJobRun(ctx, run); err != nil {
+		log.Printf("job %s: cannot record run: %v", j.name, err)
+	}
+	if err := s.db.ReleaseJob(ctx, j.name, s.owner, s.now()); err != nil && !errors.Is(err, repository.ErrNotFound) {
+		log.Printf("job %s: cannot release lock: %v", j.name, err)
+	}
+
+	return true, runErr
+}
+
+// call runs the function of j with its timeout and turns a panic into an error
+func (s *Scheduler) call(j *job) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), j.timeout)
+	defer cancel()
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return j.run(ctx)
+}
+
+// Jobs returns the status of every job, sorted by name
+func (s *Scheduler) Jobs() []Status {
+	s.mu.Lock()
+	jobs := s.jobs
+	s.mu.Unlock()
+
+	now := s.now()
+	statuses := make([]Status, 0, len(jobs))
+	for _, j := range jobs {
+		j.mu.Lock()
+		st := Status{
+			Name:    j.name,
+			Spec:    j.spec,
+			Timeout: j.timeout,
+			Next:    j.next,
+			Running: j.running,
+		}
+		j.mu.Unlock()
+
+		if st.Next.IsZero() || st.Next.Before(now) {
+			st.Next = j.schedule.Next(now)
+		}
+		statuses = append(statuses, st)
+	}
+
+	sort.Slice(statuses, func(a, b int) bool { return statuses[a].Name < statuses[b].Name })
+
+	return statuses
+}
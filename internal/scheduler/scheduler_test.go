@@ -0,0 +1,213 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/adewidyatamadb/GoBookings/internal/models"
+	"github.com/adewidyatamadb/GoBookings/internal/repository"
+)
+
+// jobsRepo keeps job locks and runs in memory, the rest of the repository is not implemented
+type jobsRepo struct {
+	repository.DatabaseRepo
+
+	mu    sync.Mutex
+	locks map[string]models.JobRun
+	runs  []models.JobRun
+}
+
+func newJobsRepo() *jobsRepo {
+	return &jobsRepo{locks: make(map[string]models.JobRun)}
+}
+
+// ClaimJob keeps the lock as a run, with the time it is locked until as FinishedAt
+func (r *jobsRepo) ClaimJob(ctx context.Context, name, owner string, scheduledFor, lockedUntil, now time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if lock, ok := r.locks[name]; ok && (!lock.ScheduledFor.Before(scheduledFor) || lock.FinishedAt.After(now)) {
+		return false, nil
+	}
+	r.locks[name] = models.JobRun{Name: name, Owner: owner, ScheduledFor: scheduledFor, FinishedAt: lockedUntil}
+	return true, nil
+}
+
+func (r *jobsRepo) ReleaseJob(ctx context.Context, name, owner string, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	lock, ok := r.locks[name]
+	if !ok || lock.Owner != owner {
+		return repository.ErrNotFound
+	}
+	lock.FinishedAt = now
+	r.locks[name] = lock
+	return nil
+}
+
+func (r *jobsRepo) InsertJobRun(ctx context.Context, run models.JobRun) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	run.ID = len(r.runs) + 1
+	r.runs = append(r.runs, run)
+	return nil
+}
+
+func (r *jobsRepo) JobRuns(ctx context.Context, name string, limit int) ([]models.JobRun, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var runs []models.JobRun
+	for i := len(r.runs) - 1; i >= 0 && len(runs) < limit; i-- {
+		if r.runs[i].Name == name {
+			runs = append(runs, r.runs[i])
+		}
+	}
+	return runs, nil
+}
+
+func TestScheduler_Add(t *testing.T) {
+	s := New(newJobsRepo(), "test")
+	noop := func(ctx context.Context) error { return nil }
+
+	if err := s.Add("job", "* * * * *", time.Minute, noop); err != nil {
+		t.Errorf("expected to add a job but got %v", err)
+	}
+	if err := s.Add("job", "@hourly", time.Minute, noop); err == nil {
+		t.Error("expected an error for a duplicate job name")
+	}
+	if err := s.Add("invalid", "every minute", time.Minute, noop); err == nil {
+		t.Error("expected an error for an invalid schedule")
+	}
+	if err := s.Add("no timeout", "@hourly", 0, noop); err == nil {
+		t.Error("expected an error for a job without a timeout")
+	}
+
+	jobs := s.Jobs()
+	if len(jobs) != 1 || jobs[0].Name != "job" || jobs[0].Next.IsZero() {
+		t.Errorf("expected the job to be listed with its next run but got %+v", jobs)
+	}
+}
+
+func TestScheduler_runOnce(t *testing.T) {
+	db := newJobsRepo()
+	first := New(db, "first")
+	second := New(db, "second")
+
+	var calls int32
+	run := func(ctx context.Context) error {
+		atomic.AddInt32(&calls, 1)
+		return errors.New("mail server down")
+	}
+	for _, s := range []*Scheduler{first, second} {
+		if err := s.Add("job", "* * * * *", time.Minute, run); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	scheduledFor := time.Now().Truncate(time.Minute)
+
+	ran, err := first.runOnce(first.jobs[0], scheduledFor)
+	if !ran || err == nil || err.Error() != "mail server down" {
+		t.Errorf("expected the first instance to run the job and fail but got %t, %v", ran, err)
+	}
+
+	ran, err = second.runOnce(second.jobs[0], scheduledFor)
+	if ran || err != nil {
+		t.Errorf("expected the second instance to skip the claimed run but got %t, %v", ran, err)
+	}
+
+	ran, _ = second.runOnce(second.jobs[0], scheduledFor.Add(time.Minute))
+	if !ran {
+		t.Error("expected the second instance to run the next scheduled time")
+	}
+
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("expected the job to run twice but it ran %d times", n)
+	}
+
+	runs, err := db.JobRuns(context.Background(), "job", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 || runs[0].Owner != "second" || runs[1].Owner != "first" || runs[1].Error != "mail server down" {
+		t.Errorf("expected both runs in the history but got %+v", runs)
+	}
+}
+
+func TestScheduler_runOncePanic(t *testing.T) {
+	db := newJobsRepo()
+	s := New(db, "")
+
+	err := s.Add("panics", "@hourly", time.Minute, func(ctx context.Context) error {
+		panic("boom")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ran, err := s.runOnce(s.jobs[0], time.Now().Truncate(time.Hour))
+	if !ran || err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("expected the panic to be turned into an error but got %t, %v", ran, err)
+	}
+
+	runs, _ := db.JobRuns(context.Background(), "panics", 10)
+	if len(runs) != 1 || runs[0].Owner != s.Owner() || !runs[0].Failed() {
+		t.Errorf("expected a failed run in the history but got %+v", runs)
+	}
+}
+
+func TestScheduler_Start(t *testing.T) {
+	db := newJobsRepo()
+	s := New(db, "test")
+
+	ran := make(chan struct{}, 1)
+	err := s.Add("every second", "@every 1s", time.Minute, func(ctx context.Context) error {
+		select {
+		case ran <- struct{}{}:
+		default:
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stop := s.Start()
+	defer stop()
+
+	select {
+	case <-ran:
+	case <-time.After(3 * time.Second):
+		t.Error("expected the job to run within its interval")
+	}
+
+	if err := s.Add("late", "@hourly", time.Minute, nil); err == nil {
+		t.Error("expected an error adding a job to a started scheduler")
+	}
+}
+
+func TestScheduler_SetLocation(t *testing.T) {
+	s := New(newJobsRepo(), "test")
+	tokyo := time.FixedZone("Tokyo", 9*60*60)
+
+	if err := s.SetLocation(tokyo); err != nil {
+		t.Fatalf("expected to set the location but got %v", err)
+	}
+	if loc := s.now().Location(); loc != tokyo {
+		t.Errorf("expected the schedules to follow Tokyo but got %v", loc)
+	}
+
+	stop := s.Start()
+	stop()
+	if err := s.SetLocation(time.UTC); err == nil {
+		t.Error("expected an error for a started scheduler")
+	}
+}
@@ -0,0 +1,96 @@
+// Package sessionstore keeps scs sessions in the database through the repository,
+// so sessions survive restarts and can be shared by several instances
+package sessionstore
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/adewidyatamadb/GoBookings/internal/models"
+	"github.com/adewidyatamadb/GoBookings/internal/repository"
+	"github.com/alexedwards/scs/v2"
+)
+
+// maxUserAgent is the longest user agent kept with a session
+const maxUserAgent = 255
+
+// Store implements scs.Store on top of a DatabaseRepo
+type Store struct {
+	db    repository.DatabaseRepo
+	codec scs.Codec
+}
+
+// New creates a store keeping sessions in db, codec has to match the codec of the session manager
+func New(db repository.DatabaseRepo, codec scs.Codec) *Store {
+	return &Store{
+		db:    db,
+		codec: codec,
+	}
+}
+
+// Find returns the data of an unexpired session
+func (s *Store) Find(token string) ([]byte, bool, error) {
+	session, err := s.db.FindSession(context.Background(), token)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	return session.Data, true, nil
+}
+
+// Commit stores the data of a session, together with the user, IP address and user agent
+// kept in the session values so staff sessions can be listed and revoked
+func (s *Store) Commit(token string, b []byte, expiry time.Time) error {
+	session := models.Session{
+		Token:  token,
+		Data:   b,
+		Expiry: expiry,
+	}
+
+	_, values, err := s.codec.Decode(b)
+	if err != nil {
+		return err
+	}
+	session.UserID, _ = values["user_id"].(int)
+	session.IP, _ = values["ip"].(string)
+	session.UserAgent, _ = values["user_agent"].(string)
+	if len(session.UserAgent) > maxUserAgent {
+		session.UserAgent = session.UserAgent[:maxUserAgent]
+	}
+
+	return s.db.CommitSession(context.Background(), session)
+}
+
+// Delete deletes a session
+func (s *Store) Delete(token string) error {
+	return s.db.DeleteSessionToken(context.Background(), token)
+}
+
+// StartCleanup deletes expired sessions every interval until the returned function is called
+func (s *Store) StartCleanup(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				n, err := s.db.DeleteExpiredSessions(context.Background())
+				if err != nil {
+					log.Println("cannot delete expired sessions:", err)
+				} else if n > 0 {
+					log.Printf("Deleted %d expired sessions", n)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
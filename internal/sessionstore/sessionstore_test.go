@@ -0,0 +1,93 @@
+package sessionstore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/adewidyatamadb/GoBookings/internal/repository"
+	"github.com/adewidyatamadb/GoBookings/internal/repository/dbrepo"
+	"github.com/alexedwards/scs/v2"
+)
+
+func TestStore(t *testing.T) {
+	db := dbrepo.NewMemoryRepo(nil)
+	store := New(db, scs.GobCodec{})
+
+	if _, found, err := store.Find("token"); found || err != nil {
+		t.Errorf("expected a missing session not to be found but got %t, %v", found, err)
+	}
+
+	b, err := scs.GobCodec{}.Encode(time.Now().Add(time.Hour), map[string]interface{}{
+		"user_id":    1,
+		"ip":         "192.0.2.1",
+		"user_agent": "Firefox",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.Commit("token", b, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found, ok, err := store.Find("token")
+	if err != nil || !ok || string(found) != string(b) {
+		t.Errorf("expected to find the committed session but got %t, %v", ok, err)
+	}
+
+	sessions, err := db.UserSessions(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || sessions[0].IP != "192.0.2.1" || sessions[0].UserAgent != "Firefox" {
+		t.Errorf("expected the session to be listed with its user, IP address and user agent but got %+v", sessions)
+	}
+
+	err = store.Delete("token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := store.Find("token"); ok {
+		t.Error("expected a deleted session not to be found")
+	}
+}
+
+// cleanupRepo signals every time expired sessions are deleted
+type cleanupRepo struct {
+	repository.DatabaseRepo
+	deleted chan int
+}
+
+func (c cleanupRepo) DeleteExpiredSessions(ctx context.Context) (int, error) {
+	n, err := c.DatabaseRepo.DeleteExpiredSessions(ctx)
+	c.deleted <- n
+	return n, err
+}
+
+func TestStore_Cleanup(t *testing.T) {
+	db := cleanupRepo{DatabaseRepo: dbrepo.NewMemoryRepo(nil), deleted: make(chan int, 10)}
+	store := New(db, scs.GobCodec{})
+
+	b, err := scs.GobCodec{}.Encode(time.Now(), map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Commit("expired", b, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stop := store.StartCleanup(10 * time.Millisecond)
+	defer stop()
+
+	select {
+	case n := <-db.deleted:
+		if n != 1 {
+			t.Errorf("expected the cleanup to delete the expired session but it deleted %d", n)
+		}
+	case <-time.After(time.Second):
+		t.Error("expected the cleanup to run")
+	}
+}
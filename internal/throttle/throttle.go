@@ -0,0 +1,132 @@
+// Package throttle slows down repeated failures, e.g. login attempts, per key
+package throttle
+
+import (
+	"sync"
+	"time"
+)
+
+// sweepThreshold is the number of tracked keys above which idle keys are dropped
+const sweepThreshold = 10000
+
+// Policy describes how failures of a key are throttled
+type Policy struct {
+	// FreeAttempts is the number of failures allowed before delays start
+	FreeAttempts int
+	// BaseDelay is the delay after the first failure past the free attempts, it doubles with every further failure
+	BaseDelay time.Duration
+	// MaxDelay caps the progressive delay
+	MaxDelay time.Duration
+	// MaxFailures is the number of failures that locks the key
+	MaxFailures int
+	// Lockout is how long a locked key has to wait
+	Lockout time.Duration
+	// Window is how long failures are remembered after the last one
+	Window time.Duration
+}
+
+type entry struct {
+	failures    int
+	lastFailure time.Time
+	next        time.Time
+}
+
+// Limiter tracks failures per key in memory, it is safe for concurrent use
+type Limiter struct {
+	policy Policy
+	now    func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*entry
+}
+
+// New creates a limiter applying p
+func New(p Policy) *Limiter {
+	return &Limiter{
+		policy:  p,
+		now:     time.Now,
+		entries: make(map[string]*entry),
+	}
+}
+
+// Wait returns how long key has to wait before its next attempt, zero when it may try now
+func (l *Limiter) Wait(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e, ok := l.entries[key]
+	if !ok {
+		return 0
+	}
+
+	wait := e.next.Sub(l.now())
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// Fail records a failure of key and returns its number of consecutive failures,
+// the count starts over once the key has been locked
+func (l *Limiter) Fail(key string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	e, ok := l.entries[key]
+	if !ok || l.expired(e, now) {
+		if len(l.entries) >= sweepThreshold {
+			l.sweep(now)
+		}
+		e = &entry{}
+		l.entries[key] = e
+	}
+
+	e.failures++
+	e.lastFailure = now
+	failures := e.failures
+
+	switch {
+	case l.policy.MaxFailures > 0 && e.failures >= l.policy.MaxFailures:
+		e.next = now.Add(l.policy.Lockout)
+		e.failures = 0
+	case e.failures > l.policy.FreeAttempts:
+		e.next = now.Add(l.delay(e.failures - l.policy.FreeAttempts))
+	}
+
+	return failures
+}
+
+// Reset forgets the failures of key
+func (l *Limiter) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.entries, key)
+}
+
+// delay returns the progressive delay after n failures past the free attempts
+func (l *Limiter) delay(n int) time.Duration {
+	d := l.policy.BaseDelay
+	for i := 1; i < n && d < l.policy.MaxDelay; i++ {
+		d *= 2
+	}
+	if l.policy.MaxDelay > 0 && d > l.policy.MaxDelay {
+		d = l.policy.MaxDelay
+	}
+	return d
+}
+
+// expired reports whether e can be forgotten, the caller holds the lock
+func (l *Limiter) expired(e *entry, now time.Time) bool {
+	return now.After(e.next) && now.Sub(e.lastFailure) > l.policy.Window
+}
+
+// sweep drops the keys that can be forgotten, the caller holds the lock
+func (l *Limiter) sweep(now time.Time) {
+	for key, e := range l.entries {
+		if l.expired(e, now) {
+			delete(l.entries, key)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package throttle
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	l := New(Policy{
+		FreeAttempts: 2,
+		BaseDelay:    time.Second,
+		MaxDelay:     4 * time.Second,
+		MaxFailures:  6,
+		Lockout:      15 * time.Minute,
+		Window:       time.Hour,
+	})
+	l.now = func() time.Time { return now }
+
+	var tableTest = []struct {
+		name         string
+		expectedWait time.Duration
+	}{
+		{"first failure", 0},
+		{"last free attempt", 0},
+		{"first delay", time.Second},
+		{"doubled delay", 2 * time.Second},
+		{"capped delay", 4 * time.Second},
+		{"locked", 15 * time.Minute},
+	}
+
+	for i, test := range tableTest {
+		if n := l.Fail("me@here.com"); n != i+1 {
+			t.Errorf("case - %s: expected %d failures but got %d", test.name, i+1, n)
+		}
+		if wait := l.Wait("me@here.com"); wait != test.expectedWait {
+			t.Errorf("case - %s: expected wait %s but got %s", test.name, test.expectedWait, wait)
+		}
+	}
+
+	if wait := l.Wait("other@here.com"); wait != 0 {
+		t.Errorf("expected other keys not to wait but got %s", wait)
+	}
+
+	now = now.Add(16 * time.Minute)
+	if wait := l.Wait("me@here.com"); wait != 0 {
+		t.Errorf("expected the lockout to end but got wait %s", wait)
+	}
+	if n := l.Fail("me@here.com"); n != 1 {
+		t.Errorf("expected the failures to start over after a lockout but got %d", n)
+	}
+
+	l.Reset("me@here.com")
+	l.Fail("me@here.com")
+	l.Fail("me@here.com")
+	if wait := l.Wait("me@here.com"); wait != 0 {
+		t.Errorf("expected reset to forget failures but got wait %s", wait)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if n := l.Fail("me@here.com"); n != 1 {
+		t.Errorf("expected failures to be forgotten after the window but got %d", n)
+	}
+}
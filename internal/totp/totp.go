@@ -0,0 +1,104 @@
+// Package totp implements RFC 6238 time-based one-time passwords as used by authenticator apps
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Parameters understood by every authenticator app
+const (
+	Digits = 6
+	Period = 30 * time.Second
+	// Skew is the number of periods before and after the current one that are accepted
+	Skew = 1
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns a random base32 encoded secret
+func GenerateSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return encoding.EncodeToString(b), nil
+}
+
+// Code returns the code of secret at time t
+func Code(secret string, t time.Time) (string, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", fmt.Errorf("invalid totp secret: %w", err)
+	}
+	return code(key, uint64(t.Unix()/int64(Period/time.Second))), nil
+}
+
+// code returns the HOTP value of key for counter, see RFC 4226
+func code(key []byte, counter uint64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", Digits, value%1000000)
+}
+
+// Validate reports whether passcode is the code of secret at time t, allowing for clock skew
+func Validate(secret, passcode string, t time.Time) bool {
+	_, ok := Match(secret, passcode, t)
+	return ok
+}
+
+// Match is Validate returning the counter of the period passcode belongs to as well. A code stays valid
+// for every period of the skew, callers store the counter of the last code they accepted and refuse
+// codes at or before it so a code cannot be used twice
+func Match(secret, passcode string, t time.Time) (int64, bool) {
+	passcode = strings.ReplaceAll(strings.TrimSpace(passcode), " ", "")
+	if len(passcode) != Digits {
+		return 0, false
+	}
+
+	key, err := encoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return 0, false
+	}
+
+	counter := t.Unix() / int64(Period/time.Second)
+	var matched int64
+	valid := false
+	for i := -Skew; i <= Skew; i++ {
+		if subtle.ConstantTimeCompare([]byte(code(key, uint64(counter+int64(i)))), []byte(passcode)) == 1 {
+			matched = counter + int64(i)
+			valid = true
+		}
+	}
+
+	return matched, valid
+}
+
+// ProvisioningURI returns the otpauth URI authenticator apps scan as a QR code
+func ProvisioningURI(secret, issuer, account string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(Digits))
+	v.Set("period", fmt.Sprint(int(Period/time.Second)))
+
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + v.Encode()
+}
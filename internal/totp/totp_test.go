@@ -0,0 +1,114 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 key of the RFC 6238 test vectors
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	// the RFC 6238 vectors use 8 digits, the last 6 of them are the 6 digit code
+	var tableTest = []struct {
+		unix     int64
+		expected string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, test := range tableTest {
+		code, err := Code(rfcSecret, time.Unix(test.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != test.expected {
+			t.Errorf("case - %d: expected code %s but got %s", test.unix, test.expected, code)
+		}
+	}
+
+	if _, err := Code("not base32!", time.Now()); err == nil {
+		t.Error("expected an error for an invalid secret")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+
+	var tableTest = []struct {
+		name     string
+		passcode string
+		at       time.Time
+		expected bool
+	}{
+		{"current code", "005924", now, true},
+		{"with spaces", " 005 924 ", now, true},
+		{"previous period", "005924", now.Add(Period), true},
+		{"too old", "005924", now.Add(2 * Period), false},
+		{"wrong code", "005925", now, false},
+		{"too short", "5924", now, false},
+	}
+
+	for _, test := range tableTest {
+		if valid := Validate(rfcSecret, test.passcode, test.at); valid != test.expected {
+			t.Errorf("case - %s: expected %t but got %t", test.name, test.expected, valid)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	counter := now.Unix() / int64(Period/time.Second)
+
+	var tableTest = []struct {
+		name     string
+		at       time.Time
+		expected int64
+	}{
+		{"current period", now, counter},
+		{"previous period", now.Add(Period), counter},
+		{"next period", now.Add(-Period), counter},
+	}
+
+	for _, test := range tableTest {
+		matched, ok := Match(rfcSecret, "005924", test.at)
+		if !ok {
+			t.Errorf("case - %s: expected the code to match", test.name)
+		}
+		if matched != test.expected {
+			t.Errorf("case - %s: expected counter %d but got %d", test.name, test.expected, matched)
+		}
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, err := Code(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Validate(secret, code, time.Now()) {
+		t.Error("expected the code of a generated secret to validate")
+	}
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri := ProvisioningURI("ABCDEF", "Fort Smythe", "me@here.com")
+
+	for _, expected := range []string{"otpauth://totp/Fort%20Smythe:me@here.com?", "secret=ABCDEF", "issuer=Fort+Smythe", "digits=6", "period=30"} {
+		if !strings.Contains(uri, expected) {
+			t.Errorf("expected %s in %s", expected, uri)
+		}
+	}
+}
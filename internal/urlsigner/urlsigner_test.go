@@ -0,0 +1,47 @@
+package urlsigner
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSigner(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	signer := New([]byte("secret"))
+
+	link, err := signer.Sign("http://localhost:8080/user/reset-password?id=5", now.Add(time.Hour), "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tableTest = []struct {
+		name     string
+		link     string
+		binding  string
+		now      time.Time
+		expected error
+	}{
+		{"valid", link, "hash", now, nil},
+		{"other host", strings.Replace(link, "localhost:8080", "bookings.example.com", 1), "hash", now, nil},
+		{"expired", link, "hash", now.Add(2 * time.Hour), ErrExpired},
+		{"changed binding", link, "new hash", now, ErrInvalidSignature},
+		{"changed id", strings.Replace(link, "id=5", "id=6", 1), "hash", now, ErrInvalidSignature},
+		{"changed expiry", strings.Replace(link, "expires=", "expires=9", 1), "hash", now, ErrInvalidSignature},
+		{"missing signature", strings.Split(link, "&signature=")[0], "hash", now, ErrInvalidSignature},
+		{"other secret", link, "hash", now, ErrInvalidSignature},
+	}
+
+	for _, test := range tableTest {
+		s := signer
+		if test.name == "other secret" {
+			s = New([]byte("other secret"))
+		}
+
+		err := s.Verify(test.link, test.binding, test.now)
+		if !errors.Is(err, test.expected) {
+			t.Errorf("case - %s: expected %v but got %v", test.name, test.expected, err)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/adewidyatamadb/GoBookings/internal/models"
+	"github.com/adewidyatamadb/GoBookings/internal/repository"
+)
+
+// retryDelays are the waits after each failed attempt, a delivery fails for good after the last one
+var retryDelays = []time.Duration{
+	time.Minute,
+	5 * time.Minute,
+	30 * time.Minute,
+	2 * time.Hour,
+	12 * time.Hour,
+}
+
+// batchSize is how many deliveries one call to DeliverDue sends at most
+const batchSize = 50
+
+// requestTimeout bounds a single request to a webhook
+const requestTimeout = 10 * time.Second
+
+// maxErrorLength is how much of a failed response is kept in the delivery log
+const maxErrorLength = 500
+
+// Sender delivers the queued webhook deliveries
+type Sender struct {
+	db     repository.DatabaseRepo
+	client *http.Client
+	now    func() time.Time
+}
+
+// NewSender returns a sender that delivers the deliveries queued in db with client, nil uses a client with a
+// timeout of 10 seconds that does not follow redirects
+func NewSender(db repository.DatabaseRepo, client *http.Client) *Sender {
+	if client == nil {
+		client = &http.Client{
+			Timeout: requestTimeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+	}
+
+	return &Sender{
+		db:     db,
+		client: client,
+		now:    time.Now,
+	}
+}
+
+// DeliverDue sends the deliveries that are due and records every attempt, it returns how many were accepted.
+// Deliveries that are not accepted are retried later until they run out of attempts
+func (s *Sender) DeliverDue(ctx context.Context) (int, error) {
+	deliveries, err := s.db.DueWebhookDeliveries(ctx, s.now(), batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	delivered := 0
+	for _, d := range deliveries {
+		if err := ctx.Err(); err != nil {
+			return delivered, err
+		}
+
+		d = s.attempt(ctx, d)
+		if d.Status == models.DeliveryDelivered {
+			delivered++
+		}
+
+		err := s.db.UpdateWebhookDelivery(ctx, d)
+		if err != nil {
+			return delivered, err
+		}
+	}
+
+	return delivered, nil
+}
+
+// attempt sends d once and returns it with the outcome and, when it is to be retried, the next attempt
+func (s *Sender) attempt(ctx context.Context, d models.WebhookDelivery) models.WebhookDelivery {
+	d.Attempts++
+	d.ResponseCode = 0
+	d.Error = ""
+
+	code, err := s.send(ctx, d)
+	d.ResponseCode = code
+	now := s.now()
+
+	switch {
+	case err == nil:
+		d.Status = models.DeliveryDelivered
+		d.DeliveredAt = now
+		return d
+	case d.Attempts > len(retryDelays):
+		d.Status = models.DeliveryFailed
+	default:
+		d.NextAttemptAt = now.Add(retryDelays[d.Attempts-1])
+	}
+	d.Error = err.Error()
+
+	return d
+}
+
+// send posts the payload of d to its webhook and returns the response code, any response other than 2xx is an error
+func (s *Sender) send(ctx context.Context, d models.WebhookDelivery) (int, error) {
+	body := []byte(d.Payload)
+	timestamp := s.now().Unix()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.Webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "GoBookings-Webhooks/1.0")
+	req.Header.Set(EventHeader, d.Event)
+	req.Header.Set(DeliveryHeader, strconv.Itoa(d.ID))
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, Sign(d.Webhook.Secret, timestamp, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorLength))
+		return resp.StatusCode, fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	return resp.StatusCode, nil
+}
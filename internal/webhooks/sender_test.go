@@ -0,0 +1,131 @@
+package webhooks
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adewidyatamadb/GoBookings/internal/dates"
+	"github.com/adewidyatamadb/GoBookings/internal/models"
+	"github.com/adewidyatamadb/GoBookings/internal/repository/dbrepo"
+)
+
+// receiver is a local webhook endpoint that checks signatures at the time of clock and answers with status
+type receiver struct {
+	mu       sync.Mutex
+	clock    func() time.Time
+	status   int
+	received []http.Header
+	invalid  int
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if err := Verify("secret", r.Header, body, rc.clock(), 5*time.Minute); err != nil {
+		rc.invalid++
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	rc.received = append(rc.received, r.Header)
+	w.WriteHeader(rc.status)
+}
+
+func TestSender_DeliverDue(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	rc := &receiver{clock: func() time.Time { return now }, status: http.StatusNoContent}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	db := dbrepo.NewMemoryRepo(nil)
+	id, err := db.InsertWebhook(ctx, models.Webhook{URL: srv.URL, Secret: "secret", Events: models.WebhookEvents, Active: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sender := NewSender(db, srv.Client())
+	sender.now = func() time.Time { return now }
+
+	_, err = Enqueue(ctx, db, models.EventReservationCreated, BlockData(1, dates.Of(now)), 0, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := sender.DeliverDue(ctx)
+	if err != nil || n != 1 {
+		t.Fatalf("expected 1 delivery but got %d, %v", n, err)
+	}
+	if len(rc.received) != 1 || rc.received[0].Get(EventHeader) != models.EventReservationCreated || rc.received[0].Get(DeliveryHeader) == "" {
+		t.Errorf("expected the receiver to get the signed event but got %+v", rc.received)
+	}
+
+	log, _ := db.WebhookDeliveries(ctx, id, 10)
+	if len(log) != 1 || log[0].Status != models.DeliveryDelivered || log[0].ResponseCode != http.StatusNoContent || log[0].Attempts != 1 {
+		t.Errorf("expected the delivery to be logged as delivered but got %+v", log)
+	}
+
+	// the receiver fails until the delivery runs out of attempts
+	rc.status = http.StatusInternalServerError
+	_, err = Enqueue(ctx, db, models.EventReservationCancelled, BlockData(1, dates.Of(now)), 0, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for attempt := 1; attempt <= len(retryDelays)+1; attempt++ {
+		n, err := sender.DeliverDue(ctx)
+		if err != nil || n != 0 {
+			t.Fatalf("attempt %d: expected no delivery but got %d, %v", attempt, n, err)
+		}
+
+		log, _ := db.WebhookDeliveries(ctx, id, 1)
+		d := log[0]
+		if d.Attempts != attempt || d.ResponseCode != http.StatusInternalServerError || d.Error == "" {
+			t.Errorf("attempt %d: expected the failure to be logged but got %+v", attempt, d)
+		}
+
+		if attempt <= len(retryDelays) {
+			if d.Status != models.DeliveryPending || !d.NextAttemptAt.Equal(now.Add(retryDelays[attempt-1])) {
+				t.Errorf("attempt %d: expected a retry after %s but got %+v", attempt, retryDelays[attempt-1], d)
+			}
+			if n, _ := sender.DeliverDue(ctx); n != 0 || len(rc.received) != attempt+1 {
+				t.Errorf("attempt %d: expected no retry before the delay", attempt)
+			}
+			now = d.NextAttemptAt
+		} else if d.Status != models.DeliveryFailed {
+			t.Errorf("expected the delivery to fail after %d attempts but got %+v", attempt, d)
+		}
+	}
+
+	if rc.invalid != 0 {
+		t.Errorf("expected every request to be signed but %d were not", rc.invalid)
+	}
+}
+
+func TestSender_DeliverDueUnreachable(t *testing.T) {
+	ctx := context.Background()
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+
+	db := dbrepo.NewMemoryRepo(nil)
+	id, _ := db.InsertWebhook(ctx, models.Webhook{URL: url, Secret: "secret", Events: models.WebhookEvents, Active: true})
+	_, _ = Enqueue(ctx, db, models.EventPing, struct{}{}, id, time.Now())
+
+	n, err := NewSender(db, nil).DeliverDue(ctx)
+	if err != nil || n != 0 {
+		t.Fatalf("expected no delivery but got %d, %v", n, err)
+	}
+
+	log, _ := db.WebhookDeliveries(ctx, id, 1)
+	if len(log) != 1 || log[0].Status != models.DeliveryPending || log[0].ResponseCode != 0 || log[0].Error == "" {
+		t.Errorf("expected the connection error to be logged for a retry but got %+v", log)
+	}
+}
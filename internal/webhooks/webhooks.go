@@ -0,0 +1,190 @@
+// Package webhooks queues events for the webhooks that subscribe to them and delivers them as signed JSON.
+//
+// Every request carries the event in the X-Webhook-Event header, the delivery id in X-Webhook-Delivery, the
+// Unix time it was sent in X-Webhook-Timestamp and in X-Webhook-Signature "sha256=" followed by the hex HMAC-SHA256
+// of the timestamp, a dot and the body, keyed with the secret of the webhook. Receivers should check the
+// signature with Verify and ignore deliveries they have seen, since a delivery is retried until a 2xx response.
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/adewidyatamadb/GoBookings/internal/dates"
+	"github.com/adewidyatamadb/GoBookings/internal/events"
+	"github.com/adewidyatamadb/GoBookings/internal/models"
+	"github.com/adewidyatamadb/GoBookings/internal/repository"
+)
+
+// Headers of webhook requests
+const (
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+	TimestampHeader = "X-Webhook-Timestamp"
+	SignatureHeader = "X-Webhook-Signature"
+)
+
+// Envelope is the JSON body of every delivery
+type Envelope struct {
+	Event      string          `json:"event"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// Reservation is the data of reservation events
+type Reservation struct {
+	ID        int    `json:"id"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Email     string `json:"email"`
+	Phone     string `json:"phone"`
+	StartDate string `json:"start_date"`
+	EndDate   string `json:"end_date"`
+	RoomID    int    `json:"room_id"`
+	RoomName  string `json:"room_name,omitempty"`
+	Processed bool   `json:"processed"`
+}
+
+// Block is the data of block events
+type Block struct {
+	RoomID int    `json:"room_id"`
+	Date   string `json:"date"`
+}
+
+// ReservationData returns the data of a reservation event
+func ReservationData(res models.Reservation) Reservation {
+	return Reservation{
+		ID:        res.ID,
+		FirstName: res.FirstName,
+		LastName:  res.LastName,
+		Email:     res.Email,
+		Phone:     res.Phone,
+		StartDate: res.StartDate.String(),
+		EndDate:   res.EndDate.String(),
+		RoomID:    res.RoomID,
+		RoomName:  res.Room.RoomName,
+		Processed: res.Processed == 1,
+	}
+}
+
+// BlockData returns the data of a block event, dates are sent as ISO 8601 dates
+func BlockData(roomID int, date dates.Date) Block {
+	return Block{RoomID: roomID, Date: date.String()}
+}
+
+// NewSecret returns a random signing secret for a new webhook
+func NewSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// Sign returns the signature header value of body sent at timestamp
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// ErrInvalidSignature is returned by Verify for requests that were not signed with the secret or are too old
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// Verify checks the signature of a webhook request with the given body, requests sent more than tolerance
+// away from now are rejected so that captured requests cannot be replayed later
+func Verify(secret string, header http.Header, body []byte, now time.Time, tolerance time.Duration) error {
+	timestamp, err := strconv.ParseInt(header.Get(TimestampHeader), 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	sent := time.Unix(timestamp, 0)
+	if sent.Before(now.Add(-tolerance)) || sent.After(now.Add(tolerance)) {
+		return ErrInvalidSignature
+	}
+
+	if !hmac.Equal([]byte(header.Get(SignatureHeader)), []byte(Sign(secret, timestamp, body))) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// Enqueue queues event with data for every active webhook that subscribes to it, or for the webhook with id
+// only when id is not 0, and returns how many deliveries were queued
+func Enqueue(ctx context.Context, db repository.DatabaseRepo, event string, data interface{}, id int, now time.Time) (int, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return 0, err
+	}
+	payload, err := json.Marshal(Envelope{Event: event, OccurredAt: now.UTC(), Data: raw})
+	if err != nil {
+		return 0, err
+	}
+
+	hooks, err := db.AllWebhooks(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	queued := 0
+	for _, h := range hooks {
+		if (id != 0 && h.ID != id) || (id == 0 && !h.Active) || !h.Subscribed(event) {
+			continue
+		}
+
+		_, err := db.InsertWebhookDelivery(ctx, models.WebhookDelivery{
+			WebhookID:     h.ID,
+			Event:         event,
+			Payload:       string(payload),
+			Status:        models.DeliveryPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+		})
+		if err != nil {
+			return queued, err
+		}
+		queued++
+	}
+
+	return queued, nil
+}
+
+// Subscriber returns the event subscriber that queues the events webhooks can subscribe to
+func Subscriber(db repository.DatabaseRepo) events.Handler {
+	return func(ctx context.Context, e events.Event) error {
+		var data interface{}
+		switch e := e.(type) {
+		case events.ReservationCreated:
+			data = ReservationData(e.Reservation)
+		case events.ReservationUpdated:
+			data = ReservationData(e.Reservation)
+		case events.ReservationProcessed:
+			data = ReservationData(e.Reservation)
+		case events.ReservationCancelled:
+			data = ReservationData(e.Reservation)
+		case events.BlockAdded:
+			data = BlockData(e.RoomID, e.Date)
+		default:
+			return nil
+		}
+
+		at := e.Metadata().At
+		if at.IsZero() {
+			at = time.Now()
+		}
+		_, err := Enqueue(ctx, db, e.Name(), data, 0, at)
+		return err
+	}
+}
@@ -0,0 +1,143 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/adewidyatamadb/GoBookings/internal/dates"
+	"github.com/adewidyatamadb/GoBookings/internal/events"
+	"github.com/adewidyatamadb/GoBookings/internal/models"
+	"github.com/adewidyatamadb/GoBookings/internal/repository/dbrepo"
+)
+
+func TestVerify(t *testing.T) {
+	now := time.Date(2021, 10, 19, 14, 0, 0, 0, time.UTC)
+	body := []byte(`{"event":"ping"}`)
+
+	signed := func(secret string, sent time.Time, body []byte) http.Header {
+		h := http.Header{}
+		h.Set(TimestampHeader, strconv.FormatInt(sent.Unix(), 10))
+		h.Set(SignatureHeader, Sign(secret, sent.Unix(), body))
+		return h
+	}
+
+	var tableTest = []struct {
+		name          string
+		header        http.Header
+		body          []byte
+		expectedError bool
+	}{
+		{"valid", signed("secret", now, body), body, false},
+		{"recent", signed("secret", now.Add(-4*time.Minute), body), body, false},
+		{"other secret", signed("other", now, body), body, true},
+		{"changed body", signed("secret", now, body), []byte(`{"event":"reservation.cancelled"}`), true},
+		{"too old", signed("secret", now.Add(-10*time.Minute), body), body, true},
+		{"no headers", http.Header{}, body, true},
+	}
+
+	for _, test := range tableTest {
+		err := Verify("secret", test.header, test.body, now, 5*time.Minute)
+		if (err != nil) != test.expectedError {
+			t.Errorf("case - %s: expected error %t but got %v", test.name, test.expectedError, err)
+		}
+	}
+}
+
+func TestEnqueue(t *testing.T) {
+	ctx := context.Background()
+	db := dbrepo.NewMemoryRepo(nil)
+	now := time.Date(2021, 10, 19, 14, 0, 0, 0, time.UTC)
+
+	all, _ := db.InsertWebhook(ctx, models.Webhook{URL: "https://a.example.com", Secret: "a", Events: models.WebhookEvents, Active: true})
+	cancellations, _ := db.InsertWebhook(ctx, models.Webhook{URL: "https://b.example.com", Secret: "b", Events: []string{models.EventReservationCancelled}, Active: true})
+	inactive, _ := db.InsertWebhook(ctx, models.Webhook{URL: "https://c.example.com", Secret: "c", Events: models.WebhookEvents})
+
+	var tableTest = []struct {
+		name     string
+		event    string
+		id       int
+		expected []int
+	}{
+		{"created", models.EventReservationCreated, 0, []int{all}},
+		{"cancelled", models.EventReservationCancelled, 0, []int{all, cancellations}},
+		{"ping to an inactive webhook", models.EventPing, inactive, []int{inactive}},
+		{"ping to one webhook", models.EventPing, cancellations, []int{cancellations}},
+	}
+
+	for _, test := range tableTest {
+		before := make(map[int]int)
+		for _, id := range []int{all, cancellations, inactive} {
+			log, _ := db.WebhookDeliveries(ctx, id, 100)
+			before[id] = len(log)
+		}
+
+		day := dates.Of(now)
+		res := models.Reservation{ID: 7, FirstName: "John", StartDate: day, EndDate: day.AddDays(2), RoomID: 1}
+		n, err := Enqueue(ctx, db, test.event, ReservationData(res), test.id, now)
+		if err != nil {
+			t.Errorf("case - %s: %v", test.name, err)
+			continue
+		}
+		if n != len(test.expected) {
+			t.Errorf("case - %s: expected %d deliveries but got %d", test.name, len(test.expected), n)
+		}
+
+		for _, id := range test.expected {
+			log, _ := db.WebhookDeliveries(ctx, id, 100)
+			if len(log) != before[id]+1 {
+				t.Errorf("case - %s: expected a delivery to webhook %d", test.name, id)
+				continue
+			}
+
+			var envelope struct {
+				Event string      `json:"event"`
+				Data  Reservation `json:"data"`
+			}
+			err := json.Unmarshal([]byte(log[0].Payload), &envelope)
+			if err != nil {
+				t.Errorf("case - %s: %v", test.name, err)
+				continue
+			}
+			if envelope.Event != test.event || envelope.Data.ID != 7 || envelope.Data.StartDate != "2021-10-19" || envelope.Data.EndDate != "2021-10-21" {
+				t.Errorf("case - %s: unexpected payload %s", test.name, log[0].Payload)
+			}
+		}
+	}
+}
+
+func TestSubscriber(t *testing.T) {
+	ctx := context.Background()
+	db := dbrepo.NewMemoryRepo(nil)
+	now := time.Date(2021, 10, 19, 14, 0, 0, 0, time.UTC)
+
+	id, _ := db.InsertWebhook(ctx, models.Webhook{URL: "https://a.example.com", Secret: "a", Events: models.WebhookEvents, Active: true})
+	handle := Subscriber(db)
+
+	day := dates.Of(now)
+	res := models.Reservation{ID: 7, FirstName: "John", StartDate: day, EndDate: day.AddDays(2), RoomID: 1}
+	published := []events.Event{
+		events.ReservationHeld{Meta: events.Meta{At: now}, Reservation: res},
+		events.ReservationCancelled{Meta: events.Meta{At: now, UserID: 1}, Reservation: res},
+		events.BlockAdded{Meta: events.Meta{At: now}, RoomID: 2, Date: day},
+	}
+	for _, e := range published {
+		if err := handle(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	log, _ := db.WebhookDeliveries(ctx, id, 100)
+	if len(log) != 2 {
+		t.Fatalf("expected the cancellation and the block to be queued but got %+v", log)
+	}
+	if log[0].Event != models.EventBlockCreated || log[1].Event != models.EventReservationCancelled {
+		t.Errorf("expected the block and the cancellation but got %s and %s", log[0].Event, log[1].Event)
+	}
+	if !log[1].CreatedAt.Equal(now) {
+		t.Errorf("expected the delivery to be queued when the event happened but got %v", log[1].CreatedAt)
+	}
+}
@@ -0,0 +1,3 @@
+update reservations set guest_id = null where guest_id in (select id from guests where password = '');
+
+delete from guests where password = '';
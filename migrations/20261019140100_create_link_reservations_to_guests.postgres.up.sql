@@ -0,0 +1,12 @@
+update guests set phone_key = regexp_replace(phone, '[^0-9]', '', 'g');
+
+insert into guests (first_name, last_name, email, phone, phone_key, password, email_verified, created_at, updated_at)
+select distinct on (lower(trim(email)))
+  first_name, last_name, lower(trim(email)), phone, regexp_replace(phone, '[^0-9]', '', 'g'), '', false, now(), now()
+from reservations
+where guest_id is null and lower(trim(email)) not in (select email from guests)
+order by lower(trim(email)), start_date desc;
+
+update reservations r set guest_id = g.id
+from guests g
+where r.guest_id is null and g.email = lower(trim(r.email));
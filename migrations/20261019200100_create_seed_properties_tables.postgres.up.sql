@@ -0,0 +1,2 @@
+INSERT INTO public.properties (name,slug,host,time_zone,currency,mail_from,owner_email,description,created_at,updated_at) VALUES
+	 ('Fort Smythe Bed and Breakfast','fort-smythe','','','USD','fort@smythe.com','me@here.com','Your home away from home, set on the majestic waters of the Atlantic Ocean, this will be a vacation to remember.','2026-10-19 00:00:00.000','2026-10-19 00:00:00.000');
@@ -0,0 +1,3 @@
+update booking_rules r set property_id = rm.property_id
+from rooms rm
+where rm.id = r.room_id;